@@ -4,14 +4,11 @@ import (
 	"context"
 
 	"github.com/illidaris/aphrodite/pkg/exception"
-	restSender "github.com/illidaris/rest/sender"
-	"github.com/illidaris/rest/signature"
 )
 
 func POST[In IRequest, Out any](host string, opts ...Option) func(ctx context.Context, req In) (Out, exception.Exception) {
 	return func(ctx context.Context, req In) (Out, exception.Exception) {
-		r := NewPostAPI[In, Out](req)
-		err := invoke(ctx, r, host, opts...)
+		r, err := invoke(ctx, bind(NewPostAPI[In, Out], req), host, opts...)
 		if err != nil {
 			return r.Response.Data, exception.ERR_BUSI.Wrap(err)
 		}
@@ -21,19 +18,21 @@ func POST[In IRequest, Out any](host string, opts ...Option) func(ctx context.Co
 
 func FORM[In IRequest, Out any](host string, opts ...Option) func(ctx context.Context, req In) (Out, exception.Exception) {
 	return func(ctx context.Context, req In) (Out, exception.Exception) {
-		r := NewFormAPI[In, Out](req)
-		err := invoke(ctx, r, host, opts...)
+		var out Out
+		r, err := invoke(ctx, bind(NewFormAPI[In, Out], req), host, opts...)
+		if r.Response.Data != nil {
+			out = *r.Response.Data
+		}
 		if err != nil {
-			return r.Response.Data, exception.ERR_BUSI.Wrap(err)
+			return out, exception.ERR_BUSI.Wrap(err)
 		}
-		return r.Response.Data, r.Response.ToException()
+		return out, r.Response.ToException()
 	}
 }
 
 func PUT[In IRequest, Out any](host string, opts ...Option) func(ctx context.Context, req In) (Out, exception.Exception) {
 	return func(ctx context.Context, req In) (Out, exception.Exception) {
-		r := NewPutAPI[In, Out](req)
-		err := invoke(ctx, r, host, opts...)
+		r, err := invoke(ctx, bind(NewPutAPI[In, Out], req), host, opts...)
 		if err != nil {
 			return r.Response.Data, exception.ERR_BUSI.Wrap(err)
 		}
@@ -43,8 +42,7 @@ func PUT[In IRequest, Out any](host string, opts ...Option) func(ctx context.Con
 
 func GET[In IRequest, Out any](host string, opts ...Option) func(ctx context.Context, req In) (Out, exception.Exception) {
 	return func(ctx context.Context, req In) (Out, exception.Exception) {
-		r := NewGetAPI[In, Out](req)
-		err := invoke(ctx, r, host, opts...)
+		r, err := invoke(ctx, bind(NewGetAPI[In, Out], req), host, opts...)
 		if err != nil {
 			return r.Response.Data, exception.ERR_BUSI.Wrap(err)
 		}
@@ -54,8 +52,7 @@ func GET[In IRequest, Out any](host string, opts ...Option) func(ctx context.Con
 
 func DELETE[In IRequest, Out any](host string, opts ...Option) func(ctx context.Context, req In) (Out, exception.Exception) {
 	return func(ctx context.Context, req In) (Out, exception.Exception) {
-		r := NewDeleteAPI[In, Out](req)
-		err := invoke(ctx, r, host, opts...)
+		r, err := invoke(ctx, bind(NewDeleteAPI[In, Out], req), host, opts...)
 		if err != nil {
 			return r.Response.Data, exception.ERR_BUSI.Wrap(err)
 		}
@@ -63,34 +60,9 @@ func DELETE[In IRequest, Out any](host string, opts ...Option) func(ctx context.
 	}
 }
 
-func invoke(ctx context.Context, req restSender.IRequest, host string, opts ...Option) error {
-	o := newOptions(opts...)
-	rsOpts := []restSender.Option{
-		restSender.WithTimeout(o.Timeout),
-		restSender.WithHost(host),
-	}
-
-	if o.Secret != "" {
-		rsOpts = append(rsOpts, restSender.WithSignSetMode(signature.SignSetlInURL, o.Secret, signature.Generate))
-	}
-
-	if len(o.RsOptions) > 0 {
-		rsOpts = append(rsOpts, o.RsOptions...)
-	}
-	s := restSender.NewSender(rsOpts...)
-
-	if o.RequestFunc != nil {
-		o.RequestFunc(ctx, req)
-	}
-
-	resp, err := s.Invoke(ctx, req)
-
-	if o.ResponseFunc != nil {
-		o.ResponseFunc(ctx, resp, err)
-	}
-
-	if err != nil {
-		return err
+// bind 每次请求按req创建新的请求对象
+func bind[In IRequest, R any](f func(In) R, req In) func() R {
+	return func() R {
+		return f(req)
 	}
-	return nil
 }
@@ -53,14 +53,14 @@ func (r PostBaseAPI[Req, T]) Decode(bs []byte) error {
 	return err
 }
 
-func NewFormAPI[Req IRequest, T any](param Req) *PostBaseAPI[Req, T] {
-	return &PostBaseAPI[Req, T]{
+func NewFormAPI[Req IRequest, T any](param Req) *FormBaseAPI[Req, T] {
+	return &FormBaseAPI[Req, T]{
 		Request:  param,
-		Response: new(dto.TResponse[T]),
+		Response: new(dto.PtrResponse[T]),
 	}
 }
 
-var _ = restSender.IRequest(&PostBaseAPI[IRequest, any]{})
+var _ = restSender.IRequest(&FormBaseAPI[IRequest, any]{})
 
 type FormBaseAPI[Req IRequest, T any] struct {
 	restSender.FormUrlEncodeRequest `json:"-"`
@@ -83,7 +83,7 @@ func (r FormBaseAPI[Req, T]) Encode() ([]byte, error) {
 
 func (r FormBaseAPI[Req, T]) GetResponse() any {
 	if r.Response == nil {
-		return new(dto.TResponse[T])
+		return new(dto.PtrResponse[T])
 	}
 	return r.Response
 }
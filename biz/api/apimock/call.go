@@ -0,0 +1,69 @@
+package apimock
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/illidaris/rest/signature"
+)
+
+// signKeys the query keys set by the signature, they are ignored when recording and replaying
+var signKeys = []string{
+	signature.SignKeySign,
+	signature.SignKeyTimestamp,
+	signature.SignKeyNoise,
+	signature.SignAppID,
+	signature.SignToken,
+}
+
+// Call a request received by the transport
+type Call struct {
+	Method string
+	URL    *url.URL
+	Header http.Header
+	Body   []byte
+}
+
+func newCall(req *http.Request) (*Call, error) {
+	var bs []byte
+	if req.Body != nil {
+		var err error
+		if bs, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		_ = req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(bs))
+	}
+	u := *req.URL
+	return &Call{
+		Method: req.Method,
+		URL:    &u,
+		Header: req.Header.Clone(),
+		Body:   bs,
+	}, nil
+}
+
+// Request rebuild the http request of the call
+func (c *Call) Request() *http.Request {
+	req, _ := http.NewRequestWithContext(context.Background(), c.Method, c.URL.String(), bytes.NewReader(c.Body))
+	req.Header = c.Header.Clone()
+	return req
+}
+
+// Query the query without signature keys
+func (c *Call) Query() url.Values {
+	q := c.URL.Query()
+	for _, k := range signKeys {
+		q.Del(k)
+	}
+	return q
+}
+
+// VerifySign verify the signature set by biz/api WithSecret, in url or header
+func (c *Call) VerifySign(secret string, opts ...signature.OptionFunc) error {
+	opts = append([]signature.OptionFunc{signature.WithSecret(secret)}, opts...)
+	return signature.VerifySign(c.Request(), opts...)
+}
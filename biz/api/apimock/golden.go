@@ -0,0 +1,113 @@
+package apimock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Exchange a recorded request and response, the signature keys of the query are dropped
+type Exchange struct {
+	Method   string      `json:"method"`
+	Path     string      `json:"path"`
+	Query    url.Values  `json:"query,omitempty"`
+	Body     string      `json:"body,omitempty"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header,omitempty"`
+	Response string      `json:"response"`
+}
+
+func newExchange(c *Call, res *http.Response, bs []byte) Exchange {
+	header := http.Header{}
+	if v := res.Header.Get("Content-Type"); v != "" {
+		header.Set("Content-Type", v)
+	}
+	return Exchange{
+		Method:   c.Method,
+		Path:     c.URL.Path,
+		Query:    c.Query(),
+		Body:     string(c.Body),
+		Status:   res.StatusCode,
+		Header:   header,
+		Response: string(bs),
+	}
+}
+
+func (e Exchange) key() string {
+	return e.Method + " " + e.Path + "?" + e.Query.Encode() + "\n" + e.Body
+}
+
+// Exchanges the recorded exchanges in order
+func (t *Transport) Exchanges() []Exchange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Exchange{}, t.exchanges...)
+}
+
+// SaveGolden write the recorded exchanges to the fixture file
+func (t *Transport) SaveGolden(file string) error {
+	bs, err := json.MarshalIndent(t.Exchanges(), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(bs, '\n'), 0o644)
+}
+
+// LoadGolden replay the fixture file, the same requests get the responses in the recorded order
+func LoadGolden(file string) (*Transport, error) {
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	exchanges := []Exchange{}
+	if err := json.Unmarshal(bs, &exchanges); err != nil {
+		return nil, err
+	}
+	t := New()
+	stubs := map[string]*Stub{}
+	for _, e := range exchanges {
+		s, ok := stubs[e.key()]
+		if !ok {
+			s = t.On(e.Method, e.Path)
+			for k, vs := range e.Query {
+				s.WithQuery(k, vs...)
+			}
+			body := e.Body
+			if json.Valid([]byte(body)) {
+				s.WithJSON(body)
+			} else {
+				s.WithRawBody(body)
+			}
+			stubs[e.key()] = s
+		}
+		s.Reply(e.Status, e.Response)
+		for k := range e.Header {
+			s.Header(k, e.Header.Get(k))
+		}
+	}
+	return t, nil
+}
+
+/*
+Golden replay the fixture file, or record the exchanges of real into it when record is true,
+the returned save must be called after the test, it writes the fixture file when recording.
+
+	var update = flag.Bool("update", false, "update golden files")
+
+	mock, save, err := apimock.Golden("testdata/partner.json", *update, nil)
+	api.SetDefaultTransport(mock)
+	defer save()
+*/
+func Golden(file string, record bool, real http.RoundTripper) (*Transport, func() error, error) {
+	if record {
+		t := NewRecorder(real)
+		return t, func() error { return t.SaveGolden(file) }, nil
+	}
+	t, err := LoadGolden(file)
+	return t, func() error { return nil }, err
+}
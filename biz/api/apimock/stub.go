@@ -0,0 +1,216 @@
+package apimock
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stub the replies of the matched requests, replies are used in order and the last one repeats
+type Stub struct {
+	mu      *sync.Mutex // mutex of the transport
+	method  string
+	path    string
+	query   url.Values
+	body    func([]byte) bool
+	replies []*Reply
+	hits    int
+}
+
+func newStub(mu *sync.Mutex, method, p string) *Stub {
+	return &Stub{
+		mu:     mu,
+		method: strings.ToUpper(method),
+		path:   "/" + strings.TrimPrefix(p, "/"),
+		query:  url.Values{},
+	}
+}
+
+// WithQuery the request query must contain k=v
+func (s *Stub) WithQuery(k string, v ...string) *Stub {
+	s.query[k] = append(s.query[k], v...)
+	return s
+}
+
+// WithBody the request body must satisfy f
+func (s *Stub) WithBody(f func(body []byte) bool) *Stub {
+	s.body = f
+	return s
+}
+
+// WithRawBody the request body must equal to body
+func (s *Stub) WithRawBody(body string) *Stub {
+	return s.WithBody(func(bs []byte) bool {
+		return string(bs) == body
+	})
+}
+
+// WithJSON the request body must be json equal to v
+func (s *Stub) WithJSON(v any) *Stub {
+	want := normalize(v)
+	return s.WithBody(func(bs []byte) bool {
+		var got any
+		if err := json.Unmarshal(bs, &got); err != nil {
+			return false
+		}
+		return reflect.DeepEqual(got, want)
+	})
+}
+
+// WithForm the request form body must contain k=v
+func (s *Stub) WithForm(k string, v ...string) *Stub {
+	return s.WithBody(func(bs []byte) bool {
+		form, err := url.ParseQuery(string(bs))
+		return err == nil && contains(form, url.Values{k: v})
+	})
+}
+
+// Reply append a reply, body of string or []byte is written as it is, others are encoded as json
+func (s *Stub) Reply(status int, body any) *Stub {
+	s.replies = append(s.replies, &Reply{Status: status, Body: encode(body), Header: http.Header{}})
+	return s
+}
+
+// ReplyError append a reply failed with err, as a network error
+func (s *Stub) ReplyError(err error) *Stub {
+	s.replies = append(s.replies, &Reply{Err: err})
+	return s
+}
+
+// Delay delay the last reply
+func (s *Stub) Delay(d time.Duration) *Stub {
+	if len(s.replies) == 0 {
+		s.Reply(http.StatusOK, nil)
+	}
+	s.replies[len(s.replies)-1].Delay = d
+	return s
+}
+
+// Header set header of the last reply
+func (s *Stub) Header(k, v string) *Stub {
+	if len(s.replies) == 0 {
+		s.Reply(http.StatusOK, nil)
+	}
+	s.replies[len(s.replies)-1].Header.Set(k, v)
+	return s
+}
+
+// Hits how many requests matched the stub
+func (s *Stub) Hits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits
+}
+
+func (s *Stub) match(c *Call) bool {
+	if s.method != "" && s.method != c.Method {
+		return false
+	}
+	if ok, _ := path.Match(s.path, c.URL.Path); !ok && s.path != c.URL.Path {
+		return false
+	}
+	if !contains(c.URL.Query(), s.query) {
+		return false
+	}
+	return s.body == nil || s.body(c.Body)
+}
+
+func (s *Stub) next() *Reply {
+	s.hits++
+	if len(s.replies) == 0 {
+		return &Reply{Status: http.StatusOK, Header: http.Header{}}
+	}
+	i := s.hits - 1
+	if i >= len(s.replies) {
+		i = len(s.replies) - 1
+	}
+	return s.replies[i]
+}
+
+// Reply a stubbed response
+type Reply struct {
+	Status int
+	Header http.Header
+	Body   []byte
+	Delay  time.Duration
+	Err    error
+}
+
+func (r *Reply) respond(req *http.Request) (*http.Response, error) {
+	if r.Delay > 0 {
+		timer := time.NewTimer(r.Delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+	if r.Err != nil {
+		return nil, r.Err
+	}
+	header := r.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json")
+	}
+	return &http.Response{
+		Status:        http.StatusText(r.Status),
+		StatusCode:    r.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}, nil
+}
+
+func encode(body any) []byte {
+	switch v := body.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		bs, _ := json.Marshal(v)
+		return bs
+	}
+}
+
+func normalize(v any) any {
+	var res any
+	_ = json.Unmarshal(encode(v), &res)
+	return res
+}
+
+// contains got has all values of want
+func contains(got, want url.Values) bool {
+	for k, vs := range want {
+		for _, v := range vs {
+			found := false
+			for _, g := range got[k] {
+				if g == v {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
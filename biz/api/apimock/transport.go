@@ -0,0 +1,123 @@
+// Package apimock provides a stub, record and replay http.RoundTripper for the biz/api typed client.
+//
+//	mock := apimock.New()
+//	mock.On(http.MethodPost, "user/info").WithQuery("id", "1").
+//		Reply(http.StatusServiceUnavailable, nil).
+//		Reply(http.StatusOK, `{"code":0,"data":{"name":"a"}}`)
+//	api.SetDefaultTransport(mock)
+//	defer api.SetDefaultTransport(nil)
+package apimock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+var ErrNoStub = errors.New("[apimock]no stub matched")
+
+var _ = http.RoundTripper(&Transport{})
+
+// Transport serves the requests by stubs, the unmatched requests are sent to the real transport
+// when recording, otherwise fail with ErrNoStub
+type Transport struct {
+	mu        sync.Mutex
+	stubs     []*Stub
+	calls     []*Call
+	real      http.RoundTripper
+	exchanges []Exchange
+}
+
+// New a stub transport
+func New() *Transport {
+	return &Transport{}
+}
+
+// NewRecorder forward all unmatched requests to real and record the exchanges, see SaveGolden
+func NewRecorder(real http.RoundTripper) *Transport {
+	if real == nil {
+		real = http.DefaultTransport
+	}
+	return &Transport{real: real}
+}
+
+// On stub the requests of method and path, path is the action of the request, it supports path.Match pattern
+func (t *Transport) On(method, path string) *Stub {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := newStub(&t.mu, method, path)
+	t.stubs = append(t.stubs, s)
+	return s
+}
+
+// Calls all requests received in order
+func (t *Transport) Calls() []*Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*Call{}, t.calls...)
+}
+
+// LastCall the last request received, nil if none
+func (t *Transport) LastCall() *Call {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.calls) == 0 {
+		return nil
+	}
+	return t.calls[len(t.calls)-1]
+}
+
+// Reset clear the stubs, calls and recorded exchanges
+func (t *Transport) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stubs, t.calls, t.exchanges = nil, nil, nil
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	call, err := newCall(req)
+	if err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	t.calls = append(t.calls, call)
+	var reply *Reply
+	for _, s := range t.stubs {
+		if s.match(call) {
+			reply = s.next()
+			break
+		}
+	}
+	real := t.real
+	t.mu.Unlock()
+
+	if reply != nil {
+		return reply.respond(req)
+	}
+	if real == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoStub, call.Method, call.URL)
+	}
+	return t.record(req, call, real)
+}
+
+func (t *Transport) record(req *http.Request, call *Call, real http.RoundTripper) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(call.Body))
+	res, err := real.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	bs, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = io.NopCloser(bytes.NewReader(bs))
+	t.mu.Lock()
+	t.exchanges = append(t.exchanges, newExchange(call, res, bs))
+	t.mu.Unlock()
+	return res, nil
+}
@@ -0,0 +1,135 @@
+package apimock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/illidaris/aphrodite/biz/api"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+const host = "http://partner.test"
+
+type userRequest struct {
+	Id   int64  `json:"id" url:"id"`
+	Name string `json:"name,omitempty" url:"name,omitempty"`
+}
+
+func (r userRequest) GetAction() string {
+	return "user/info"
+}
+
+type user struct {
+	Id   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestTransportStub(t *testing.T) {
+	convey.Convey("TestTransportStub", t, func() {
+		mock := New()
+		ctx := context.Background()
+		convey.Convey("sequence", func() {
+			s := mock.On(http.MethodGet, "user/info").WithQuery("id", "1").
+				Reply(http.StatusServiceUnavailable, nil).
+				ReplyError(syscall.ECONNRESET).
+				Reply(http.StatusOK, `{"code":0,"data":{"id":1,"name":"a"}}`)
+			out, ex := api.GET[userRequest, user](host, api.WithTransport(mock), api.WithRetry(3, 0, 0))(ctx, userRequest{Id: 1})
+			convey.So(ex, convey.ShouldBeNil)
+			convey.So(out, convey.ShouldResemble, user{Id: 1, Name: "a"})
+			convey.So(s.Hits(), convey.ShouldEqual, 3)
+			convey.So(mock.Calls(), convey.ShouldHaveLength, 3)
+		})
+		convey.Convey("json body", func() {
+			mock.On(http.MethodPost, "user/*").WithJSON(map[string]any{"id": 2}).
+				Reply(http.StatusOK, map[string]any{"code": 0, "data": user{Id: 2}})
+			out, ex := api.POST[userRequest, user](host, api.WithTransport(mock))(ctx, userRequest{Id: 2})
+			convey.So(ex, convey.ShouldBeNil)
+			convey.So(out.Id, convey.ShouldEqual, 2)
+
+			_, ex = api.POST[userRequest, user](host, api.WithTransport(mock))(ctx, userRequest{Id: 3})
+			convey.So(ex, convey.ShouldNotBeNil)
+			convey.So(ex.Error(), convey.ShouldContainSubstring, ErrNoStub.Error())
+		})
+		convey.Convey("form body", func() {
+			mock.On(http.MethodPost, "user/info").WithForm("name", "b").
+				Reply(http.StatusOK, `{"code":0,"data":{"id":4,"name":"b"}}`)
+			out, ex := api.FORM[userRequest, user](host, api.WithTransport(mock))(ctx, userRequest{Id: 4, Name: "b"})
+			convey.So(ex, convey.ShouldBeNil)
+			convey.So(out, convey.ShouldResemble, user{Id: 4, Name: "b"})
+			convey.So(mock.LastCall().Header.Get("Content-Type"), convey.ShouldContainSubstring, "x-www-form-urlencoded")
+		})
+		convey.Convey("latency", func() {
+			mock.On(http.MethodGet, "user/info").Reply(http.StatusOK, `{"code":0}`).Delay(time.Second)
+			begin := time.Now()
+			_, ex := api.GET[userRequest, user](host, api.WithTransport(mock), api.WithTimeout(20*time.Millisecond))(ctx, userRequest{Id: 1})
+			convey.So(ex, convey.ShouldNotBeNil)
+			convey.So(time.Since(begin), convey.ShouldBeLessThan, 500*time.Millisecond)
+		})
+		convey.Convey("default transport", func() {
+			mock.On(http.MethodGet, "user/info").Reply(http.StatusOK, `{"code":0,"data":{"id":5}}`)
+			api.SetDefaultTransport(mock)
+			defer api.SetDefaultTransport(nil)
+			out, ex := api.GET[userRequest, user](host)(ctx, userRequest{Id: 5})
+			convey.So(ex, convey.ShouldBeNil)
+			convey.So(out.Id, convey.ShouldEqual, 5)
+		})
+	})
+}
+
+func TestCallVerifySign(t *testing.T) {
+	convey.Convey("TestCallVerifySign", t, func() {
+		mock := New()
+		mock.On("", "user/info").Reply(http.StatusOK, `{"code":0}`)
+		ctx := context.Background()
+		_, ex := api.GET[userRequest, user](host, api.WithTransport(mock), api.WithSecret("s1"))(ctx, userRequest{Id: 1})
+		convey.So(ex, convey.ShouldBeNil)
+		_, ex = api.POST[userRequest, user](host, api.WithTransport(mock), api.WithSecret("s1"))(ctx, userRequest{Id: 1})
+		convey.So(ex, convey.ShouldBeNil)
+		for _, c := range mock.Calls() {
+			convey.So(c.VerifySign("s1"), convey.ShouldBeNil)
+			convey.So(c.VerifySign("s2"), convey.ShouldNotBeNil)
+		}
+	})
+}
+
+func TestGolden(t *testing.T) {
+	convey.Convey("TestGolden", t, func() {
+		n := 0
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n++
+			_, _ = fmt.Fprintf(w, `{"code":0,"data":{"id":%s,"name":"n%d"}}`, r.URL.Query().Get("id"), n)
+		}))
+		defer srv.Close()
+		file := filepath.Join(t.TempDir(), "testdata", "user.json")
+		ctx := context.Background()
+		call := func(rt http.RoundTripper, id int64) user {
+			out, ex := api.GET[userRequest, user](srv.URL, api.WithTransport(rt), api.WithSecret("s1"))(ctx, userRequest{Id: id})
+			convey.So(ex, convey.ShouldBeNil)
+			return out
+		}
+
+		rec, save, err := Golden(file, true, nil)
+		convey.So(err, convey.ShouldBeNil)
+		recorded := []user{call(rec, 1), call(rec, 1), call(rec, 2)}
+		convey.So(save(), convey.ShouldBeNil)
+		bs, _ := os.ReadFile(file)
+		convey.So(string(bs), convey.ShouldNotContainSubstring, `"sign"`)
+
+		srv.Close()
+		replay, _, err := Golden(file, false, nil)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So([]user{call(replay, 1), call(replay, 1), call(replay, 2)}, convey.ShouldResemble, recorded)
+		convey.So(recorded[0].Name, convey.ShouldNotEqual, recorded[1].Name)
+
+		_, err = LoadGolden(filepath.Join(t.TempDir(), "missing.json"))
+		convey.So(errors.Is(err, os.ErrNotExist), convey.ShouldBeTrue)
+	})
+}
@@ -0,0 +1,163 @@
+package api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// 熔断状态
+const (
+	BREAKER_CLOSED    = "closed"
+	BREAKER_HALF_OPEN = "half_open"
+	BREAKER_OPEN      = "open"
+)
+
+// BreakerConfig 熔断配置
+type BreakerConfig struct {
+	Failures    int           // 连续失败次数达到后熔断
+	OpenTimeout time.Duration // 熔断持续时间，之后进入半开
+	Probes      int           // 半开时放行的探测请求数，全部成功后恢复
+}
+
+var (
+	breakers  sync.Map // host => *breaker
+	bulkheads sync.Map // host => *bulkhead
+)
+
+// BreakerState 熔断状态，host未启用熔断时为closed
+func BreakerState(host string) string {
+	if b, ok := breakers.Load(hostKey(host)); ok {
+		return b.(*breaker).State()
+	}
+	return BREAKER_CLOSED
+}
+
+// ResetBreaker 重置host的熔断状态
+func ResetBreaker(host string) {
+	breakers.Delete(hostKey(host))
+}
+
+// breaker 按host的熔断器，同一host使用首次创建时的配置
+type breaker struct {
+	mu        sync.Mutex
+	cfg       BreakerConfig
+	state     string
+	failures  int
+	openedAt  time.Time
+	probes    int
+	successes int
+}
+
+func getBreaker(key string, cfg BreakerConfig) *breaker {
+	if cfg.Failures <= 0 {
+		cfg.Failures = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.Probes <= 0 {
+		cfg.Probes = 1
+	}
+	b, _ := breakers.LoadOrStore(key, &breaker{cfg: cfg, state: BREAKER_CLOSED})
+	return b.(*breaker)
+}
+
+func (b *breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// allow 熔断时拒绝，熔断超时后转为半开并放行有限的探测请求
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BREAKER_OPEN {
+		if time.Since(b.openedAt) < b.cfg.OpenTimeout {
+			return ErrBreakerOpen
+		}
+		b.state, b.probes, b.successes = BREAKER_HALF_OPEN, 0, 0
+	}
+	if b.state == BREAKER_HALF_OPEN {
+		if b.probes >= b.cfg.Probes {
+			return ErrBreakerOpen
+		}
+		b.probes++
+	}
+	return nil
+}
+
+func (b *breaker) report(failure bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BREAKER_HALF_OPEN:
+		if failure {
+			b.state, b.openedAt = BREAKER_OPEN, time.Now()
+			return
+		}
+		b.successes++
+		if b.successes >= b.cfg.Probes {
+			b.state, b.failures = BREAKER_CLOSED, 0
+		}
+	case BREAKER_CLOSED:
+		if !failure {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.cfg.Failures {
+			b.state, b.openedAt = BREAKER_OPEN, time.Now()
+		}
+	}
+}
+
+// release 半开时被取消的探测请求归还额度
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == BREAKER_HALF_OPEN && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// bulkhead 按host的并发限制，同一host使用首次创建时的大小
+type bulkhead struct {
+	sem chan struct{}
+}
+
+func getBulkhead(key string, size int) *bulkhead {
+	b, _ := bulkheads.LoadOrStore(key, &bulkhead{sem: make(chan struct{}, size)})
+	return b.(*bulkhead)
+}
+
+// acquire 获取并发额度，最多等待wait
+func (b *bulkhead) acquire(ctx context.Context, wait time.Duration) error {
+	select {
+	case b.sem <- struct{}{}:
+		return nil
+	default:
+	}
+	if wait <= 0 {
+		return ErrBulkheadFull
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case b.sem <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return ErrBulkheadFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *bulkhead) release() {
+	<-b.sem
+}
+
+func (b *bulkhead) inflight() int {
+	return len(b.sem)
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// 请求结果
+const (
+	RESULT_SUCCESS       = "success"
+	RESULT_FAILED        = "failed"
+	RESULT_BREAKER_OPEN  = "breaker_open"
+	RESULT_BULKHEAD_FULL = "bulkhead_full"
+)
+
+// Metrics 接口调用监控指标
+//
+//	api_attempts_total     counter_vec  请求次数，含重试与对冲
+//	api_retries_total      counter_vec  重试次数
+//	api_hedges_total       counter_vec  对冲请求次数
+//	api_breaker_state      gauge_vec    熔断状态 0-closed 1-half_open 2-open
+//	api_bulkhead_inflight  gauge_vec    并发占用
+type Metrics struct {
+	Attempts *prometheus.CounterVec
+	Retries  *prometheus.CounterVec
+	Hedges   *prometheus.CounterVec
+	Breaker  *prometheus.GaugeVec
+	Inflight *prometheus.GaugeVec
+}
+
+// NewMetrics 创建监控指标，需调用Register注册
+func NewMetrics(subsystem string) *Metrics {
+	return &Metrics{
+		Attempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "api_attempts_total",
+			Help:      "How many api attempts sent, partitioned by host and result.",
+		}, []string{"host", "result"}),
+		Retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "api_retries_total",
+			Help:      "How many api calls retried, partitioned by host.",
+		}, []string{"host"}),
+		Hedges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "api_hedges_total",
+			Help:      "How many hedged api attempts sent, partitioned by host.",
+		}, []string{"host"}),
+		Breaker: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "api_breaker_state",
+			Help:      "The circuit breaker state, 0 closed, 1 half open, 2 open.",
+		}, []string{"host"}),
+		Inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "api_bulkhead_inflight",
+			Help:      "How many api calls are holding the bulkhead, partitioned by host.",
+		}, []string{"host"}),
+	}
+}
+
+// Register 注册到registerer，已注册时复用已有的指标
+func (m *Metrics) Register(reg prometheus.Registerer) error {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	var err error
+	if m.Attempts, err = register(reg, m.Attempts); err != nil {
+		return err
+	}
+	if m.Retries, err = register(reg, m.Retries); err != nil {
+		return err
+	}
+	if m.Hedges, err = register(reg, m.Hedges); err != nil {
+		return err
+	}
+	if m.Breaker, err = register(reg, m.Breaker); err != nil {
+		return err
+	}
+	if m.Inflight, err = register(reg, m.Inflight); err != nil {
+		return err
+	}
+	return nil
+}
+
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	err := reg.Register(c)
+	if err == nil {
+		return c, nil
+	}
+	are := prometheus.AlreadyRegisteredError{}
+	if errors.As(err, &are) {
+		if exist, ok := are.ExistingCollector.(C); ok {
+			return exist, nil
+		}
+	}
+	return c, err
+}
+
+func (m *Metrics) attempt(host, result string) {
+	if m == nil {
+		return
+	}
+	m.Attempts.WithLabelValues(host, result).Inc()
+}
+
+func (m *Metrics) retry(host string) {
+	if m == nil {
+		return
+	}
+	m.Retries.WithLabelValues(host).Inc()
+}
+
+func (m *Metrics) hedge(host string) {
+	if m == nil {
+		return
+	}
+	m.Hedges.WithLabelValues(host).Inc()
+}
+
+func (m *Metrics) breaker(host, state string) {
+	if m == nil {
+		return
+	}
+	v := 0.0
+	switch state {
+	case BREAKER_HALF_OPEN:
+		v = 1
+	case BREAKER_OPEN:
+		v = 2
+	}
+	m.Breaker.WithLabelValues(host).Set(v)
+}
+
+func (m *Metrics) inflight(host string, n int) {
+	if m == nil {
+		return
+	}
+	m.Inflight.WithLabelValues(host).Set(float64(n))
+}
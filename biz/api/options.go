@@ -2,6 +2,8 @@ package api
 
 import (
 	"context"
+	"net/http"
+	"sync/atomic"
 	"time"
 
 	restSender "github.com/illidaris/rest/sender"
@@ -24,10 +26,35 @@ type options struct {
 	RequestFunc  func(context.Context, restSender.IRequest)
 	ResponseFunc func(context.Context, any, error)
 	RsOptions    []restSender.Option
+	Retry        RetryPolicy
+	Breaker      *BreakerConfig
+	Bulkhead     int           // 每个host的最大并发，0不限制
+	BulkheadWait time.Duration // 并发已满时的最长等待
+	HedgeDelay   time.Duration // 超过该时长未返回则发起对冲请求
+	Hedges       int           // 对冲请求的最大数量，0不对冲
+	Metrics      *Metrics
+	Transport    http.RoundTripper // 为空时使用SetDefaultTransport的设置
 }
 
 type Option func(*options)
 
+var defaultTransport atomic.Value // http.RoundTripper
+
+// SetDefaultTransport 设置全局的请求传输，测试中可替换为apimock，nil恢复默认
+func SetDefaultTransport(rt http.RoundTripper) {
+	defaultTransport.Store(&rt)
+}
+
+func (o *options) transport() http.RoundTripper {
+	if o.Transport != nil {
+		return o.Transport
+	}
+	if rt, ok := defaultTransport.Load().(*http.RoundTripper); ok {
+		return *rt
+	}
+	return nil
+}
+
 func WithTimeout(timeout time.Duration) Option {
 	return func(o *options) {
 		o.Timeout = timeout
@@ -57,3 +84,69 @@ func WithRsOptions(opts ...restSender.Option) Option {
 		o.RsOptions = append(o.RsOptions, opts...)
 	}
 }
+
+// WithRetry 幂等请求(GET/PUT/DELETE)失败时最多重试max次，退避为[0, min(cap, base*2^n))的随机值
+func WithRetry(max int, base, cap time.Duration) Option {
+	return func(o *options) {
+		o.Retry.Max = max
+		o.Retry.Base = base
+		o.Retry.Cap = cap
+	}
+}
+
+// WithRetryOnStatus 重试的http状态码，默认429/500/502/503/504
+func WithRetryOnStatus(codes ...int) Option {
+	return func(o *options) {
+		o.Retry.Statuses = codes
+	}
+}
+
+// WithRetryOnError 按错误判断是否重试，默认仅重试网络错误
+func WithRetryOnError(f func(error) bool) Option {
+	return func(o *options) {
+		o.Retry.RetryIf = f
+	}
+}
+
+// WithRetryUnsafe POST/FORM也重试与对冲，需确认下游幂等
+func WithRetryUnsafe(v bool) Option {
+	return func(o *options) {
+		o.Retry.Unsafe = v
+	}
+}
+
+// WithBreaker 按host熔断
+func WithBreaker(cfg BreakerConfig) Option {
+	return func(o *options) {
+		o.Breaker = &cfg
+	}
+}
+
+// WithBulkhead 按host限制并发，已满时最多等待wait
+func WithBulkhead(size int, wait time.Duration) Option {
+	return func(o *options) {
+		o.Bulkhead = size
+		o.BulkheadWait = wait
+	}
+}
+
+// WithHedge 幂等请求超过delay未返回时发起对冲请求，最多n个，取最先成功的结果
+func WithHedge(delay time.Duration, n int) Option {
+	return func(o *options) {
+		o.HedgeDelay = delay
+		o.Hedges = n
+	}
+}
+
+func WithMetrics(m *Metrics) Option {
+	return func(o *options) {
+		o.Metrics = m
+	}
+}
+
+// WithTransport 使用指定的请求传输，如apimock.Transport
+func WithTransport(rt http.RoundTripper) Option {
+	return func(o *options) {
+		o.Transport = rt
+	}
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	restSender "github.com/illidaris/rest/sender"
+	"github.com/illidaris/rest/signature"
+)
+
+var (
+	ErrBreakerOpen  = errors.New("[api]circuit breaker is open")
+	ErrBulkheadFull = errors.New("[api]bulkhead is full")
+)
+
+var defaultRetryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// StatusError 下游返回了非200的http状态
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("[api]status %d: %v", e.Code, e.Err)
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode 错误对应的http状态，非StatusError时为0
+func StatusCode(err error) int {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	return 0
+}
+
+// RetryPolicy 重试策略
+type RetryPolicy struct {
+	Max      int              // 最大重试次数，不含首次请求
+	Base     time.Duration    // 退避基数
+	Cap      time.Duration    // 退避上限
+	Statuses []int            // 重试的http状态码，为空时使用默认
+	RetryIf  func(error) bool // 非http状态的错误是否重试，为空时仅重试网络错误
+	Unsafe   bool             // 非幂等请求也重试
+}
+
+func (p RetryPolicy) retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) ||
+		errors.Is(err, ErrBreakerOpen) || errors.Is(err, ErrBulkheadFull) {
+		return false
+	}
+	if code := StatusCode(err); code != 0 {
+		statuses := p.Statuses
+		if len(statuses) == 0 {
+			statuses = defaultRetryStatuses
+		}
+		return slices.Contains(statuses, code)
+	}
+	if p.RetryIf != nil {
+		return p.RetryIf(err)
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// backoff 第n次重试前的等待，full jitter
+func (p RetryPolicy) backoff(n int) time.Duration {
+	if p.Base <= 0 {
+		return 0
+	}
+	d := p.Base
+	for i := 0; i < n && (p.Cap <= 0 || d < p.Cap); i++ {
+		d *= 2
+	}
+	if p.Cap > 0 && d > p.Cap {
+		d = p.Cap
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// failure 熔断计数的失败：网络错误、5xx与429
+func failure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if code := StatusCode(err); code != 0 {
+		return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+func hostKey(host string) string {
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return host
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// caller 一次接口调用，依次经过并发限制、重试、对冲与熔断，每次请求使用newReq创建新的请求
+type caller[R restSender.IRequest] struct {
+	o       *options
+	host    string
+	key     string
+	newReq  func() R
+	safe    bool
+	breaker *breaker
+}
+
+func invoke[R restSender.IRequest](ctx context.Context, newReq func() R, host string, opts ...Option) (R, error) {
+	o := newOptions(opts...)
+	first := newReq()
+	c := &caller[R]{
+		o:      o,
+		host:   host,
+		key:    hostKey(host),
+		newReq: newReq,
+		safe:   idempotent(first.GetMethod()) || o.Retry.Unsafe,
+	}
+	if o.Breaker != nil {
+		c.breaker = getBreaker(c.key, *o.Breaker)
+	}
+	if o.Bulkhead > 0 {
+		b := getBulkhead(c.key, o.Bulkhead)
+		if err := b.acquire(ctx, o.BulkheadWait); err != nil {
+			o.Metrics.attempt(c.key, RESULT_BULKHEAD_FULL)
+			return first, err
+		}
+		o.Metrics.inflight(c.key, b.inflight())
+		defer func() {
+			b.release()
+			o.Metrics.inflight(c.key, b.inflight())
+		}()
+	}
+	return c.retry(ctx)
+}
+
+func (c *caller[R]) retry(ctx context.Context) (R, error) {
+	retries := 0
+	if c.safe {
+		retries = c.o.Retry.Max
+	}
+	for n := 0; ; n++ {
+		r, err := c.hedge(ctx)
+		if err == nil || n >= retries || !c.o.Retry.retryable(err) {
+			return r, err
+		}
+		c.o.Metrics.retry(c.key)
+		if sleep(ctx, c.o.Retry.backoff(n)) != nil {
+			return r, err
+		}
+	}
+}
+
+// hedge 超过HedgeDelay未返回时再发起请求，取最先成功或不可重试的结果
+func (c *caller[R]) hedge(ctx context.Context) (R, error) {
+	if !c.safe || c.o.Hedges <= 0 {
+		return c.send(ctx)
+	}
+	type result struct {
+		r   R
+		err error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan result, c.o.Hedges+1)
+	launch := func() {
+		go func() {
+			r, err := c.send(ctx)
+			results <- result{r, err}
+		}()
+	}
+	launch()
+	pending, remain := 1, c.o.Hedges
+	timer := time.NewTimer(c.o.HedgeDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if remain > 0 {
+				remain--
+				pending++
+				c.o.Metrics.hedge(c.key)
+				launch()
+				timer.Reset(c.o.HedgeDelay)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil || pending == 0 || !c.o.Retry.retryable(res.err) {
+				return res.r, res.err
+			}
+		}
+	}
+}
+
+func (c *caller[R]) send(ctx context.Context) (R, error) {
+	r := c.newReq()
+	if c.breaker != nil {
+		err := c.breaker.allow()
+		c.o.Metrics.breaker(c.key, c.breaker.State())
+		if err != nil {
+			c.o.Metrics.attempt(c.key, RESULT_BREAKER_OPEN)
+			return r, err
+		}
+	}
+	status := 0
+	rsOpts := []restSender.Option{
+		restSender.WithTimeout(c.o.Timeout),
+		restSender.WithHost(c.host),
+	}
+	if c.o.Secret != "" {
+		rsOpts = append(rsOpts, restSender.WithSignSetMode(signature.SignSetlInURL, c.o.Secret, signature.Generate))
+	}
+	rsOpts = append(rsOpts, c.o.RsOptions...)
+	if rt := c.o.transport(); rt != nil {
+		rsOpts = append(rsOpts, restSender.WithClient(&http.Client{Transport: rt}))
+	}
+	rsOpts = append(rsOpts, restSender.WithHandler(func(sc *restSender.SenderContext) {
+		sc.Next()
+		if sc.Response != nil {
+			status = sc.Response.StatusCode
+		}
+	}))
+	s := restSender.NewSender(rsOpts...)
+
+	if c.o.RequestFunc != nil {
+		c.o.RequestFunc(ctx, r)
+	}
+
+	resp, err := s.Invoke(ctx, r)
+
+	if c.o.ResponseFunc != nil {
+		c.o.ResponseFunc(ctx, resp, err)
+	}
+
+	if err != nil && status != 0 && status != http.StatusOK {
+		err = &StatusError{Code: status, Err: err}
+	}
+	c.report(err)
+	return r, err
+}
+
+func (c *caller[R]) report(err error) {
+	result := RESULT_SUCCESS
+	if err != nil {
+		result = RESULT_FAILED
+	}
+	c.o.Metrics.attempt(c.key, result)
+	if c.breaker == nil {
+		return
+	}
+	if errors.Is(err, context.Canceled) {
+		c.breaker.release()
+	} else {
+		c.breaker.report(failure(err))
+	}
+	c.o.Metrics.breaker(c.key, c.breaker.State())
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
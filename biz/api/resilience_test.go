@@ -0,0 +1,171 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type echoRequest struct {
+	Name string `json:"name" url:"name"`
+}
+
+func (r echoRequest) GetAction() string {
+	return "echo"
+}
+
+// newServer 按第n次请求(从1开始)返回状态码与响应时长
+func newServer(f func(n int32) (int, time.Duration)) (*httptest.Server, *atomic.Int32) {
+	hits := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := hits.Add(1)
+		code, delay := f(n)
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.WriteHeader(code)
+		_, _ = fmt.Fprintf(w, `{"code":0,"data":"%s-%d"}`, r.URL.Query().Get("name"), n)
+	}))
+	return srv, hits
+}
+
+func TestRetry(t *testing.T) {
+	convey.Convey("TestRetry", t, func() {
+		srv, hits := newServer(func(n int32) (int, time.Duration) {
+			if n < 3 {
+				return http.StatusServiceUnavailable, 0
+			}
+			return http.StatusOK, 0
+		})
+		defer srv.Close()
+		m := NewMetrics("test_retry")
+		convey.Convey("idempotent", func() {
+			out, ex := GET[echoRequest, string](srv.URL, WithRetry(3, time.Millisecond, 5*time.Millisecond), WithMetrics(m))(context.Background(), echoRequest{Name: "a"})
+			convey.So(ex, convey.ShouldBeNil)
+			convey.So(out, convey.ShouldEqual, "a-3")
+			convey.So(hits.Load(), convey.ShouldEqual, 3)
+			convey.So(testutil.ToFloat64(m.Retries.WithLabelValues(hostKey(srv.URL))), convey.ShouldEqual, 2)
+			convey.So(testutil.ToFloat64(m.Attempts.WithLabelValues(hostKey(srv.URL), RESULT_FAILED)), convey.ShouldEqual, 2)
+		})
+		convey.Convey("non idempotent", func() {
+			_, ex := POST[echoRequest, string](srv.URL, WithRetry(3, time.Millisecond, 5*time.Millisecond))(context.Background(), echoRequest{Name: "a"})
+			convey.So(ex, convey.ShouldNotBeNil)
+			convey.So(hits.Load(), convey.ShouldEqual, 1)
+		})
+		convey.Convey("status not retried", func() {
+			_, ex := GET[echoRequest, string](srv.URL, WithRetry(3, time.Millisecond, 5*time.Millisecond), WithRetryOnStatus(http.StatusBadGateway))(context.Background(), echoRequest{Name: "a"})
+			convey.So(ex, convey.ShouldNotBeNil)
+			convey.So(hits.Load(), convey.ShouldEqual, 1)
+		})
+	})
+}
+
+func TestRetryPolicy(t *testing.T) {
+	convey.Convey("TestRetryPolicy", t, func() {
+		p := RetryPolicy{Base: 10 * time.Millisecond, Cap: 40 * time.Millisecond}
+		for n := 0; n < 10; n++ {
+			convey.So(p.backoff(n), convey.ShouldBeLessThan, 40*time.Millisecond)
+		}
+		convey.So(p.retryable(&StatusError{Code: http.StatusBadGateway, Err: errors.New("x")}), convey.ShouldBeTrue)
+		convey.So(p.retryable(&StatusError{Code: http.StatusBadRequest, Err: errors.New("x")}), convey.ShouldBeFalse)
+		convey.So(p.retryable(errors.New("decode")), convey.ShouldBeFalse)
+		convey.So(p.retryable(ErrBreakerOpen), convey.ShouldBeFalse)
+		p.RetryIf = func(err error) bool { return err.Error() == "decode" }
+		convey.So(p.retryable(errors.New("decode")), convey.ShouldBeTrue)
+	})
+}
+
+func TestBreaker(t *testing.T) {
+	convey.Convey("TestBreaker", t, func() {
+		healthy := atomic.Bool{}
+		srv, hits := newServer(func(n int32) (int, time.Duration) {
+			if healthy.Load() {
+				return http.StatusOK, 0
+			}
+			return http.StatusInternalServerError, 0
+		})
+		defer srv.Close()
+		defer ResetBreaker(srv.URL)
+		call := GET[echoRequest, string](srv.URL, WithBreaker(BreakerConfig{Failures: 2, OpenTimeout: 50 * time.Millisecond, Probes: 1}))
+		ctx := context.Background()
+
+		_, _ = call(ctx, echoRequest{})
+		_, _ = call(ctx, echoRequest{})
+		convey.So(BreakerState(srv.URL), convey.ShouldEqual, BREAKER_OPEN)
+		_, ex := call(ctx, echoRequest{})
+		convey.So(ex, convey.ShouldNotBeNil)
+		convey.So(hits.Load(), convey.ShouldEqual, 2)
+
+		// 半开探测失败重新熔断
+		time.Sleep(60 * time.Millisecond)
+		_, _ = call(ctx, echoRequest{})
+		convey.So(hits.Load(), convey.ShouldEqual, 3)
+		convey.So(BreakerState(srv.URL), convey.ShouldEqual, BREAKER_OPEN)
+
+		// 半开探测成功恢复
+		healthy.Store(true)
+		time.Sleep(60 * time.Millisecond)
+		out, ex := call(ctx, echoRequest{Name: "b"})
+		convey.So(ex, convey.ShouldBeNil)
+		convey.So(out, convey.ShouldEqual, "b-4")
+		convey.So(BreakerState(srv.URL), convey.ShouldEqual, BREAKER_CLOSED)
+	})
+}
+
+func TestBulkhead(t *testing.T) {
+	convey.Convey("TestBulkhead", t, func() {
+		srv, hits := newServer(func(n int32) (int, time.Duration) {
+			return http.StatusOK, 100 * time.Millisecond
+		})
+		defer srv.Close()
+		m := NewMetrics("test_bulkhead")
+		call := GET[echoRequest, string](srv.URL, WithBulkhead(1, 0), WithMetrics(m))
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, _ = call(context.Background(), echoRequest{})
+		}()
+		for hits.Load() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		_, ex := call(context.Background(), echoRequest{})
+		convey.So(ex, convey.ShouldNotBeNil)
+		convey.So(testutil.ToFloat64(m.Attempts.WithLabelValues(hostKey(srv.URL), RESULT_BULKHEAD_FULL)), convey.ShouldEqual, 1)
+		convey.So(testutil.ToFloat64(m.Inflight.WithLabelValues(hostKey(srv.URL))), convey.ShouldEqual, 1)
+		<-done
+		convey.So(hits.Load(), convey.ShouldEqual, 1)
+		convey.So(testutil.ToFloat64(m.Inflight.WithLabelValues(hostKey(srv.URL))), convey.ShouldEqual, 0)
+	})
+}
+
+func TestHedge(t *testing.T) {
+	convey.Convey("TestHedge", t, func() {
+		srv, hits := newServer(func(n int32) (int, time.Duration) {
+			if n == 1 {
+				return http.StatusOK, time.Second
+			}
+			return http.StatusOK, 0
+		})
+		defer srv.Close()
+		m := NewMetrics("test_hedge")
+		begin := time.Now()
+		out, ex := GET[echoRequest, string](srv.URL, WithHedge(20*time.Millisecond, 1), WithMetrics(m))(context.Background(), echoRequest{Name: "c"})
+		convey.So(ex, convey.ShouldBeNil)
+		convey.So(out, convey.ShouldEqual, "c-2")
+		convey.So(time.Since(begin), convey.ShouldBeLessThan, 500*time.Millisecond)
+		convey.So(hits.Load(), convey.ShouldEqual, 2)
+		convey.So(testutil.ToFloat64(m.Hedges.WithLabelValues(hostKey(srv.URL))), convey.ShouldEqual, 1)
+	})
+}
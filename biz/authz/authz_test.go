@@ -0,0 +1,162 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/illidaris/aphrodite/biz/session"
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+type order struct {
+	Id      int64  `json:"id"`
+	BizId   uint64 `json:"bizId" gorm:"column:bizId"`
+	Creator string `json:"creator"`
+}
+
+func TestEnforcer(t *testing.T) {
+	convey.Convey("TestEnforcer", t, func() {
+		e, err := NewEnforcer(context.Background(), StaticLoader(Rules{
+			Roles: []RoleInherit{
+				{Role: "admin", Parents: []string{"editor"}},
+				{Role: "editor", Parents: []string{"viewer", "admin"}}, // 环不影响展开
+			},
+			Policies: []Policy{
+				{Subject: "viewer", Resource: "/orders*", Action: ACTION_READ, Conditions: []string{COND_SAME_BIZ}},
+				{Subject: "editor", Resource: "/orders*", Action: "*", Conditions: []string{COND_SAME_BIZ, COND_OWNER}},
+				{Subject: "admin", Resource: "*", Action: "*"},
+				{Subject: "*", Resource: "/orders/export", Action: "*", Effect: EFFECT_DENY},
+				{Subject: "u9", Resource: "/reports", Action: ACTION_READ},
+			},
+		}))
+		convey.So(err, convey.ShouldBeNil)
+
+		viewer := &Subject{ID: "u1", Roles: []string{"viewer"}, BizId: 7}
+		editor := &Subject{ID: "u2", Roles: []string{"editor"}, BizId: 7}
+		admin := &Subject{ID: "u3", Roles: []string{"admin"}, BizId: 1}
+
+		convey.Convey("rbac", func() {
+			convey.So(e.Enforce(viewer, "/orders", ACTION_CREATE).Allowed, convey.ShouldBeFalse)
+			convey.So(e.Enforce(viewer, "/reports", ACTION_READ).Allowed, convey.ShouldBeFalse)
+			convey.So(e.Enforce(&Subject{ID: "u9"}, "/reports", ACTION_READ).Unconditional(), convey.ShouldBeTrue)
+			convey.So(e.Enforce(admin, "/anything", ACTION_DELETE).Unconditional(), convey.ShouldBeTrue)
+			// editor继承admin（环）
+			convey.So(e.Enforce(editor, "/anything", ACTION_DELETE).Allowed, convey.ShouldBeTrue)
+			convey.So(e.Enforce(admin, "/orders/export", ACTION_READ).Allowed, convey.ShouldBeFalse)
+			convey.So(e.Enforce(nil, "/orders", ACTION_READ).Allowed, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("abac", func() {
+			d := e.Enforce(viewer, "/orders", ACTION_READ)
+			convey.So(d.Allowed, convey.ShouldBeTrue)
+			convey.So(d.Unconditional(), convey.ShouldBeFalse)
+			convey.So(d.Conds(), convey.ShouldResemble, []any{"(`bizId` = ?)", int64(7)})
+			convey.So(d.Match(&order{BizId: 7}), convey.ShouldBeTrue)
+			convey.So(d.Match(order{BizId: 8}), convey.ShouldBeFalse)
+			convey.So(d.Match(map[string]any{"bizId": "7"}), convey.ShouldBeTrue)
+			convey.So(e.Check(viewer, "/orders/1", ACTION_UPDATE, &order{BizId: 7}), convey.ShouldBeFalse)
+
+			writer := &Subject{ID: "u5", Roles: []string{"writer"}, BizId: 7}
+			e2, err := NewEnforcer(context.Background(), StaticLoader(Rules{Policies: []Policy{
+				{Subject: "writer", Resource: "/orders", Action: "*", Conditions: []string{COND_SAME_BIZ, COND_OWNER}},
+				{Subject: "writer", Resource: "/orders", Action: "*", Conditions: []string{"vip"}},
+			}}), WithCondition("vip", Condition{Match: func(sub *Subject, obj any) bool { return sub.Attrs["vip"] == true }}))
+			convey.So(err, convey.ShouldBeNil)
+			d = e2.Enforce(writer, "/orders", ACTION_READ)
+			// vip无过滤条件，仅保留可过滤的组
+			convey.So(d.Conds(), convey.ShouldResemble, []any{"((`bizId` = ?) AND (`creator` = ?))", int64(7), "u5"})
+			convey.So(d.Match(&order{BizId: 7, Creator: "u5"}), convey.ShouldBeTrue)
+			convey.So(d.Match(&order{BizId: 7, Creator: "u6"}), convey.ShouldBeFalse)
+			// 更新时未修改的属性不校验，修改为他人的值则拒绝
+			convey.So(d.MatchChanges(&order{}), convey.ShouldBeTrue)
+			convey.So(d.MatchChanges(&order{Creator: "u5"}), convey.ShouldBeTrue)
+			convey.So(d.MatchChanges(&order{Creator: "u6"}), convey.ShouldBeFalse)
+			convey.So(d.MatchChanges(&order{BizId: 8}), convey.ShouldBeFalse)
+
+			_, err = NewEnforcer(context.Background(), StaticLoader(Rules{Policies: []Policy{{Subject: "a", Resource: "*", Action: "*", Conditions: []string{"nope"}}}}))
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("subject", func() {
+			ctx := session.NewContext(context.Background(), &session.Claims{Subject: "u1", BizId: 7, Extra: map[string]any{CLAIM_ROLES: []any{"viewer"}}})
+			sub, ok := FromContext(ctx)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(sub.Roles, convey.ShouldResemble, []string{"viewer"})
+			convey.So(e.Enforce(sub, "/orders", ACTION_READ).Allowed, convey.ShouldBeTrue)
+			_, ok = FromContext(context.Background())
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+	})
+}
+
+func TestViperLoader(t *testing.T) {
+	convey.Convey("TestViperLoader", t, func() {
+		v := viper.New()
+		v.SetConfigType("yaml")
+		convey.So(v.ReadConfig(bytes.NewBufferString(`
+authz:
+  roles:
+    - role: admin
+      parents: [viewer]
+  policies:
+    - subject: viewer
+      resource: /books
+      action: read
+`)), convey.ShouldBeNil)
+		e, err := NewEnforcer(context.Background(), ViperLoader(v, "authz"))
+		convey.So(err, convey.ShouldBeNil)
+		admin := &Subject{ID: "u1", Roles: []string{"admin"}}
+		convey.So(e.Enforce(admin, "/books", ACTION_READ).Allowed, convey.ShouldBeTrue)
+		convey.So(e.Enforce(admin, "/books", ACTION_DELETE).Allowed, convey.ShouldBeFalse)
+
+		convey.So(v.ReadConfig(bytes.NewBufferString(`
+authz:
+  policies:
+    - subject: admin
+      resource: /books
+      action: "*"
+      effect: deny
+`)), convey.ShouldBeNil)
+		convey.So(e.Reload(context.Background()), convey.ShouldBeNil)
+		convey.So(e.Enforce(admin, "/books", ACTION_READ).Allowed, convey.ShouldBeFalse)
+	})
+}
+
+func TestEnforcerWatch(t *testing.T) {
+	convey.Convey("TestEnforcerWatch", t, func() {
+		var fail atomic.Bool
+		loader := LoaderFunc(func(ctx context.Context) (*Rules, error) {
+			if fail.Load() {
+				return nil, errors.New("load failed")
+			}
+			return &Rules{Policies: []Policy{{Subject: "a", Resource: "*", Action: "*"}}}, nil
+		})
+		errs := make(chan error, 16)
+		e, err := NewEnforcer(context.Background(), loader, WithReloadHandle(func(ctx context.Context, err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		}))
+		convey.So(err, convey.ShouldBeNil)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		e.Watch(ctx, 10*time.Millisecond)
+		convey.So(<-errs, convey.ShouldBeNil)
+		fail.Store(true)
+		for err = range errs {
+			if err != nil {
+				break
+			}
+		}
+		convey.So(err, convey.ShouldNotBeNil)
+		// 失败时保留原策略
+		convey.So(e.Enforce(&Subject{ID: "a"}, "/books", ACTION_READ).Allowed, convey.ShouldBeTrue)
+	})
+}
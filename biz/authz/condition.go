@@ -0,0 +1,110 @@
+package authz
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// 内置条件
+const (
+	COND_SAME_BIZ = "same_biz" // 与调用方同一BizId
+	COND_OWNER    = "owner"    // 仅所有者
+)
+
+// Condition 属性条件，Match用于已知对象的校验，Filter用于列表的行级过滤，返回gorm风格的条件，
+// 仅能用于支持字符串条件的仓储(dependency.ISQLConds)；Column为条件校验的属性，用于判断更新是否修改了该属性
+type Condition struct {
+	Match  func(sub *Subject, obj any) bool
+	Filter func(sub *Subject) []any
+	Column string
+}
+
+// SameBiz 对象的column字段等于主体的BizId
+func SameBiz(column string) Condition {
+	return Condition{
+		Column: column,
+		Match: func(sub *Subject, obj any) bool {
+			v, ok := Attr(obj, column)
+			return ok && cast.ToInt64(v) == sub.BizId
+		},
+		Filter: func(sub *Subject) []any {
+			return []any{"`" + column + "` = ?", sub.BizId}
+		},
+	}
+}
+
+// Owner 对象的column字段等于主体的ID
+func Owner(column string) Condition {
+	return Condition{
+		Column: column,
+		Match: func(sub *Subject, obj any) bool {
+			v, ok := Attr(obj, column)
+			return ok && sub.ID != "" && cast.ToString(v) == sub.ID
+		},
+		Filter: func(sub *Subject) []any {
+			return []any{"`" + column + "` = ?", sub.ID}
+		},
+	}
+}
+
+// Attr 读取对象属性，支持map与结构体，结构体字段按gorm column、json标签或字段名匹配
+func Attr(obj any, name string) (any, bool) {
+	if m, ok := obj.(map[string]any); ok {
+		v, ok := m[name]
+		return v, ok
+	}
+	v := reflect.ValueOf(obj)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, false
+	}
+	return structAttr(v, name)
+}
+
+func structAttr(v reflect.Value, name string) (any, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous {
+			fv := v.Field(i)
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				if res, ok := structAttr(fv, name); ok {
+					return res, true
+				}
+			}
+			continue
+		}
+		if fieldNamed(f, name) {
+			return v.Field(i).Interface(), true
+		}
+	}
+	return nil, false
+}
+
+func fieldNamed(f reflect.StructField, name string) bool {
+	for _, item := range strings.Split(f.Tag.Get("gorm"), ";") {
+		if col, ok := strings.CutPrefix(item, "column:"); ok && col == name {
+			return true
+		}
+	}
+	if tag, _, _ := strings.Cut(f.Tag.Get("json"), ","); tag == name {
+		return true
+	}
+	return strings.EqualFold(f.Name, name)
+}
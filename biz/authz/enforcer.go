@@ -0,0 +1,259 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/pkg/logex"
+	"github.com/spf13/viper"
+)
+
+// Enforcer 策略引擎，策略由ILoader加载，Reload后原子替换
+type Enforcer struct {
+	loader     ILoader
+	conditions map[string]Condition
+	rules      atomic.Pointer[rules]
+	onReload   func(ctx context.Context, err error)
+}
+
+type Option func(*Enforcer)
+
+// WithCondition 注册或覆盖属性条件
+func WithCondition(name string, c Condition) Option {
+	return func(e *Enforcer) {
+		e.conditions[name] = c
+	}
+}
+
+// WithReloadHandle Watch与WatchViper每次重新加载后回调，err为空表示成功，可用于日志与监控，默认仅打印失败
+func WithReloadHandle(f func(ctx context.Context, err error)) Option {
+	return func(e *Enforcer) {
+		e.onReload = f
+	}
+}
+
+// NewEnforcer 创建并加载策略，内置same_biz(bizId)与owner(creator)条件
+func NewEnforcer(ctx context.Context, loader ILoader, opts ...Option) (*Enforcer, error) {
+	e := &Enforcer{
+		loader: loader,
+		conditions: map[string]Condition{
+			COND_SAME_BIZ: SameBiz("bizId"),
+			COND_OWNER:    Owner("creator"),
+		},
+		onReload: logReload,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if err := e.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload 重新加载策略，失败时保留原策略
+func (e *Enforcer) Reload(ctx context.Context) error {
+	r, err := e.loader.Load(ctx)
+	if err != nil {
+		return err
+	}
+	for _, p := range r.Policies {
+		for _, name := range p.Conditions {
+			if _, ok := e.conditions[name]; !ok {
+				return fmt.Errorf("[authz]unknown condition %s", name)
+			}
+		}
+	}
+	e.rules.Store(newRules(r))
+	return nil
+}
+
+// reload 后台重新加载，结果交给onReload
+func (e *Enforcer) reload(ctx context.Context) {
+	err := e.Reload(ctx)
+	if e.onReload != nil {
+		e.onReload(ctx, err)
+	}
+}
+
+func logReload(ctx context.Context, err error) {
+	if err != nil {
+		logex.DefaultLogger{}.Error(ctx, "[authz]reload failed, keep the previous rules: %v", err)
+	}
+}
+
+// Watch 按间隔重新加载，ctx结束时退出
+func (e *Enforcer) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				e.reload(ctx)
+			}
+		}
+	}()
+}
+
+// WatchViper 配置文件变化时重新加载，会覆盖v已设置的OnConfigChange
+func (e *Enforcer) WatchViper(v *viper.Viper) {
+	v.OnConfigChange(func(fsnotify.Event) {
+		e.reload(context.Background())
+	})
+	v.WatchConfig()
+}
+
+// Enforce 判定主体能否对资源执行操作，命中deny即拒绝，带条件的allow在Decision中延迟校验
+func (e *Enforcer) Enforce(sub *Subject, resource, action string) *Decision {
+	d := &Decision{subject: sub}
+	if sub == nil {
+		return d
+	}
+	r := e.rules.Load()
+	subjects := r.subjects(sub)
+	for _, p := range r.policies {
+		if !p.match(subjects, resource, action) {
+			continue
+		}
+		if p.deny() {
+			return &Decision{subject: sub}
+		}
+		if len(p.Conditions) == 0 {
+			d.unconditional = true
+			continue
+		}
+		grant := make([]Condition, 0, len(p.Conditions))
+		for _, name := range p.Conditions {
+			grant = append(grant, e.conditions[name])
+		}
+		d.grants = append(d.grants, grant)
+	}
+	d.Allowed = d.unconditional || len(d.grants) > 0
+	return d
+}
+
+// Check 对已知对象判定
+func (e *Enforcer) Check(sub *Subject, resource, action string, obj any) bool {
+	return e.Enforce(sub, resource, action).Match(obj)
+}
+
+// Decision 判定结果
+type Decision struct {
+	Allowed       bool
+	subject       *Subject
+	unconditional bool
+	grants        [][]Condition // 带条件的allow，任一组条件全部满足即允许
+}
+
+// Unconditional 无需按对象属性过滤
+func (d *Decision) Unconditional() bool {
+	return d.Allowed && d.unconditional
+}
+
+// Match 对象是否满足条件
+func (d *Decision) Match(obj any) bool {
+	if !d.Allowed {
+		return false
+	}
+	if d.unconditional {
+		return true
+	}
+	for _, grant := range d.grants {
+		ok := true
+		for _, c := range grant {
+			if c.Match == nil || !c.Match(d.subject, obj) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchChanges 更新的新值是否满足条件，Column为零值的条件视为未修改该属性，由行级过滤限定原有数据
+func (d *Decision) MatchChanges(obj any) bool {
+	if !d.Allowed {
+		return false
+	}
+	if d.unconditional {
+		return true
+	}
+	for _, grant := range d.grants {
+		ok := true
+		for _, c := range grant {
+			if c.Column != "" {
+				if v, found := Attr(obj, c.Column); !found || v == nil || reflect.ValueOf(v).IsZero() {
+					continue
+				}
+			}
+			if c.Match == nil || !c.Match(d.subject, obj) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Conds 列表查询的行级过滤条件，无条件允许时为空，拒绝时为1 = 0
+func (d *Decision) Conds() []any {
+	if d.Unconditional() {
+		return nil
+	}
+	queries := []string{}
+	args := []any{}
+	for _, grant := range d.grants {
+		conds, ok := grantConds(d.subject, grant)
+		if !ok {
+			continue
+		}
+		queries = append(queries, "("+conds[0].(string)+")")
+		args = append(args, conds[1:]...)
+	}
+	if len(queries) == 0 {
+		return []any{"1 = 0"}
+	}
+	return append([]any{strings.Join(queries, " OR ")}, args...)
+}
+
+// grantConds 一组条件的AND，存在无法过滤的条件时放弃该组
+func grantConds(sub *Subject, grant []Condition) ([]any, bool) {
+	var conds []any
+	for _, c := range grant {
+		if c.Filter == nil {
+			return nil, false
+		}
+		conds = dependency.AndConds(conds, c.Filter(sub))
+	}
+	if len(conds) == 0 {
+		return nil, false
+	}
+	_, ok := conds[0].(string)
+	return conds, ok
+}
+
+type decisionKey struct{}
+
+func WithDecision(ctx context.Context, d *Decision) context.Context {
+	return context.WithValue(ctx, decisionKey{}, d)
+}
+
+func DecisionFromContext(ctx context.Context) (*Decision, bool) {
+	d, ok := ctx.Value(decisionKey{}).(*Decision)
+	return d, ok
+}
@@ -0,0 +1,69 @@
+package authz
+
+import (
+	"context"
+	"strings"
+
+	"github.com/illidaris/aphrodite/component/gormex"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/spf13/viper"
+)
+
+// ILoader 策略来源
+type ILoader interface {
+	Load(ctx context.Context) (*Rules, error)
+}
+
+// LoaderFunc 函数适配ILoader
+type LoaderFunc func(ctx context.Context) (*Rules, error)
+
+func (f LoaderFunc) Load(ctx context.Context) (*Rules, error) {
+	return f(ctx)
+}
+
+// StaticLoader 固定策略
+func StaticLoader(r Rules) ILoader {
+	return LoaderFunc(func(ctx context.Context) (*Rules, error) {
+		return &r, nil
+	})
+}
+
+// ViperLoader 读取viper的key，配合Enforcer.WatchViper热加载
+func ViperLoader(v *viper.Viper, key string) ILoader {
+	return LoaderFunc(func(ctx context.Context) (*Rules, error) {
+		r := &Rules{}
+		if v == nil || !v.IsSet(key) {
+			return r, nil
+		}
+		err := v.UnmarshalKey(key, r)
+		return r, err
+	})
+}
+
+// GormLoader 读取po.AuthzPolicy与po.AuthzRole，配合Enforcer.Watch定时加载
+func GormLoader(db string) ILoader {
+	return LoaderFunc(func(ctx context.Context) (*Rules, error) {
+		policies := []po.AuthzPolicy{}
+		if err := gormex.CoreFrmCtx(ctx, db).Where("`disable` = ?", false).Order("`id`").Find(&policies).Error; err != nil {
+			return nil, err
+		}
+		roles := []po.AuthzRole{}
+		if err := gormex.CoreFrmCtx(ctx, db).Order("`id`").Find(&roles).Error; err != nil {
+			return nil, err
+		}
+		r := &Rules{}
+		for _, p := range policies {
+			item := Policy{Subject: p.Subject, Resource: p.Resource, Action: p.Action, Effect: p.Effect}
+			for _, c := range strings.Split(p.Conditions, ",") {
+				if c = strings.TrimSpace(c); c != "" {
+					item.Conditions = append(item.Conditions, c)
+				}
+			}
+			r.Policies = append(r.Policies, item)
+		}
+		for _, role := range roles {
+			r.Roles = append(r.Roles, RoleInherit{Role: role.Role, Parents: []string{role.Parent}})
+		}
+		return r, nil
+	})
+}
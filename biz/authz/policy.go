@@ -0,0 +1,107 @@
+package authz
+
+import (
+	"path"
+	"strings"
+)
+
+const (
+	EFFECT_ALLOW = "allow"
+	EFFECT_DENY  = "deny"
+	ANY          = "*"
+)
+
+// 常用操作，中间件按请求方法映射
+const (
+	ACTION_READ   = "read"
+	ACTION_CREATE = "create"
+	ACTION_UPDATE = "update"
+	ACTION_DELETE = "delete"
+)
+
+// Policy 策略，Subject为用户ID、角色或*，Resource与Action支持path.Match通配
+type Policy struct {
+	Subject    string   `json:"subject" mapstructure:"subject"`
+	Resource   string   `json:"resource" mapstructure:"resource"`
+	Action     string   `json:"action" mapstructure:"action"`
+	Effect     string   `json:"effect" mapstructure:"effect"`         // allow或deny，默认allow
+	Conditions []string `json:"conditions" mapstructure:"conditions"` // 属性条件，全部满足才生效，deny不支持条件
+}
+
+func (p Policy) deny() bool {
+	return strings.EqualFold(p.Effect, EFFECT_DENY)
+}
+
+func (p Policy) match(subjects map[string]struct{}, resource, action string) bool {
+	if _, ok := subjects[p.Subject]; !ok && p.Subject != ANY {
+		return false
+	}
+	return glob(p.Resource, resource) && glob(p.Action, action)
+}
+
+func glob(pattern, v string) bool {
+	if pattern == ANY || pattern == v {
+		return true
+	}
+	ok, _ := path.Match(pattern, v)
+	return ok
+}
+
+// RoleInherit 角色继承，Role拥有Parents的全部权限
+type RoleInherit struct {
+	Role    string   `json:"role" mapstructure:"role"`
+	Parents []string `json:"parents" mapstructure:"parents"`
+}
+
+// Rules 策略集合
+//
+//	authz:
+//	  roles:
+//	    - role: admin
+//	      parents: [editor]
+//	  policies:
+//	    - subject: editor
+//	      resource: /books*
+//	      action: "*"
+//	      conditions: [same_biz]
+type Rules struct {
+	Policies []Policy      `json:"policies" mapstructure:"policies"`
+	Roles    []RoleInherit `json:"roles" mapstructure:"roles"`
+}
+
+// rules 加载后的只读快照
+type rules struct {
+	policies []Policy
+	parents  map[string][]string
+}
+
+func newRules(r *Rules) *rules {
+	res := &rules{parents: map[string][]string{}}
+	if r == nil {
+		return res
+	}
+	res.policies = append(res.policies, r.Policies...)
+	for _, inherit := range r.Roles {
+		res.parents[inherit.Role] = append(res.parents[inherit.Role], inherit.Parents...)
+	}
+	return res
+}
+
+// subjects 用户ID与展开继承后的全部角色
+func (r *rules) subjects(sub *Subject) map[string]struct{} {
+	res := map[string]struct{}{}
+	if sub.ID != "" {
+		res[sub.ID] = struct{}{}
+	}
+	queue := append([]string{}, sub.Roles...)
+	for len(queue) > 0 {
+		role := queue[0]
+		queue = queue[1:]
+		if _, ok := res[role]; ok {
+			continue
+		}
+		res[role] = struct{}{}
+		queue = append(queue, r.parents[role]...)
+	}
+	return res
+}
@@ -0,0 +1,49 @@
+package authz
+
+import (
+	"context"
+
+	"github.com/illidaris/aphrodite/biz/session"
+	"github.com/spf13/cast"
+)
+
+const CLAIM_ROLES = "roles" // 会话Extra中的角色声明
+
+// Subject 访问主体
+type Subject struct {
+	ID    string         `json:"id"`
+	Roles []string       `json:"roles"`
+	BizId int64          `json:"bizId"`
+	Attrs map[string]any `json:"attrs,omitempty"`
+}
+
+type subjectKey struct{}
+
+func NewContext(ctx context.Context, sub *Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, sub)
+}
+
+// FromContext 优先取NewContext写入的主体，其次由会话声明构造
+func FromContext(ctx context.Context) (*Subject, bool) {
+	if sub, ok := ctx.Value(subjectKey{}).(*Subject); ok {
+		return sub, true
+	}
+	claims, ok := session.FromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return FromClaims(claims), true
+}
+
+// FromClaims 由会话声明构造主体，角色取Extra的roles
+func FromClaims(claims *session.Claims) *Subject {
+	sub := &Subject{
+		ID:    claims.Subject,
+		BizId: claims.BizId,
+		Attrs: claims.Extra,
+	}
+	if claims.Extra != nil {
+		sub.Roles = cast.ToStringSlice(claims.Extra[CLAIM_ROLES])
+	}
+	return sub
+}
@@ -0,0 +1,85 @@
+package ginoauth2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	apOAuth2 "github.com/illidaris/aphrodite/biz/oauth2"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/exception"
+	"golang.org/x/oauth2"
+)
+
+type oidcClaimsKey struct{}
+
+// NewClaimsContext id token声明写入上下文
+func NewClaimsContext(ctx context.Context, claims *apOAuth2.IDTokenClaims) context.Context {
+	return context.WithValue(ctx, oidcClaimsKey{}, claims)
+}
+
+// ClaimsFromContext 上下文中的id token声明
+func ClaimsFromContext(ctx context.Context) (*apOAuth2.IDTokenClaims, bool) {
+	claims, ok := ctx.Value(oidcClaimsKey{}).(*apOAuth2.IDTokenClaims)
+	return claims, ok
+}
+
+func LoginByOIDCRedirectController(opts ...apOAuth2.Option) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		url, _, _, err := apOAuth2.GetOIDCAuthorizeURl(c.Request.Context(), opts...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(err)))
+			return
+		}
+		// 重定向到授权URL
+		c.Redirect(http.StatusTemporaryRedirect, url)
+	}
+}
+
+func LoginByOIDCController(opts ...apOAuth2.Option) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		url, _, _, err := apOAuth2.GetOIDCAuthorizeURl(c.Request.Context(), opts...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(err)))
+			return
+		}
+		c.JSON(http.StatusOK, dto.NewResponse(url, nil))
+	}
+}
+
+// CallbackOIDCController 校验id token后调用handle，上下文中可通过ClaimsFromContext获取声明
+func CallbackOIDCController(handle func(ctx context.Context, token *oauth2.Token, claims *apOAuth2.IDTokenClaims) (any, exception.Exception), opts ...apOAuth2.Option) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		token, claims, ok := oidcCallback(c, opts...)
+		if !ok {
+			return
+		}
+		if handle == nil {
+			c.JSON(http.StatusUnauthorized, dto.NewResponse(nil, exception.ERR_COMMON_UNAUTH.New("没有配置验证过程")))
+			return
+		}
+		resp, ex := handle(c.Request.Context(), token, claims)
+		if ex != nil {
+			c.JSON(http.StatusOK, dto.NewResponse(resp, ex))
+			return
+		}
+		c.JSON(http.StatusOK, dto.NewResponse(resp, nil))
+	}
+}
+
+// oidcCallback 完成授权码交换与id token校验，失败时已写入响应
+func oidcCallback(c *gin.Context, opts ...apOAuth2.Option) (*oauth2.Token, *apOAuth2.IDTokenClaims, bool) {
+	param := &apOAuth2.OAuthCallbackParam{}
+	if err := c.ShouldBind(param); err != nil {
+		c.JSON(http.StatusUnauthorized, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(fmt.Errorf("请求登录态参数错误%v", err))))
+		return nil, nil, false
+	}
+	token, claims, err := apOAuth2.OIDCCallback(c.Request.Context(), param, nil, opts...)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, dto.NewResponse(nil, exception.ERR_COMMON_UNAUTH.Wrap(fmt.Errorf("获取登录态失败%v", err))))
+		return nil, nil, false
+	}
+	c.Request = c.Request.WithContext(NewClaimsContext(c.Request.Context(), claims))
+	return token, claims, true
+}
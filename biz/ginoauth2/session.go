@@ -0,0 +1,149 @@
+package ginoauth2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	apOAuth2 "github.com/illidaris/aphrodite/biz/oauth2"
+	"github.com/illidaris/aphrodite/biz/session"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	"github.com/illidaris/aphrodite/pkg/exception"
+	"golang.org/x/oauth2"
+)
+
+const (
+	SESSION_HEADER        = "Authorization"
+	SESSION_BEARER        = "Bearer "
+	SESSION_COOKIE        = "_aph_session"
+	SESSION_REFRESH_PARAM = "refreshToken"
+)
+
+// SessionToken 优先从Authorization头获取，其次从cookie获取
+func SessionToken(c *gin.Context, cookie string) string {
+	if v := c.GetHeader(SESSION_HEADER); strings.HasPrefix(v, SESSION_BEARER) {
+		return strings.TrimSpace(v[len(SESSION_BEARER):])
+	}
+	if cookie == "" {
+		return ""
+	}
+	v, err := c.Cookie(cookie)
+	if err != nil {
+		return ""
+	}
+	return v
+}
+
+// SessionMidleware 校验会话token，声明通过session.FromContext获取，BizId写入contextex
+func SessionMidleware(m *session.Manager, cookie string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := SessionToken(c, cookie)
+		if raw == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.NewResponse(nil, exception.ERR_COMMON_UNAUTH.New("未登录")))
+			return
+		}
+		claims, err := m.Verify(c.Request.Context(), raw)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.NewResponse(nil, exception.ERR_COMMON_UNAUTH.Wrap(err)))
+			return
+		}
+		ctx := session.NewContext(c.Request.Context(), claims)
+		if claims.BizId > 0 {
+			ctx = contextex.WithBizId(ctx, claims.BizId)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// SetSessionCookie access token写入cookie，cookie为空时不写入
+func SetSessionCookie(c *gin.Context, cookie, domain string, pair *session.TokenPair) {
+	if cookie == "" || pair == nil {
+		return
+	}
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(cookie, pair.AccessToken, int(pair.ExpiresIn), "/", domain, true, true)
+}
+
+// PrincipalFromIDToken 使用id token声明构造会话用户
+func PrincipalFromIDToken(ctx context.Context, claims *apOAuth2.IDTokenClaims) *session.Claims {
+	name := claims.Name
+	if name == "" {
+		name = claims.PreferredUsername
+	}
+	return &session.Claims{
+		Subject: claims.Subject,
+		BizId:   contextex.GetBizId(ctx),
+		Name:    name,
+	}
+}
+
+// CallbackSessionController OIDC回调后签发会话，handle为空或返回nil时使用PrincipalFromIDToken
+func CallbackSessionController(m *session.Manager, cookie, domain string, handle func(ctx context.Context, token *oauth2.Token, claims *apOAuth2.IDTokenClaims) (*session.Claims, exception.Exception), opts ...apOAuth2.Option) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		token, claims, ok := oidcCallback(c, opts...)
+		if !ok {
+			return
+		}
+		ctx := c.Request.Context()
+		var principal *session.Claims
+		if handle != nil {
+			p, ex := handle(ctx, token, claims)
+			if ex != nil {
+				c.JSON(http.StatusOK, dto.NewResponse(nil, ex))
+				return
+			}
+			principal = p
+		}
+		if principal == nil {
+			principal = PrincipalFromIDToken(ctx, claims)
+		}
+		pair, err := m.Issue(ctx, principal)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, dto.NewResponse(nil, exception.ERR_COMMON_BUSY.Wrap(err)))
+			return
+		}
+		SetSessionCookie(c, cookie, domain, pair)
+		c.JSON(http.StatusOK, dto.NewResponse(pair, nil))
+	}
+}
+
+// RefreshSessionController 轮换refresh token
+func RefreshSessionController(m *session.Manager, cookie, domain string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		raw := c.PostForm(SESSION_REFRESH_PARAM)
+		if raw == "" {
+			c.JSON(http.StatusUnauthorized, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.New("缺少refresh token")))
+			return
+		}
+		pair, err := m.Refresh(c.Request.Context(), raw)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, dto.NewResponse(nil, exception.ERR_COMMON_UNAUTH.Wrap(err)))
+			return
+		}
+		SetSessionCookie(c, cookie, domain, pair)
+		c.JSON(http.StatusOK, dto.NewResponse(pair, nil))
+	}
+}
+
+// LogoutSessionController 注销当前会话，需挂载在SessionMidleware之后
+func LogoutSessionController(m *session.Manager, cookie, domain string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		claims, ok := session.FromContext(c.Request.Context())
+		if !ok {
+			c.JSON(http.StatusUnauthorized, dto.NewResponse(nil, exception.ERR_COMMON_UNAUTH.Wrap(errors.New("未登录"))))
+			return
+		}
+		if err := m.Revoke(c.Request.Context(), claims); err != nil {
+			c.JSON(http.StatusInternalServerError, dto.NewResponse(nil, exception.ERR_COMMON_BUSY.Wrap(err)))
+			return
+		}
+		if cookie != "" {
+			c.SetCookie(cookie, "", -1, "/", domain, true, true)
+		}
+		c.JSON(http.StatusOK, dto.NewResponse(nil, nil))
+	}
+}
@@ -0,0 +1,67 @@
+package ginoauth2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/biz/session"
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestSessionMidleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	m, _ := session.NewManager(
+		session.WithSigner(session.NewHS256Signer("k", []byte("secret"))),
+		session.WithCache(session.NewMemoryCache()),
+	)
+	r := gin.New()
+	r.POST("/refresh", RefreshSessionController(m, SESSION_COOKIE, ""))
+	auth := r.Group("/", SessionMidleware(m, SESSION_COOKIE))
+	auth.GET("/me", func(c *gin.Context) {
+		claims, _ := session.FromContext(c.Request.Context())
+		c.String(http.StatusOK, "%s:%d", claims.Subject, contextex.GetBizId(c.Request.Context()))
+	})
+	auth.POST("/logout", LogoutSessionController(m, SESSION_COOKIE, ""))
+
+	do := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	convey.Convey("TestSessionMidleware", t, func() {
+		pair, err := m.Issue(contextex.WithBizId(t.Context(), 3), &session.Claims{Subject: "u1", BizId: 3})
+		convey.So(err, convey.ShouldBeNil)
+
+		w := do(httptest.NewRequest(http.MethodGet, "/me", nil))
+		convey.So(w.Code, convey.ShouldEqual, http.StatusUnauthorized)
+
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set(SESSION_HEADER, SESSION_BEARER+pair.AccessToken)
+		w = do(req)
+		convey.So(w.Code, convey.ShouldEqual, http.StatusOK)
+		convey.So(w.Body.String(), convey.ShouldEqual, "u1:3")
+
+		req = httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.AddCookie(&http.Cookie{Name: SESSION_COOKIE, Value: pair.AccessToken})
+		convey.So(do(req).Code, convey.ShouldEqual, http.StatusOK)
+
+		form := url.Values{SESSION_REFRESH_PARAM: {pair.RefreshToken}}
+		req = httptest.NewRequest(http.MethodPost, "/refresh", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w = do(req)
+		convey.So(w.Code, convey.ShouldEqual, http.StatusOK)
+		convey.So(w.Header().Get("Set-Cookie"), convey.ShouldContainSubstring, SESSION_COOKIE)
+
+		req = httptest.NewRequest(http.MethodPost, "/logout", nil)
+		req.Header.Set(SESSION_HEADER, SESSION_BEARER+pair.AccessToken)
+		convey.So(do(req).Code, convey.ShouldEqual, http.StatusOK)
+		req = httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set(SESSION_HEADER, SESSION_BEARER+pair.AccessToken)
+		convey.So(do(req).Code, convey.ShouldEqual, http.StatusUnauthorized)
+	})
+}
@@ -9,6 +9,7 @@ type AuthorizeParam struct {
 	Verifier string `json:"verifier" form:"verifier" url:"verifier"`
 	BizId    int64  `json:"bizId" form:"bizId" url:"bizId"`
 	Expire   int64  `json:"expire" form:"expire" url:"expire"`
+	Nonce    string `json:"nonce,omitempty" form:"nonce" url:"nonce,omitempty"` // OIDC nonce
 }
 
 func (s AuthorizeParam) Valid(bizId int64) error {
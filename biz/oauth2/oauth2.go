@@ -13,6 +13,11 @@ import (
 // GetAuthorizeURl 获取授权URL
 func GetAuthorizeURl(ctx context.Context, opts ...Option) (string, AuthorizeParam, string, error) {
 	opt := NewOptions(opts...)
+	return opt.authorize(ctx, opt.GetOAuth2Config(ctx), "")
+}
+
+// authorize 生成state与code verifier，nonce不为空时为OIDC授权
+func (opt options) authorize(ctx context.Context, conf *oauth2.Config, nonce string) (string, AuthorizeParam, string, error) {
 	state := ulid.Make().String()
 	verifier := oauth2.GenerateVerifier()
 	dur := opt.GetCodeChallengeExpireHandle(ctx)
@@ -20,6 +25,7 @@ func GetAuthorizeURl(ctx context.Context, opts ...Option) (string, AuthorizePara
 		Verifier: verifier,
 		BizId:    opt.BizIdHandle(ctx),
 		Expire:   time.Now().Add(dur).Unix(),
+		Nonce:    nonce,
 	}
 	if opt.Cache != nil {
 		key := fmt.Sprintf(CACHE_KEY_CODE_VERIFIER, state)
@@ -29,35 +35,46 @@ func GetAuthorizeURl(ctx context.Context, opts ...Option) (string, AuthorizePara
 			return "", param, param.Encode(opt.GetBusiSecretHandle(ctx)), err
 		}
 	}
-	url := opt.GetOAuth2Config(ctx).AuthCodeURL(state, oauth2.S256ChallengeOption(verifier))
+	authOpts := []oauth2.AuthCodeOption{oauth2.S256ChallengeOption(verifier)}
+	if nonce != "" {
+		authOpts = append(authOpts, oauth2.SetAuthURLParam("nonce", nonce))
+	}
+	url := conf.AuthCodeURL(state, authOpts...)
 	return url, param, param.Encode(opt.GetBusiSecretHandle(ctx)), nil
 }
 
 // OAuthCallback 处理OAuth回调
 func OAuthCallback(ctx context.Context, param *OAuthCallbackParam, findCodeVerifier func(string) string, opts ...Option) (*oauth2.Token, error) {
 	opt := NewOptions(opts...)
+	token, _, err := opt.exchange(ctx, opt.GetOAuth2Config(ctx), param, findCodeVerifier)
+	return token, err
+}
+
+// exchange 校验state对应的授权参数并换取令牌
+func (opt options) exchange(ctx context.Context, conf *oauth2.Config, param *OAuthCallbackParam, findCodeVerifier func(string) string) (*oauth2.Token, *AuthorizeParam, error) {
 	bizId := opt.BizIdHandle(ctx)
 	cacheParam := &AuthorizeParam{}
 	if findCodeVerifier != nil {
 		v := findCodeVerifier(param.State)
 		err := cacheParam.Decode(v, opt.GetBusiSecretHandle(ctx))
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	} else if opt.Cache != nil {
 		key := fmt.Sprintf(CACHE_KEY_CODE_VERIFIER, param.State)
 		res, err := opt.Cache().GetCtx(ctx, key)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 		defer opt.Cache().DelCtx(ctx, key)
 		err = json.Unmarshal([]byte(res), cacheParam)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 	if err := cacheParam.Valid(bizId); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return opt.GetOAuth2Config(ctx).Exchange(ctx, param.Code, oauth2.VerifierOption(cacheParam.Verifier))
+	token, err := conf.Exchange(ctx, param.Code, oauth2.VerifierOption(cacheParam.Verifier))
+	return token, cacheParam, err
 }
@@ -0,0 +1,315 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	OIDC_DISCOVERY_PATH   = "/.well-known/openid-configuration"
+	OIDC_SCOPE            = "openid"
+	OIDC_LEEWAY           = time.Minute      // 时间声明允许的时钟偏差
+	OIDC_JWKS_TTL         = time.Hour        // 公钥缓存时长
+	OIDC_JWKS_MIN_REFRESH = 10 * time.Second // 未知kid时刷新公钥的最小间隔
+)
+
+var (
+	ErrNoIssuer     = errors.New("[oidc]issuer is empty")
+	ErrNoIDToken    = errors.New("[oidc]id_token not found in token response")
+	ErrInvalidClaim = errors.New("[oidc]invalid claim")
+
+	providers sync.Map // issuer => *oidcProvider
+)
+
+// ProviderMetadata OpenID Provider Metadata
+type ProviderMetadata struct {
+	Issuer                           string   `json:"issuer"`
+	AuthorizationEndpoint            string   `json:"authorization_endpoint"`
+	TokenEndpoint                    string   `json:"token_endpoint"`
+	UserinfoEndpoint                 string   `json:"userinfo_endpoint"`
+	JwksUri                          string   `json:"jwks_uri"`
+	RevocationEndpoint               string   `json:"revocation_endpoint,omitempty"`
+	IdTokenSigningAlgValuesSupported []string `json:"id_token_signing_alg_values_supported,omitempty"`
+}
+
+type oidcProvider struct {
+	mu        sync.Mutex
+	meta      *ProviderMetadata
+	metaAt    time.Time
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+	refreshAt time.Time
+}
+
+func httpClient(ctx context.Context) *http.Client {
+	if c, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok && c != nil {
+		return c
+	}
+	return http.DefaultClient
+}
+
+func getJSON(ctx context.Context, url, accessToken string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	resp, err := httpClient(ctx).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	bs, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("[oidc]get %s failed, status %d", url, resp.StatusCode)
+	}
+	return json.Unmarshal(bs, v)
+}
+
+func provider(issuer string) *oidcProvider {
+	v, _ := providers.LoadOrStore(issuer, &oidcProvider{})
+	return v.(*oidcProvider)
+}
+
+// Discover 获取并缓存提供方的元数据
+func Discover(ctx context.Context, issuer string) (*ProviderMetadata, error) {
+	if issuer == "" {
+		return nil, ErrNoIssuer
+	}
+	p := provider(issuer)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil && time.Since(p.metaAt) < OIDC_JWKS_TTL {
+		return p.meta, nil
+	}
+	meta := &ProviderMetadata{}
+	if err := getJSON(ctx, strings.TrimSuffix(issuer, "/")+OIDC_DISCOVERY_PATH, "", meta); err != nil {
+		return nil, err
+	}
+	// 防止元数据被替换为其他提供方
+	if meta.Issuer != issuer {
+		return nil, fmt.Errorf("[oidc]issuer mismatch, expected %s got %s", issuer, meta.Issuer)
+	}
+	p.meta, p.metaAt = meta, time.Now()
+	return meta, nil
+}
+
+// publicKey 按kid获取公钥，未知kid时刷新，支持提供方轮换密钥
+func (p *oidcProvider) publicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.keys[kid]; ok && time.Since(p.keysAt) < OIDC_JWKS_TTL {
+		return key, nil
+	}
+	if time.Since(p.refreshAt) < OIDC_JWKS_MIN_REFRESH {
+		if key, ok := p.keys[kid]; ok {
+			return key, nil
+		}
+		return nil, ErrKeyNotFound
+	}
+	p.refreshAt = time.Now()
+	set := &JSONWebKeySet{}
+	if err := getJSON(ctx, p.meta.JwksUri, "", set); err != nil {
+		return nil, err
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	p.keys, p.keysAt = keys, time.Now()
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	// 仅有一个公钥且未指定kid
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+// oidcConfig oauth2配置，未配置的端点取自提供方元数据
+func (opt options) oidcConfig(ctx context.Context) (*oauth2.Config, *ProviderMetadata, error) {
+	meta, err := Discover(ctx, opt.GetIssuerHandle(ctx))
+	if err != nil {
+		return nil, nil, err
+	}
+	conf := opt.GetOAuth2Config(ctx)
+	if conf.Endpoint.AuthURL == "" {
+		conf.Endpoint.AuthURL = meta.AuthorizationEndpoint
+	}
+	if conf.Endpoint.TokenURL == "" {
+		conf.Endpoint.TokenURL = meta.TokenEndpoint
+	}
+	hasOpenId := false
+	for _, scope := range conf.Scopes {
+		hasOpenId = hasOpenId || scope == OIDC_SCOPE
+	}
+	if !hasOpenId {
+		conf.Scopes = append([]string{OIDC_SCOPE}, conf.Scopes...)
+	}
+	return conf, meta, nil
+}
+
+// GetOIDCAuthorizeURl 获取OIDC授权URL，nonce与code verifier一起保存
+func GetOIDCAuthorizeURl(ctx context.Context, opts ...Option) (string, AuthorizeParam, string, error) {
+	opt := NewOptions(opts...)
+	conf, _, err := opt.oidcConfig(ctx)
+	if err != nil {
+		return "", AuthorizeParam{}, "", err
+	}
+	// nonce与verifier同为32字节随机数
+	return opt.authorize(ctx, conf, oauth2.GenerateVerifier())
+}
+
+// OIDCCallback 处理OIDC回调，校验id token并返回声明
+func OIDCCallback(ctx context.Context, param *OAuthCallbackParam, findCodeVerifier func(string) string, opts ...Option) (*oauth2.Token, *IDTokenClaims, error) {
+	opt := NewOptions(opts...)
+	conf, _, err := opt.oidcConfig(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	token, authParam, err := opt.exchange(ctx, conf, param, findCodeVerifier)
+	if err != nil {
+		return nil, nil, err
+	}
+	raw, _ := token.Extra("id_token").(string)
+	if raw == "" {
+		return token, nil, ErrNoIDToken
+	}
+	if authParam.Nonce == "" {
+		return token, nil, fmt.Errorf("%w: nonce is not saved", ErrInvalidClaim)
+	}
+	claims, err := VerifyIDToken(ctx, raw, authParam.Nonce, opts...)
+	if err != nil {
+		return token, nil, err
+	}
+	if err := verifyAtHash(claims, raw, token.AccessToken); err != nil {
+		return token, nil, err
+	}
+	return token, claims, nil
+}
+
+// VerifyIDToken 校验id token的签名与iss、aud、exp、nonce等声明，nonce为空时不校验
+func VerifyIDToken(ctx context.Context, raw, nonce string, opts ...Option) (*IDTokenClaims, error) {
+	opt := NewOptions(opts...)
+	issuer := opt.GetIssuerHandle(ctx)
+	meta, err := Discover(ctx, issuer)
+	if err != nil {
+		return nil, err
+	}
+	header, payload, signed, sig, err := parseJWT(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(meta.IdTokenSigningAlgValuesSupported) > 0 && !Audience(meta.IdTokenSigningAlgValuesSupported).Contains(header.Alg) {
+		return nil, ErrUnsupportedAlg
+	}
+	key, err := provider(issuer).publicKey(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, signed, sig); err != nil {
+		return nil, err
+	}
+	claims := &IDTokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, ErrInvalidJWT
+	}
+	_ = json.Unmarshal(payload, &claims.Raw)
+	now := time.Now()
+	clientId := opt.GetClientIdHandle(ctx)
+	switch {
+	case claims.Issuer != issuer:
+		return nil, fmt.Errorf("%w: iss %s", ErrInvalidClaim, claims.Issuer)
+	case !claims.Audience.Contains(clientId):
+		return nil, fmt.Errorf("%w: aud %v", ErrInvalidClaim, claims.Audience)
+	case len(claims.Audience) > 1 && claims.Azp != "" && claims.Azp != clientId:
+		return nil, fmt.Errorf("%w: azp %s", ErrInvalidClaim, claims.Azp)
+	case claims.Expiry == 0 || now.After(claims.Expiry.Time().Add(OIDC_LEEWAY)):
+		return nil, fmt.Errorf("%w: expired", ErrInvalidClaim)
+	case claims.NotBefore != 0 && now.Add(OIDC_LEEWAY).Before(claims.NotBefore.Time()):
+		return nil, fmt.Errorf("%w: not before", ErrInvalidClaim)
+	case claims.IssuedAt != 0 && now.Add(OIDC_LEEWAY).Before(claims.IssuedAt.Time()):
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidClaim)
+	case nonce != "" && claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce", ErrInvalidClaim)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: sub is empty", ErrInvalidClaim)
+	}
+	return claims, nil
+}
+
+// verifyAtHash access token的摘要，at_hash为空时不校验
+func verifyAtHash(claims *IDTokenClaims, raw, accessToken string) error {
+	if claims.AtHash == "" || accessToken == "" {
+		return nil
+	}
+	header, _, _, _, _ := parseJWT(raw)
+	var hash crypto.Hash
+	if header.Alg == "EdDSA" {
+		hash = crypto.SHA512
+	} else {
+		hash = algHash(header.Alg)
+	}
+	if hash == 0 {
+		return ErrUnsupportedAlg
+	}
+	h := hash.New()
+	_, _ = h.Write([]byte(accessToken))
+	sum := h.Sum(nil)
+	if base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2]) != claims.AtHash {
+		return fmt.Errorf("%w: at_hash", ErrInvalidClaim)
+	}
+	return nil
+}
+
+// GetUserInfo 获取用户信息，sub不为空时校验与id token一致
+func GetUserInfo(ctx context.Context, token *oauth2.Token, sub string, opts ...Option) (*UserInfo, error) {
+	opt := NewOptions(opts...)
+	meta, err := Discover(ctx, opt.GetIssuerHandle(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if meta.UserinfoEndpoint == "" {
+		return nil, errors.New("[oidc]userinfo endpoint is empty")
+	}
+	raw := map[string]any{}
+	if err := getJSON(ctx, meta.UserinfoEndpoint, token.AccessToken, &raw); err != nil {
+		return nil, err
+	}
+	info := &UserInfo{Raw: raw}
+	bs, _ := json.Marshal(raw)
+	if err := json.Unmarshal(bs, &info.ProfileClaims); err != nil {
+		return nil, err
+	}
+	if sub != "" && info.Subject != sub {
+		return nil, fmt.Errorf("%w: userinfo sub %s", ErrInvalidClaim, info.Subject)
+	}
+	return info, nil
+}
@@ -0,0 +1,93 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// Audience aud可以是字符串或数组
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(bs []byte) error {
+	var s string
+	if err := json.Unmarshal(bs, &s); err == nil {
+		*a = Audience{s}
+		return nil
+	}
+	var ss []string
+	if err := json.Unmarshal(bs, &ss); err != nil {
+		return err
+	}
+	*a = ss
+	return nil
+}
+
+func (a Audience) Contains(v string) bool {
+	for _, s := range a {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// NumericDate 秒级时间戳，兼容小数
+type NumericDate int64
+
+func (d *NumericDate) UnmarshalJSON(bs []byte) error {
+	f, err := strconv.ParseFloat(string(bs), 64)
+	if err != nil {
+		return err
+	}
+	*d = NumericDate(f)
+	return nil
+}
+
+func (d NumericDate) Time() time.Time {
+	if d == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(d), 0)
+}
+
+// ProfileClaims 标准用户信息
+type ProfileClaims struct {
+	Subject           string `json:"sub"`
+	Name              string `json:"name,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Picture           string `json:"picture,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     bool   `json:"email_verified,omitempty"`
+	PhoneNumber       string `json:"phone_number,omitempty"`
+}
+
+// IDTokenClaims id token的声明，Raw为全部声明
+type IDTokenClaims struct {
+	ProfileClaims
+	Issuer    string         `json:"iss"`
+	Audience  Audience       `json:"aud"`
+	Expiry    NumericDate    `json:"exp"`
+	IssuedAt  NumericDate    `json:"iat"`
+	NotBefore NumericDate    `json:"nbf,omitempty"`
+	AuthTime  NumericDate    `json:"auth_time,omitempty"`
+	Nonce     string         `json:"nonce,omitempty"`
+	AtHash    string         `json:"at_hash,omitempty"`
+	Azp       string         `json:"azp,omitempty"`
+	Raw       map[string]any `json:"-"`
+}
+
+// Claims 解析自定义声明
+func (c *IDTokenClaims) Claims(v any) error {
+	bs, err := json.Marshal(c.Raw)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, v)
+}
+
+// UserInfo userinfo端点返回的用户信息，Raw为全部字段
+type UserInfo struct {
+	ProfileClaims
+	Raw map[string]any `json:"-"`
+}
@@ -0,0 +1,176 @@
+package oauth2
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var (
+	ErrInvalidJWT       = errors.New("[oidc]invalid jwt")
+	ErrUnsupportedAlg   = errors.New("[oidc]unsupported signing algorithm")
+	ErrInvalidSignature = errors.New("[oidc]invalid signature")
+	ErrKeyNotFound      = errors.New("[oidc]signing key not found")
+)
+
+// JSONWebKey RFC 7517，仅支持签名验证所需的公钥字段
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// PublicKey rsa、ecdsa或ed25519公钥
+func (k JSONWebKey) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("[oidc]unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("[oidc]unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("[oidc]unsupported key type %s", k.Kty)
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// parseJWT split the compact jws, the payload is not verified
+func parseJWT(raw string) (header jwtHeader, payload []byte, signed string, sig []byte, err error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return header, nil, "", nil, ErrInvalidJWT
+	}
+	hb, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return header, nil, "", nil, ErrInvalidJWT
+	}
+	if err = json.Unmarshal(hb, &header); err != nil {
+		return header, nil, "", nil, ErrInvalidJWT
+	}
+	if payload, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		return header, nil, "", nil, ErrInvalidJWT
+	}
+	if sig, err = base64.RawURLEncoding.DecodeString(parts[2]); err != nil {
+		return header, nil, "", nil, ErrInvalidJWT
+	}
+	return header, payload, parts[0] + "." + parts[1], sig, nil
+}
+
+func algHash(alg string) crypto.Hash {
+	switch alg[len(alg)-3:] {
+	case "256":
+		return crypto.SHA256
+	case "384":
+		return crypto.SHA384
+	case "512":
+		return crypto.SHA512
+	}
+	return 0
+}
+
+// verifySignature 非对称签名验证，不支持none与HS*，避免算法混淆
+func verifySignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	if alg == "EdDSA" {
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(pub, []byte(signed), sig) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	if len(alg) != 5 {
+		return ErrUnsupportedAlg
+	}
+	hash := algHash(alg)
+	if hash == 0 {
+		return ErrUnsupportedAlg
+	}
+	h := hash.New()
+	_, _ = h.Write([]byte(signed))
+	digest := h.Sum(nil)
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidSignature
+		}
+		var err error
+		if alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+		} else {
+			err = rsa.VerifyPSS(pub, hash, digest, sig, nil)
+		}
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		return nil
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig)%2 != 0 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return ErrInvalidSignature
+		}
+		return nil
+	}
+	return ErrUnsupportedAlg
+}
@@ -0,0 +1,208 @@
+package oauth2
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// fakeIdP in process identity provider
+type fakeIdP struct {
+	*httptest.Server
+	mu     sync.Mutex
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+	jwks   []JSONWebKey
+	nonce  string
+	claims func(map[string]any)
+}
+
+func newFakeIdP() *fakeIdP {
+	idp := &fakeIdP{}
+	idp.rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	idp.ecKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	idp.jwks = []JSONWebKey{{
+		Kty: "RSA", Kid: "k1", Use: "sig", Alg: "RS256",
+		N: base64.RawURLEncoding.EncodeToString(idp.rsaKey.N.Bytes()),
+		E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.rsaKey.E)).Bytes()),
+	}}
+	mux := http.NewServeMux()
+	mux.HandleFunc(OIDC_DISCOVERY_PATH, func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(ProviderMetadata{
+			Issuer:                idp.URL,
+			AuthorizationEndpoint: idp.URL + "/authorize",
+			TokenEndpoint:         idp.URL + "/token",
+			UserinfoEndpoint:      idp.URL + "/userinfo",
+			JwksUri:               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(JSONWebKeySet{Keys: idp.jwks})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idp.sign("RS256", "k1", idp.idClaims("access")),
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"sub": "user-1", "email": "a@b.c", "email_verified": true, "dept": "rd"})
+	})
+	idp.Server = httptest.NewServer(mux)
+	return idp
+}
+
+func (idp *fakeIdP) idClaims(accessToken string) map[string]any {
+	sum := sha256.Sum256([]byte(accessToken))
+	claims := map[string]any{
+		"iss":     idp.URL,
+		"sub":     "user-1",
+		"aud":     "client",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+		"iat":     time.Now().Unix(),
+		"nonce":   idp.nonce,
+		"at_hash": base64.RawURLEncoding.EncodeToString(sum[:16]),
+		"email":   "a@b.c",
+		"dept":    "rd",
+	}
+	if idp.claims != nil {
+		idp.claims(claims)
+	}
+	return claims
+}
+
+func (idp *fakeIdP) sign(alg, kid string, claims map[string]any) string {
+	hb, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	pb, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(pb)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch alg {
+	case "RS256":
+		sig, _ = rsa.SignPKCS1v15(rand.Reader, idp.rsaKey, crypto.SHA256, digest[:])
+	case "ES256":
+		r, s, _ := ecdsa.Sign(rand.Reader, idp.ecKey, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestOIDC(t *testing.T) {
+	idp := newFakeIdP()
+	defer idp.Close()
+	ctx := context.Background()
+	opts := []Option{
+		WithGetIssuerHandle(func(context.Context) string { return idp.URL }),
+		WithGetClientIdHandle(func(context.Context) string { return "client" }),
+		WithGetRedirectUrlHandle(func(context.Context) string { return "https://app/callback" }),
+		WithGetScopesHandle(func(context.Context) []string { return []string{"email"} }),
+		WithBizIdHandle(func(context.Context) int64 { return 1 }),
+	}
+
+	convey.Convey("TestOIDC", t, func() {
+		convey.Convey("login", func() {
+			authUrl, param, _, err := GetOIDCAuthorizeURl(ctx, opts...)
+			convey.So(err, convey.ShouldBeNil)
+			u, _ := url.Parse(authUrl)
+			q := u.Query()
+			convey.So(u.Path, convey.ShouldEqual, "/authorize")
+			convey.So(q.Get("scope"), convey.ShouldEqual, "openid email")
+			convey.So(q.Get("nonce"), convey.ShouldEqual, param.Nonce)
+			convey.So(param.Nonce, convey.ShouldNotBeEmpty)
+
+			idp.nonce = param.Nonce
+			token, claims, err := OIDCCallback(ctx, &OAuthCallbackParam{Code: "code", State: q.Get("state")}, nil, opts...)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(token.AccessToken, convey.ShouldEqual, "access")
+			convey.So(claims.Subject, convey.ShouldEqual, "user-1")
+			convey.So(claims.Email, convey.ShouldEqual, "a@b.c")
+			convey.So(claims.Audience, convey.ShouldResemble, Audience{"client"})
+			custom := struct {
+				Dept string `json:"dept"`
+			}{}
+			convey.So(claims.Claims(&custom), convey.ShouldBeNil)
+			convey.So(custom.Dept, convey.ShouldEqual, "rd")
+
+			info, err := GetUserInfo(ctx, token, claims.Subject, opts...)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(info.EmailVerified, convey.ShouldBeTrue)
+			convey.So(info.Raw["dept"], convey.ShouldEqual, "rd")
+			_, err = GetUserInfo(ctx, token, "user-2", opts...)
+			convey.So(err, convey.ShouldWrap, ErrInvalidClaim)
+
+			// state只能使用一次
+			idp.nonce = "other"
+			_, _, err = OIDCCallback(ctx, &OAuthCallbackParam{Code: "code", State: q.Get("state")}, nil, opts...)
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("verify", func() {
+			idp.nonce = "n"
+			valid := idp.sign("RS256", "k1", idp.idClaims("access"))
+			_, err := VerifyIDToken(ctx, valid, "n", opts...)
+			convey.So(err, convey.ShouldBeNil)
+			_, err = VerifyIDToken(ctx, valid, "other", opts...)
+			convey.So(err, convey.ShouldWrap, ErrInvalidClaim)
+			_, err = VerifyIDToken(ctx, valid[:len(valid)-4]+"AAAA", "n", opts...)
+			convey.So(err, convey.ShouldEqual, ErrInvalidSignature)
+
+			for _, mutate := range []func(map[string]any){
+				func(c map[string]any) { c["aud"] = []string{"other"} },
+				func(c map[string]any) { c["iss"] = "https://evil" },
+				func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+				func(c map[string]any) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+			} {
+				claims := idp.idClaims("access")
+				mutate(claims)
+				_, err = VerifyIDToken(ctx, idp.sign("RS256", "k1", claims), "n", opts...)
+				convey.So(err, convey.ShouldWrap, ErrInvalidClaim)
+			}
+
+			// 不允许none与对称算法
+			hb := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"k1"}`))
+			pb, _ := json.Marshal(idp.idClaims("access"))
+			_, err = VerifyIDToken(ctx, hb+"."+base64.RawURLEncoding.EncodeToString(pb)+".", "n", opts...)
+			convey.So(err, convey.ShouldEqual, ErrUnsupportedAlg)
+
+			// 密钥轮换后刷新公钥
+			es := idp.sign("ES256", "k2", idp.idClaims("access"))
+			_, err = VerifyIDToken(ctx, es, "n", opts...)
+			convey.So(err, convey.ShouldEqual, ErrKeyNotFound)
+			idp.mu.Lock()
+			idp.jwks = append(idp.jwks, JSONWebKey{
+				Kty: "EC", Kid: "k2", Crv: "P-256",
+				X: base64.RawURLEncoding.EncodeToString(idp.ecKey.X.FillBytes(make([]byte, 32))),
+				Y: base64.RawURLEncoding.EncodeToString(idp.ecKey.Y.FillBytes(make([]byte, 32))),
+			})
+			idp.mu.Unlock()
+			provider(idp.URL).refreshAt = time.Time{}
+			claims, err := VerifyIDToken(ctx, es, "n", opts...)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(claims.Subject, convey.ShouldEqual, "user-1")
+		})
+	})
+}
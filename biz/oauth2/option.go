@@ -9,7 +9,10 @@ import (
 	"golang.org/x/oauth2"
 )
 
-var _defaultCache = defaultCache{&sync.Map{}}
+var (
+	_defaultCache      = defaultCache{&sync.Map{}}
+	_defaultTokenStore = NewMemoryTokenStore()
+)
 
 type Handle func(context.Context) string
 type Option func(*options)
@@ -24,6 +27,12 @@ type options struct {
 	GetCodeChallengeExpireHandle func(context.Context) time.Duration
 	BizIdHandle                  func(context.Context) int64
 	Cache                        func() ICache
+	GetIssuerHandle              Handle                              // OIDC提供方，端点为空时通过发现获取
+	GetProviderHandle            Handle                              // 提供方，令牌按提供方隔离
+	GetRevokeUrlHandle           Handle                              // 撤销地址，RFC 7009，为空时仅删除本地令牌
+	GetRefreshAheadHandle        func(context.Context) time.Duration // 过期前提前刷新的时长
+	GetTokenTTLHandle            func(context.Context) time.Duration // 有刷新令牌时的存储时长
+	TokenStore                   func() ITokenStore
 }
 
 func (opt options) GetOAuth2Config(ctx context.Context) *oauth2.Config {
@@ -58,6 +67,18 @@ func NewOptions(opts ...Option) *options {
 		Cache: func() ICache {
 			return _defaultCache
 		},
+		GetIssuerHandle:    func(context.Context) string { return "" },
+		GetProviderHandle:  func(context.Context) string { return "" },
+		GetRevokeUrlHandle: func(context.Context) string { return "" },
+		GetRefreshAheadHandle: func(context.Context) time.Duration {
+			return time.Minute
+		},
+		GetTokenTTLHandle: func(context.Context) time.Duration {
+			return 30 * 24 * time.Hour
+		},
+		TokenStore: func() ITokenStore {
+			return _defaultTokenStore
+		},
 	}
 	for _, opt := range opts {
 		opt(o)
@@ -132,3 +153,41 @@ func WithBizIdHandle(handle func(context.Context) int64) Option {
 		o.BizIdHandle = handle
 	}
 }
+
+func WithGetIssuerHandle(handle Handle) Option {
+	return func(o *options) {
+		o.GetIssuerHandle = handle
+	}
+}
+
+func WithGetProviderHandle(handle Handle) Option {
+	return func(o *options) {
+		o.GetProviderHandle = handle
+	}
+}
+
+func WithGetRevokeUrlHandle(handle Handle) Option {
+	return func(o *options) {
+		o.GetRevokeUrlHandle = handle
+	}
+}
+
+func WithGetRefreshAheadHandle(handle func(context.Context) time.Duration) Option {
+	return func(o *options) {
+		o.GetRefreshAheadHandle = handle
+	}
+}
+
+func WithGetTokenTTLHandle(handle func(context.Context) time.Duration) Option {
+	return func(o *options) {
+		o.GetTokenTTLHandle = handle
+	}
+}
+
+func WithTokenStore(store ITokenStore) Option {
+	return func(o *options) {
+		o.TokenStore = func() ITokenStore {
+			return store
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	ErrNoRefreshToken = errors.New("[oauth2]token expired without refresh token")
+
+	refreshGroup singleflight.Group
+)
+
+// storedToken oauth2.Token的json不包含extra，保留id_token
+type storedToken struct {
+	*oauth2.Token
+	IdToken string `json:"idToken,omitempty"`
+}
+
+func (opt options) tokenKey(ctx context.Context, userId string) TokenKey {
+	return TokenKey{
+		Provider: opt.GetProviderHandle(ctx),
+		BizId:    opt.BizIdHandle(ctx),
+		UserId:   userId,
+	}
+}
+
+func (opt options) saveToken(ctx context.Context, key TokenKey, t *oauth2.Token) error {
+	st := storedToken{Token: t}
+	if idToken, ok := t.Extra("id_token").(string); ok {
+		st.IdToken = idToken
+	}
+	value, err := AESEncode(st, opt.GetBusiSecretHandle(ctx))
+	if err != nil {
+		return err
+	}
+	// 无刷新令牌时随访问令牌过期
+	var expire time.Time
+	if t.RefreshToken != "" {
+		if ttl := opt.GetTokenTTLHandle(ctx); ttl > 0 {
+			expire = time.Now().Add(ttl)
+		}
+	} else {
+		expire = t.Expiry
+	}
+	return opt.TokenStore().SetToken(ctx, key.String(), value, expire)
+}
+
+func (opt options) loadToken(ctx context.Context, key TokenKey) (*oauth2.Token, error) {
+	value, err := opt.TokenStore().GetToken(ctx, key.String())
+	if err != nil {
+		return nil, err
+	}
+	st := storedToken{}
+	if err := AESDecode(&st, value, opt.GetBusiSecretHandle(ctx)); err != nil {
+		return nil, err
+	}
+	if st.Token == nil {
+		return nil, ErrTokenNotFound
+	}
+	t := st.Token
+	if st.IdToken != "" {
+		t = t.WithExtra(map[string]any{"id_token": st.IdToken})
+	}
+	return t, nil
+}
+
+// SaveToken 加密保存用户的令牌，一般在OAuthCallback之后调用
+func SaveToken(ctx context.Context, userId string, t *oauth2.Token, opts ...Option) error {
+	opt := NewOptions(opts...)
+	return opt.saveToken(ctx, opt.tokenKey(ctx, userId), t)
+}
+
+// LoadToken 读取用户的令牌，不刷新
+func LoadToken(ctx context.Context, userId string, opts ...Option) (*oauth2.Token, error) {
+	opt := NewOptions(opts...)
+	return opt.loadToken(ctx, opt.tokenKey(ctx, userId))
+}
+
+// DeleteToken 删除本地令牌
+func DeleteToken(ctx context.Context, userId string, opts ...Option) error {
+	opt := NewOptions(opts...)
+	return opt.TokenStore().DelToken(ctx, opt.tokenKey(ctx, userId).String())
+}
+
+/*
+NewTokenSource 自动刷新的令牌，过期前GetRefreshAheadHandle时长内刷新并保存，同一令牌的并发刷新合并为一次
+
+	client := oauth2.NewClient(ctx, NewTokenSource(ctx, userId, opts...))
+*/
+func NewTokenSource(ctx context.Context, userId string, opts ...Option) oauth2.TokenSource {
+	opt := NewOptions(opts...)
+	return &refreshingTokenSource{
+		ctx: ctx,
+		opt: opt,
+		key: opt.tokenKey(ctx, userId),
+	}
+}
+
+type refreshingTokenSource struct {
+	ctx context.Context
+	opt *options
+	key TokenKey
+}
+
+func (s *refreshingTokenSource) fresh(t *oauth2.Token) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || time.Until(t.Expiry) > s.opt.GetRefreshAheadHandle(s.ctx)
+}
+
+func (s *refreshingTokenSource) Token() (*oauth2.Token, error) {
+	t, err := s.opt.loadToken(s.ctx, s.key)
+	if err != nil {
+		return nil, err
+	}
+	if s.fresh(t) {
+		return t, nil
+	}
+	v, err, _ := refreshGroup.Do(s.key.String(), func() (any, error) {
+		// 其他实例可能已刷新
+		cur, err := s.opt.loadToken(s.ctx, s.key)
+		if err != nil {
+			return nil, err
+		}
+		if s.fresh(cur) {
+			return cur, nil
+		}
+		if cur.RefreshToken == "" {
+			return nil, ErrNoRefreshToken
+		}
+		// 清空访问令牌强制刷新，提供方未返回新的刷新令牌时沿用旧的
+		nt, err := s.opt.GetOAuth2Config(s.ctx).TokenSource(s.ctx, &oauth2.Token{RefreshToken: cur.RefreshToken}).Token()
+		if err != nil {
+			return nil, err
+		}
+		if err := s.opt.saveToken(s.ctx, s.key, nt); err != nil {
+			return nil, err
+		}
+		return nt, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*oauth2.Token), nil
+}
+
+// RevokeToken 撤销令牌并删除本地令牌，优先撤销刷新令牌
+func RevokeToken(ctx context.Context, userId string, opts ...Option) error {
+	opt := NewOptions(opts...)
+	key := opt.tokenKey(ctx, userId)
+	t, err := opt.loadToken(ctx, key)
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if revokeUrl := opt.GetRevokeUrlHandle(ctx); revokeUrl != "" {
+		token, hint := t.RefreshToken, "refresh_token"
+		if token == "" {
+			token, hint = t.AccessToken, "access_token"
+		}
+		if err := revoke(ctx, opt, revokeUrl, token, hint); err != nil {
+			return err
+		}
+	}
+	return opt.TokenStore().DelToken(ctx, key.String())
+}
+
+func revoke(ctx context.Context, opt *options, revokeUrl, token, hint string) error {
+	form := url.Values{"token": {token}, "token_type_hint": {hint}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, revokeUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(opt.GetClientIdHandle(ctx)), url.QueryEscape(opt.GetClientSecretHandle(ctx)))
+	resp, err := httpClient(ctx).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// RFC 7009 令牌无效时也返回200
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("[oauth2]revoke token failed, status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package oauth2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/illidaris/aphrodite/component/gormex"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	CACHE_KEY_TOKEN = "_aph_oauth2:token:%s:%d:%s" // 提供方:业务:用户
+)
+
+var ErrTokenNotFound = errors.New("[oauth2]token not found")
+
+// TokenKey 令牌按提供方、业务与用户隔离
+type TokenKey struct {
+	Provider string `json:"provider"`
+	BizId    int64  `json:"bizId"`
+	UserId   string `json:"userId"`
+}
+
+func (k TokenKey) String() string {
+	return fmt.Sprintf(CACHE_KEY_TOKEN, k.Provider, k.BizId, k.UserId)
+}
+
+// ITokenStore 令牌存储，value为加密后的令牌，expire为零值表示不过期
+type ITokenStore interface {
+	SetToken(ctx context.Context, key, value string, expire time.Time) error
+	GetToken(ctx context.Context, key string) (string, error) // 不存在时返回ErrTokenNotFound
+	DelToken(ctx context.Context, key string) error
+}
+
+var _ = ITokenStore(&MemoryTokenStore{})
+
+type memoryToken struct {
+	value  string
+	expire time.Time
+}
+
+// MemoryTokenStore 进程内存储，仅用于单实例与测试
+type MemoryTokenStore struct {
+	m sync.Map
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{}
+}
+
+func (s *MemoryTokenStore) SetToken(ctx context.Context, key, value string, expire time.Time) error {
+	s.m.Store(key, memoryToken{value: value, expire: expire})
+	return nil
+}
+
+func (s *MemoryTokenStore) GetToken(ctx context.Context, key string) (string, error) {
+	v, ok := s.m.Load(key)
+	if !ok {
+		return "", ErrTokenNotFound
+	}
+	t := v.(memoryToken)
+	if !t.expire.IsZero() && t.expire.Before(time.Now()) {
+		s.m.Delete(key)
+		return "", ErrTokenNotFound
+	}
+	return t.value, nil
+}
+
+func (s *MemoryTokenStore) DelToken(ctx context.Context, key string) error {
+	s.m.Delete(key)
+	return nil
+}
+
+var _ = ITokenStore(&CacheTokenStore{})
+
+// CacheTokenStore 基于ICache的存储，例如redis
+type CacheTokenStore struct {
+	cache ICache
+}
+
+func NewCacheTokenStore(cache ICache) *CacheTokenStore {
+	return &CacheTokenStore{cache: cache}
+}
+
+func (s *CacheTokenStore) SetToken(ctx context.Context, key, value string, expire time.Time) error {
+	var dur time.Duration
+	if !expire.IsZero() {
+		if dur = time.Until(expire); dur <= 0 {
+			return s.cache.DelCtx(ctx, key)
+		}
+	}
+	return s.cache.SetCtx(ctx, key, value, dur)
+}
+
+func (s *CacheTokenStore) GetToken(ctx context.Context, key string) (string, error) {
+	v, err := s.cache.GetCtx(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if v == "" {
+		return "", ErrTokenNotFound
+	}
+	return v, nil
+}
+
+func (s *CacheTokenStore) DelToken(ctx context.Context, key string) error {
+	return s.cache.DelCtx(ctx, key)
+}
+
+var _ = ITokenStore(&GormTokenStore{})
+
+// GormTokenStore 基于数据库的存储，表为po.OAuth2Token
+type GormTokenStore struct {
+	gormex.BaseRepository[po.OAuth2Token]
+	db string
+}
+
+func NewGormTokenStore(db string) *GormTokenStore {
+	return &GormTokenStore{db: db}
+}
+
+func (s *GormTokenStore) SetToken(ctx context.Context, key, value string, expire time.Time) error {
+	p := &po.OAuth2Token{Key: key, Token: value}
+	if !expire.IsZero() {
+		p.Expire = expire.Unix()
+	}
+	return gormex.CoreFrmCtx(ctx, s.db).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"token", "expire", "updateAt"}),
+	}).Create(p).Error
+}
+
+func (s *GormTokenStore) GetToken(ctx context.Context, key string) (string, error) {
+	p, err := s.BaseGet(ctx, dependency.WithDataBase(s.db), dependency.WithConds("`key` = ?", key))
+	if err != nil {
+		return "", err
+	}
+	if p == nil || p.Expire > 0 && p.Expire < time.Now().Unix() {
+		return "", ErrTokenNotFound
+	}
+	return p.Token, nil
+}
+
+func (s *GormTokenStore) DelToken(ctx context.Context, key string) error {
+	return gormex.CoreFrmCtx(ctx, s.db).Where("`key` = ?", key).Delete(&po.OAuth2Token{}).Error
+}
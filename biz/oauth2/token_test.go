@@ -0,0 +1,184 @@
+package oauth2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/illidaris/aphrodite/component/gormex"
+	"github.com/smartystreets/goconvey/convey"
+	"golang.org/x/oauth2"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func newTokenServer(refreshes, revokes *int32) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		atomic.AddInt32(refreshes, 1)
+		// 刷新变慢，以便并发请求合并
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access-" + r.Form.Get("refresh_token"),
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"refresh_token": "refresh-2",
+		})
+	})
+	mux.HandleFunc("/revoke", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if id, _, _ := r.BasicAuth(); id != "client" || r.Form.Get("token_type_hint") != "refresh_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		atomic.AddInt32(revokes, 1)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestTokenSource(t *testing.T) {
+	var refreshes, revokes int32
+	srv := newTokenServer(&refreshes, &revokes)
+	defer srv.Close()
+	ctx := context.Background()
+
+	convey.Convey("TestTokenSource", t, func() {
+		atomic.StoreInt32(&refreshes, 0)
+		opts := []Option{
+			WithGetTokenUrlHandle(func(context.Context) string { return srv.URL + "/token" }),
+			WithGetRevokeUrlHandle(func(context.Context) string { return srv.URL + "/revoke" }),
+			WithGetClientIdHandle(func(context.Context) string { return "client" }),
+			WithGetBusiSecretHandle(func(context.Context) string { return "0123456789abcdef" }),
+			WithGetProviderHandle(func(context.Context) string { return "feishu" }),
+			WithBizIdHandle(func(context.Context) int64 { return 1 }),
+			WithTokenStore(NewMemoryTokenStore()),
+		}
+
+		convey.Convey("refresh once when expired", func() {
+			expired := (&oauth2.Token{AccessToken: "old", RefreshToken: "refresh-1", Expiry: time.Now().Add(-time.Minute)}).
+				WithExtra(map[string]any{"id_token": "id"})
+			convey.So(SaveToken(ctx, "u1", expired, opts...), convey.ShouldBeNil)
+
+			wg := sync.WaitGroup{}
+			for i := 0; i < 5; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, _ = NewTokenSource(ctx, "u1", opts...).Token()
+				}()
+			}
+			wg.Wait()
+			convey.So(atomic.LoadInt32(&refreshes), convey.ShouldEqual, 1)
+
+			tk, err := NewTokenSource(ctx, "u1", opts...).Token()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(tk.AccessToken, convey.ShouldEqual, "access-refresh-1")
+			convey.So(tk.RefreshToken, convey.ShouldEqual, "refresh-2")
+			convey.So(atomic.LoadInt32(&refreshes), convey.ShouldEqual, 1)
+
+			// 其他用户与提供方隔离
+			_, err = LoadToken(ctx, "u2", opts...)
+			convey.So(err, convey.ShouldEqual, ErrTokenNotFound)
+			_, err = LoadToken(ctx, "u1", append(opts, WithGetProviderHandle(func(context.Context) string { return "github" }))...)
+			convey.So(err, convey.ShouldEqual, ErrTokenNotFound)
+		})
+
+		convey.Convey("keep id token and fresh token", func() {
+			fresh := (&oauth2.Token{AccessToken: "a", RefreshToken: "r", Expiry: time.Now().Add(time.Hour)}).
+				WithExtra(map[string]any{"id_token": "id"})
+			convey.So(SaveToken(ctx, "u1", fresh, opts...), convey.ShouldBeNil)
+			tk, err := NewTokenSource(ctx, "u1", opts...).Token()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(tk.AccessToken, convey.ShouldEqual, "a")
+			convey.So(tk.Extra("id_token"), convey.ShouldEqual, "id")
+			convey.So(atomic.LoadInt32(&refreshes), convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("expired without refresh token", func() {
+			convey.So(SaveToken(ctx, "u1", &oauth2.Token{AccessToken: "a", Expiry: time.Now().Add(30 * time.Second)}, opts...), convey.ShouldBeNil)
+			_, err := NewTokenSource(ctx, "u1", opts...).Token()
+			convey.So(err, convey.ShouldEqual, ErrNoRefreshToken)
+		})
+
+		convey.Convey("revoke", func() {
+			convey.So(SaveToken(ctx, "u1", &oauth2.Token{AccessToken: "a", RefreshToken: "r"}, opts...), convey.ShouldBeNil)
+			convey.So(RevokeToken(ctx, "u1", opts...), convey.ShouldBeNil)
+			convey.So(atomic.LoadInt32(&revokes), convey.ShouldEqual, 1)
+			_, err := LoadToken(ctx, "u1", opts...)
+			convey.So(err, convey.ShouldEqual, ErrTokenNotFound)
+			convey.So(RevokeToken(ctx, "u1", opts...), convey.ShouldBeNil)
+		})
+	})
+}
+
+func TestTokenStore(t *testing.T) {
+	ctx := context.Background()
+	convey.Convey("TestTokenStore", t, func() {
+		for _, store := range []ITokenStore{NewMemoryTokenStore(), NewCacheTokenStore(_defaultCache)} {
+			convey.So(store.SetToken(ctx, "k", "v", time.Time{}), convey.ShouldBeNil)
+			v, err := store.GetToken(ctx, "k")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(v, convey.ShouldEqual, "v")
+			convey.So(store.DelToken(ctx, "k"), convey.ShouldBeNil)
+			_, err = store.GetToken(ctx, "k")
+			convey.So(err, convey.ShouldEqual, ErrTokenNotFound)
+		}
+		mem := NewMemoryTokenStore()
+		convey.So(mem.SetToken(ctx, "k", "v", time.Now().Add(-time.Second)), convey.ShouldBeNil)
+		_, err := mem.GetToken(ctx, "k")
+		convey.So(err, convey.ShouldEqual, ErrTokenNotFound)
+		convey.So(TokenKey{Provider: "feishu", BizId: 1, UserId: "u"}.String(), convey.ShouldEqual, "_aph_oauth2:token:feishu:1:u")
+	})
+}
+
+func TestGormTokenStore(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	gormDb, err := gorm.Open(mysql.New(mysql.Config{Conn: db, SkipInitializeWithVersion: true}), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch := gomonkey.ApplyFunc(gormex.CoreFrmCtx, func(ctx context.Context, id string) *gorm.DB {
+		return gormDb.WithContext(ctx)
+	})
+	defer patch.Reset()
+
+	convey.Convey("TestGormTokenStore", t, func() {
+		store := NewGormTokenStore("db")
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `aphrodite_oauth2_token` .* ON DUPLICATE KEY UPDATE").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		convey.So(store.SetToken(ctx, "k", "v", time.Time{}), convey.ShouldBeNil)
+
+		mock.ExpectQuery("SELECT .* FROM `aphrodite_oauth2_token` WHERE `key` = ?").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "key", "token", "expire"}).AddRow(1, "k", "v", 0))
+		v, err := store.GetToken(ctx, "k")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "v")
+
+		mock.ExpectQuery("SELECT").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "key", "token", "expire"}).AddRow(1, "k", "v", 1))
+		_, err = store.GetToken(ctx, "k")
+		convey.So(err, convey.ShouldEqual, ErrTokenNotFound)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `aphrodite_oauth2_token`").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		convey.So(store.DelToken(ctx, "k"), convey.ShouldBeNil)
+		convey.So(mock.ExpectationsWereMet(), convey.ShouldBeNil)
+	})
+}
@@ -0,0 +1,76 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	CACHE_KEY_REVOKED = "_aph_session:revoked:%s" // 吊销的jti
+	CACHE_KEY_REFRESH = "_aph_session:refresh:%s" // 可用的refresh token jti
+	CACHE_KEY_FAMILY  = "_aph_session:family:%s"  // 吊销的family
+)
+
+// ICache 在oauth2.ICache的基础上增加GetDelCtx
+type ICache interface {
+	SetCtx(context.Context, string, string, time.Duration) error
+	GetCtx(context.Context, string) (string, error)
+	DelCtx(context.Context, string) error
+	// GetDelCtx 读取并删除，必须原子执行，例如redis的GETDEL，并发刷新时仅一个请求能取到值
+	GetDelCtx(context.Context, string) (string, error)
+}
+
+type memoryItem struct {
+	value  string
+	expire time.Time
+}
+
+// memoryCache 单机缓存，支持过期，仅用于开发与测试
+type memoryCache struct {
+	m sync.Map
+}
+
+// NewMemoryCache 单机缓存，吊销与refresh状态不跨实例共享，仅用于开发与测试
+func NewMemoryCache() ICache {
+	return &memoryCache{}
+}
+
+func (c *memoryCache) SetCtx(ctx context.Context, key, value string, duration time.Duration) error {
+	item := memoryItem{value: value}
+	if duration > 0 {
+		item.expire = time.Now().Add(duration)
+	}
+	c.m.Store(key, item)
+	return nil
+}
+
+func (c *memoryCache) GetCtx(ctx context.Context, key string) (string, error) {
+	v, ok := c.m.Load(key)
+	if !ok {
+		return "", nil
+	}
+	item := v.(memoryItem)
+	if !item.expire.IsZero() && time.Now().After(item.expire) {
+		c.m.Delete(key)
+		return "", nil
+	}
+	return item.value, nil
+}
+
+func (c *memoryCache) DelCtx(ctx context.Context, key string) error {
+	c.m.Delete(key)
+	return nil
+}
+
+func (c *memoryCache) GetDelCtx(ctx context.Context, key string) (string, error) {
+	v, ok := c.m.LoadAndDelete(key)
+	if !ok {
+		return "", nil
+	}
+	item := v.(memoryItem)
+	if !item.expire.IsZero() && time.Now().After(item.expire) {
+		return "", nil
+	}
+	return item.value, nil
+}
@@ -0,0 +1,118 @@
+package session
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+const (
+	TOKEN_TYPE_ACCESS  = "access"
+	TOKEN_TYPE_REFRESH = "refresh"
+)
+
+// Claims 会话声明，即请求上下文中的当前用户
+type Claims struct {
+	Issuer    string         `json:"iss,omitempty"`
+	Subject   string         `json:"sub"`
+	Audience  string         `json:"aud,omitempty"`
+	ExpiresAt int64          `json:"exp"`
+	NotBefore int64          `json:"nbf,omitempty"`
+	IssuedAt  int64          `json:"iat"`
+	ID        string         `json:"jti"`
+	Type      string         `json:"typ"`           // access或refresh
+	Family    string         `json:"fam,omitempty"` // 同一次登录轮换出的token共用family，注销时整体吊销
+	BizId     int64          `json:"biz,omitempty"`
+	Name      string         `json:"name,omitempty"`
+	Extra     map[string]any `json:"ext,omitempty"` // 自定义声明
+}
+
+func (c *Claims) Expire() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// principal 仅保留用户相关声明，用于刷新时签发新token
+func (c *Claims) principal() *Claims {
+	return &Claims{
+		Subject: c.Subject,
+		Family:  c.Family,
+		BizId:   c.BizId,
+		Name:    c.Name,
+		Extra:   c.Extra,
+	}
+}
+
+type claimsKey struct{}
+
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ"`
+}
+
+func encode(signer ISigner, claims *Claims) (string, error) {
+	hb, err := json.Marshal(header{Alg: signer.Alg(), Kid: signer.Kid(), Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	pb, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(hb) + "." + base64.RawURLEncoding.EncodeToString(pb)
+	sig, err := signer.Sign([]byte(signed))
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// decode 按kid选择密钥验签，header中的alg须与密钥一致，避免算法混淆
+func decode(keys map[string]ISigner, raw string) (*Claims, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	hb, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	h := header{}
+	if err = json.Unmarshal(hb, &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+	key, ok := keys[h.Kid]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+	if key.Alg() != h.Alg {
+		return nil, ErrInvalidToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if err = key.Verify([]byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+	pb, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	claims := &Claims{}
+	if err = json.Unmarshal(pb, claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
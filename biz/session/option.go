@@ -0,0 +1,97 @@
+package session
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	DEFAULT_ACCESS_TTL  = 15 * time.Minute
+	DEFAULT_REFRESH_TTL = 7 * 24 * time.Hour
+	DEFAULT_LEEWAY      = 30 * time.Second
+)
+
+type Option func(*Options)
+
+type Options struct {
+	Signer       ISigner                                    // 当前签名密钥
+	Verifiers    []ISigner                                  // 轮换前的旧密钥，仅用于验签
+	Issuer       string                                     // iss，非空时校验
+	Audience     string                                     // aud，非空时校验
+	AccessTTL    time.Duration                              // access token有效期
+	RefreshTTL   time.Duration                              // refresh token有效期，为0则不签发
+	Leeway       time.Duration                              // 时钟偏差
+	Cache        ICache                                     // 吊销列表与refresh token状态
+	ClaimsHandle func(ctx context.Context, c *Claims) error // 签发前补充自定义声明
+}
+
+func newOptions(opts ...Option) *Options {
+	o := &Options{
+		AccessTTL:  DEFAULT_ACCESS_TTL,
+		RefreshTTL: DEFAULT_REFRESH_TTL,
+		Leeway:     DEFAULT_LEEWAY,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.AccessTTL <= 0 {
+		o.AccessTTL = DEFAULT_ACCESS_TTL
+	}
+	return o
+}
+
+func WithSigner(signer ISigner) Option {
+	return func(o *Options) {
+		o.Signer = signer
+	}
+}
+
+// WithVerifiers 密钥轮换时保留旧密钥验签，直至旧token全部过期
+func WithVerifiers(verifiers ...ISigner) Option {
+	return func(o *Options) {
+		o.Verifiers = append(o.Verifiers, verifiers...)
+	}
+}
+
+func WithIssuer(issuer string) Option {
+	return func(o *Options) {
+		o.Issuer = issuer
+	}
+}
+
+func WithAudience(audience string) Option {
+	return func(o *Options) {
+		o.Audience = audience
+	}
+}
+
+func WithAccessTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.AccessTTL = ttl
+	}
+}
+
+func WithRefreshTTL(ttl time.Duration) Option {
+	return func(o *Options) {
+		o.RefreshTTL = ttl
+	}
+}
+
+func WithLeeway(leeway time.Duration) Option {
+	return func(o *Options) {
+		o.Leeway = leeway
+	}
+}
+
+// WithCache 必填，多实例部署需使用共享存储，例如redisex.NewCache
+func WithCache(cache ICache) Option {
+	return func(o *Options) {
+		o.Cache = cache
+	}
+}
+
+func WithClaimsHandle(handle func(ctx context.Context, c *Claims) error) Option {
+	return func(o *Options) {
+		o.ClaimsHandle = handle
+	}
+}
@@ -0,0 +1,199 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrNoSigner       = errors.New("[session]no signer")
+	ErrNoCache        = errors.New("[session]no cache")
+	ErrInvalidToken   = errors.New("[session]invalid token")
+	ErrKeyNotFound    = errors.New("[session]signing key not found")
+	ErrTokenExpired   = errors.New("[session]token expired")
+	ErrTokenRevoked   = errors.New("[session]token revoked")
+	ErrTokenType      = errors.New("[session]unexpected token type")
+	ErrRefreshReused  = errors.New("[session]refresh token reused")
+	ErrRefreshDisable = errors.New("[session]refresh token disabled")
+)
+
+// TokenPair 签发结果
+type TokenPair struct {
+	AccessToken      string `json:"accessToken"`
+	RefreshToken     string `json:"refreshToken,omitempty"`
+	TokenType        string `json:"tokenType"`
+	ExpiresIn        int64  `json:"expiresIn"`
+	RefreshExpiresIn int64  `json:"refreshExpiresIn,omitempty"`
+}
+
+/*
+Manager 会话签发与校验
+
+	access token无状态校验，仅额外检查吊销列表；
+	refresh token每次刷新都会轮换，旧token立即失效，
+	已失效的refresh token再次使用视为泄露，吊销整个family。
+*/
+type Manager struct {
+	opts *Options
+	keys map[string]ISigner
+}
+
+func NewManager(opts ...Option) (*Manager, error) {
+	o := newOptions(opts...)
+	if o.Signer == nil {
+		return nil, ErrNoSigner
+	}
+	if o.Cache == nil {
+		return nil, ErrNoCache
+	}
+	keys := map[string]ISigner{}
+	for _, v := range o.Verifiers {
+		keys[v.Kid()] = v
+	}
+	keys[o.Signer.Kid()] = o.Signer
+	return &Manager{opts: o, keys: keys}, nil
+}
+
+// Issue 为principal签发新会话，principal中的Subject、BizId、Name、Extra写入token
+func (m *Manager) Issue(ctx context.Context, principal *Claims) (*TokenPair, error) {
+	p := principal.principal()
+	p.Family = uuid.NewString()
+	return m.issue(ctx, p)
+}
+
+func (m *Manager) issue(ctx context.Context, p *Claims) (*TokenPair, error) {
+	now := time.Now()
+	access := m.claims(p, now, TOKEN_TYPE_ACCESS, m.opts.AccessTTL)
+	if m.opts.ClaimsHandle != nil {
+		if err := m.opts.ClaimsHandle(ctx, access); err != nil {
+			return nil, err
+		}
+	}
+	raw, err := encode(m.opts.Signer, access)
+	if err != nil {
+		return nil, err
+	}
+	pair := &TokenPair{
+		AccessToken: raw,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(m.opts.AccessTTL.Seconds()),
+	}
+	if m.opts.RefreshTTL <= 0 {
+		return pair, nil
+	}
+	refresh := m.claims(access.principal(), now, TOKEN_TYPE_REFRESH, m.opts.RefreshTTL)
+	if pair.RefreshToken, err = encode(m.opts.Signer, refresh); err != nil {
+		return nil, err
+	}
+	if err = m.opts.Cache.SetCtx(ctx, fmt.Sprintf(CACHE_KEY_REFRESH, refresh.ID), refresh.Family, m.opts.RefreshTTL); err != nil {
+		return nil, err
+	}
+	pair.RefreshExpiresIn = int64(m.opts.RefreshTTL.Seconds())
+	return pair, nil
+}
+
+func (m *Manager) claims(p *Claims, now time.Time, typ string, ttl time.Duration) *Claims {
+	c := p.principal()
+	c.Issuer = m.opts.Issuer
+	c.Audience = m.opts.Audience
+	c.IssuedAt = now.Unix()
+	c.ExpiresAt = now.Add(ttl).Unix()
+	c.ID = uuid.NewString()
+	c.Type = typ
+	return c
+}
+
+// Verify 校验access token
+func (m *Manager) Verify(ctx context.Context, raw string) (*Claims, error) {
+	claims, err := m.parse(ctx, raw, TOKEN_TYPE_ACCESS)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := m.opts.Cache.GetCtx(ctx, fmt.Sprintf(CACHE_KEY_REVOKED, claims.ID))
+	if err != nil {
+		return nil, err
+	}
+	if revoked != "" {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// Refresh 使用refresh token换取新的token对，旧refresh token失效
+func (m *Manager) Refresh(ctx context.Context, raw string) (*TokenPair, error) {
+	if m.opts.RefreshTTL <= 0 {
+		return nil, ErrRefreshDisable
+	}
+	claims, err := m.parse(ctx, raw, TOKEN_TYPE_REFRESH)
+	if err != nil {
+		return nil, err
+	}
+	// 原子消费jti，并发刷新时仅一个请求成功
+	family, err := m.opts.Cache.GetDelCtx(ctx, fmt.Sprintf(CACHE_KEY_REFRESH, claims.ID))
+	if err != nil {
+		return nil, err
+	}
+	if family == "" || family != claims.Family {
+		// 已轮换过或已被消费的refresh token被再次使用
+		if err = m.revokeFamily(ctx, claims.Family); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshReused
+	}
+	return m.issue(ctx, claims.principal())
+}
+
+// Revoke 吊销access token，同时吊销同一family的refresh token，用于注销
+func (m *Manager) Revoke(ctx context.Context, claims *Claims) error {
+	ttl := time.Until(claims.Expire()) + m.opts.Leeway
+	if ttl > 0 {
+		if err := m.opts.Cache.SetCtx(ctx, fmt.Sprintf(CACHE_KEY_REVOKED, claims.ID), "1", ttl); err != nil {
+			return err
+		}
+	}
+	return m.revokeFamily(ctx, claims.Family)
+}
+
+func (m *Manager) revokeFamily(ctx context.Context, family string) error {
+	if family == "" || m.opts.RefreshTTL <= 0 {
+		return nil
+	}
+	return m.opts.Cache.SetCtx(ctx, fmt.Sprintf(CACHE_KEY_FAMILY, family), "1", m.opts.RefreshTTL)
+}
+
+func (m *Manager) parse(ctx context.Context, raw, typ string) (*Claims, error) {
+	claims, err := decode(m.keys, raw)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Type != typ {
+		return nil, ErrTokenType
+	}
+	now := time.Now()
+	if claims.ExpiresAt == 0 || now.After(claims.Expire().Add(m.opts.Leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if claims.NotBefore > 0 && now.Add(m.opts.Leeway).Before(time.Unix(claims.NotBefore, 0)) {
+		return nil, ErrInvalidToken
+	}
+	if m.opts.Issuer != "" && claims.Issuer != m.opts.Issuer {
+		return nil, ErrInvalidToken
+	}
+	if m.opts.Audience != "" && claims.Audience != m.opts.Audience {
+		return nil, ErrInvalidToken
+	}
+	if claims.Family != "" {
+		revoked, err := m.opts.Cache.GetCtx(ctx, fmt.Sprintf(CACHE_KEY_FAMILY, claims.Family))
+		if err != nil {
+			return nil, err
+		}
+		if revoked != "" {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return claims, nil
+}
@@ -0,0 +1,158 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+func TestSigner(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	sm2Key, _ := sm2.GenerateKey(rand.Reader)
+	convey.Convey("TestSigner", t, func() {
+		for _, signer := range []ISigner{
+			NewHS256Signer("h", []byte("secret")),
+			NewRS256Signer("r", rsaKey),
+			NewSM2Signer("s", sm2Key),
+		} {
+			sig, err := signer.Sign([]byte("payload"))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(signer.Verify([]byte("payload"), sig), convey.ShouldBeNil)
+			convey.So(signer.Verify([]byte("payload2"), sig), convey.ShouldEqual, ErrInvalidSignature)
+		}
+		_, err := NewSM2Verifier("s", &sm2Key.PublicKey).Sign([]byte("payload"))
+		convey.So(err, convey.ShouldEqual, ErrVerifyOnly)
+	})
+}
+
+func TestManager(t *testing.T) {
+	ctx := context.Background()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	convey.Convey("TestManager", t, func() {
+		_, err := NewManager()
+		convey.So(err, convey.ShouldEqual, ErrNoSigner)
+		_, err = NewManager(WithSigner(NewRS256Signer("k1", rsaKey)))
+		convey.So(err, convey.ShouldEqual, ErrNoCache)
+
+		m, err := NewManager(
+			WithSigner(NewRS256Signer("k1", rsaKey)),
+			WithCache(NewMemoryCache()),
+			WithIssuer("aph"),
+			WithClaimsHandle(func(ctx context.Context, c *Claims) error {
+				c.Extra = map[string]any{"role": "admin"}
+				return nil
+			}),
+		)
+		convey.So(err, convey.ShouldBeNil)
+		pair, err := m.Issue(ctx, &Claims{Subject: "u1", BizId: 7, Name: "n"})
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.Convey("verify", func() {
+			claims, err := m.Verify(ctx, pair.AccessToken)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(claims.Subject, convey.ShouldEqual, "u1")
+			convey.So(claims.BizId, convey.ShouldEqual, 7)
+			convey.So(claims.Issuer, convey.ShouldEqual, "aph")
+			convey.So(claims.Extra["role"], convey.ShouldEqual, "admin")
+
+			_, err = m.Verify(ctx, pair.RefreshToken)
+			convey.So(err, convey.ShouldEqual, ErrTokenType)
+			_, err = m.Verify(ctx, pair.AccessToken[:len(pair.AccessToken)-4]+"AAAA")
+			convey.So(err, convey.ShouldEqual, ErrInvalidSignature)
+
+			// 相同kid但算法不同的token
+			forged, _ := encode(NewHS256Signer("k1", []byte("k1")), claims)
+			_, err = m.Verify(ctx, forged)
+			convey.So(err, convey.ShouldEqual, ErrInvalidToken)
+
+			other, _ := NewManager(WithSigner(NewRS256Signer("k1", rsaKey)), WithIssuer("other"), WithCache(NewMemoryCache()))
+			_, err = other.Verify(ctx, pair.AccessToken)
+			convey.So(err, convey.ShouldEqual, ErrInvalidToken)
+		})
+
+		convey.Convey("expired", func() {
+			short, _ := NewManager(WithSigner(NewHS256Signer("h", []byte("s"))), WithCache(NewMemoryCache()), WithAccessTTL(time.Second), WithLeeway(-time.Second))
+			p, _ := short.Issue(ctx, &Claims{Subject: "u1"})
+			time.Sleep(1100 * time.Millisecond)
+			_, err := short.Verify(ctx, p.AccessToken)
+			convey.So(err, convey.ShouldEqual, ErrTokenExpired)
+		})
+
+		convey.Convey("rotation", func() {
+			rotated, _ := NewManager(
+				WithSigner(NewHS256Signer("k2", []byte("new"))),
+				WithVerifiers(NewRS256Verifier("k1", &rsaKey.PublicKey)),
+				WithCache(NewMemoryCache()),
+				WithIssuer("aph"),
+			)
+			_, err := rotated.Verify(ctx, pair.AccessToken)
+			convey.So(err, convey.ShouldBeNil)
+			p, _ := rotated.Issue(ctx, &Claims{Subject: "u2"})
+			convey.So(strings.Count(p.AccessToken, "."), convey.ShouldEqual, 2)
+			_, err = m.Verify(ctx, p.AccessToken)
+			convey.So(err, convey.ShouldEqual, ErrKeyNotFound)
+		})
+
+		convey.Convey("refresh", func() {
+			next, err := m.Refresh(ctx, pair.RefreshToken)
+			convey.So(err, convey.ShouldBeNil)
+			claims, err := m.Verify(ctx, next.AccessToken)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(claims.Subject, convey.ShouldEqual, "u1")
+			convey.So(claims.Extra["role"], convey.ShouldEqual, "admin")
+
+			// 旧refresh token再次使用，整个family被吊销
+			_, err = m.Refresh(ctx, pair.RefreshToken)
+			convey.So(err, convey.ShouldEqual, ErrRefreshReused)
+			_, err = m.Refresh(ctx, next.RefreshToken)
+			convey.So(err, convey.ShouldEqual, ErrTokenRevoked)
+			_, err = m.Verify(ctx, next.AccessToken)
+			convey.So(err, convey.ShouldEqual, ErrTokenRevoked)
+		})
+
+		convey.Convey("concurrent refresh", func() {
+			var (
+				wg      sync.WaitGroup
+				success atomic.Int32
+				reused  atomic.Int32
+			)
+			for i := 0; i < 16; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := m.Refresh(ctx, pair.RefreshToken)
+					switch err {
+					case nil:
+						success.Add(1)
+					case ErrRefreshReused, ErrTokenRevoked:
+						reused.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			convey.So(success.Load(), convey.ShouldEqual, 1)
+			convey.So(reused.Load(), convey.ShouldEqual, 15)
+		})
+
+		convey.Convey("revoke", func() {
+			claims, _ := m.Verify(ctx, pair.AccessToken)
+			convey.So(m.Revoke(ctx, claims), convey.ShouldBeNil)
+			_, err := m.Verify(ctx, pair.AccessToken)
+			convey.So(err, convey.ShouldEqual, ErrTokenRevoked)
+			_, err = m.Refresh(ctx, pair.RefreshToken)
+			convey.So(err, convey.ShouldEqual, ErrTokenRevoked)
+
+			other, _ := m.Issue(ctx, &Claims{Subject: "u1"})
+			_, err = m.Verify(ctx, other.AccessToken)
+			convey.So(err, convey.ShouldBeNil)
+		})
+	})
+}
@@ -0,0 +1,142 @@
+package session
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+
+	"github.com/tjfoc/gmsm/sm2"
+)
+
+const (
+	ALG_HS256 = "HS256"
+	ALG_RS256 = "RS256"
+	ALG_SM2   = "SM2" // SM2withSM3，签名值为r||s各32字节
+)
+
+var (
+	ErrVerifyOnly       = errors.New("[session]signer is verify only")
+	ErrInvalidSignature = errors.New("[session]invalid signature")
+)
+
+// ISigner jwt签名器，kid用于密钥轮换时选择验签密钥
+type ISigner interface {
+	Alg() string
+	Kid() string
+	Sign(signed []byte) ([]byte, error)
+	Verify(signed, sig []byte) error
+}
+
+var (
+	_ = ISigner(&hmacSigner{})
+	_ = ISigner(&rsaSigner{})
+	_ = ISigner(&sm2Signer{})
+)
+
+type hmacSigner struct {
+	kid    string
+	secret []byte
+}
+
+// NewHS256Signer 对称签名，签发方与验证方共享secret
+func NewHS256Signer(kid string, secret []byte) ISigner {
+	return &hmacSigner{kid: kid, secret: secret}
+}
+
+func (s *hmacSigner) Alg() string { return ALG_HS256 }
+func (s *hmacSigner) Kid() string { return s.kid }
+
+func (s *hmacSigner) Sign(signed []byte) ([]byte, error) {
+	h := hmac.New(sha256.New, s.secret)
+	_, _ = h.Write(signed)
+	return h.Sum(nil), nil
+}
+
+func (s *hmacSigner) Verify(signed, sig []byte) error {
+	expect, _ := s.Sign(signed)
+	if !hmac.Equal(expect, sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type rsaSigner struct {
+	kid  string
+	priv *rsa.PrivateKey
+	pub  *rsa.PublicKey
+}
+
+// NewRS256Signer 私钥签名
+func NewRS256Signer(kid string, priv *rsa.PrivateKey) ISigner {
+	return &rsaSigner{kid: kid, priv: priv, pub: &priv.PublicKey}
+}
+
+// NewRS256Verifier 仅验签，用于轮换后的旧密钥或其他服务
+func NewRS256Verifier(kid string, pub *rsa.PublicKey) ISigner {
+	return &rsaSigner{kid: kid, pub: pub}
+}
+
+func (s *rsaSigner) Alg() string { return ALG_RS256 }
+func (s *rsaSigner) Kid() string { return s.kid }
+
+func (s *rsaSigner) Sign(signed []byte) ([]byte, error) {
+	if s.priv == nil {
+		return nil, ErrVerifyOnly
+	}
+	digest := sha256.Sum256(signed)
+	return rsa.SignPKCS1v15(rand.Reader, s.priv, crypto.SHA256, digest[:])
+}
+
+func (s *rsaSigner) Verify(signed, sig []byte) error {
+	digest := sha256.Sum256(signed)
+	if err := rsa.VerifyPKCS1v15(s.pub, crypto.SHA256, digest[:], sig); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type sm2Signer struct {
+	kid  string
+	priv *sm2.PrivateKey
+	pub  *sm2.PublicKey
+}
+
+// NewSM2Signer 国密签名，使用默认uid
+func NewSM2Signer(kid string, priv *sm2.PrivateKey) ISigner {
+	return &sm2Signer{kid: kid, priv: priv, pub: &priv.PublicKey}
+}
+
+// NewSM2Verifier 仅验签
+func NewSM2Verifier(kid string, pub *sm2.PublicKey) ISigner {
+	return &sm2Signer{kid: kid, pub: pub}
+}
+
+func (s *sm2Signer) Alg() string { return ALG_SM2 }
+func (s *sm2Signer) Kid() string { return s.kid }
+
+func (s *sm2Signer) Sign(signed []byte) ([]byte, error) {
+	if s.priv == nil {
+		return nil, ErrVerifyOnly
+	}
+	r, ss, err := sm2.Sm2Sign(s.priv, signed, nil, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return append(r.FillBytes(make([]byte, 32)), ss.FillBytes(make([]byte, 32))...), nil
+}
+
+func (s *sm2Signer) Verify(signed, sig []byte) error {
+	if len(sig) != 64 {
+		return ErrInvalidSignature
+	}
+	r := new(big.Int).SetBytes(sig[:32])
+	ss := new(big.Int).SetBytes(sig[32:])
+	if !sm2.Sm2Verify(s.pub, signed, nil, r, ss) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package elasticex
+
+import (
+	"errors"
+
+	"github.com/olivere/elastic/v7"
+)
+
+/*
+Aggs typed aggregation builder of T, fields are struct field names of T and resolved to es names by json tag.
+
+	a := elasticex.NewAggs[Article]()
+	a.Add("by_day", a.DateHistogram("CreateAt").CalendarInterval("day").
+		SubAggregation("authors", a.Cardinality("Author.Name")).
+		SubAggregation("likes", a.Percentiles("Likes").Percentiles(50, 99)))
+	aggs, err := repo.BaseAggregate(ctx, a, q.Option())
+	days, err := elasticex.DecodeBuckets[DayStat](aggs, "by_day")
+
+Unknown fields are collected and returned by Err, so the search fails before sending the request.
+*/
+type Aggs[T any] struct {
+	names []string
+	aggs  map[string]elastic.Aggregation
+	errs  []error
+}
+
+func NewAggs[T any]() *Aggs[T] {
+	return &Aggs[T]{aggs: map[string]elastic.Aggregation{}}
+}
+
+// Add add a top level aggregation, the same name is replaced
+func (a *Aggs[T]) Add(name string, agg elastic.Aggregation) *Aggs[T] {
+	if _, ok := a.aggs[name]; !ok {
+		a.names = append(a.names, name)
+	}
+	a.aggs[name] = agg
+	return a
+}
+
+// Err errors of unknown fields
+func (a *Aggs[T]) Err() error {
+	return errors.Join(a.errs...)
+}
+
+// Names names of top level aggregations in order
+func (a *Aggs[T]) Names() []string {
+	return a.names
+}
+
+// Get the top level aggregation of name
+func (a *Aggs[T]) Get(name string) elastic.Aggregation {
+	return a.aggs[name]
+}
+
+// Source sources of all top level aggregations
+func (a *Aggs[T]) Source() (map[string]any, error) {
+	if err := a.Err(); err != nil {
+		return nil, err
+	}
+	res := map[string]any{}
+	for _, name := range a.names {
+		src, err := a.aggs[name].Source()
+		if err != nil {
+			return nil, err
+		}
+		res[name] = src
+	}
+	return res, nil
+}
+
+// Apply add all aggregations to the search service
+func (a *Aggs[T]) Apply(srv *elastic.SearchService) *elastic.SearchService {
+	for _, name := range a.names {
+		srv = srv.Aggregation(name, a.aggs[name])
+	}
+	return srv
+}
+
+func (a *Aggs[T]) field(path string) string {
+	name, err := FieldName[T](path)
+	if err != nil {
+		a.errs = append(a.errs, err)
+	}
+	return name
+}
+
+func (a *Aggs[T]) Terms(field string) *elastic.TermsAggregation {
+	return elastic.NewTermsAggregation().Field(a.field(field))
+}
+
+func (a *Aggs[T]) DateHistogram(field string) *elastic.DateHistogramAggregation {
+	return elastic.NewDateHistogramAggregation().Field(a.field(field))
+}
+
+func (a *Aggs[T]) Histogram(field string, interval float64) *elastic.HistogramAggregation {
+	return elastic.NewHistogramAggregation().Field(a.field(field)).Interval(interval)
+}
+
+func (a *Aggs[T]) Range(field string) *elastic.RangeAggregation {
+	return elastic.NewRangeAggregation().Field(a.field(field))
+}
+
+func (a *Aggs[T]) Filter(query elastic.Query) *elastic.FilterAggregation {
+	return elastic.NewFilterAggregation().Filter(query)
+}
+
+// Nested aggregation of nested field, fields of sub aggregations are full paths, such as "Comments.Author"
+func (a *Aggs[T]) Nested(path string) *elastic.NestedAggregation {
+	return elastic.NewNestedAggregation().Path(a.field(path))
+}
+
+// ReverseNested join back to the root document in a nested aggregation
+func (a *Aggs[T]) ReverseNested() *elastic.ReverseNestedAggregation {
+	return elastic.NewReverseNestedAggregation()
+}
+
+func (a *Aggs[T]) Cardinality(field string) *elastic.CardinalityAggregation {
+	return elastic.NewCardinalityAggregation().Field(a.field(field))
+}
+
+func (a *Aggs[T]) Percentiles(field string) *elastic.PercentilesAggregation {
+	return elastic.NewPercentilesAggregation().Field(a.field(field))
+}
+
+func (a *Aggs[T]) Sum(field string) *elastic.SumAggregation {
+	return elastic.NewSumAggregation().Field(a.field(field))
+}
+
+func (a *Aggs[T]) Avg(field string) *elastic.AvgAggregation {
+	return elastic.NewAvgAggregation().Field(a.field(field))
+}
+
+func (a *Aggs[T]) Min(field string) *elastic.MinAggregation {
+	return elastic.NewMinAggregation().Field(a.field(field))
+}
+
+func (a *Aggs[T]) Max(field string) *elastic.MaxAggregation {
+	return elastic.NewMaxAggregation().Field(a.field(field))
+}
+
+func (a *Aggs[T]) ValueCount(field string) *elastic.ValueCountAggregation {
+	return elastic.NewValueCountAggregation().Field(a.field(field))
+}
+
+// Composite paging all buckets by after key, see BaseRepository.BaseComposite
+func (a *Aggs[T]) Composite(sources ...elastic.CompositeAggregationValuesSource) *elastic.CompositeAggregation {
+	return elastic.NewCompositeAggregation().Sources(sources...)
+}
+
+// TermsSource terms values source of composite aggregation, name is the key in the bucket key
+func (a *Aggs[T]) TermsSource(name string, field string) *elastic.CompositeAggregationTermsValuesSource {
+	return elastic.NewCompositeAggregationTermsValuesSource(name).Field(a.field(field))
+}
+
+// DateHistogramSource date histogram values source of composite aggregation
+func (a *Aggs[T]) DateHistogramSource(name string, field string) *elastic.CompositeAggregationDateHistogramValuesSource {
+	return elastic.NewCompositeAggregationDateHistogramValuesSource(name).Field(a.field(field))
+}
+
+// HistogramSource histogram values source of composite aggregation
+func (a *Aggs[T]) HistogramSource(name string, field string, interval float64) *elastic.CompositeAggregationHistogramValuesSource {
+	return elastic.NewCompositeAggregationHistogramValuesSource(name, interval).Field(a.field(field))
+}
@@ -0,0 +1,155 @@
+package elasticex
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/olivere/elastic/v7"
+)
+
+var (
+	ErrAggNotFound = errors.New("aggregation not found")
+	ErrNotBuckets  = errors.New("aggregation has no buckets")
+)
+
+// bucketProps properties of the bucket itself, others are sub aggregations
+var bucketProps = map[string]struct{}{
+	"key":            {},
+	"key_as_string":  {},
+	"doc_count":      {},
+	"from":           {},
+	"from_as_string": {},
+	"to":             {},
+	"to_as_string":   {},
+}
+
+/*
+FlattenAgg flatten the result of the aggregation of name, so it could be decoded into go structs or maps.
+
+	bucket aggregation                => []bucket, keyed buckets => map[key]bucket
+	bucket                            => {"key":..., "key_as_string":..., "doc_count":..., "{sub}": flattened sub aggregation}
+	single bucket (nested, filter)    => bucket
+	single value metric (cardinality) => value
+	percentiles                       => {"50.0": value}
+	multi value metric (stats)        => the origin object
+*/
+func FlattenAgg(aggs elastic.Aggregations, name string) (any, error) {
+	raw, ok := aggs[name]
+	if !ok || raw == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAggNotFound, name)
+	}
+	v := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return flattenAgg(v), nil
+}
+
+// DecodeAgg decode the flattened result of the aggregation of name into R, see FlattenAgg
+func DecodeAgg[R any](aggs elastic.Aggregations, name string) (R, error) {
+	var r R
+	v, err := FlattenAgg(aggs, name)
+	if err != nil {
+		return r, err
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return r, err
+	}
+	err = json.Unmarshal(bs, &r)
+	return r, err
+}
+
+/*
+DecodeBuckets decode the buckets of the aggregation of name into B, B is a struct or map[string]any.
+
+	type DayStat struct {
+		Day     int64   `json:"key"`
+		Count   int64   `json:"doc_count"`
+		Authors int64   `json:"authors"` // cardinality sub aggregation
+		Tags    []struct {
+			Tag   string `json:"key"`
+			Count int64  `json:"doc_count"`
+		} `json:"tags"` // terms sub aggregation
+	}
+*/
+func DecodeBuckets[B any](aggs elastic.Aggregations, name string) ([]B, error) {
+	v, err := FlattenAgg(aggs, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := v.([]any); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotBuckets, name)
+	}
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	res := []B{}
+	err = json.Unmarshal(bs, &res)
+	return res, err
+}
+
+func flattenAgg(v map[string]any) any {
+	if buckets, ok := v["buckets"]; ok {
+		switch bs := buckets.(type) {
+		case []any:
+			res := make([]any, 0, len(bs))
+			for _, b := range bs {
+				res = append(res, flattenBucket(b))
+			}
+			return res
+		case map[string]any:
+			res := map[string]any{}
+			for k, b := range bs {
+				res[k] = flattenBucket(b)
+			}
+			return res
+		}
+	}
+	if values, ok := v["values"]; ok {
+		// keyed is false: [{"key":50.0,"value":1}]
+		if vs, ok := values.([]any); ok {
+			res := map[string]any{}
+			for _, item := range vs {
+				if m, ok := item.(map[string]any); ok {
+					res[fmt.Sprint(m["key"])] = m["value"]
+				}
+			}
+			return res
+		}
+		return values
+	}
+	if _, ok := v["doc_count"]; ok {
+		return flattenBucket(v)
+	}
+	if value, ok := v["value"]; ok {
+		return value
+	}
+	delete(v, "meta")
+	return v
+}
+
+func flattenBucket(b any) any {
+	m, ok := b.(map[string]any)
+	if !ok {
+		return b
+	}
+	res := map[string]any{}
+	for k, v := range m {
+		if _, ok := bucketProps[k]; ok {
+			res[k] = v
+			continue
+		}
+		if sub, ok := v.(map[string]any); ok {
+			res[k] = flattenAgg(sub)
+			continue
+		}
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,153 @@
+package elasticex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/olivere/elastic/v7"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type dslDayStat struct {
+	Day     int64              `json:"key"`
+	Date    string             `json:"key_as_string"`
+	Count   int64              `json:"doc_count"`
+	Authors int64              `json:"authors"`
+	Likes   map[string]float64 `json:"likes"`
+	Tags    []struct {
+		Tag   string `json:"key"`
+		Count int64  `json:"doc_count"`
+	} `json:"tags"`
+}
+
+// aggSource wrap aggs as elastic.Query to compare with golden file
+type aggSource map[string]any
+
+func (s aggSource) Source() (interface{}, error) {
+	return map[string]any(s), nil
+}
+
+func TestAggsGolden(t *testing.T) {
+	a := NewAggs[dslArticle]()
+	a.Add("by_day", a.DateHistogram("CreateAt").CalendarInterval("day").
+		SubAggregation("authors", a.Cardinality("Author.Author")).
+		SubAggregation("likes", a.Percentiles("Likes").Percentiles(50, 99)).
+		SubAggregation("tags", a.Terms("Tags").Size(5)))
+	a.Add("comments", a.Nested("Comments").
+		SubAggregation("by_author", a.Terms("Comments.Author").
+			SubAggregation("articles", a.ReverseNested())))
+	a.Add("by_author", a.Composite(a.TermsSource("author", "Author.Author"), a.HistogramSource("likes", "Likes", 10)).Size(2))
+	src, err := a.Source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertGolden(t, "agg_source", aggSource(src))
+}
+
+func TestAggsErr(t *testing.T) {
+	convey.Convey("TestAggsErr", t, func() {
+		a := NewAggs[dslArticle]()
+		a.Add("x", a.Sum("Missing"))
+		_, err := a.Source()
+		convey.So(errors.Is(err, ErrFieldNotFound), convey.ShouldBeTrue)
+
+		b := NewAggs[testStructShardingPo]()
+		b.Add("x", b.Max("Missing"))
+		_, err = (&BaseRepository[testStructShardingPo]{}).BaseAggregate(context.Background(), b)
+		convey.So(errors.Is(err, ErrFieldNotFound), convey.ShouldBeTrue)
+	})
+}
+
+func TestDecodeAgg(t *testing.T) {
+	convey.Convey("TestDecodeAgg", t, func() {
+		bs, err := os.ReadFile("testdata/agg_response.json")
+		convey.So(err, convey.ShouldBeNil)
+		aggs := elastic.Aggregations{}
+		convey.So(json.Unmarshal(bs, &aggs), convey.ShouldBeNil)
+
+		days, err := DecodeBuckets[dslDayStat](aggs, "by_day")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(len(days), convey.ShouldEqual, 2)
+		convey.So(days[0].Day, convey.ShouldEqual, 1704067200000)
+		convey.So(days[0].Date, convey.ShouldEqual, "2024-01-01")
+		convey.So(days[0].Count, convey.ShouldEqual, 3)
+		convey.So(days[0].Authors, convey.ShouldEqual, 2)
+		convey.So(days[0].Likes["99.0"], convey.ShouldEqual, 20)
+		convey.So(len(days[0].Tags), convey.ShouldEqual, 2)
+		convey.So(days[0].Tags[1].Tag, convey.ShouldEqual, "es")
+		convey.So(len(days[1].Tags), convey.ShouldEqual, 0)
+
+		rows, err := DecodeBuckets[map[string]any](aggs, "by_day")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(rows[1]["authors"], convey.ShouldEqual, 1)
+
+		comments, err := DecodeAgg[struct {
+			Count    int64 `json:"doc_count"`
+			ByAuthor []struct {
+				Author   string         `json:"key"`
+				Articles map[string]int `json:"articles"`
+			} `json:"by_author"`
+		}](aggs, "comments")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(comments.Count, convey.ShouldEqual, 5)
+		convey.So(comments.ByAuthor[0].Author, convey.ShouldEqual, "bob")
+		convey.So(comments.ByAuthor[0].Articles["doc_count"], convey.ShouldEqual, 2)
+
+		total, err := DecodeAgg[float64](aggs, "total_likes")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(total, convey.ShouldEqual, 36)
+		percentiles, err := DecodeAgg[map[string]float64](aggs, "likes_percentiles")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(percentiles["50.0"], convey.ShouldEqual, 3)
+
+		_, err = DecodeBuckets[dslDayStat](aggs, "total_likes")
+		convey.So(errors.Is(err, ErrNotBuckets), convey.ShouldBeTrue)
+		_, err = DecodeAgg[float64](aggs, "missing")
+		convey.So(errors.Is(err, ErrAggNotFound), convey.ShouldBeTrue)
+	})
+}
+
+func TestBaseComposite(t *testing.T) {
+	mockESX(func() {
+		convey.Convey("TestBaseComposite", t, func() {
+			ctx := context.Background()
+			a := NewAggs[testStructShardingPo]()
+			agg := a.Composite(a.TermsSource("code", "Code")).Size(2)
+			a.Add("by_code", agg)
+			pages := []string{
+				`{"by_code":{"after_key":{"code":"b"},"buckets":[{"key":{"code":"a"},"doc_count":1},{"key":{"code":"b"},"doc_count":2}]}}`,
+				`{"by_code":{"after_key":{"code":"c"},"buckets":[{"key":{"code":"c"},"doc_count":3}]}}`,
+				`{"by_code":{"buckets":[]}}`,
+			}
+			afters := []any{}
+			call := 0
+			patch := gomonkey.ApplyMethodFunc(reflect.TypeOf(&elastic.SearchService{}), "Do", func(ctx context.Context) (*elastic.SearchResult, error) {
+				src, _ := agg.Source()
+				afters = append(afters, src.(map[string]any)["composite"].(map[string]any)["after"])
+				aggs := elastic.Aggregations{}
+				err := json.Unmarshal([]byte(pages[call]), &aggs)
+				call++
+				return &elastic.SearchResult{Aggregations: aggs}, err
+			})
+			defer patch.Reset()
+
+			rows, err := CompositeAll[struct {
+				Key   map[string]string `json:"key"`
+				Count int64             `json:"doc_count"`
+			}](ctx, &BaseRepository[testStructShardingPo]{}, a, "by_code")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(rows), convey.ShouldEqual, 3)
+			convey.So(rows[2].Key["code"], convey.ShouldEqual, "c")
+			convey.So(rows[2].Count, convey.ShouldEqual, 3)
+			convey.So(afters, convey.ShouldResemble, []any{nil, map[string]any{"code": "b"}, map[string]any{"code": "c"}})
+
+			err = (&BaseRepository[testStructShardingPo]{}).BaseComposite(ctx, a, "missing", nil)
+			convey.So(errors.Is(err, ErrNotComposite), convey.ShouldBeTrue)
+		})
+	})
+}
@@ -32,16 +32,25 @@ func CoreFrmCtx(ctx context.Context, id string) *elastic.Client {
 	return WithContext(ctx, id)
 }
 
+// WithQuery conds are placed in filter, except the typed Query which is placed in must to keep the score
 func WithQuery(conds ...any) elastic.Query {
 	qs := []elastic.Query{}
+	scoreds := []elastic.Query{}
 	if len(conds) > 0 {
 		for _, cond := range conds {
+			if v, ok := cond.(scoredQuery); ok {
+				scoreds = append(scoreds, v)
+				continue
+			}
 			if v, ok := cond.(elastic.Query); ok {
 				qs = append(qs, v)
 			}
 		}
 	}
-	return elastic.NewBoolQuery().Filter(qs...)
+	if len(scoreds) == 1 && len(qs) == 0 {
+		return scoreds[0]
+	}
+	return elastic.NewBoolQuery().Must(scoreds...).Filter(qs...)
 }
 
 func WithSort(sorts ...dependency.ISortField) []elastic.Sorter {
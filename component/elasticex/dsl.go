@@ -0,0 +1,240 @@
+package elasticex
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/olivere/elastic/v7"
+)
+
+var _ = elastic.Query(&Query[dependency.EmptyPo]{})
+
+// scoredQuery query should be placed in must instead of filter, so the score is kept
+type scoredQuery interface {
+	elastic.Query
+	scored()
+}
+
+/*
+Query typed query builder of T, fields are struct field names of T and resolved to es names by json tag.
+
+	q := elasticex.NewQuery[Article]()
+	q.Must(q.Match("Title", "golang").Boost(2)).
+		Should(q.Term("Tags", "go"), q.Term("Tags", "es")).MinimumShouldMatch("1").
+		Filter(q.Range("CreateAt").Gte(begin), q.Exists("Author")).
+		MustNot(q.Nested("Comments", q.Wildcard("Comments.Author", "spam*"))).
+		FunctionScore(q.FieldValueFactor("Likes").Modifier("log1p"))
+	repo.BaseQuery(ctx, q.Option())
+
+Unknown fields are collected and returned by Source, so the search fails before sending the request.
+*/
+type Query[T any] struct {
+	bq        *elastic.BoolQuery
+	fsq       *elastic.FunctionScoreQuery
+	hasFunc   bool
+	errs      []error
+	subs      []*Query[T]
+	hasClause bool
+}
+
+func NewQuery[T any]() *Query[T] {
+	return &Query[T]{bq: elastic.NewBoolQuery()}
+}
+
+func (q *Query[T]) scored() {}
+
+func (q *Query[T]) field(path string) string {
+	name, err := FieldName[T](path)
+	if err != nil {
+		q.errs = append(q.errs, err)
+	}
+	return name
+}
+
+// Err errors of unknown fields
+func (q *Query[T]) Err() error {
+	errs := append([]error{}, q.errs...)
+	for _, sub := range q.subs {
+		errs = append(errs, sub.Err())
+	}
+	return errors.Join(errs...)
+}
+
+// Option plug into dependency.BaseOption, appended to the conds so other conds are kept
+func (q *Query[T]) Option() dependency.BaseOptionFunc {
+	return func(o *dependency.BaseOption) {
+		o.Conds = append(o.Conds, q)
+	}
+}
+
+// Source implements elastic.Query
+func (q *Query[T]) Source() (interface{}, error) {
+	if err := q.Err(); err != nil {
+		return nil, err
+	}
+	if q.hasFunc {
+		return q.fsq.Query(q.bq).Source()
+	}
+	return q.bq.Source()
+}
+
+// IsEmpty no clause is added
+func (q *Query[T]) IsEmpty() bool {
+	return !q.hasClause
+}
+
+func (q *Query[T]) clauses(qs []elastic.Query) []elastic.Query {
+	res := make([]elastic.Query, 0, len(qs))
+	for _, v := range qs {
+		if v != nil {
+			res = append(res, v)
+		}
+	}
+	if len(res) > 0 {
+		q.hasClause = true
+	}
+	return res
+}
+
+func (q *Query[T]) Must(qs ...elastic.Query) *Query[T] {
+	q.bq.Must(q.clauses(qs)...)
+	return q
+}
+
+func (q *Query[T]) Should(qs ...elastic.Query) *Query[T] {
+	q.bq.Should(q.clauses(qs)...)
+	return q
+}
+
+func (q *Query[T]) MustNot(qs ...elastic.Query) *Query[T] {
+	q.bq.MustNot(q.clauses(qs)...)
+	return q
+}
+
+func (q *Query[T]) Filter(qs ...elastic.Query) *Query[T] {
+	q.bq.Filter(q.clauses(qs)...)
+	return q
+}
+
+// MinimumShouldMatch such as "1" or "75%"
+func (q *Query[T]) MinimumShouldMatch(v string) *Query[T] {
+	q.bq.MinimumShouldMatch(v)
+	return q
+}
+
+// Boost boost of the bool query
+func (q *Query[T]) Boost(v float64) *Query[T] {
+	q.bq.Boost(v)
+	return q
+}
+
+// Bool a sub bool query of T, such as (a OR b) AND c
+func (q *Query[T]) Bool() *Query[T] {
+	sub := NewQuery[T]()
+	q.subs = append(q.subs, sub)
+	return sub
+}
+
+func (q *Query[T]) Match(field string, text any) *elastic.MatchQuery {
+	return elastic.NewMatchQuery(q.field(field), text)
+}
+
+func (q *Query[T]) MatchPhrase(field string, text any) *elastic.MatchPhraseQuery {
+	return elastic.NewMatchPhraseQuery(q.field(field), text)
+}
+
+// MultiMatch fields support boost suffix, such as "Title^2"
+func (q *Query[T]) MultiMatch(text any, fields ...string) *elastic.MultiMatchQuery {
+	mq := elastic.NewMultiMatchQuery(text)
+	for _, f := range fields {
+		name, boost, ok := strings.Cut(f, "^")
+		if !ok {
+			mq.Field(q.field(name))
+			continue
+		}
+		b, err := strconv.ParseFloat(boost, 64)
+		if err != nil {
+			q.errs = append(q.errs, err)
+		}
+		mq.FieldWithBoost(q.field(name), b)
+	}
+	return mq
+}
+
+func (q *Query[T]) Term(field string, value any) *elastic.TermQuery {
+	return elastic.NewTermQuery(q.field(field), value)
+}
+
+func (q *Query[T]) Terms(field string, values ...any) *elastic.TermsQuery {
+	return elastic.NewTermsQuery(q.field(field), values...)
+}
+
+func (q *Query[T]) Range(field string) *elastic.RangeQuery {
+	return elastic.NewRangeQuery(q.field(field))
+}
+
+func (q *Query[T]) Exists(field string) *elastic.ExistsQuery {
+	return elastic.NewExistsQuery(q.field(field))
+}
+
+func (q *Query[T]) Wildcard(field string, pattern string) *elastic.WildcardQuery {
+	return elastic.NewWildcardQuery(q.field(field), pattern)
+}
+
+func (q *Query[T]) Prefix(field string, prefix string) *elastic.PrefixQuery {
+	return elastic.NewPrefixQuery(q.field(field), prefix)
+}
+
+// Nested query of nested field, fields of the inner query are full paths, such as "Comments.Author"
+func (q *Query[T]) Nested(path string, query elastic.Query) *elastic.NestedQuery {
+	return elastic.NewNestedQuery(q.field(path), query)
+}
+
+// FunctionScore boost the score of the whole query by score functions
+func (q *Query[T]) FunctionScore(fns ...elastic.ScoreFunction) *Query[T] {
+	for _, fn := range fns {
+		q.functionScore().AddScoreFunc(fn)
+	}
+	return q
+}
+
+// FunctionScoreWithFilter boost the score of the documents matched the filter
+func (q *Query[T]) FunctionScoreWithFilter(filter elastic.Query, fn elastic.ScoreFunction) *Query[T] {
+	q.functionScore().Add(filter, fn)
+	return q
+}
+
+// ScoreMode multiply, sum, avg, first, max, min
+func (q *Query[T]) ScoreMode(mode string) *Query[T] {
+	q.functionScore().ScoreMode(mode)
+	return q
+}
+
+// BoostMode multiply, replace, sum, avg, max, min
+func (q *Query[T]) BoostMode(mode string) *Query[T] {
+	q.functionScore().BoostMode(mode)
+	return q
+}
+
+func (q *Query[T]) MaxBoost(v float64) *Query[T] {
+	q.functionScore().MaxBoost(v)
+	return q
+}
+
+func (q *Query[T]) functionScore() *elastic.FunctionScoreQuery {
+	if q.fsq == nil {
+		q.fsq = elastic.NewFunctionScoreQuery()
+	}
+	q.hasFunc = true
+	return q.fsq
+}
+
+func (q *Query[T]) FieldValueFactor(field string) *elastic.FieldValueFactorFunction {
+	return elastic.NewFieldValueFactorFunction().Field(q.field(field))
+}
+
+func (q *Query[T]) Weight(weight float64) *elastic.WeightFactorFunction {
+	return elastic.NewWeightFactorFunction(weight)
+}
@@ -0,0 +1,99 @@
+package elasticex
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var ErrFieldNotFound = errors.New("field not found")
+
+var fieldCache sync.Map // reflect.Type => *sync.Map(field path => es name)
+
+// FieldName resolve the struct field path of T to the es mapping name by json tag.
+//
+//	"Title"           => "title"
+//	"Author.Name"     => "author.name"       nested or object field, slices and pointers are dereferenced
+//	"Title.keyword"   => "title.keyword"     segments after a non-struct field are kept as multi-fields
+//	"_id"             => "_id"               meta fields are kept
+func FieldName[T any](path string) (string, error) {
+	var t T
+	return resolveField(reflect.TypeOf(t), path)
+}
+
+func resolveField(typ reflect.Type, path string) (string, error) {
+	if path == "" || strings.HasPrefix(path, "_") || typ == nil {
+		return path, nil
+	}
+	v, _ := fieldCache.LoadOrStore(typ, &sync.Map{})
+	cache := v.(*sync.Map)
+	if name, ok := cache.Load(path); ok {
+		return name.(string), nil
+	}
+	names := []string{}
+	cur := typ
+	segs := strings.Split(path, ".")
+	for i, seg := range segs {
+		cur = indirectType(cur)
+		if cur.Kind() != reflect.Struct {
+			names = append(names, segs[i:]...)
+			break
+		}
+		f, ok := lookupField(cur, seg)
+		if !ok {
+			return "", fmt.Errorf("%w: %s of %s", ErrFieldNotFound, path, typ)
+		}
+		name := jsonName(f)
+		if name == "" {
+			return "", fmt.Errorf("%w: %s of %s is ignored by json", ErrFieldNotFound, path, typ)
+		}
+		names = append(names, name)
+		cur = f.Type
+	}
+	name := strings.Join(names, ".")
+	cache.Store(path, name)
+	return name, nil
+}
+
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	return t
+}
+
+// lookupField find field by go name, also the json name is accepted, embedded structs are promoted
+func lookupField(t reflect.Type, name string) (reflect.StructField, bool) {
+	if f, ok := t.FieldByName(name); ok && f.IsExported() {
+		return f, true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			if sub, ok := lookupField(indirectType(f.Type), name); ok {
+				return sub, true
+			}
+			continue
+		}
+		if jsonName(f) == name {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func jsonName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return ""
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name
+	}
+	return f.Name
+}
@@ -0,0 +1,144 @@
+package elasticex
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/olivere/elastic/v7"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+type dslComment struct {
+	Author  string `json:"author"`
+	Content string `json:"content"`
+}
+
+type dslArticle struct {
+	dependency.EmptyPo
+	po.IDAutoSection
+	Title    string        `json:"title"`
+	Tags     []string      `json:"tags,omitempty"`
+	Likes    int64         `json:"likes"`
+	CreateAt int64         `json:"createAt"`
+	Author   *dslComment   `json:"author"`
+	Comments []*dslComment `json:"comments"`
+	Secret   string        `json:"-"`
+	Raw      string
+}
+
+// assertGolden compare the source of the query with testdata/{name}.golden, go test -update to rewrite
+func assertGolden(t *testing.T, name string, q elastic.Query) {
+	src, err := q.Source()
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := json.MarshalIndent(src, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual = append(actual, '\n')
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, actual, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("%s mismatch\nexpected:\n%s\nactual:\n%s", path, expected, actual)
+	}
+}
+
+func TestFieldName(t *testing.T) {
+	convey.Convey("TestFieldName", t, func() {
+		for path, expected := range map[string]string{
+			"Title":           "title",
+			"title":           "title",
+			"Id":              "id",
+			"Author.Author":   "author.author",
+			"Comments.Author": "comments.author",
+			"Title.keyword":   "title.keyword",
+			"Raw":             "Raw",
+			"_id":             "_id",
+		} {
+			name, err := FieldName[dslArticle](path)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(name, convey.ShouldEqual, expected)
+		}
+		_, err := FieldName[dslArticle]("Secret")
+		convey.So(errors.Is(err, ErrFieldNotFound), convey.ShouldBeTrue)
+		_, err = FieldName[dslArticle]("Comments.Missing")
+		convey.So(errors.Is(err, ErrFieldNotFound), convey.ShouldBeTrue)
+	})
+}
+
+func TestQueryGolden(t *testing.T) {
+	t.Run("bool", func(t *testing.T) {
+		q := NewQuery[dslArticle]()
+		q.Must(q.Match("Title", "golang").Boost(2)).
+			Should(q.Term("Tags", "go"), q.Terms("Tags", "es", "redis")).
+			MinimumShouldMatch("1").
+			Filter(q.Range("CreateAt").Gte(100).Lt(200), q.Exists("Author")).
+			MustNot(q.Wildcard("Title.keyword", "draft*"))
+		assertGolden(t, "dsl_bool", q)
+	})
+	t.Run("multi_match", func(t *testing.T) {
+		q := NewQuery[dslArticle]()
+		q.Must(q.MultiMatch("golang", "Title^3", "Comments.Content").Type("best_fields"))
+		assertGolden(t, "dsl_multi_match", q)
+	})
+	t.Run("nested", func(t *testing.T) {
+		q := NewQuery[dslArticle]()
+		q.Filter(q.Nested("Comments", q.Bool().
+			Must(q.Term("Comments.Author", "bob")).
+			MustNot(q.Prefix("Comments.Content", "spam"))))
+		assertGolden(t, "dsl_nested", q)
+	})
+	t.Run("function_score", func(t *testing.T) {
+		q := NewQuery[dslArticle]()
+		q.Must(q.Match("Title", "golang")).
+			FunctionScore(q.FieldValueFactor("Likes").Modifier("log1p").Factor(1.2)).
+			FunctionScoreWithFilter(q.Term("Tags", "hot"), q.Weight(3)).
+			ScoreMode("sum").
+			BoostMode("multiply")
+		assertGolden(t, "dsl_function_score", q)
+	})
+	t.Run("with_query", func(t *testing.T) {
+		q := NewQuery[dslArticle]()
+		q.Must(q.Match("Title", "golang"))
+		opt := dependency.NewBaseOption(dependency.WithConds(elastic.NewTermQuery("likes", 1)), q.Option())
+		assertGolden(t, "dsl_with_query", WithQuery(opt.Conds...))
+	})
+}
+
+func TestQueryErr(t *testing.T) {
+	convey.Convey("TestQueryErr", t, func() {
+		q := NewQuery[dslArticle]()
+		convey.So(q.IsEmpty(), convey.ShouldBeTrue)
+		q.Must(q.Match("Missing", "v"), q.Bool().Filter(q.Term("Secret", "v")))
+		convey.So(q.IsEmpty(), convey.ShouldBeFalse)
+		_, err := q.Source()
+		convey.So(errors.Is(err, ErrFieldNotFound), convey.ShouldBeTrue)
+		convey.So(err.Error(), convey.ShouldContainSubstring, "Missing")
+		convey.So(err.Error(), convey.ShouldContainSubstring, "Secret")
+
+		src, err := WithQuery(q).Source()
+		convey.So(src, convey.ShouldBeNil)
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+}
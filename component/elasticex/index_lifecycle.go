@@ -0,0 +1,585 @@
+package elasticex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	iLog "github.com/illidaris/logger"
+	"github.com/olivere/elastic/v7"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+)
+
+const (
+	INDEX_VERSION_SEP  = "_v"     // 版本索引 name_v3
+	WRITE_ALIAS_SUFFIX = "_write" // 写别名 name_write
+)
+
+var (
+	ErrNoMapping      = errors.New("entity has no mapping")
+	ErrLegacyIndex    = errors.New("index is not managed by alias")
+	ErrNoAcknowledged = errors.New("no acknowledged")
+	ErrReindexFailed  = errors.New("reindex failed")
+	ErrWritesActive   = errors.New("writes of other processes are not confirmed paused, see WithWritesPaused")
+)
+
+var dualWrites sync.Map // alias => *dualWrite
+
+// dualWrite 重建索引期间的双写目标，记录期间删除的ID，复制完成后从新索引删除，避免复制写回已删除的文档
+type dualWrite struct {
+	index    string
+	mu       sync.RWMutex // 双写持读锁，清理已删除的ID持写锁
+	idsMu    sync.Mutex
+	deleteds map[string]struct{}
+}
+
+// mark 记录删除或撤销删除
+func (d *dualWrite) mark(deleted bool, ids ...string) {
+	d.idsMu.Lock()
+	defer d.idsMu.Unlock()
+	for _, id := range ids {
+		if deleted {
+			d.deleteds[id] = struct{}{}
+		} else {
+			delete(d.deleteds, id)
+		}
+	}
+}
+
+// take 取出并清空已删除的ID
+func (d *dualWrite) take() []string {
+	d.idsMu.Lock()
+	defer d.idsMu.Unlock()
+	ids := make([]string, 0, len(d.deleteds))
+	for id := range d.deleteds {
+		ids = append(ids, id)
+	}
+	d.deleteds = map[string]struct{}{}
+	return ids
+}
+
+// EnableDualWrite writes of the repository to alias are also written to index, until DisableDualWrite.
+// It is local to the process, writes of other processes are not dual written.
+func EnableDualWrite(alias, index string) {
+	dualWrites.Store(alias, &dualWrite{index: index, deleteds: map[string]struct{}{}})
+}
+
+func DisableDualWrite(alias string) {
+	dualWrites.Delete(alias)
+}
+
+// DualWriteIndex the index of dual write of alias
+func DualWriteIndex(alias string) (string, bool) {
+	v, ok := dualWrites.Load(alias)
+	if !ok {
+		return "", false
+	}
+	return v.(*dualWrite).index, true
+}
+
+// withDualWrite 执行写入，alias处于双写时f收到双写索引，否则为空；成功后记录写入与删除的ID
+func withDualWrite(alias string, writes, deletes []string, f func(dual string) error) error {
+	v, ok := dualWrites.Load(alias)
+	if !ok {
+		return f("")
+	}
+	d := v.(*dualWrite)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if err := f(d.index); err != nil {
+		return err
+	}
+	d.mark(false, writes...)
+	d.mark(true, deletes...)
+	return nil
+}
+
+// ReindexProgress 复制进度
+type ReindexProgress struct {
+	Source string `json:"source"`
+	Dest   string `json:"dest"`
+	Total  int64  `json:"total"`
+	Copied int64  `json:"copied"` // 包含因双写已存在而跳过的文档
+	Done   bool   `json:"done"`
+}
+
+// MigrateResult 迁移结果
+type MigrateResult struct {
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	Diff     *MappingDiff `json:"diff"`
+	Reindex  bool         `json:"reindex"`
+	Removeds []string     `json:"removeds"`
+}
+
+type IndexLifecycleOptions struct {
+	KeepVersions int                   // 切换后保留的旧版本数量
+	AppCopy      bool                  // 使用应用侧复制代替_reindex，适用于无权限或跨集群
+	BatchSize    int                   // 应用侧复制的批量
+	PollInterval time.Duration         // _reindex任务进度轮询间隔
+	Force        bool                  // mapping无变化也重建
+	Progress     func(ReindexProgress) // 进度回调
+	WritesPaused bool                  // 确认复制期间其他进程的写入已暂停
+}
+
+type IndexLifecycleOptionFunc func(*IndexLifecycleOptions)
+
+func WithKeepVersions(v int) IndexLifecycleOptionFunc {
+	return func(o *IndexLifecycleOptions) {
+		o.KeepVersions = v
+	}
+}
+
+func WithAppCopy(batch int) IndexLifecycleOptionFunc {
+	return func(o *IndexLifecycleOptions) {
+		o.AppCopy = true
+		o.BatchSize = batch
+	}
+}
+
+func WithPollInterval(v time.Duration) IndexLifecycleOptionFunc {
+	return func(o *IndexLifecycleOptions) {
+		o.PollInterval = v
+	}
+}
+
+func WithForceReindex() IndexLifecycleOptionFunc {
+	return func(o *IndexLifecycleOptions) {
+		o.Force = true
+	}
+}
+
+// WithWritesPaused confirm the writes of other processes are paused while copying,
+// dual write lives in the process, without it Migrate refuses to copy
+func WithWritesPaused() IndexLifecycleOptionFunc {
+	return func(o *IndexLifecycleOptions) {
+		o.WritesPaused = true
+	}
+}
+
+func WithProgress(f func(ReindexProgress)) IndexLifecycleOptionFunc {
+	return func(o *IndexLifecycleOptions) {
+		o.Progress = f
+	}
+}
+
+/*
+IndexLifecycle manage versioned indices of T behind aliases, the TableName resolved by opts is the read alias.
+
+	name_v1 <= name, name_write (is_write_index)
+
+Migrate create name_v{n+1} with the mapping of T when the mapping is changed, copy documents by _reindex
+or application side with dual write, delete the documents deleted while copying, switch both aliases in one request,
+and remove old versions.
+Dual write lives in the process, writes of BaseRepository in other processes are lost,
+so copying requires WithWritesPaused to confirm they are paused.
+*/
+type IndexLifecycle[T dependency.IEntity] struct {
+	opts *IndexLifecycleOptions
+}
+
+func NewIndexLifecycle[T dependency.IEntity](opts ...IndexLifecycleOptionFunc) *IndexLifecycle[T] {
+	o := &IndexLifecycleOptions{
+		KeepVersions: 1,
+		BatchSize:    DEFAULT_ITER_BATCH,
+		PollInterval: time.Second,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &IndexLifecycle[T]{opts: o}
+}
+
+// VersionIndex name_v{version}
+func VersionIndex(alias string, version int) string {
+	return fmt.Sprintf("%s%s%d", alias, INDEX_VERSION_SEP, version)
+}
+
+// IndexVersion version of name_v{version}, 0 if not a version index of alias
+func IndexVersion(alias, index string) int {
+	v, ok := strings.CutPrefix(index, alias+INDEX_VERSION_SEP)
+	if !ok {
+		return 0
+	}
+	version, err := strconv.Atoi(v)
+	if err != nil {
+		return 0
+	}
+	return version
+}
+
+func (l *IndexLifecycle[T]) resolve(ctx context.Context, opts ...dependency.BaseOptionFunc) (*elastic.Client, string) {
+	var t T
+	opt := dependency.NewBaseOption(opts...)
+	return CoreFrmCtx(ctx, opt.GetDataBase(t)), opt.GetTableName(t)
+}
+
+func (l *IndexLifecycle[T]) mapping() (string, error) {
+	var t T
+	m, ok := any(t).(dependency.IMapping)
+	if !ok {
+		return "", ErrNoMapping
+	}
+	return m.GetMapping(), nil
+}
+
+// Current the index of the read alias, empty if the alias is not exist
+func (l *IndexLifecycle[T]) Current(ctx context.Context, opts ...dependency.BaseOptionFunc) (string, error) {
+	db, alias := l.resolve(ctx, opts...)
+	res, err := db.Aliases().Alias(alias).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	indices := res.IndicesByAlias(alias)
+	if len(indices) == 0 {
+		return "", nil
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		return IndexVersion(alias, indices[i]) > IndexVersion(alias, indices[j])
+	})
+	return indices[0], nil
+}
+
+// Ensure create name_v1 behind the aliases if the alias is not exist, return the current index
+func (l *IndexLifecycle[T]) Ensure(ctx context.Context, opts ...dependency.BaseOptionFunc) (string, error) {
+	cur, err := l.Current(ctx, opts...)
+	if err != nil || cur != "" {
+		return cur, err
+	}
+	db, alias := l.resolve(ctx, opts...)
+	exist, err := db.IndexExists(alias).Do(ctx)
+	if err != nil {
+		return "", err
+	}
+	if exist {
+		return "", fmt.Errorf("%w: %s", ErrLegacyIndex, alias)
+	}
+	index := VersionIndex(alias, 1)
+	if err := l.create(ctx, db, index); err != nil {
+		return "", err
+	}
+	return index, l.switchAlias(ctx, db, alias, "", index)
+}
+
+// Diff the mapping of T with the current index
+func (l *IndexLifecycle[T]) Diff(ctx context.Context, opts ...dependency.BaseOptionFunc) (*MappingDiff, error) {
+	cur, err := l.Current(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cur == "" {
+		_, alias := l.resolve(ctx, opts...)
+		return nil, fmt.Errorf("%w: %s", ErrLegacyIndex, alias)
+	}
+	db, _ := l.resolve(ctx, opts...)
+	return l.diff(ctx, db, cur)
+}
+
+func (l *IndexLifecycle[T]) diff(ctx context.Context, db *elastic.Client, index string) (*MappingDiff, error) {
+	body, err := l.mapping()
+	if err != nil {
+		return nil, err
+	}
+	settings, mappings, err := parseMappingBody(body)
+	if err != nil {
+		return nil, err
+	}
+	res, err := db.IndexGet(index).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	actual, ok := res[index]
+	if !ok {
+		return nil, fmt.Errorf("index %s not found", index)
+	}
+	return DiffMapping(settings, mappings, actual.Settings, actual.Mappings), nil
+}
+
+/*
+Migrate bring the index up to the mapping of T without downtime.
+
+	no alias           => create name_v1 behind the aliases
+	only added fields  => put mapping to the current index
+	changed fields     => create name_v{n+1}, dual write, copy, delete the deleteds, switch aliases atomically, remove old versions
+
+With tenancy enabled, only the documents of the tenant in ctx are copied, it fits the index per tenant,
+an index shared by tenants must be migrated with dependency.WithCrossTenant.
+*/
+func (l *IndexLifecycle[T]) Migrate(ctx context.Context, opts ...dependency.BaseOptionFunc) (*MigrateResult, error) {
+	opts, scope, err := tenantOptions[T](ctx, nil, dependency.TENANT_OP_UPDATE, false, opts)
+	if err != nil {
+		return nil, err
+	}
+	cur, err := l.Current(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cur == "" {
+		to, err := l.Ensure(ctx, opts...)
+		return &MigrateResult{To: to}, err
+	}
+	db, alias := l.resolve(ctx, opts...)
+	result := &MigrateResult{From: cur, To: cur}
+	if result.Diff, err = l.diff(ctx, db, cur); err != nil {
+		return result, err
+	}
+	if !l.opts.Force && !result.Diff.NeedReindex() {
+		if len(result.Diff.Added) > 0 {
+			err = l.putMapping(ctx, db, cur)
+		}
+		return result, err
+	}
+	if !l.opts.WritesPaused {
+		return result, ErrWritesActive
+	}
+	result.Reindex = true
+	result.To = VersionIndex(alias, IndexVersion(alias, cur)+1)
+	if err := l.create(ctx, db, result.To); err != nil {
+		return result, err
+	}
+	EnableDualWrite(alias, result.To)
+	defer DisableDualWrite(alias)
+	if l.opts.AppCopy {
+		err = l.appCopy(ctx, db, cur, result.To, scope, opts...)
+	} else {
+		err = l.reindex(ctx, db, cur, result.To, scope)
+	}
+	if err != nil {
+		return result, err
+	}
+	if err := l.purge(ctx, db, alias); err != nil {
+		return result, err
+	}
+	if _, err := db.Refresh(result.To).Do(ctx); err != nil {
+		return result, err
+	}
+	if err := l.switchAlias(ctx, db, alias, cur, result.To); err != nil {
+		return result, err
+	}
+	result.Removeds, err = l.GC(ctx, opts...)
+	return result, err
+}
+
+// GC remove the versions older than the current index, except the latest KeepVersions versions
+func (l *IndexLifecycle[T]) GC(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]string, error) {
+	cur, err := l.Current(ctx, opts...)
+	if err != nil || cur == "" {
+		return nil, err
+	}
+	db, alias := l.resolve(ctx, opts...)
+	res, err := db.IndexGet(alias + INDEX_VERSION_SEP + "*").AllowNoIndices(true).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	curVersion := IndexVersion(alias, cur)
+	olds := []string{}
+	for index := range res {
+		if v := IndexVersion(alias, index); v > 0 && v < curVersion {
+			olds = append(olds, index)
+		}
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		return IndexVersion(alias, olds[i]) > IndexVersion(alias, olds[j])
+	})
+	if len(olds) <= l.opts.KeepVersions {
+		return nil, nil
+	}
+	removeds := olds[l.opts.KeepVersions:]
+	if _, err := db.DeleteIndex(removeds...).Do(ctx); err != nil {
+		return nil, err
+	}
+	return removeds, nil
+}
+
+func (l *IndexLifecycle[T]) create(ctx context.Context, db *elastic.Client, index string) error {
+	body, err := l.mapping()
+	if err != nil {
+		return err
+	}
+	res, err := db.CreateIndex(index).BodyString(body).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if !res.Acknowledged {
+		return ErrNoAcknowledged
+	}
+	return nil
+}
+
+func (l *IndexLifecycle[T]) putMapping(ctx context.Context, db *elastic.Client, index string) error {
+	body, err := l.mapping()
+	if err != nil {
+		return err
+	}
+	_, mappings, err := parseMappingBody(body)
+	if err != nil {
+		return err
+	}
+	res, err := db.PutMapping().Index(index).BodyJson(mappings).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if !res.Acknowledged {
+		return ErrNoAcknowledged
+	}
+	return nil
+}
+
+// switchAlias move the read and write alias from old to index in one request
+func (l *IndexLifecycle[T]) switchAlias(ctx context.Context, db *elastic.Client, alias, old, index string) error {
+	actions := []elastic.AliasAction{}
+	if old != "" {
+		actions = append(actions,
+			elastic.NewAliasRemoveAction(alias).Index(old),
+			elastic.NewAliasRemoveAction(alias+WRITE_ALIAS_SUFFIX).Index(old))
+	}
+	actions = append(actions,
+		elastic.NewAliasAddAction(alias).Index(index),
+		elastic.NewAliasAddAction(alias+WRITE_ALIAS_SUFFIX).Index(index).IsWriteIndex(true))
+	res, err := db.Alias().Action(actions...).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if !res.Acknowledged {
+		return ErrNoAcknowledged
+	}
+	return nil
+}
+
+// purge 删除复制期间已删除的文档，复制基于快照，会写回这些文档；期间阻塞双写，避免删除重新写入的文档
+func (l *IndexLifecycle[T]) purge(ctx context.Context, db *elastic.Client, alias string) error {
+	v, ok := dualWrites.Load(alias)
+	if !ok {
+		return nil
+	}
+	d := v.(*dualWrite)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ids := d.take()
+	if len(ids) == 0 {
+		return nil
+	}
+	bulk := db.Bulk()
+	for _, id := range ids {
+		bulk.Add(elastic.NewBulkDeleteRequest().Index(d.index).Id(id))
+	}
+	res, err := bulk.Do(ctx)
+	if err != nil {
+		return err
+	}
+	for _, item := range res.Failed() {
+		if item.Status != 404 {
+			return fmt.Errorf("%w: delete %s %v", ErrReindexFailed, item.Id, item.Error)
+		}
+	}
+	return nil
+}
+
+func (l *IndexLifecycle[T]) progress(p ReindexProgress) {
+	if l.opts.Progress != nil {
+		l.opts.Progress(p)
+	}
+}
+
+// reindex by the _reindex task, documents already dual written are skipped by op_type create
+func (l *IndexLifecycle[T]) reindex(ctx context.Context, db *elastic.Client, src, dst string, scope *dependency.TenantScope) error {
+	source := elastic.NewReindexSource().Index(src)
+	if scope != nil {
+		source = source.Query(tenantQuery(scope))
+	}
+	task, err := db.Reindex().
+		Source(source).
+		Destination(elastic.NewReindexDestination().Index(dst).OpType("create")).
+		ProceedOnVersionConflict().
+		Slices("auto").
+		DoAsync(ctx)
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(l.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		res, err := db.TasksGetTask().TaskId(task.TaskId).Do(ctx)
+		if err != nil {
+			return err
+		}
+		p := ReindexProgress{Source: src, Dest: dst, Done: res.Completed}
+		if res.Task != nil {
+			status := cast.ToStringMap(res.Task.Status)
+			p.Total = cast.ToInt64(status["total"])
+			p.Copied = cast.ToInt64(status["created"]) + cast.ToInt64(status["updated"]) + cast.ToInt64(status["version_conflicts"])
+		}
+		l.progress(p)
+		if res.Error != nil {
+			return fmt.Errorf("%w: %s %s", ErrReindexFailed, res.Error.Type, res.Error.Reason)
+		}
+		if res.Completed {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// appCopy copy by the iterator and bulk, documents already dual written are skipped by op_type create,
+// the iterator limits the documents to the tenant itself
+func (l *IndexLifecycle[T]) appCopy(ctx context.Context, db *elastic.Client, src, dst string, scope *dependency.TenantScope, opts ...dependency.BaseOptionFunc) error {
+	count := db.Count(src)
+	if scope != nil {
+		count = count.Query(tenantQuery(scope))
+	}
+	total, err := count.Do(ctx)
+	if err != nil {
+		return err
+	}
+	p := ReindexProgress{Source: src, Dest: dst, Total: total}
+	bulk := db.Bulk()
+	flush := func() error {
+		if bulk.NumberOfActions() == 0 {
+			return nil
+		}
+		res, err := bulk.Do(ctx)
+		if err != nil {
+			return err
+		}
+		for _, item := range res.Failed() {
+			if item.Status != 409 {
+				return fmt.Errorf("%w: %s %v", ErrReindexFailed, item.Id, item.Error)
+			}
+		}
+		p.Copied += int64(len(res.Items))
+		l.progress(p)
+		return nil
+	}
+	it := NewIterator[T](WithIterBatchSize(l.opts.BatchSize))
+	err = it.Each(ctx, func(hit *elastic.SearchHit, t *T) error {
+		bulk.Add(elastic.NewBulkIndexRequest().OpType("create").Index(dst).Id(hit.Id).Doc(hit.Source))
+		if bulk.NumberOfActions() >= l.opts.BatchSize {
+			return flush()
+		}
+		return nil
+	}, append(opts, dependency.WithTableName(src))...)
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		iLog.ErrorCtx(ctx, "copy index failed", zap.String("source", src), zap.String("dest", dst), zap.Error(err))
+		return err
+	}
+	p.Done = true
+	l.progress(p)
+	return nil
+}
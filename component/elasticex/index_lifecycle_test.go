@@ -0,0 +1,570 @@
+package elasticex
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/olivere/elastic/v7"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type lifecycleV1 struct {
+	dependency.EmptyPo
+	Id   string `json:"id"`
+	Code string `json:"code"`
+}
+
+func (s lifecycleV1) ID() any           { return s.Id }
+func (s lifecycleV1) TableName() string { return "article" }
+func (s lifecycleV1) GetMapping() string {
+	return `{"settings":{"number_of_shards":1},"mappings":{"properties":{"id":{"type":"keyword"},"code":{"type":"keyword"}}}}`
+}
+
+// lifecycleAdded add a field
+type lifecycleAdded struct{ lifecycleV1 }
+
+func (s lifecycleAdded) GetMapping() string {
+	return `{"settings":{"number_of_shards":1},"mappings":{"properties":{"id":{"type":"keyword"},"code":{"type":"keyword"},"title":{"type":"text"}}}}`
+}
+
+// lifecycleChanged change the type of code
+type lifecycleChanged struct{ lifecycleV1 }
+
+func (s lifecycleChanged) GetMapping() string {
+	return `{"settings":{"number_of_shards":1},"mappings":{"properties":{"id":{"type":"keyword"},"code":{"type":"text","fields":{"keyword":{"type":"keyword"}}}}}}`
+}
+
+type fakeIndex struct {
+	settings map[string]any
+	mappings map[string]any
+	docs     map[string]json.RawMessage
+	versions map[string]int64
+}
+
+// fakeES in memory es of the apis used by IndexLifecycle
+type fakeES struct {
+	mu       sync.Mutex
+	indices  map[string]*fakeIndex
+	aliases  map[string]map[string]bool // alias => index => is write index
+	onCopy   func()                     // called before copy documents
+	onCopied func()                     // called after the documents to copy are read, before they are written
+}
+
+func newFakeES() *fakeES {
+	return &fakeES{indices: map[string]*fakeIndex{}, aliases: map[string]map[string]bool{}}
+}
+
+func (f *fakeES) reply(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeES) notFound(w http.ResponseWriter, typ string) {
+	f.reply(w, 404, map[string]any{"status": 404, "error": map[string]any{"type": typ}})
+}
+
+func (f *fakeES) aliasesOf(index string) map[string]any {
+	res := map[string]any{}
+	for alias, indices := range f.aliases {
+		if isWrite, ok := indices[index]; ok {
+			res[alias] = map[string]any{"is_write_index": isWrite}
+		}
+	}
+	return res
+}
+
+// queryTerm the first term query in the body
+func queryTerm(v any) (string, any, bool) {
+	switch q := v.(type) {
+	case map[string]any:
+		if term, ok := q["term"].(map[string]any); ok {
+			for k, val := range term {
+				if m, ok := val.(map[string]any); ok {
+					return k, m["value"], true
+				}
+				return k, val, true
+			}
+		}
+		for _, sub := range q {
+			if k, val, ok := queryTerm(sub); ok {
+				return k, val, true
+			}
+		}
+	case []any:
+		for _, sub := range q {
+			if k, val, ok := queryTerm(sub); ok {
+				return k, val, true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+// docMatch only the term query is supported
+func docMatch(query any) func(doc json.RawMessage) bool {
+	field, value, ok := queryTerm(query)
+	return func(doc json.RawMessage) bool {
+		if !ok {
+			return true
+		}
+		m := map[string]any{}
+		_ = json.Unmarshal(doc, &m)
+		return fmt.Sprint(m[field]) == fmt.Sprint(value)
+	}
+}
+
+func (f *fakeES) copyDocs(src, dst string, match func(json.RawMessage) bool) int {
+	if f.onCopy != nil {
+		f.onCopy()
+	}
+	f.mu.Lock()
+	docs := map[string]json.RawMessage{}
+	for id, doc := range f.indices[src].docs {
+		if match(doc) {
+			docs[id] = doc
+		}
+	}
+	f.mu.Unlock()
+	f.copied()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for id, doc := range docs {
+		if _, ok := f.indices[dst].docs[id]; !ok {
+			f.indices[dst].docs[id] = doc
+		}
+	}
+	return len(docs)
+}
+
+// index the index or the index of the alias
+func (f *fakeES) index(name string) *fakeIndex {
+	index, ok := f.indices[name]
+	if !ok {
+		for i := range f.aliases[name] {
+			index = f.indices[i]
+		}
+	}
+	return index
+}
+
+// copied call onCopied once
+func (f *fakeES) copied() {
+	if f.onCopied != nil {
+		onCopied := f.onCopied
+		f.onCopied = nil
+		onCopied()
+	}
+}
+
+func (f *fakeES) sortedDocs(index string, match func(json.RawMessage) bool) []map[string]any {
+	hits := []map[string]any{}
+	for id, doc := range f.indices[index].docs {
+		if !match(doc) {
+			continue
+		}
+		hits = append(hits, map[string]any{"_index": index, "_id": id, "_source": doc})
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i]["_id"].(string) < hits[j]["_id"].(string) })
+	return hits
+}
+
+func (f *fakeES) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segs := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	body := map[string]any{}
+	if r.Method != http.MethodHead && !strings.HasSuffix(r.URL.Path, "_bulk") {
+		_ = json.NewDecoder(r.Body).Decode(&body)
+	}
+	switch {
+	case segs[0] == "_alias":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		indices, ok := f.aliases[segs[1]]
+		if !ok || len(indices) == 0 {
+			f.notFound(w, "aliases_not_found_exception")
+			return
+		}
+		res := map[string]any{}
+		for index, isWrite := range indices {
+			res[index] = map[string]any{"aliases": map[string]any{segs[1]: map[string]any{"is_write_index": isWrite}}}
+		}
+		f.reply(w, 200, res)
+	case segs[0] == "_aliases":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		for _, v := range body["actions"].([]any) {
+			for op, arg := range v.(map[string]any) {
+				a := arg.(map[string]any)
+				alias, index := a["alias"].(string), a["index"].(string)
+				if op == "remove" {
+					delete(f.aliases[alias], index)
+					continue
+				}
+				if f.aliases[alias] == nil {
+					f.aliases[alias] = map[string]bool{}
+				}
+				isWrite, _ := a["is_write_index"].(bool)
+				f.aliases[alias][index] = isWrite
+			}
+		}
+		f.reply(w, 200, map[string]any{"acknowledged": true})
+	case segs[0] == "_reindex":
+		src, ok := body["source"].(map[string]any)["index"].(string)
+		if !ok {
+			src = body["source"].(map[string]any)["index"].([]any)[0].(string)
+		}
+		dst := body["dest"].(map[string]any)["index"].(string)
+		n := f.copyDocs(src, dst, docMatch(body["source"].(map[string]any)["query"]))
+		f.mu.Lock()
+		f.indices["_task"] = &fakeIndex{settings: map[string]any{"total": n}}
+		f.mu.Unlock()
+		f.reply(w, 200, map[string]any{"task": "node:1"})
+	case segs[0] == "_tasks":
+		f.mu.Lock()
+		n := f.indices["_task"].settings["total"]
+		f.mu.Unlock()
+		f.reply(w, 200, map[string]any{"completed": true, "task": map[string]any{"status": map[string]any{"total": n, "created": n}}})
+	case segs[0] == "_bulk":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		items := []any{}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			meta := map[string]map[string]any{}
+			_ = json.Unmarshal(scanner.Bytes(), &meta)
+			for op, m := range meta {
+				var (
+					index      = f.index(m["_index"].(string))
+					id         = m["_id"].(string)
+					version, _ = m["version"].(float64)
+					status     = 201
+				)
+				if op != "delete" {
+					scanner.Scan()
+				}
+				_, exist := index.docs[id]
+				switch {
+				case exist && op == "create":
+					status = 409
+				case version > 0 && int64(version) <= index.versions[id]:
+					status = 409
+				case op == "delete" && !exist:
+					status = 404
+				case op == "delete":
+					status = 200
+					delete(index.docs, id)
+				default:
+					index.docs[id] = append(json.RawMessage{}, scanner.Bytes()...)
+				}
+				if status < 300 && version > 0 {
+					if index.versions == nil {
+						index.versions = map[string]int64{}
+					}
+					index.versions[id] = int64(version)
+				}
+				items = append(items, map[string]any{op: map[string]any{"_index": m["_index"], "_id": id, "status": status}})
+			}
+		}
+		f.reply(w, 200, map[string]any{"items": items})
+	case segs[0] == "_search" && segs[1] == "scroll":
+		f.reply(w, 200, map[string]any{"_scroll_id": "s1", "hits": map[string]any{"hits": []any{}}})
+	case len(segs) == 2 && segs[1] == "_pit":
+		f.reply(w, 400, map[string]any{"status": 400, "error": map[string]any{"type": "illegal_argument_exception"}})
+	case len(segs) == 2 && segs[1] == "_search":
+		if f.onCopy != nil {
+			f.onCopy()
+		}
+		f.mu.Lock()
+		hits := f.sortedDocs(segs[0], docMatch(body["query"]))
+		f.mu.Unlock()
+		f.copied()
+		f.reply(w, 200, map[string]any{"_scroll_id": "s1", "hits": map[string]any{"hits": hits}})
+	case len(segs) == 2 && segs[1] == "_count":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.reply(w, 200, map[string]any{"count": len(f.sortedDocs(segs[0], docMatch(body["query"])))})
+	case len(segs) == 2 && segs[1] == "_refresh":
+		f.reply(w, 200, map[string]any{})
+	case len(segs) == 2 && segs[1] == "_mapping":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		props := f.indices[segs[0]].mappings["properties"].(map[string]any)
+		for k, v := range body["properties"].(map[string]any) {
+			props[k] = v
+		}
+		f.reply(w, 200, map[string]any{"acknowledged": true})
+	case len(segs) == 3 && segs[1] == "_doc":
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		index := f.index(segs[0])
+		if r.Method == http.MethodDelete {
+			if _, ok := index.docs[segs[2]]; !ok {
+				f.notFound(w, "not_found")
+				return
+			}
+			delete(index.docs, segs[2])
+			f.reply(w, 200, map[string]any{"_index": segs[0], "_id": segs[2], "result": "deleted"})
+			return
+		}
+		bs, _ := json.Marshal(body)
+		index.docs[segs[2]] = bs
+		f.reply(w, 201, map[string]any{"_index": segs[0], "_id": segs[2], "result": "created"})
+	case len(segs) == 1:
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		switch r.Method {
+		case http.MethodHead:
+			if _, ok := f.indices[segs[0]]; ok {
+				w.WriteHeader(200)
+				return
+			}
+			w.WriteHeader(404)
+		case http.MethodPut:
+			settings, _ := body["settings"].(map[string]any)
+			index := map[string]any{}
+			for k, v := range settings {
+				bs, _ := json.Marshal(v)
+				index[k] = strings.Trim(string(bs), `"`)
+			}
+			mappings, _ := body["mappings"].(map[string]any)
+			f.indices[segs[0]] = &fakeIndex{settings: map[string]any{"index": index}, mappings: mappings, docs: map[string]json.RawMessage{}}
+			f.reply(w, 200, map[string]any{"acknowledged": true, "index": segs[0]})
+		case http.MethodGet:
+			res := map[string]any{}
+			for name, index := range f.indices {
+				if ok, _ := path.Match(segs[0], name); ok && name != "_task" {
+					res[name] = map[string]any{"aliases": f.aliasesOf(name), "mappings": index.mappings, "settings": index.settings}
+				}
+			}
+			f.reply(w, 200, res)
+		case http.MethodDelete:
+			for _, name := range strings.Split(segs[0], ",") {
+				delete(f.indices, name)
+			}
+			f.reply(w, 200, map[string]any{"acknowledged": true})
+		}
+	default:
+		f.reply(w, 400, map[string]any{"status": 400, "error": map[string]any{"type": "unsupported " + r.URL.Path}})
+	}
+}
+
+func mockFakeES(f func(es *fakeES)) {
+	es := newFakeES()
+	server := httptest.NewServer(es)
+	defer server.Close()
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if err != nil {
+		panic(err)
+	}
+	patch := gomonkey.ApplyFunc(CoreFrmCtx, func(ctx context.Context, id string) *elastic.Client {
+		return client
+	})
+	defer patch.Reset()
+	f(es)
+}
+
+func TestDiffMapping(t *testing.T) {
+	convey.Convey("TestDiffMapping", t, func() {
+		settings, mappings, err := parseMappingBody(lifecycleChanged{}.GetMapping())
+		convey.So(err, convey.ShouldBeNil)
+		_, actual, _ := parseMappingBody(lifecycleV1{}.GetMapping())
+		diff := DiffMapping(settings, mappings, map[string]any{"index": map[string]any{"number_of_shards": "1"}}, actual)
+		convey.So(diff.Added, convey.ShouldResemble, []string{"code.keyword"})
+		convey.So(diff.Changed, convey.ShouldResemble, []string{"code"})
+		convey.So(diff.NeedReindex(), convey.ShouldBeTrue)
+
+		diff = DiffMapping(settings, mappings, map[string]any{"index": map[string]any{"number_of_shards": "3"}}, mappings)
+		convey.So(diff.Settings, convey.ShouldResemble, []string{"number_of_shards"})
+		diff = DiffMapping(settings, mappings, settings, mappings)
+		convey.So(diff.IsEmpty(), convey.ShouldBeTrue)
+	})
+}
+
+func TestIndexLifecycle(t *testing.T) {
+	mockFakeES(func(es *fakeES) {
+		convey.Convey("TestIndexLifecycle", t, func() {
+			ctx := context.Background()
+			progress := []ReindexProgress{}
+			v1 := NewIndexLifecycle[lifecycleV1]()
+			index, err := v1.Ensure(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(index, convey.ShouldEqual, "article_v1")
+			convey.So(es.aliases["article_write"], convey.ShouldResemble, map[string]bool{"article_v1": true})
+			_, err = (&BaseRepository[lifecycleV1]{}).BaseCreate(ctx, []*lifecycleV1{{Id: "1", Code: "a"}})
+			convey.So(err, convey.ShouldBeNil)
+
+			// 仅新增字段
+			res, err := NewIndexLifecycle[lifecycleAdded]().Migrate(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(res.Reindex, convey.ShouldBeFalse)
+			convey.So(res.Diff.Added, convey.ShouldResemble, []string{"title"})
+			convey.So(es.indices["article_v1"].mappings["properties"], convey.ShouldContainKey, "title")
+
+			// 类型变化，复制期间双写
+			var dualErr error
+			es.onCopy = func() {
+				es.onCopy = nil
+				_, dualErr = (&BaseRepository[lifecycleChanged]{}).BaseCreate(ctx, []*lifecycleChanged{{lifecycleV1{Id: "2", Code: "b"}}})
+			}
+			_, err = NewIndexLifecycle[lifecycleChanged]().Migrate(ctx)
+			convey.So(err, convey.ShouldEqual, ErrWritesActive)
+			convey.So(es.indices, convey.ShouldNotContainKey, "article_v2")
+			changed := NewIndexLifecycle[lifecycleChanged](WithWritesPaused(), WithProgress(func(p ReindexProgress) {
+				progress = append(progress, p)
+			}))
+			res, err = changed.Migrate(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(dualErr, convey.ShouldBeNil)
+			convey.So(res.Reindex, convey.ShouldBeTrue)
+			convey.So(res.From, convey.ShouldEqual, "article_v1")
+			convey.So(res.To, convey.ShouldEqual, "article_v2")
+			convey.So(len(es.indices["article_v2"].docs), convey.ShouldEqual, 2)
+			convey.So(es.aliases["article"], convey.ShouldResemble, map[string]bool{"article_v2": false})
+			convey.So(es.aliases["article_write"], convey.ShouldResemble, map[string]bool{"article_v2": true})
+			convey.So(progress[len(progress)-1], convey.ShouldResemble, ReindexProgress{Source: "article_v1", Dest: "article_v2", Total: 2, Copied: 2, Done: true})
+			_, dual := DualWriteIndex("article")
+			convey.So(dual, convey.ShouldBeFalse)
+
+			// 应用侧复制，保留0个旧版本
+			appCopy := NewIndexLifecycle[lifecycleChanged](WithWritesPaused(), WithForceReindex(), WithAppCopy(10), WithKeepVersions(0))
+			res, err = appCopy.Migrate(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(res.To, convey.ShouldEqual, "article_v3")
+			convey.So(len(es.indices["article_v3"].docs), convey.ShouldEqual, 2)
+			sort.Strings(res.Removeds)
+			convey.So(res.Removeds, convey.ShouldResemble, []string{"article_v1", "article_v2"})
+			convey.So(es.indices, convey.ShouldNotContainKey, "article_v1")
+
+			diff, err := appCopy.Diff(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(diff.IsEmpty(), convey.ShouldBeTrue)
+		})
+	})
+}
+
+func TestIndexLifecycleDeleteWhileCopy(t *testing.T) {
+	mockFakeES(func(es *fakeES) {
+		convey.Convey("TestIndexLifecycleDeleteWhileCopy", t, func() {
+			ctx := context.Background()
+			repo := &BaseRepository[lifecycleChanged]{}
+			_, err := NewIndexLifecycle[lifecycleV1]().Ensure(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			_, err = repo.BaseCreate(ctx, []*lifecycleChanged{{lifecycleV1{Id: "1"}}, {lifecycleV1{Id: "2"}}, {lifecycleV1{Id: "3"}}})
+			convey.So(err, convey.ShouldBeNil)
+
+			// 复制读取后删除，复制不会写回
+			var dualErr error
+			deleteWhileCopy := func() {
+				_, dualErr = repo.BaseDelete(ctx, &lifecycleChanged{lifecycleV1{Id: "1"}})
+			}
+			es.onCopied = deleteWhileCopy
+			res, err := NewIndexLifecycle[lifecycleChanged](WithWritesPaused()).Migrate(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(dualErr, convey.ShouldBeNil)
+			convey.So(es.indices[res.To].docs, convey.ShouldNotContainKey, "1")
+			convey.So(es.indices[res.To].docs, convey.ShouldHaveLength, 2)
+
+			// 应用侧复制，删除后重新写入的文档保留
+			es.onCopied = func() {
+				_, dualErr = repo.BaseDelete(ctx, &lifecycleChanged{lifecycleV1{Id: "2"}})
+				if dualErr == nil {
+					_, dualErr = repo.BaseDelete(ctx, &lifecycleChanged{lifecycleV1{Id: "3"}})
+				}
+				if dualErr == nil {
+					_, dualErr = repo.BaseCreate(ctx, []*lifecycleChanged{{lifecycleV1{Id: "3", Code: "new"}}})
+				}
+			}
+			res, err = NewIndexLifecycle[lifecycleChanged](WithWritesPaused(), WithForceReindex(), WithAppCopy(10)).Migrate(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(dualErr, convey.ShouldBeNil)
+			convey.So(es.indices[res.To].docs, convey.ShouldNotContainKey, "2")
+			convey.So(string(es.indices[res.To].docs["3"]), convey.ShouldContainSubstring, `"new"`)
+
+			// 投影同样双写
+			es.onCopied = func() {
+				_, dualErr = repo.BaseSync(ctx, []*lifecycleChanged{{lifecycleV1{Id: "4"}}}, map[string]int64{"3": 0})
+			}
+			res, err = NewIndexLifecycle[lifecycleChanged](WithWritesPaused(), WithForceReindex()).Migrate(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(dualErr, convey.ShouldBeNil)
+			convey.So(es.indices[res.To].docs, convey.ShouldContainKey, "4")
+			convey.So(es.indices[res.To].docs, convey.ShouldNotContainKey, "3")
+		})
+	})
+}
+
+func TestIndexLifecycleLegacy(t *testing.T) {
+	mockFakeES(func(es *fakeES) {
+		convey.Convey("TestIndexLifecycleLegacy", t, func() {
+			ctx := context.Background()
+			es.indices["article"] = &fakeIndex{docs: map[string]json.RawMessage{}}
+			_, err := NewIndexLifecycle[lifecycleV1]().Ensure(ctx)
+			convey.So(errors.Is(err, ErrLegacyIndex), convey.ShouldBeTrue)
+			_, err = NewIndexLifecycle[testStructShardingPo]().Ensure(ctx, dependency.WithTableName("other"))
+			convey.So(err, convey.ShouldBeNil)
+			_, err = NewIndexLifecycle[lifecycleNoMapping]().Ensure(ctx)
+			convey.So(errors.Is(err, ErrNoMapping), convey.ShouldBeTrue)
+		})
+	})
+}
+
+type lifecycleNoMapping struct {
+	dependency.EmptyPo
+}
+
+func (s lifecycleNoMapping) TableName() string { return "nomapping" }
+
+// lifecycleTenant the changed mapping with tenant
+type lifecycleTenant struct {
+	lifecycleChanged
+	BizId int64 `json:"bizId"`
+}
+
+func (s lifecycleTenant) TenantColumn() string   { return "bizId" }
+func (s lifecycleTenant) GetTenant() int64       { return s.BizId }
+func (s *lifecycleTenant) SetTenant(bizId int64) { s.BizId = bizId }
+
+func TestIndexLifecycleTenant(t *testing.T) {
+	dependency.EnableTenancy(true)
+	defer dependency.EnableTenancy(false)
+	mockFakeES(func(es *fakeES) {
+		convey.Convey("TestIndexLifecycleTenant", t, func() {
+			ctx := contextex.WithBizId(context.Background(), 7)
+			_, err := NewIndexLifecycle[lifecycleV1]().Ensure(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			es.indices["article_v1"].docs["1"] = json.RawMessage(`{"id":"1","bizId":7}`)
+			es.indices["article_v1"].docs["2"] = json.RawMessage(`{"id":"2","bizId":8}`)
+
+			_, err = NewIndexLifecycle[lifecycleTenant]().Migrate(context.Background())
+			convey.So(err, convey.ShouldEqual, dependency.ErrTenantRequired)
+
+			// _reindex仅复制本租户
+			res, err := NewIndexLifecycle[lifecycleTenant](WithWritesPaused()).Migrate(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(res.To, convey.ShouldEqual, "article_v2")
+			convey.So(es.indices["article_v2"].docs, convey.ShouldContainKey, "1")
+			convey.So(es.indices["article_v2"].docs, convey.ShouldNotContainKey, "2")
+
+			// 应用侧复制仅迭代本租户
+			es.indices["article_v2"].docs["3"] = json.RawMessage(`{"id":"3","bizId":8}`)
+			res, err = NewIndexLifecycle[lifecycleTenant](WithWritesPaused(), WithForceReindex(), WithAppCopy(10)).Migrate(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(res.To, convey.ShouldEqual, "article_v3")
+			convey.So(es.indices["article_v3"].docs, convey.ShouldContainKey, "1")
+			convey.So(es.indices["article_v3"].docs, convey.ShouldHaveLength, 1)
+		})
+	})
+}
@@ -0,0 +1,156 @@
+package elasticex
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// MappingDiff 期望的mapping与当前索引的差异
+type MappingDiff struct {
+	Added    []string `json:"added"`    // 新增字段，put mapping即可
+	Changed  []string `json:"changed"`  // 类型、分词器等变化的字段，需要重建索引
+	Settings []string `json:"settings"` // 分片数、分析器等不可变设置变化，需要重建索引
+}
+
+func (d *MappingDiff) IsEmpty() bool {
+	return d == nil || len(d.Added)+len(d.Changed)+len(d.Settings) == 0
+}
+
+func (d *MappingDiff) NeedReindex() bool {
+	return d != nil && len(d.Changed)+len(d.Settings) > 0
+}
+
+// parseMappingBody parse the body of IMapping, {"settings":{...},"mappings":{...}}
+func parseMappingBody(body string) (settings map[string]any, mappings map[string]any, err error) {
+	v := struct {
+		Settings map[string]any `json:"settings"`
+		Mappings map[string]any `json:"mappings"`
+	}{}
+	if err = json.Unmarshal([]byte(body), &v); err != nil {
+		return nil, nil, err
+	}
+	return v.Settings, v.Mappings, nil
+}
+
+/*
+DiffMapping compare the desired mapping with the actual mapping of the index, fields are compared by path,
+only the properties in the desired mapping are compared, so the defaults added by es are ignored.
+
+	title          => {"type":"text","analyzer":"ik_max_word"}
+	title.keyword  => {"type":"keyword"}            multi-fields
+	author.name    => {"type":"keyword"}            object or nested properties
+*/
+func DiffMapping(desiredSettings, desiredMappings, actualSettings, actualMappings map[string]any) *MappingDiff {
+	diff := &MappingDiff{}
+	desired, actual := map[string]map[string]any{}, map[string]map[string]any{}
+	flattenProperties("", desiredMappings, desired)
+	flattenProperties("", actualMappings, actual)
+	for path, props := range desired {
+		cur, ok := actual[path]
+		if !ok {
+			diff.Added = append(diff.Added, path)
+			continue
+		}
+		for k, v := range props {
+			if !sameValue(v, cur[k]) && !(k == "type" && v == "object" && cur[k] == nil) {
+				diff.Changed = append(diff.Changed, path)
+				break
+			}
+		}
+	}
+	for _, key := range []string{"number_of_shards", "analysis"} {
+		v, ok := settingValue(desiredSettings, key)
+		if !ok {
+			continue
+		}
+		if cur, _ := settingValue(actualSettings, key); !sameValue(v, cur) {
+			diff.Settings = append(diff.Settings, key)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+func flattenProperties(prefix string, mapping map[string]any, res map[string]map[string]any) {
+	properties, _ := mapping["properties"].(map[string]any)
+	for name, v := range properties {
+		field, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		props := map[string]any{}
+		for k, pv := range field {
+			if k == "properties" || k == "fields" {
+				continue
+			}
+			props[k] = pv
+		}
+		res[path] = props
+		flattenProperties(path, field, res)
+		if fields, ok := field["fields"].(map[string]any); ok {
+			flattenProperties(path, map[string]any{"properties": fields}, res)
+		}
+	}
+}
+
+// settingValue get setting by key, both {"index":{"key":v}} and {"key":v} are accepted
+func settingValue(settings map[string]any, key string) (any, bool) {
+	if settings == nil {
+		return nil, false
+	}
+	if index, ok := settings["index"].(map[string]any); ok {
+		if v, ok := index[key]; ok {
+			return v, true
+		}
+	}
+	if v, ok := settings["index."+key]; ok {
+		return v, true
+	}
+	v, ok := settings[key]
+	return v, ok
+}
+
+// sameValue es returns numbers and booleans of settings as strings
+func sameValue(a, b any) bool {
+	if reflect.DeepEqual(a, b) {
+		return true
+	}
+	ma, oka := a.(map[string]any)
+	mb, okb := b.(map[string]any)
+	if oka && okb {
+		if len(ma) != len(mb) {
+			return false
+		}
+		for k, v := range ma {
+			if !sameValue(v, mb[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	sa, oka := a.([]any)
+	sb, okb := b.([]any)
+	if oka && okb {
+		if len(sa) != len(sb) {
+			return false
+		}
+		for i := range sa {
+			if !sameValue(sa[i], sb[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if a == nil || b == nil || oka || okb {
+		return false
+	}
+	return strings.EqualFold(fmt.Sprint(a), fmt.Sprint(b))
+}
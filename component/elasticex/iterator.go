@@ -0,0 +1,326 @@
+package elasticex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	iLog "github.com/illidaris/logger"
+	"github.com/olivere/elastic/v7"
+	"go.uber.org/zap"
+)
+
+const (
+	DEFAULT_ITER_BATCH      = 1000
+	DEFAULT_ITER_KEEP_ALIVE = "1m"
+	DEFAULT_ITER_MAX_REOPEN = 3
+	DEFAULT_ITER_TIEBREAKER = "id"         // 文档的唯一字段，pit丢失后可重新打开继续迭代
+	TIEBREAKER_SHARD_DOC    = "_shard_doc" // pit 隐式排序字段，无需文档字段，但pit丢失后无法继续
+)
+
+var (
+	ErrIterStop = errors.New("iterator stop")
+	ErrPitLost  = errors.New("point in time is lost")
+
+	errPitUnsupported = errors.New("point in time is not supported")
+)
+
+type IterOptions struct {
+	BatchSize  int    // 每批数量
+	KeepAlive  string // pit或scroll的保活时间，每批请求都会续期
+	Tiebreaker string // 排序的唯一字段，默认id，pit丢失后重新打开需要文档字段
+	MaxReopen  int    // pit丢失后最多重新打开次数
+	Scroll     bool   // 强制使用scroll
+}
+
+type IterOptionFunc func(*IterOptions)
+
+func WithIterBatchSize(v int) IterOptionFunc {
+	return func(o *IterOptions) {
+		o.BatchSize = v
+	}
+}
+
+func WithIterKeepAlive(v string) IterOptionFunc {
+	return func(o *IterOptions) {
+		o.KeepAlive = v
+	}
+}
+
+// WithIterTiebreaker unique field to sort, default "id", the documents without unique keyword field can use TIEBREAKER_SHARD_DOC,
+// but the iteration fails with ErrPitLost when the point in time is lost
+func WithIterTiebreaker(v string) IterOptionFunc {
+	return func(o *IterOptions) {
+		o.Tiebreaker = v
+	}
+}
+
+func WithIterMaxReopen(v int) IterOptionFunc {
+	return func(o *IterOptions) {
+		o.MaxReopen = v
+	}
+}
+
+// WithIterScroll use scroll instead of point in time
+func WithIterScroll() IterOptionFunc {
+	return func(o *IterOptions) {
+		o.Scroll = true
+	}
+}
+
+/*
+Iterator deep iteration of all documents matched the conds, by point in time and search_after,
+scroll is used when the cluster does not support point in time (before 7.10).
+
+	it := elasticex.NewIterator[Article](elasticex.WithIterBatchSize(500))
+	err := it.Each(ctx, func(hit *elastic.SearchHit, t *Article) error {
+		...
+	}, q.Option(), dependency.WithSearchAfter(page))
+
+Sorts and the start sort values are taken from the SearchAfter of opts, or sorts of the Page.
+The tiebreaker is appended to the sorts, so the sort values are unique.
+*/
+type Iterator[T dependency.IEntity] struct {
+	opts *IterOptions
+}
+
+func NewIterator[T dependency.IEntity](opts ...IterOptionFunc) *Iterator[T] {
+	o := &IterOptions{
+		BatchSize:  DEFAULT_ITER_BATCH,
+		KeepAlive:  DEFAULT_ITER_KEEP_ALIVE,
+		Tiebreaker: DEFAULT_ITER_TIEBREAKER,
+		MaxReopen:  DEFAULT_ITER_MAX_REOPEN,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return &Iterator[T]{opts: o}
+}
+
+// Each call fn for each document in order, return ErrIterStop in fn to stop without error
+func (it *Iterator[T]) Each(ctx context.Context, fn func(hit *elastic.SearchHit, t *T) error, opts ...dependency.BaseOptionFunc) error {
+	err := it.each(ctx, fn, opts...)
+	if errors.Is(err, ErrIterStop) {
+		return nil
+	}
+	return err
+}
+
+// Chan stream documents through the channel, the error channel receive at most one error after the documents channel is closed
+func (it *Iterator[T]) Chan(ctx context.Context, opts ...dependency.BaseOptionFunc) (<-chan *T, <-chan error) {
+	ch := make(chan *T, it.opts.BatchSize)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(errCh)
+		defer close(ch)
+		err := it.Each(ctx, func(hit *elastic.SearchHit, t *T) error {
+			select {
+			case ch <- t:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}, opts...)
+		if err != nil {
+			errCh <- err
+		}
+	}()
+	return ch, errCh
+}
+
+func (it *Iterator[T]) each(ctx context.Context, fn func(hit *elastic.SearchHit, t *T) error, opts ...dependency.BaseOptionFunc) error {
+	opts, _, err := tenantOptions[T](ctx, nil, dependency.TENANT_OP_QUERY, true, opts)
+	if err != nil {
+		return err
+	}
+	var (
+		t      T
+		opt    = dependency.NewBaseOption(opts...)
+		db     = CoreFrmCtx(ctx, opt.GetDataBase(t))
+		index  = opt.GetTableName(t)
+		query  elastic.Query
+		sorts  []dependency.ISortField
+		after  []any
+		result = func(res *elastic.SearchResult) (int, error) {
+			if res == nil || res.Hits == nil {
+				return 0, nil
+			}
+			for _, hit := range res.Hits.Hits {
+				tPtr := new(T)
+				if err := json.Unmarshal(hit.Source, tPtr); err != nil {
+					return 0, err
+				}
+				if err := fn(hit, tPtr); err != nil {
+					return 0, err
+				}
+			}
+			return len(res.Hits.Hits), nil
+		}
+	)
+	if len(opt.Conds) > 0 {
+		query = WithQuery(opt.Conds...)
+	} else {
+		query = elastic.NewMatchAllQuery()
+	}
+	if sa := opt.SearchAfter; sa != nil {
+		sorts = sa.GetSorts()
+		if vs := sa.GetSortValues(); len(vs) > 0 && !(len(vs) == 1 && vs[0] == nil) {
+			after = vs
+		}
+	} else if opt.Page != nil {
+		sorts = opt.Page.GetSorts()
+	}
+	if !it.opts.Scroll {
+		err := it.eachPit(ctx, db, index, query, sorts, after, result)
+		if !errors.Is(err, errPitUnsupported) {
+			return err
+		}
+		iLog.WarnCtx(ctx, "point in time is not supported, fallback to scroll", zap.String("index", index), zap.Error(err))
+	}
+	return it.eachScroll(ctx, db, index, query, sorts, result)
+}
+
+func (it *Iterator[T]) sorters(sorts []dependency.ISortField, pit bool) []elastic.Sorter {
+	esSorts := []elastic.Sorter{}
+	for _, sort := range sorts {
+		if sort != nil && sort.GetField() != it.opts.Tiebreaker {
+			esSorts = append(esSorts, elastic.SortInfo{Field: sort.GetField(), Ascending: !sort.GetIsDesc()})
+		}
+	}
+	// _shard_doc 仅pit可用
+	if it.opts.Tiebreaker != "" && (pit || it.opts.Tiebreaker != TIEBREAKER_SHARD_DOC) {
+		esSorts = append(esSorts, elastic.NewFieldSort(it.opts.Tiebreaker).Asc())
+	}
+	return esSorts
+}
+
+func (it *Iterator[T]) eachPit(ctx context.Context, db *elastic.Client, index string, query elastic.Query, sorts []dependency.ISortField, after []any, result func(*elastic.SearchResult) (int, error)) error {
+	open := func() (string, error) {
+		res, err := db.OpenPointInTime(index).KeepAlive(it.opts.KeepAlive).Do(ctx)
+		if err != nil {
+			return "", err
+		}
+		return res.Id, nil
+	}
+	pitId, err := open()
+	if isPitUnsupported(err) {
+		return errors.Join(errPitUnsupported, err)
+	}
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// 上下文取消后也需要关闭pit
+		if _, err := db.ClosePointInTime(pitId).Do(context.WithoutCancel(ctx)); err != nil {
+			iLog.WarnCtx(ctx, "close point in time failed", zap.String("index", index), zap.Error(err))
+		}
+	}()
+	var (
+		sorters = it.sorters(sorts, true)
+		reopens = 0
+	)
+	for {
+		srv := db.Search().
+			PointInTime(elastic.NewPointInTimeWithKeepAlive(pitId, it.opts.KeepAlive)).
+			Query(query).
+			SortBy(sorters...).
+			Size(it.opts.BatchSize)
+		if len(after) > 0 {
+			srv = srv.SearchAfter(after...)
+		}
+		res, err := srv.Do(ctx)
+		if isPitLost(err) {
+			// _shard_doc的排序值在新的pit中无意义
+			if reopens >= it.opts.MaxReopen || it.opts.Tiebreaker == TIEBREAKER_SHARD_DOC {
+				return errors.Join(ErrPitLost, err)
+			}
+			reopens++
+			iLog.WarnCtx(ctx, "point in time is lost, reopen", zap.String("index", index), zap.Int("reopens", reopens), zap.Error(err))
+			if pitId, err = open(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if res.PitId != "" {
+			pitId = res.PitId
+		}
+		n, err := result(res)
+		if err != nil {
+			return err
+		}
+		if n < it.opts.BatchSize {
+			return nil
+		}
+		after = res.Hits.Hits[n-1].Sort
+	}
+}
+
+func (it *Iterator[T]) eachScroll(ctx context.Context, db *elastic.Client, index string, query elastic.Query, sorts []dependency.ISortField, result func(*elastic.SearchResult) (int, error)) error {
+	srv := db.Scroll(index).
+		Query(query).
+		KeepAlive(it.opts.KeepAlive).
+		Size(it.opts.BatchSize)
+	if len(sorts) > 0 {
+		srv = srv.SortBy(it.sorters(sorts, false)...)
+	} else {
+		// 无排序时按_doc最快
+		srv = srv.Sort("_doc", true)
+	}
+	defer func() {
+		if err := srv.Clear(context.WithoutCancel(ctx)); err != nil {
+			iLog.WarnCtx(ctx, "clear scroll failed", zap.String("index", index), zap.Error(err))
+		}
+	}()
+	for {
+		res, err := srv.Do(ctx)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		n, err := result(res)
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// isPitUnsupported the cluster before 7.10 has no handler of _pit
+func isPitUnsupported(err error) bool {
+	if err == nil {
+		return false
+	}
+	var e *elastic.Error
+	if !errors.As(err, &e) {
+		return false
+	}
+	if e.Status == 405 {
+		return true
+	}
+	if e.Status == 400 || e.Status == 404 {
+		return e.Details == nil || !strings.Contains(e.Details.Type, "index_not_found")
+	}
+	return false
+}
+
+// isPitLost keep alive of the pit is expired
+func isPitLost(err error) bool {
+	if err == nil {
+		return false
+	}
+	var e *elastic.Error
+	if !errors.As(err, &e) || e.Status != 404 {
+		return false
+	}
+	return e.Details == nil || e.Details.Type == "search_context_missing_exception" || strings.Contains(e.Details.Reason, "No search context found")
+}
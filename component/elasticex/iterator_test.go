@@ -0,0 +1,156 @@
+package elasticex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/olivere/elastic/v7"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func iterHits(ids ...int) *elastic.SearchHits {
+	hits := &elastic.SearchHits{}
+	for _, id := range ids {
+		bs, _ := json.Marshal(&testStructShardingPo{Id: fmt.Sprint(id), Code: "x"})
+		hits.Hits = append(hits.Hits, &elastic.SearchHit{Source: bs, Sort: []any{"x", id}})
+	}
+	return hits
+}
+
+// mockIter patch pit and scroll services, search results are taken from pages in order
+func mockIter(openErr error, pages []*elastic.SearchResult, f func(opens, closes *[]string)) {
+	opens, closes := []string{}, []string{}
+	patches := gomonkey.ApplyFunc(CoreFrmCtx, func(ctx context.Context, id string) *elastic.Client {
+		return &elastic.Client{}
+	})
+	defer patches.Reset()
+	patches.ApplyMethodFunc(reflect.TypeOf(&elastic.OpenPointInTimeService{}), "Do", func(ctx context.Context) (*elastic.OpenPointInTimeResponse, error) {
+		if openErr != nil {
+			return nil, openErr
+		}
+		id := fmt.Sprintf("pit%d", len(opens))
+		opens = append(opens, id)
+		return &elastic.OpenPointInTimeResponse{Id: id}, nil
+	})
+	patches.ApplyMethod(reflect.TypeOf(&elastic.Client{}), "ClosePointInTime", func(c *elastic.Client, id string) *elastic.ClosePointInTimeService {
+		closes = append(closes, id)
+		return elastic.NewClosePointInTimeService(c)
+	})
+	patches.ApplyMethodFunc(reflect.TypeOf(&elastic.ClosePointInTimeService{}), "Do", func(ctx context.Context) (*elastic.ClosePointInTimeResponse, error) {
+		return &elastic.ClosePointInTimeResponse{Succeeded: true}, nil
+	})
+	call := 0
+	next := func(ctx context.Context) (*elastic.SearchResult, error) {
+		if call >= len(pages) {
+			return nil, io.EOF
+		}
+		res := pages[call]
+		call++
+		if res.Error != nil {
+			return nil, &elastic.Error{Status: res.Status, Details: res.Error}
+		}
+		return res, nil
+	}
+	patches.ApplyMethodFunc(reflect.TypeOf(&elastic.SearchService{}), "Do", next)
+	patches.ApplyMethodFunc(reflect.TypeOf(&elastic.ScrollService{}), "Do", next)
+	patches.ApplyMethodFunc(reflect.TypeOf(&elastic.ScrollService{}), "Clear", func(ctx context.Context) error {
+		closes = append(closes, "scroll")
+		return nil
+	})
+	f(&opens, &closes)
+}
+
+func TestIteratorPit(t *testing.T) {
+	convey.Convey("TestIteratorPit", t, func() {
+		ctx := context.Background()
+		lost := &elastic.SearchResult{Status: 404, Error: &elastic.ErrorDetails{Type: "search_context_missing_exception"}}
+		pages := []*elastic.SearchResult{
+			{Hits: iterHits(1, 2), PitId: "pit0-1"},
+			lost,
+			{Hits: iterHits(3, 4)},
+			{Hits: iterHits(5)},
+		}
+		mockIter(nil, pages, func(opens, closes *[]string) {
+			ids := []string{}
+			it := NewIterator[testStructShardingPo](WithIterBatchSize(2), WithIterTiebreaker("id"))
+			page := &dto.Page{AfterId: []any{"x", 0}, Sorts: []string{"code"}}
+			err := it.Each(ctx, func(hit *elastic.SearchHit, t *testStructShardingPo) error {
+				ids = append(ids, t.Id)
+				return nil
+			}, dependency.WithSearchAfter(page))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(ids, convey.ShouldResemble, []string{"1", "2", "3", "4", "5"})
+			convey.So(*opens, convey.ShouldResemble, []string{"pit0", "pit1"})
+			convey.So(*closes, convey.ShouldResemble, []string{"pit1"})
+		})
+	})
+}
+
+func TestIteratorPitLost(t *testing.T) {
+	convey.Convey("TestIteratorPitLost", t, func() {
+		ctx := context.Background()
+		lost := &elastic.SearchResult{Status: 404, Error: &elastic.ErrorDetails{Type: "search_context_missing_exception"}}
+		mockIter(nil, []*elastic.SearchResult{{Hits: iterHits(1, 2)}, lost}, func(opens, closes *[]string) {
+			err := NewIterator[testStructShardingPo](WithIterBatchSize(2), WithIterTiebreaker(TIEBREAKER_SHARD_DOC)).Each(ctx, func(hit *elastic.SearchHit, t *testStructShardingPo) error {
+				return nil
+			})
+			convey.So(errors.Is(err, ErrPitLost), convey.ShouldBeTrue)
+			convey.So(*closes, convey.ShouldResemble, []string{"pit0"})
+		})
+		// 默认按文档字段排序，pit丢失后重新打开
+		mockIter(nil, []*elastic.SearchResult{{Hits: iterHits(1, 2)}, lost, {Hits: iterHits(3)}}, func(opens, closes *[]string) {
+			ids := []string{}
+			err := NewIterator[testStructShardingPo](WithIterBatchSize(2)).Each(ctx, func(hit *elastic.SearchHit, t *testStructShardingPo) error {
+				ids = append(ids, t.Id)
+				return nil
+			})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(ids, convey.ShouldResemble, []string{"1", "2", "3"})
+			convey.So(*opens, convey.ShouldResemble, []string{"pit0", "pit1"})
+		})
+	})
+}
+
+func TestIteratorScrollFallback(t *testing.T) {
+	convey.Convey("TestIteratorScrollFallback", t, func() {
+		ctx := context.Background()
+		unsupported := &elastic.Error{Status: 400, Details: &elastic.ErrorDetails{Type: "illegal_argument_exception"}}
+		pages := []*elastic.SearchResult{{Hits: iterHits(1, 2)}, {Hits: iterHits(3)}}
+		mockIter(unsupported, pages, func(opens, closes *[]string) {
+			ch, errCh := NewIterator[testStructShardingPo](WithIterBatchSize(2)).Chan(ctx)
+			ids := []string{}
+			for t := range ch {
+				ids = append(ids, t.Id)
+			}
+			convey.So(<-errCh, convey.ShouldBeNil)
+			convey.So(ids, convey.ShouldResemble, []string{"1", "2", "3"})
+			convey.So(len(*opens), convey.ShouldEqual, 0)
+			convey.So(*closes, convey.ShouldResemble, []string{"scroll"})
+		})
+	})
+}
+
+func TestIteratorStop(t *testing.T) {
+	convey.Convey("TestIteratorStop", t, func() {
+		ctx := context.Background()
+		mockIter(nil, []*elastic.SearchResult{{Hits: iterHits(1, 2)}, {Hits: iterHits(3)}}, func(opens, closes *[]string) {
+			count := 0
+			err := NewIterator[testStructShardingPo](WithIterBatchSize(2), WithIterScroll()).Each(ctx, func(hit *elastic.SearchHit, t *testStructShardingPo) error {
+				count++
+				return ErrIterStop
+			})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(count, convey.ShouldEqual, 1)
+			convey.So(len(*opens), convey.ShouldEqual, 0)
+			convey.So(*closes, convey.ShouldResemble, []string{"scroll"})
+		})
+	})
+}
@@ -0,0 +1,90 @@
+package elasticex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/olivere/elastic/v7"
+)
+
+var ErrNotComposite = errors.New("aggregation is not composite")
+
+// BaseAggregate aggregate the documents matched the conds, index is resolved by TableName and DataBase of opts
+func (r *BaseRepository[T]) BaseAggregate(ctx context.Context, aggs *Aggs[T], opts ...dependency.BaseOptionFunc) (elastic.Aggregations, error) {
+	if err := aggs.Err(); err != nil {
+		return nil, err
+	}
+	opts, _, err := tenantOptions[T](ctx, nil, dependency.TENANT_OP_QUERY, true, opts)
+	if err != nil {
+		return nil, err
+	}
+	opt := dependency.NewBaseOption(opts...)
+	res, err := aggs.Apply(r.GetAggregateServiceFrmOpt(ctx, opt)).Do(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return res.Aggregations, nil
+}
+
+/*
+BaseComposite page all buckets of the composite aggregation of name by after key, iterate is called for each page.
+
+	a := elasticex.NewAggs[Article]()
+	a.Add("by_author", a.Composite(a.TermsSource("author", "Author.Name")).Size(500))
+	err := repo.BaseComposite(ctx, a, "by_author", func(aggs elastic.Aggregations) error {
+		rows, err := elasticex.DecodeBuckets[AuthorStat](aggs, "by_author")
+		...
+	})
+*/
+func (r *BaseRepository[T]) BaseComposite(ctx context.Context, aggs *Aggs[T], name string, iterate func(aggs elastic.Aggregations) error, opts ...dependency.BaseOptionFunc) error {
+	agg, ok := aggs.Get(name).(*elastic.CompositeAggregation)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotComposite, name)
+	}
+	var after map[string]any
+	defer agg.AggregateAfter(nil)
+	for {
+		agg.AggregateAfter(after)
+		res, err := r.BaseAggregate(ctx, aggs, opts...)
+		if err != nil {
+			return err
+		}
+		items, ok := res.Composite(name)
+		if !ok || len(items.Buckets) == 0 {
+			return nil
+		}
+		if err := iterate(res); err != nil {
+			return err
+		}
+		if len(items.AfterKey) == 0 {
+			return nil
+		}
+		after = items.AfterKey
+	}
+}
+
+// CompositeAll decode all buckets of the composite aggregation of name into B, see BaseRepository.BaseComposite
+func CompositeAll[B any, T dependency.IEntity](ctx context.Context, r *BaseRepository[T], aggs *Aggs[T], name string, opts ...dependency.BaseOptionFunc) ([]B, error) {
+	res := []B{}
+	err := r.BaseComposite(ctx, aggs, name, func(page elastic.Aggregations) error {
+		bs, err := DecodeBuckets[B](page, name)
+		res = append(res, bs...)
+		return err
+	}, opts...)
+	return res, err
+}
+
+// GetAggregateServiceFrmOpt search service without hits
+func (r *BaseRepository[T]) GetAggregateServiceFrmOpt(ctx context.Context, opt *dependency.BaseOption) *elastic.SearchService {
+	var (
+		t T
+	)
+	db := CoreFrmCtx(ctx, opt.GetDataBase(t))
+	srv := db.Search().Index(opt.GetTableName(t)).Size(0)
+	if len(opt.Conds) > 0 {
+		srv = srv.Query(WithQuery(opt.Conds...))
+	}
+	return srv
+}
@@ -22,18 +22,31 @@ func (r *BaseRepository[T]) BaseCreate(ctx context.Context, ts []*T, opts ...dep
 
 // BaseCreate
 func (r *BaseRepository[T]) BaseCreateOne(ctx context.Context, t *T, opts ...dependency.BaseOptionFunc) (int64, error) {
+	opts, scope, err := tenantOptions(ctx, t, dependency.TENANT_OP_CREATE, false, opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := dependency.StampTenant(scope, t); err != nil {
+		return 0, err
+	}
 	srv := r.GetIndexService(ctx, opts...)
 	p, ok := any(t).(dependency.IEntity)
 	if ok && p.ID() != nil {
+		if err := r.tenantOwned(ctx, scope, p.ID(), opts...); err != nil {
+			return 0, err
+		}
 		srv = srv.Id(cast.ToString(p.ID()))
 	}
-	_, err := srv.
+	_, err = srv.
 		BodyJson(t).
 		Do(ctx)
 	if err != nil {
 		// Handle error
 		return 0, err
 	}
+	if err := r.dualIndex(ctx, t, opts...); err != nil {
+		return 0, err
+	}
 	// println(res.Shards.Total)
 	return 1, err
 }
@@ -43,22 +56,55 @@ func (r *BaseRepository[T]) BaseCreates(ctx context.Context, ts []*T, opts ...de
 	var (
 		t T
 	)
+	if len(ts) == 0 {
+		return 0, nil
+	}
+	opts, scope, err := tenantOptions(ctx, ts[0], dependency.TENANT_OP_CREATE, false, opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := dependency.StampTenant(scope, ts...); err != nil {
+		return 0, err
+	}
+	// 覆盖写入其他租户的同ID文档
+	if err := r.tenantOwnedAll(ctx, scope, ts, opts...); err != nil {
+		return 0, err
+	}
 	opt := dependency.NewBaseOption(opts...)
 	db := CoreFrmCtx(ctx, opt.GetDataBase(t))
-	bulkRequest := db.Bulk()
+	ids := []string{}
 	for _, t := range ts {
-		p, ok := any(t).(dependency.IEntity)
-		if !ok {
-			continue
-		}
-		srv := elastic.NewBulkIndexRequest().Index(opt.GetTableName(p))
-		if p.ID() != nil {
-			srv = srv.Id(cast.ToString(p.ID()))
+		if p, ok := any(t).(dependency.IEntity); ok && p.ID() != nil {
+			ids = append(ids, cast.ToString(p.ID()))
 		}
-		req := srv.Doc(t)
-		bulkRequest.Add(req)
 	}
-	res, err := bulkRequest.Do(ctx)
+	var res *elastic.BulkResponse
+	err = withDualWrite(opt.GetTableName(t), ids, nil, func(dual string) error {
+		bulkRequest := db.Bulk()
+		for _, t := range ts {
+			p, ok := any(t).(dependency.IEntity)
+			if !ok {
+				continue
+			}
+			srv := elastic.NewBulkIndexRequest().Index(opt.GetTableName(p))
+			if p.ID() != nil {
+				srv = srv.Id(cast.ToString(p.ID()))
+			}
+			req := srv.Doc(t)
+			bulkRequest.Add(req)
+			// 重建索引期间双写
+			if dual != "" {
+				dualReq := elastic.NewBulkIndexRequest().Index(dual)
+				if p.ID() != nil {
+					dualReq = dualReq.Id(cast.ToString(p.ID()))
+				}
+				bulkRequest.Add(dualReq.Doc(t))
+			}
+		}
+		var err error
+		res, err = bulkRequest.Do(ctx)
+		return err
+	})
 	if err != nil {
 		// Handle error
 		return 0, err
@@ -74,40 +120,105 @@ func (r *BaseRepository[T]) BaseSave(ctx context.Context, ts []*T, opts ...depen
 
 // BaseUpdate
 func (r *BaseRepository[T]) BaseUpdate(ctx context.Context, t *T, opts ...dependency.BaseOptionFunc) (int64, error) {
+	opts, scope, err := tenantOptions(ctx, t, dependency.TENANT_OP_UPDATE, false, opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := dependency.StampTenant(scope, t); err != nil {
+		return 0, err
+	}
 	srv := r.GetIndexService(ctx, opts...)
 	p, ok := any(t).(dependency.IEntity)
 	if ok && p.ID() != nil {
+		if err := r.tenantOwned(ctx, scope, p.ID(), opts...); err != nil {
+			return 0, err
+		}
 		srv = srv.Id(cast.ToString(p.ID()))
 	} else {
 		return 0, nil
 	}
-	_, err := srv.
+	_, err = srv.
 		BodyJson(t).
 		Do(ctx)
 	if err != nil {
 		// Handle error
 		return 0, err
 	}
+	if err := r.dualIndex(ctx, t, opts...); err != nil {
+		return 0, err
+	}
 	// println(res.Shards.Total)
 	return 1, err
 }
 
 // BaseDelete
 func (r *BaseRepository[T]) BaseDelete(ctx context.Context, t *T, opts ...dependency.BaseOptionFunc) (int64, error) {
+	opts, scope, err := tenantOptions(ctx, t, dependency.TENANT_OP_DELETE, false, opts)
+	if err != nil {
+		return 0, err
+	}
 	srv := r.GetDeleteService(ctx, opts...)
 	p, ok := any(t).(dependency.IEntity)
 	if ok && p.ID() != nil {
+		if err := r.tenantOwned(ctx, scope, p.ID(), opts...); err != nil {
+			return 0, err
+		}
 		srv = srv.Id(cast.ToString(p.ID()))
 	} else {
 		return 0, nil
 	}
-	_, err := srv.Do(ctx)
+	_, err = srv.Do(ctx)
 	if err != nil {
 		return 0, err
 	}
+	if err := r.dualDelete(ctx, p, opts...); err != nil {
+		return 0, err
+	}
 	return 1, nil
 }
 
+// dualIndex write the document to the dual write index while reindex
+func (r *BaseRepository[T]) dualIndex(ctx context.Context, t *T, opts ...dependency.BaseOptionFunc) error {
+	var (
+		p   T
+		ids []string
+	)
+	opt := dependency.NewBaseOption(opts...)
+	if e, ok := any(t).(dependency.IEntity); ok && e.ID() != nil {
+		ids = append(ids, cast.ToString(e.ID()))
+	}
+	return withDualWrite(opt.GetTableName(p), ids, nil, func(dual string) error {
+		if dual == "" {
+			return nil
+		}
+		srv := CoreFrmCtx(ctx, opt.GetDataBase(p)).Index().Index(dual)
+		if len(ids) > 0 {
+			srv = srv.Id(ids[0])
+		}
+		_, err := srv.BodyJson(t).Do(ctx)
+		return err
+	})
+}
+
+// dualDelete delete the document from the dual write index while reindex, and record it for the copy may write it back
+func (r *BaseRepository[T]) dualDelete(ctx context.Context, e dependency.IEntity, opts ...dependency.BaseOptionFunc) error {
+	var (
+		p T
+	)
+	opt := dependency.NewBaseOption(opts...)
+	id := cast.ToString(e.ID())
+	return withDualWrite(opt.GetTableName(p), nil, []string{id}, func(dual string) error {
+		if dual == "" {
+			return nil
+		}
+		_, err := CoreFrmCtx(ctx, opt.GetDataBase(p)).Delete().Index(dual).Id(id).Do(ctx)
+		if elastic.IsNotFound(err) {
+			return nil
+		}
+		return err
+	})
+}
+
 // GetIndexService
 func (r *BaseRepository[T]) GetIndexService(ctx context.Context, opts ...dependency.BaseOptionFunc) *elastic.IndexService {
 	var (
@@ -12,6 +12,10 @@ import (
 // BaseGet
 func (r *BaseRepository[T]) BaseGet(ctx context.Context, opts ...dependency.BaseOptionFunc) (*T, error) {
 	t := new(T)
+	opts, scope, err := tenantOptions[T](ctx, nil, dependency.TENANT_OP_QUERY, false, opts)
+	if err != nil {
+		return nil, err
+	}
 	res, err := r.GetGetService(ctx, opts...).Do(ctx)
 	if err != nil {
 		return nil, err
@@ -27,11 +31,19 @@ func (r *BaseRepository[T]) BaseGet(ctx context.Context, opts ...dependency.Base
 	if err != nil {
 		return nil, err
 	}
+	// 按ID获取无法过滤，其他租户的文档视为不存在
+	if !tenantMatch(scope, t) {
+		return nil, nil
+	}
 	return t, nil
 }
 
 // BaseCount
 func (r *BaseRepository[T]) BaseCount(ctx context.Context, opts ...dependency.BaseOptionFunc) (int64, error) {
+	opts, _, err := tenantOptions[T](ctx, nil, dependency.TENANT_OP_QUERY, true, opts)
+	if err != nil {
+		return 0, err
+	}
 	return r.GetCountService(ctx, opts...).Do(ctx)
 }
 
@@ -58,6 +70,11 @@ func (r *BaseRepository[T]) BaseQueryWithCount(ctx context.Context, opts ...depe
 	if cursor+size <= MAX_WINDOW_SIZE {
 		return r.BaseSearch(ctx, opts...)
 	}
+	opts, _, err := tenantOptions[T](ctx, nil, dependency.TENANT_OP_QUERY, true, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	opt = dependency.NewBaseOption(opts...)
 	// query conditions
 	query := WithQuery(opt.Conds...)
 	// query sorts
@@ -93,6 +110,10 @@ func (r *BaseRepository[T]) BaseQueryWithCount(ctx context.Context, opts ...depe
 
 func (r *BaseRepository[T]) BaseSearch(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]T, int64, error) {
 	result := []T{}
+	opts, _, err := tenantOptions[T](ctx, nil, dependency.TENANT_OP_QUERY, true, opts)
+	if err != nil {
+		return nil, 0, err
+	}
 	opt := dependency.NewBaseOption(opts...)
 	srv := r.GetSearchServiceFrmOpt(ctx, opt)
 	res, err := srv.Do(ctx)
@@ -0,0 +1,129 @@
+package elasticex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/olivere/elastic/v7"
+	"github.com/spf13/cast"
+)
+
+/*
+BaseSync bulk upsert and delete documents, deletes is id => version.
+Documents of dependency.IVersion are written with external version, so the stale writes are ignored,
+the version 0 is written without version. Documents not found of deletes are ignored.
+While the index is migrating, the changes are also written to the dual write index, see IndexLifecycle.Migrate.
+*/
+func (r *BaseRepository[T]) BaseSync(ctx context.Context, upserts []*T, deletes map[string]int64, opts ...dependency.BaseOptionFunc) (int64, error) {
+	var (
+		t T
+	)
+	if len(upserts)+len(deletes) == 0 {
+		return 0, nil
+	}
+	opts, scope, err := tenantOptions(ctx, &t, dependency.TENANT_OP_UPDATE, false, opts)
+	if err != nil {
+		return 0, err
+	}
+	if err := dependency.StampTenant(scope, upserts...); err != nil {
+		return 0, err
+	}
+	if err := r.tenantOwnedAll(ctx, scope, upserts, opts...); err != nil {
+		return 0, err
+	}
+	if deletes, err = r.tenantDeletes(ctx, scope, deletes, opts...); err != nil {
+		return 0, err
+	}
+	opt := dependency.NewBaseOption(opts...)
+	index := opt.GetTableName(t)
+	writes, removes := make([]string, 0, len(upserts)), make([]string, 0, len(deletes))
+	for _, u := range upserts {
+		if e, ok := any(u).(dependency.IEntity); ok && e.ID() != nil {
+			writes = append(writes, cast.ToString(e.ID()))
+		}
+	}
+	for id := range deletes {
+		removes = append(removes, id)
+	}
+	var affect int64
+	err = withDualWrite(index, writes, removes, func(dual string) error {
+		bulk := CoreFrmCtx(ctx, opt.GetDataBase(t)).Bulk()
+		// 重建索引期间双写
+		indices := []string{index}
+		if dual != "" {
+			indices = append(indices, dual)
+		}
+		for _, idx := range indices {
+			for _, u := range upserts {
+				req := elastic.NewBulkIndexRequest().Index(idx).Doc(u)
+				if e, ok := any(u).(dependency.IEntity); ok && e.ID() != nil {
+					req = req.Id(cast.ToString(e.ID()))
+				}
+				if v, ok := any(u).(dependency.IVersion); ok && v.GetVersion() > 0 {
+					req = req.VersionType("external").Version(v.GetVersion())
+				}
+				bulk.Add(req)
+			}
+			for id, version := range deletes {
+				req := elastic.NewBulkDeleteRequest().Index(idx).Id(id)
+				if version > 0 {
+					req = req.VersionType("external").Version(version)
+				}
+				bulk.Add(req)
+			}
+		}
+		res, err := bulk.Do(ctx)
+		if err != nil {
+			return err
+		}
+		for _, items := range res.Items {
+			for op, item := range items {
+				switch {
+				case item.Status >= 200 && item.Status < 300:
+					if item.Index != dual {
+						affect++
+					}
+				case item.Status == 409, op == "delete" && item.Status == 404:
+					// 版本过旧或已删除
+				default:
+					return fmt.Errorf("bulk %s %s failed: %d %v", op, item.Id, item.Status, item.Error)
+				}
+			}
+		}
+		return nil
+	})
+	return affect, err
+}
+
+// tenantDeletes 仅保留属于当前租户的待删除ID，不存在的ID原样保留
+func (r *BaseRepository[T]) tenantDeletes(ctx context.Context, scope *dependency.TenantScope, deletes map[string]int64, opts ...dependency.BaseOptionFunc) (map[string]int64, error) {
+	if scope == nil || len(deletes) == 0 {
+		return deletes, nil
+	}
+	res := make(map[string]int64, len(deletes))
+	for id, version := range deletes {
+		err := r.tenantOwned(ctx, scope, id, opts...)
+		if errors.Is(err, dependency.ErrTenantMismatch) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		res[id] = version
+	}
+	return res, nil
+}
+
+// BaseQueryByIDs documents of ids, the missing ids are ignored
+func (r *BaseRepository[T]) BaseQueryByIDs(ctx context.Context, ids []string, opts ...dependency.BaseOptionFunc) ([]T, error) {
+	if len(ids) == 0 {
+		return []T{}, nil
+	}
+	opts = append(opts,
+		dependency.WithConds(elastic.NewIdsQuery().Ids(ids...)),
+		dependency.WithBatchSize(int64(len(ids))))
+	ts, _, err := r.BaseSearch(ctx, opts...)
+	return ts, err
+}
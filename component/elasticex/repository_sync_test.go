@@ -0,0 +1,48 @@
+package elasticex
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type syncVersioned struct {
+	dependency.EmptyPo
+	Id      string `json:"id"`
+	Code    string `json:"code"`
+	Version int64  `json:"version"`
+}
+
+func (s syncVersioned) ID() any           { return s.Id }
+func (s syncVersioned) TableName() string { return "article" }
+func (s syncVersioned) GetVersion() int64 { return s.Version }
+
+func TestBaseSync(t *testing.T) {
+	mockFakeES(func(es *fakeES) {
+		convey.Convey("TestBaseSync", t, func() {
+			ctx := context.Background()
+			es.indices["article"] = &fakeIndex{docs: map[string]json.RawMessage{}}
+			repo := &BaseRepository[syncVersioned]{}
+
+			affect, err := repo.BaseSync(ctx, []*syncVersioned{{Id: "1", Code: "a", Version: 2}, {Id: "2", Code: "b", Version: 1}}, nil)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 2)
+
+			// 旧版本被忽略，不存在的删除被忽略
+			affect, err = repo.BaseSync(ctx, []*syncVersioned{{Id: "1", Code: "stale", Version: 1}}, map[string]int64{"2": 2, "3": 0})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+
+			ts, err := repo.BaseQueryByIDs(ctx, []string{"1"})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(ts, convey.ShouldResemble, []syncVersioned{{Id: "1", Code: "a", Version: 2}})
+
+			affect, err = repo.BaseSync(ctx, nil, nil)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 0)
+		})
+	})
+}
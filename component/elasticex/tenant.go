@@ -0,0 +1,83 @@
+package elasticex
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/olivere/elastic/v7"
+	"github.com/spf13/cast"
+)
+
+// tenantOptions 解析租户，filter为true时追加BizId的term过滤，返回的opts携带租户范围与分片键
+func tenantOptions[T any](ctx context.Context, t *T, op string, filter bool, opts []dependency.BaseOptionFunc) ([]dependency.BaseOptionFunc, *dependency.TenantScope, error) {
+	opt := dependency.NewBaseOption(opts...)
+	if err := dependency.ApplyTenant(ctx, t, opt, op); err != nil {
+		return nil, nil, err
+	}
+	scope := opt.Tenant
+	if scope == nil {
+		return opts, nil, nil
+	}
+	dbKeys, tbKeys := opt.DbShardingKey, opt.TbShardingKey
+	res := append(append([]dependency.BaseOptionFunc{}, opts...), func(o *dependency.BaseOption) {
+		o.Tenant, o.DbShardingKey, o.TbShardingKey = scope, dbKeys, tbKeys
+		if filter {
+			o.Conds = append(o.Conds, tenantQuery(scope))
+		}
+	})
+	return res, scope, nil
+}
+
+// tenantQuery 租户范围的term过滤
+func tenantQuery(scope *dependency.TenantScope) elastic.Query {
+	return elastic.NewTermQuery(scope.Column, scope.BizId)
+}
+
+// tenantOwned 按ID写入或删除前，确认已存在的文档属于当前租户
+func (r *BaseRepository[T]) tenantOwned(ctx context.Context, scope *dependency.TenantScope, id any, opts ...dependency.BaseOptionFunc) error {
+	if scope == nil {
+		return nil
+	}
+	res, err := r.GetGetService(ctx, opts...).Id(cast.ToString(id)).Do(ctx)
+	if elastic.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !res.Found {
+		return nil
+	}
+	t := new(T)
+	if err := json.Unmarshal(res.Source, t); err != nil {
+		return err
+	}
+	if !tenantMatch(scope, t) {
+		return dependency.ErrTenantMismatch
+	}
+	return nil
+}
+
+// tenantOwnedAll 批量写入前确认已存在的同ID文档属于当前租户
+func (r *BaseRepository[T]) tenantOwnedAll(ctx context.Context, scope *dependency.TenantScope, ts []*T, opts ...dependency.BaseOptionFunc) error {
+	if scope == nil {
+		return nil
+	}
+	for _, t := range ts {
+		if e, ok := any(t).(dependency.IEntity); ok && e.ID() != nil {
+			if err := r.tenantOwned(ctx, scope, e.ID(), opts...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func tenantMatch[T any](scope *dependency.TenantScope, t *T) bool {
+	if scope == nil {
+		return true
+	}
+	tenant, ok := any(t).(dependency.ITenant)
+	return !ok || tenant.GetTenant() == scope.BizId
+}
@@ -0,0 +1,263 @@
+package gormex
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/illidaris/aphrodite/pkg/convert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	TAG_BLIND_INDEX = "BLINDINDEX" // gorm:"blindIndex:Mobile" 盲索引字段，值为被索引的字段名
+)
+
+var (
+	ErrNoFieldCipher = errors.New("field cipher is not set")
+
+	fieldCipher IFieldCipher
+)
+
+// IFieldCipher 字段加解密，一般为encrypter.FieldCipher
+type IFieldCipher interface {
+	Encrypt(ctx context.Context, plain, aad []byte) ([]byte, error)
+	Decrypt(ctx context.Context, data, aad []byte) ([]byte, error)
+	BlindIndex(ctx context.Context, plain []byte) (string, error)
+}
+
+// SetFieldCipher 设置EncryptedString使用的加解密
+func SetFieldCipher(c IFieldCipher) {
+	fieldCipher = c
+}
+
+/*
+EncryptedString 写入时加密，读取时解密，空字符串不加密
+
+	type User struct {
+		Mobile     gormex.EncryptedString `gorm:"column:mobile;type:varchar(255)"`
+		MobileBidx string                 `gorm:"column:mobileBidx;type:char(64);index;blindIndex:Mobile"`
+	}
+	idx, _ := gormex.BlindIndex(ctx, "13800000000")
+	repo.BaseQuery(ctx, dependency.WithConds("mobileBidx = ?", idx))
+
+String脱敏，日志中不会输出明文，json序列化输出明文。
+Valuer无法获取表与列，加密未绑定AAD，密文在不同行、列之间互换无法被发现，
+需要防篡改的字段应在业务层校验，如以主键作为AAD调用IFieldCipher自行加密。
+*/
+type EncryptedString string
+
+// Plain 明文
+func (s EncryptedString) Plain() string {
+	return string(s)
+}
+
+// String 脱敏，用于日志
+func (s EncryptedString) String() string {
+	return convert.MistyDefault(string(s))
+}
+
+// GoString 脱敏，用于%#v
+func (s EncryptedString) GoString() string {
+	return fmt.Sprintf("%q", s.String())
+}
+
+// Misty 按指定规则脱敏，例如convert.MistyMobile
+func (s EncryptedString) Misty(f func(string) string) string {
+	return f(string(s))
+}
+
+func (s EncryptedString) GormDataType() string {
+	return "string"
+}
+
+// Value encrypt and encode by base64
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	if fieldCipher == nil {
+		return nil, ErrNoFieldCipher
+	}
+	bs, err := fieldCipher.Encrypt(context.Background(), []byte(s), nil)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.EncodeToString(bs), nil
+}
+
+// Scan decode by base64 and decrypt
+func (s *EncryptedString) Scan(value any) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("unsupported type %T of encrypted string", value)
+	}
+	if raw == "" {
+		*s = ""
+		return nil
+	}
+	if fieldCipher == nil {
+		return ErrNoFieldCipher
+	}
+	bs, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return err
+	}
+	plain, err := fieldCipher.Decrypt(context.Background(), bs, nil)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plain)
+	return nil
+}
+
+// BlindIndex 明文的盲索引，用于加密字段的等值查询，空字符串的盲索引为空
+func BlindIndex(ctx context.Context, plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	if fieldCipher == nil {
+		return "", ErrNoFieldCipher
+	}
+	return fieldCipher.BlindIndex(ctx, []byte(plain))
+}
+
+var _ = gorm.Plugin(&BlindIndexPlugin{})
+
+// BlindIndexPlugin 创建与更新前按blindIndex标签填充盲索引字段，以map更新时需自行填充
+type BlindIndexPlugin struct{}
+
+func (p *BlindIndexPlugin) Name() string {
+	return "gormex:blind_index"
+}
+
+func (p *BlindIndexPlugin) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register(p.Name(), fillBlindIndex); err != nil {
+		return err
+	}
+	return db.Callback().Update().Before("gorm:update").Register(p.Name(), fillBlindIndex)
+}
+
+func fillBlindIndex(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	type pair struct{ index, source *schema.Field }
+	pairs := []pair{}
+	for _, field := range db.Statement.Schema.Fields {
+		name, ok := field.TagSettings[TAG_BLIND_INDEX]
+		if !ok {
+			continue
+		}
+		source := db.Statement.Schema.LookUpField(name)
+		if source == nil {
+			_ = db.AddError(fmt.Errorf("blind index source field %s of %s is not found", name, field.Name))
+			return
+		}
+		pairs = append(pairs, pair{field, source})
+	}
+	if len(pairs) == 0 {
+		return
+	}
+	ctx := db.Statement.Context
+	// 源字段为空时盲索引同样置空，避免按旧明文仍能查到
+	index := func(v any) (string, bool) {
+		idx, err := BlindIndex(ctx, plainString(v))
+		if err != nil {
+			_ = db.AddError(err)
+			return "", false
+		}
+		return idx, true
+	}
+	fill := func(rv reflect.Value) {
+		for _, p := range pairs {
+			v, _ := p.source.ValueOf(ctx, rv)
+			idx, ok := index(v)
+			if !ok {
+				return
+			}
+			if err := p.index.Set(ctx, rv, idx); err != nil {
+				_ = db.AddError(err)
+				return
+			}
+		}
+	}
+	// Updates(map)：按map中的源字段计算
+	if m, ok := db.Statement.Dest.(map[string]any); ok {
+		for _, p := range pairs {
+			v, ok := m[p.source.DBName]
+			if !ok {
+				v, ok = m[p.source.Name]
+			}
+			if !ok {
+				continue
+			}
+			if idx, ok := index(v); ok {
+				m[p.index.DBName] = idx
+			}
+		}
+		return
+	}
+	rv := db.Statement.ReflectValue
+	// Model(&t).Updates(p)：ReflectValue指向Model，值来自Dest，计算结果通过SetColumn写入更新列
+	dest := reflect.Indirect(reflect.ValueOf(db.Statement.Dest))
+	if dest.Kind() == reflect.Struct && dest != rv && dest.Type() == db.Statement.Schema.ModelType {
+		selects, restricted := db.Statement.SelectAndOmitColumns(false, true)
+		for _, p := range pairs {
+			v, zero := p.source.ValueOf(ctx, dest)
+			// 零值不更新，Select指定时更新为空
+			if zero && !(restricted && selects[p.source.DBName]) {
+				continue
+			}
+			if restricted && !selects[p.index.DBName] {
+				db.Statement.Selects = append(db.Statement.Selects, p.index.DBName)
+			}
+			idx, ok := index(v)
+			if !ok {
+				return
+			}
+			db.Statement.SetColumn(p.index.DBName, idx, true)
+		}
+		return
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			fill(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		fill(rv)
+	}
+}
+
+// plainString 源字段的明文，nil、空指针与零值为空
+func plainString(v any) string {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return ""
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() || rv.IsZero() {
+		return ""
+	}
+	return fmt.Sprint(plainOf(rv.Interface()))
+}
+
+func plainOf(v any) any {
+	if s, ok := v.(EncryptedString); ok {
+		return s.Plain()
+	}
+	return v
+}
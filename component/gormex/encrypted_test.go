@@ -0,0 +1,186 @@
+package gormex
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/pkg/encrypter"
+	"github.com/smartystreets/goconvey/convey"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type testEncryptedPo struct {
+	dependency.EmptyPo
+	Id         int64           `gorm:"column:id;primaryKey"`
+	Mobile     EncryptedString `gorm:"column:mobile;type:varchar(255)"`
+	MobileBidx string          `gorm:"column:mobileBidx;type:char(64);blindIndex:Mobile"`
+}
+
+func (s testEncryptedPo) TableName() string {
+	return "test_encrypted"
+}
+
+type memDekStore struct {
+	m map[string]*encrypter.DEKEntry
+}
+
+func (s memDekStore) DekSave(ctx context.Context, dek *encrypter.DEKEntry) (int64, error) {
+	s.m[dek.Id] = dek
+	return 1, nil
+}
+
+func (s memDekStore) DekFind(ctx context.Context, ids ...string) ([]*encrypter.DEKEntry, error) {
+	ds := []*encrypter.DEKEntry{}
+	for _, id := range ids {
+		if d, ok := s.m[id]; ok {
+			ds = append(ds, d)
+		}
+	}
+	return ds, nil
+}
+
+func TestEncryptedString(t *testing.T) {
+	convey.Convey("TestEncryptedString", t, func() {
+		ctx := context.Background()
+		kms, _ := encrypter.NewKmEmbed()
+		manage := encrypter.NewKmsManage(kms, memDekStore{m: map[string]*encrypter.DEKEntry{}}, nil)
+		_, err := manage.Generate(ctx, encrypter.WithKmsId("pii"))
+		convey.So(err, convey.ShouldBeNil)
+		SetFieldCipher(encrypter.NewFieldCipher(manage, "pii"))
+		defer SetFieldCipher(nil)
+
+		convey.Convey("value and scan", func() {
+			s := EncryptedString("13800000000")
+			v, err := s.Value()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(v, convey.ShouldNotEqual, "13800000000")
+			var res EncryptedString
+			convey.So(res.Scan([]byte(v.(string))), convey.ShouldBeNil)
+			convey.So(res.Plain(), convey.ShouldEqual, "13800000000")
+			convey.So(fmt.Sprint(res), convey.ShouldNotContainSubstring, "0000")
+			convey.So(fmt.Sprintf("%#v", res), convey.ShouldNotContainSubstring, "0000")
+			convey.So(res.Misty(func(s string) string { return s[:3] }), convey.ShouldEqual, "138")
+
+			v, err = EncryptedString("").Value()
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(v, convey.ShouldEqual, "")
+			convey.So(res.Scan(nil), convey.ShouldBeNil)
+			convey.So(res.Plain(), convey.ShouldEqual, "")
+			convey.So(res.Scan(1), convey.ShouldBeError)
+		})
+
+		convey.Convey("blind index on create", func() {
+			idx, err := BlindIndex(ctx, "13800000000")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(idx, convey.ShouldHaveLength, 64)
+			idx2, _ := BlindIndex(ctx, "13800000000")
+			convey.So(idx2, convey.ShouldEqual, idx)
+
+			db, mock, err := sqlmock.New()
+			convey.So(err, convey.ShouldBeNil)
+			defer db.Close()
+			gormDb, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      db,
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{Logger: NewLogger()})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(gormDb.Use(&BlindIndexPlugin{}), convey.ShouldBeNil)
+
+			var cipherMobile string
+			mock.ExpectBegin()
+			mock.ExpectExec("INSERT INTO `test_encrypted`").
+				WithArgs(sqlmock.AnyArg(), idx).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+			p := &testEncryptedPo{Mobile: "13800000000"}
+			convey.So(gormDb.Create(p).Error, convey.ShouldBeNil)
+			convey.So(p.MobileBidx, convey.ShouldEqual, idx)
+			convey.So(mock.ExpectationsWereMet(), convey.ShouldBeNil)
+
+			v, _ := p.Mobile.Value()
+			cipherMobile = v.(string)
+			bs, _ := base64.StdEncoding.DecodeString(cipherMobile)
+			convey.So(encrypter.IsLegacy(bs), convey.ShouldBeFalse)
+			mock.ExpectQuery("SELECT").
+				WillReturnRows(sqlmock.NewRows([]string{"id", "mobile", "mobileBidx"}).AddRow(1, cipherMobile, idx))
+			res := &testEncryptedPo{}
+			convey.So(gormDb.Where("mobileBidx = ?", idx).First(res).Error, convey.ShouldBeNil)
+			convey.So(res.Mobile.Plain(), convey.ShouldEqual, "13800000000")
+		})
+
+		convey.Convey("blind index on update", func() {
+			idx, _ := BlindIndex(ctx, "13900000000")
+			db, mock, err := sqlmock.New()
+			convey.So(err, convey.ShouldBeNil)
+			defer db.Close()
+			gormDb, err := gorm.Open(mysql.New(mysql.Config{
+				Conn:                      db,
+				SkipInitializeWithVersion: true,
+			}), &gorm.Config{Logger: NewLogger()})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(gormDb.Use(&BlindIndexPlugin{}), convey.ShouldBeNil)
+			patch := gomonkey.ApplyFunc(CoreFrmCtx, func(ctx context.Context, id string) *gorm.DB {
+				return gormDb
+			})
+			defer patch.Reset()
+
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE `test_encrypted` SET `id`=\\?,`mobile`=\\?,`mobileBidx`=\\? WHERE id = \\? AND `id` = \\?").
+				WithArgs(int64(1), sqlmock.AnyArg(), idx, 1, int64(1)).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+			p := &testEncryptedPo{Id: 1, Mobile: "13900000000"}
+			repo := &BaseRepository[testEncryptedPo]{}
+			affect, err := repo.BaseUpdate(ctx, p, dependency.WithConds("id = ?", 1))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+			convey.So(p.MobileBidx, convey.ShouldEqual, idx)
+			convey.So(mock.ExpectationsWereMet(), convey.ShouldBeNil)
+
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE `test_encrypted` SET `mobile`=\\?,`mobileBidx`=\\? WHERE id = \\?").
+				WithArgs(sqlmock.AnyArg(), idx, 1).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+			err = gormDb.Model(&testEncryptedPo{}).Where("id = ?", 1).
+				Updates(map[string]any{"mobile": EncryptedString("13900000000")}).Error
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(mock.ExpectationsWereMet(), convey.ShouldBeNil)
+
+			// 清空源字段时清空盲索引
+			for _, v := range []any{nil, EncryptedString(""), (*string)(nil)} {
+				mock.ExpectBegin()
+				mock.ExpectExec("UPDATE `test_encrypted` SET `mobile`=\\?,`mobileBidx`=\\? WHERE id = \\?").
+					WithArgs(sqlmock.AnyArg(), "", 1).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+				err = gormDb.Model(&testEncryptedPo{}).Where("id = ?", 1).
+					Updates(map[string]any{"mobile": v}).Error
+				convey.So(err, convey.ShouldBeNil)
+			}
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE `test_encrypted` SET `mobile`=\\?,`mobileBidx`=\\? WHERE id = \\?").
+				WithArgs(sqlmock.AnyArg(), "", 1).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+			err = gormDb.Model(&testEncryptedPo{}).Select("mobile").Where("id = ?", 1).
+				Updates(&testEncryptedPo{Id: 1}).Error
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(mock.ExpectationsWereMet(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("no cipher", func() {
+			SetFieldCipher(nil)
+			_, err := EncryptedString("x").Value()
+			convey.So(err, convey.ShouldEqual, ErrNoFieldCipher)
+			_, err = BlindIndex(ctx, "x")
+			convey.So(err, convey.ShouldEqual, ErrNoFieldCipher)
+		})
+	})
+}
@@ -37,6 +37,11 @@ func NewMySqlClient(dsn string, log logger.Interface) (*gorm.DB, error) {
 		Logger:                                   log,
 		DisableForeignKeyConstraintWhenMigrating: true, // 注意 AutoMigrate 会自动创建数据库外键约束，您可以在初始化时禁用此功能
 	})
+	if err != nil {
+		return db, err
+	}
+	// 加密字段的盲索引
+	err = db.Use(&BlindIndexPlugin{})
 	return db, err
 }
 
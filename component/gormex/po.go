@@ -3,22 +3,37 @@ package gormex
 import (
 	"hash/crc32"
 
+	"github.com/illidaris/aphrodite/pkg/dependency"
 	"github.com/spf13/cast"
 )
 
 type BizSection struct {
-	BizId int64 `json:"bizId" gorm:"column:bizId;type:bigint;comment:游戏ID"` // game id
+	BizId int64 `json:"bizId" bson:"bizId" gorm:"column:bizId;type:bigint;comment:游戏ID"` // game id
 }
 
 func (i BizSection) Database() string {
 	return ""
 }
 
+// DbSharding 按租户分库，映射见dependency.SetTenantDatabase
 func (i BizSection) DbSharding(keys ...any) string {
 	if len(keys) == 0 {
-		return cast.ToString(i.BizId)
+		return dependency.TenantDatabase(i.BizId)
 	}
-	return cast.ToString(keys[0])
+	return dependency.TenantDatabase(keys[0])
+}
+
+// TenantColumn 多租户隔离字段
+func (i BizSection) TenantColumn() string {
+	return "bizId"
+}
+
+func (i BizSection) GetTenant() int64 {
+	return i.BizId
+}
+
+func (i *BizSection) SetTenant(bizId int64) {
+	i.BizId = bizId
 }
 
 type OperationSection struct {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
 
 	"github.com/illidaris/aphrodite/pkg/convert"
 	"github.com/illidaris/aphrodite/pkg/dependency"
@@ -24,6 +25,9 @@ func (r *BaseRepository[T]) BaseCreate(ctx context.Context, ps []*T, opts ...dep
 		return 0, nil
 	}
 	opt := dependency.NewBaseOption(opts...)
+	if err := r.stampTenant(ctx, opt, ps...); err != nil {
+		return 0, err
+	}
 	if idgen, ok := any(ps[0]).(dependency.IGenerateID); ok && opt.IDGenerate != nil {
 		idgen.SetID(opt.IDGenerate(ctx))
 	}
@@ -44,6 +48,12 @@ func (r *BaseRepository[T]) BaseSave(ctx context.Context, ps []*T, opts ...depen
 		return 0, nil
 	}
 	opt := dependency.NewBaseOption(opts...)
+	if err := r.stampTenant(ctx, opt, ps...); err != nil {
+		return 0, err
+	}
+	if err := r.tenantOwnedAll(ctx, opt, ps...); err != nil {
+		return 0, err
+	}
 	if idgen, ok := any(ps[0]).(dependency.IGenerateID); ok && opt.IDGenerate != nil {
 		idgen.SetID(opt.IDGenerate(ctx))
 	}
@@ -60,14 +70,25 @@ func (r *BaseRepository[T]) BaseSave(ctx context.Context, ps []*T, opts ...depen
 
 // BaseUpdate
 func (r *BaseRepository[T]) BaseUpdate(ctx context.Context, p *T, opts ...dependency.BaseOptionFunc) (int64, error) {
-	result := r.BuildFrmOptions(ctx, p, opts...).Updates(p)
+	opt := dependency.NewBaseOption(opts...)
+	if err := dependency.ApplyTenant(ctx, p, opt, dependency.TENANT_OP_UPDATE); err != nil {
+		return 0, err
+	}
+	if err := dependency.StampTenant(opt.Tenant, p); err != nil {
+		return 0, err
+	}
+	result := r.BuildFrmOption(ctx, p, opt).Updates(p)
 	return result.RowsAffected, result.Error
 }
 
 // BaseGet
 func (r *BaseRepository[T]) BaseGet(ctx context.Context, opts ...dependency.BaseOptionFunc) (*T, error) {
 	var t T
-	db := r.BuildFrmOptions(ctx, nil, opts...)
+	opt := dependency.NewBaseOption(opts...)
+	if err := dependency.ApplyTenant[T](ctx, nil, opt, dependency.TENANT_OP_QUERY); err != nil {
+		return nil, err
+	}
+	db := r.BuildFrmOption(ctx, nil, opt)
 	res := db.First(&t)
 	if res.RowsAffected == 0 {
 		return nil, nil
@@ -77,7 +98,11 @@ func (r *BaseRepository[T]) BaseGet(ctx context.Context, opts ...dependency.Base
 
 // BaseDelete
 func (r *BaseRepository[T]) BaseDelete(ctx context.Context, p *T, opts ...dependency.BaseOptionFunc) (int64, error) {
-	result := r.BuildFrmOptions(ctx, p, opts...).Delete(p)
+	opt := dependency.NewBaseOption(opts...)
+	if err := dependency.ApplyTenant(ctx, p, opt, dependency.TENANT_OP_DELETE); err != nil {
+		return 0, err
+	}
+	result := r.BuildFrmOption(ctx, p, opt).Delete(p)
 	return result.RowsAffected, result.Error
 }
 
@@ -85,6 +110,9 @@ func (r *BaseRepository[T]) BaseDelete(ctx context.Context, p *T, opts ...depend
 func (r *BaseRepository[T]) BaseCount(ctx context.Context, opts ...dependency.BaseOptionFunc) (int64, error) {
 	var count int64
 	opt := dependency.NewBaseOption(opts...)
+	if err := dependency.ApplyTenant[T](ctx, nil, opt, dependency.TENANT_OP_QUERY); err != nil {
+		return 0, err
+	}
 	db := r.BuildConds(ctx, nil, opt)
 	res := db.Count(&count)
 	return count, res.Error
@@ -93,8 +121,11 @@ func (r *BaseRepository[T]) BaseCount(ctx context.Context, opts ...dependency.Ba
 // BaseQuery
 func (r *BaseRepository[T]) BaseQuery(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]T, error) {
 	result := []T{}
-	db := r.BuildFrmOptions(ctx, nil, opts...)
-	res := db.Find(&result)
+	opt := dependency.NewBaseOption(opts...)
+	if err := dependency.ApplyTenant[T](ctx, nil, opt, dependency.TENANT_OP_QUERY); err != nil {
+		return result, err
+	}
+	res := r.BuildFrmOption(ctx, nil, opt).Find(&result)
 	return result, res.Error
 }
 
@@ -111,6 +142,11 @@ func (r *BaseRepository[T]) BaseQueryWithCount(ctx context.Context, opts ...depe
 	return ts, count, err
 }
 
+// SQLConds 支持gorm风格的字符串条件，见dependency.ISQLConds
+func (r *BaseRepository[T]) SQLConds() bool {
+	return true
+}
+
 // BuildConds
 func (r *BaseRepository[T]) BuildConds(ctx context.Context, t *T, opt *dependency.BaseOption) *gorm.DB {
 	var (
@@ -140,9 +176,50 @@ func (r *BaseRepository[T]) BuildConds(ctx context.Context, t *T, opt *dependenc
 	if opt != nil && len(opt.Conds) > 0 {
 		db = db.Where(opt.Conds[0], opt.Conds[1:]...)
 	}
+	if opt != nil && opt.Tenant != nil {
+		db = db.Where(fmt.Sprintf("`%s` = ?", opt.Tenant.Column), opt.Tenant.BizId)
+	}
 	return db
 }
 
+// stampTenant 解析租户并填充待写入实体的BizId
+func (r *BaseRepository[T]) stampTenant(ctx context.Context, opt *dependency.BaseOption, ps ...*T) error {
+	if err := dependency.ApplyTenant(ctx, ps[0], opt, dependency.TENANT_OP_CREATE); err != nil {
+		return err
+	}
+	return dependency.StampTenant(opt.Tenant, ps...)
+}
+
+// tenantOwnedAll Save按主键覆盖写入，写入前确认已存在的同ID记录属于当前租户
+func (r *BaseRepository[T]) tenantOwnedAll(ctx context.Context, opt *dependency.BaseOption, ps ...*T) error {
+	if opt.Tenant == nil {
+		return nil
+	}
+	ids := []any{}
+	for _, p := range ps {
+		if e, ok := any(p).(dependency.IPo); ok && e.ID() != nil && !reflect.ValueOf(e.ID()).IsZero() {
+			ids = append(ids, e.ID())
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	o := *opt
+	o.Conds, o.Tenant = nil, nil
+	var count int64
+	res := r.BuildConds(ctx, nil, &o).
+		Where(clause.IN{Column: clause.PrimaryColumn, Values: ids}).
+		Where(fmt.Sprintf("`%s` <> ?", opt.Tenant.Column), opt.Tenant.BizId).
+		Count(&count)
+	if res.Error != nil {
+		return res.Error
+	}
+	if count > 0 {
+		return dependency.ErrTenantMismatch
+	}
+	return nil
+}
+
 // BuildFrmOption
 func (r *BaseRepository[T]) BuildFrmOption(ctx context.Context, t *T, opt *dependency.BaseOption) *gorm.DB {
 	db := r.BuildConds(ctx, t, opt)
@@ -165,7 +242,11 @@ func (r *BaseRepository[T]) BuildFrmOption(ctx context.Context, t *T, opt *depen
 // BuildFrmOptions
 func (r *BaseRepository[T]) BuildFrmOptions(ctx context.Context, t *T, opts ...dependency.BaseOptionFunc) *gorm.DB {
 	opt := dependency.NewBaseOption(opts...)
+	err := dependency.ApplyTenant(ctx, t, opt, dependency.TENANT_OP_RAW)
 	db := r.BuildFrmOption(ctx, t, opt)
+	if err != nil {
+		_ = db.AddError(err) // 未解析到租户时不执行
+	}
 	return db
 }
 
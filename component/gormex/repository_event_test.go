@@ -0,0 +1,77 @@
+package gormex
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/illidaris/aphrodite/pkg/dependency/dependencytest"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// TestEventRepositoryContract need a real mysql, e.g.
+// APHRODITE_TEST_MYSQL_DSN="root:pass@tcp(127.0.0.1:3306)/test?charset=utf8mb4&parseTime=True&loc=Local"
+//
+// The suite depends on unix_timestamp() and the rows updated by the database, sqlmock can not emulate them
+// and there is no sqlite driver in the module, so without the dsn only the statements are checked by
+// TestEventRepositoryStatements, the behaviours of the suite (skip locked and future tasks, keep lock
+// on update) are NOT verified.
+func TestEventRepositoryContract(t *testing.T) {
+	dsn := os.Getenv("APHRODITE_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("APHRODITE_TEST_MYSQL_DSN is not set, the contract suite is not verified against mysql")
+	}
+	db, err := NewMySqlClient(dsn, NewLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&po.MqMessage{}); err != nil {
+		t.Fatal(err)
+	}
+	MySqlComponent.NewWriter("", db)
+	MySqlComponent.NewReader("", db)
+	dependencytest.MQProducerRepositorySuite(t, &EventRepository[po.MqMessage]{})
+}
+
+// TestEventRepositoryStatements the statements of the steps in the contract suite
+func TestEventRepositoryStatements(t *testing.T) {
+	mockDb(func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `aphrodite_mq_compensate`").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `aphrodite_mq_compensate` SET `expire`=IF\\(`timeout` > 0, unix_timestamp\\(\\) \\+ `timeout` , unix_timestamp\\(\\) \\+ 60\\),`locker`=\\?,`retries`=retries \\+ 1,`updateAt`=\\? "+
+			"WHERE expire < unix_timestamp\\(\\) AND `bizId` = \\? AND `category` = \\? AND `name` =\\? ORDER BY createAt LIMIT \\?").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), uint64(1), uint32(7), "contract", 2).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+		mock.ExpectQuery("SELECT \\* FROM `aphrodite_mq_compensate` WHERE locker = \\?").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "locker", "retries"}).AddRow(1, "l", 1).AddRow(2, "l", 1))
+	}, func(err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		ctx := context.Background()
+		repo := &EventRepository[po.MqMessage]{}
+		convey.Convey("TestEventRepositoryStatements", t, func() {
+			m := &po.MqMessage{}
+			m.BizId, m.Category, m.Name = 1, 7, "contract"
+			convey.So(repo.InsertAction(ctx, "", m)(ctx), convey.ShouldBeNil)
+			convey.So(m.Id, convey.ShouldEqual, 1)
+
+			template := po.MqMessage{}
+			template.BizId, template.Category, template.Name, template.Timeout = 1, 7, "contract", 60
+			locker, affect, err := repo.WaitExecWithLock(ctx, template, 2)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(locker, convey.ShouldNotBeEmpty)
+			convey.So(affect, convey.ShouldEqual, 2)
+
+			lockeds, err := repo.FindLockeds(ctx, locker)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(lockeds, convey.ShouldHaveLength, 2)
+		})
+	})
+}
@@ -80,3 +80,28 @@ func (r TaskQueueRepository[T]) ReportExecResult(ctx context.Context, id int64,
 		})
 	return result.RowsAffected, result.Error
 }
+
+// RenewLease 续租，仅锁定者可以续租，影响行数为0表示锁已丢失
+func (r TaskQueueRepository[T]) RenewLease(ctx context.Context, id int64, locker string, lease time.Duration) (int64, error) {
+	if locker == "" {
+		return 0, nil
+	}
+	t := new(T)
+	opts := []dependency.BaseOptionFunc{
+		dependency.WithConds("id = ? AND locker = ?", id, locker),
+	}
+	result := r.BuildFrmOptions(ctx, t, opts...).Updates(map[string]interface{}{
+		"expire": gorm.Expr("unix_timestamp() + ?", int64(lease.Seconds())),
+	})
+	return result.RowsAffected, result.Error
+}
+
+// CountDue 到期待执行的数量
+func (r TaskQueueRepository[T]) CountDue(ctx context.Context, t T) (int64, error) {
+	return r.BaseCount(ctx,
+		dependency.WithConds("expire < unix_timestamp() AND `bizId` = ? AND `category` = ? AND `name` =?",
+			t.GetBizId(),
+			t.GetCategory(),
+			t.GetName()),
+		dependency.WithDataBase(t.Database()))
+}
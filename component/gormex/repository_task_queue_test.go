@@ -0,0 +1,35 @@
+package gormex
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestTaskQueueRepositoryRenewLease(t *testing.T) {
+	mockDb(func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `aphrodite_mq_compensate` SET `expire`=unix_timestamp\\(\\) \\+ \\?,`updateAt`=\\? WHERE id = \\? AND locker = \\?").
+			WithArgs(int64(60), sqlmock.AnyArg(), int64(1), "locker").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}, func(err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		ctx := context.Background()
+		repo := &TaskQueueRepository[po.MqMessage]{}
+		convey.Convey("TestTaskQueueRepositoryRenewLease", t, func() {
+			affect, err := repo.RenewLease(ctx, 1, "", time.Minute)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 0)
+			affect, err = repo.RenewLease(ctx, 1, "locker", time.Minute)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,211 @@
+package gormex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type testTenantPo struct {
+	dependency.EmptyPo
+	BizSection
+	Id   int64  `json:"id" gorm:"column:id;autoIncrement;type:bigint;primaryKey;comment:唯一ID"`
+	Code string `json:"code" gorm:"column:code;type:varchar(36);comment:代码"`
+}
+
+func (s testTenantPo) TableName() string {
+	return "test_tenant"
+}
+
+func (s testTenantPo) Database() string {
+	return ""
+}
+
+func (s testTenantPo) ID() any {
+	return s.Id
+}
+
+func TestBaseRepositoryTenant(t *testing.T) {
+	dependency.EnableTenancy(true)
+	defer dependency.EnableTenancy(false)
+	repo := &BaseRepository[testTenantPo]{}
+	convey.Convey("TestBaseRepositoryTenant", t, func() {
+		convey.Convey("bizId required", func() {
+			_, err := repo.BaseQuery(context.Background())
+			convey.So(err, convey.ShouldEqual, dependency.ErrTenantRequired)
+		})
+		convey.Convey("create mismatch", func() {
+			ctx := contextex.WithBizId(context.Background(), 7)
+			_, err := repo.BaseCreate(ctx, []*testTenantPo{{BizSection: BizSection{BizId: 8}}})
+			convey.So(err, convey.ShouldEqual, dependency.ErrTenantMismatch)
+		})
+		convey.Convey("update move tenant", func() {
+			ctx := contextex.WithBizId(context.Background(), 7)
+			_, err := repo.BaseUpdate(ctx, nil, dependency.WithUpdatedMap(map[string]any{"bizId": 8}))
+			convey.So(err, convey.ShouldEqual, dependency.ErrTenantMismatch)
+		})
+	})
+}
+
+func TestBaseRepositoryTenantStamp(t *testing.T) {
+	dependency.EnableTenancy(true)
+	defer dependency.EnableTenancy(false)
+	mockDb(func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `test_tenant`").
+			WithArgs(int64(7), "x1").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}, func(err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		ctx := contextex.WithBizId(context.Background(), 7)
+		p := &testTenantPo{Code: "x1"}
+		convey.Convey("TestBaseRepositoryTenantStamp", t, func() {
+			repo := &BaseRepository[testTenantPo]{}
+			affect, err := repo.BaseCreate(ctx, []*testTenantPo{p})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+			convey.So(p.BizId, convey.ShouldEqual, 7)
+		})
+	})
+}
+
+func TestBaseRepositoryTenantDelete(t *testing.T) {
+	dependency.EnableTenancy(true)
+	defer dependency.EnableTenancy(false)
+	mockDb(func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `test_tenant` WHERE `bizId` = \\?").
+			WithArgs(int64(7), int64(1)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}, func(err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		ctx := contextex.WithBizId(context.Background(), 7)
+		convey.Convey("TestBaseRepositoryTenantDelete", t, func() {
+			repo := &BaseRepository[testTenantPo]{}
+			affect, err := repo.BaseDelete(ctx, &testTenantPo{Id: 1})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+		})
+	})
+}
+
+func TestBaseRepositoryCrossTenant(t *testing.T) {
+	dependency.EnableTenancy(true)
+	defer dependency.EnableTenancy(false)
+	audits := []dependency.TenantAudit{}
+	dependency.SetTenantAuditor(func(ctx context.Context, a dependency.TenantAudit) {
+		audits = append(audits, a)
+	})
+	defer dependency.SetTenantAuditor(nil)
+	mockDb(func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `test_tenant` WHERE `test_tenant`.`id` = \\?$").
+			WithArgs(int64(1)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}, func(err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		ctx := dependency.WithCrossTenant(context.Background(), "cleanup")
+		convey.Convey("TestBaseRepositoryCrossTenant", t, func() {
+			repo := &BaseRepository[testTenantPo]{}
+			affect, err := repo.BaseDelete(ctx, &testTenantPo{Id: 1})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+			convey.So(audits, convey.ShouldResemble, []dependency.TenantAudit{
+				{Table: "test_tenant", Op: dependency.TENANT_OP_DELETE, Reason: "cleanup"},
+			})
+		})
+	})
+}
+
+func TestBaseRepositoryTenantBuildFrmOptions(t *testing.T) {
+	dependency.EnableTenancy(true)
+	defer dependency.EnableTenancy(false)
+	mockDb(func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE `test_tenant` SET `code`=\\? WHERE code = \\? AND `bizId` = \\?").
+			WithArgs("y", "x", int64(7)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+	}, func(err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		convey.Convey("TestBaseRepositoryTenantBuildFrmOptions", t, func() {
+			repo := &BaseRepository[testTenantPo]{}
+			result := repo.BuildFrmOptions(context.Background(), new(testTenantPo), dependency.WithConds("code = ?", "x")).
+				Updates(map[string]any{"code": "y"})
+			convey.So(result.Error, convey.ShouldEqual, dependency.ErrTenantRequired)
+
+			ctx := contextex.WithBizId(context.Background(), 7)
+			result = repo.BuildFrmOptions(ctx, new(testTenantPo), dependency.WithConds("code = ?", "x")).
+				Updates(map[string]any{"code": "y"})
+			convey.So(result.Error, convey.ShouldBeNil)
+			convey.So(result.RowsAffected, convey.ShouldEqual, 1)
+		})
+	})
+}
+
+func TestTenantSharding(t *testing.T) {
+	dependency.EnableTenancy(true)
+	defer dependency.EnableTenancy(false)
+	convey.Convey("TestTenantSharding", t, func() {
+		ctx := contextex.WithBizId(context.Background(), 7)
+		opt := dependency.NewBaseOption()
+		convey.So(dependency.ApplyTenant[testTenantPo](ctx, nil, opt, dependency.TENANT_OP_QUERY), convey.ShouldBeNil)
+		convey.So(opt.Tenant, convey.ShouldResemble, &dependency.TenantScope{Column: "bizId", BizId: 7})
+		convey.So(opt.DbShardingKey, convey.ShouldBeEmpty)
+
+		dependency.EnableTenantSharding(true)
+		defer dependency.EnableTenantSharding(false)
+		opt = dependency.NewBaseOption()
+		convey.So(dependency.ApplyTenant[testTenantPo](ctx, nil, opt, dependency.TENANT_OP_QUERY), convey.ShouldBeNil)
+		convey.So(opt.DbShardingKey, convey.ShouldResemble, []any{int64(7)})
+	})
+}
+
+func TestBaseRepositoryTenantSave(t *testing.T) {
+	dependency.EnableTenancy(true)
+	defer dependency.EnableTenancy(false)
+	mockDb(func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `test_tenant` WHERE `test_tenant`.`id` = \\? AND `bizId` <> \\?").
+			WithArgs(int64(99), int64(7)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectQuery("SELECT count\\(\\*\\) FROM `test_tenant` WHERE `test_tenant`.`id` = \\? AND `bizId` <> \\?").
+			WithArgs(int64(1), int64(7)).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `test_tenant` .* ON DUPLICATE KEY UPDATE").
+			WithArgs(int64(7), "x1", int64(1)).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}, func(err error) {
+		if err != nil {
+			t.Error(err)
+		}
+		ctx := contextex.WithBizId(context.Background(), 7)
+		convey.Convey("TestBaseRepositoryTenantSave", t, func() {
+			repo := &BaseRepository[testTenantPo]{}
+			// 他人租户的记录不可覆盖
+			affect, err := repo.BaseSave(ctx, []*testTenantPo{{Id: 99, Code: "x1"}})
+			convey.So(err, convey.ShouldEqual, dependency.ErrTenantMismatch)
+			convey.So(affect, convey.ShouldEqual, 0)
+
+			affect, err = repo.BaseSave(ctx, []*testTenantPo{{Id: 1, Code: "x1"}})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+		})
+	})
+}
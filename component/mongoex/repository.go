@@ -29,6 +29,13 @@ func (r *BaseRepository[T]) BaseCreate(ctx context.Context, ps []*T, opts ...dep
 	if idgen, ok := any(ps[0]).(dependency.IGenerateID); ok && opt.IDGenerate != nil {
 		idgen.SetID(opt.IDGenerate(ctx))
 	}
+	if err := applyTenant(ctx, ps[0], opt, dependency.TENANT_OP_CREATE); err != nil {
+		return 0, err
+	}
+	if err := dependency.StampTenant(opt.Tenant, ps...); err != nil {
+		return 0, err
+	}
+	tenantOpt := opt
 	return BaseGroup(func(v ...*T) (int64, error) {
 		var t *T
 		count := int64(0)
@@ -40,6 +47,7 @@ func (r *BaseRepository[T]) BaseCreate(ctx context.Context, ps []*T, opts ...dep
 			args = append(args, item)
 		}
 		opt := dependency.NewBaseOption(opts...)
+		opt.Tenant, opt.DbShardingKey, opt.TbShardingKey = tenantOpt.Tenant, tenantOpt.DbShardingKey, tenantOpt.TbShardingKey
 		finalErr := r.BuildFrmOption(ctx, t, opt, func(colls *mongo.Collection) error {
 			opts := options.InsertMany()
 			if opt.Ignore {
@@ -64,6 +72,12 @@ func (r *BaseRepository[T]) BaseSave(ctx context.Context, ps []*T, opts ...depen
 func (r *BaseRepository[T]) BaseUpdate(ctx context.Context, p *T, opts ...dependency.BaseOptionFunc) (int64, error) {
 	count := int64(0)
 	opt := dependency.NewBaseOption(opts...)
+	if err := applyTenant(ctx, p, opt, dependency.TENANT_OP_UPDATE); err != nil {
+		return 0, err
+	}
+	if err := dependency.StampTenant(opt.Tenant, p); err != nil {
+		return 0, err
+	}
 	finalErr := r.BuildFrmOption(ctx, nil, opt, func(colls *mongo.Collection) error {
 		updated := bson.E{Key: "$set", Value: p}
 		if opt.UpdatedMap != nil {
@@ -83,6 +97,9 @@ func (r *BaseRepository[T]) BaseUpdate(ctx context.Context, p *T, opts ...depend
 func (r *BaseRepository[T]) BaseGet(ctx context.Context, opts ...dependency.BaseOptionFunc) (*T, error) {
 	var t T
 	opt := dependency.NewBaseOption(opts...)
+	if err := applyTenant[T](ctx, nil, opt, dependency.TENANT_OP_QUERY); err != nil {
+		return nil, err
+	}
 	finalErr := r.BuildFrmOption(ctx, nil, opt, func(colls *mongo.Collection) error {
 		filter := QueryConds(opt)
 		res := colls.FindOne(ctx, filter)
@@ -102,6 +119,9 @@ func (r *BaseRepository[T]) BaseGet(ctx context.Context, opts ...dependency.Base
 func (r *BaseRepository[T]) BaseDelete(ctx context.Context, p *T, opts ...dependency.BaseOptionFunc) (int64, error) {
 	count := int64(0)
 	opt := dependency.NewBaseOption(opts...)
+	if err := applyTenant(ctx, p, opt, dependency.TENANT_OP_DELETE); err != nil {
+		return 0, err
+	}
 	finalErr := r.BuildFrmOption(ctx, nil, opt, func(colls *mongo.Collection) error {
 		res, err := colls.DeleteMany(ctx, QueryConds(opt))
 		if res != nil {
@@ -116,6 +136,9 @@ func (r *BaseRepository[T]) BaseDelete(ctx context.Context, p *T, opts ...depend
 func (r *BaseRepository[T]) BaseCount(ctx context.Context, opts ...dependency.BaseOptionFunc) (int64, error) {
 	count := int64(0)
 	opt := dependency.NewBaseOption(opts...)
+	if err := applyTenant[T](ctx, nil, opt, dependency.TENANT_OP_QUERY); err != nil {
+		return 0, err
+	}
 	err := r.BuildFrmOption(ctx, nil, opt, func(colls *mongo.Collection) error {
 		total, docError := colls.CountDocuments(ctx, QueryConds(opt))
 		count = total
@@ -128,6 +151,9 @@ func (r *BaseRepository[T]) BaseCount(ctx context.Context, opts ...dependency.Ba
 func (r *BaseRepository[T]) BaseQuery(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]T, error) {
 	result := []T{}
 	opt := dependency.NewBaseOption(opts...)
+	if err := applyTenant[T](ctx, nil, opt, dependency.TENANT_OP_QUERY); err != nil {
+		return result, err
+	}
 	err := r.BuildFrmOption(ctx, nil, opt, func(colls *mongo.Collection) error {
 		cur, findErr := colls.Find(ctx, QueryConds(opt), Option2Page(opt))
 		if findErr != nil {
@@ -258,7 +284,17 @@ func QueryFields(opt *dependency.BaseOption) bson.D {
 	return d
 }
 
+// QueryConds 查询条件，多租户时追加BizId
 func QueryConds(opt *dependency.BaseOption) bson.D {
+	d := queryConds(opt)
+	if opt.Tenant != nil {
+		// 复制一份，避免修改调用方传入的bson.D
+		d = append(append(bson.D{}, d...), bson.E{Key: opt.Tenant.Column, Value: opt.Tenant.BizId})
+	}
+	return d
+}
+
+func queryConds(opt *dependency.BaseOption) bson.D {
 	l := len(opt.Conds)
 	switch l {
 	case 0:
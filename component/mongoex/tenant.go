@@ -0,0 +1,75 @@
+package mongoex
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+)
+
+var tenantPaths sync.Map // reflect.Type -> string
+
+// applyTenant 解析租户范围，并将租户字段转换为实体中BizId的bson路径
+func applyTenant[T any](ctx context.Context, t *T, opt *dependency.BaseOption, op string) error {
+	if err := dependency.ApplyTenant(ctx, t, opt, op); err != nil {
+		return err
+	}
+	if opt.Tenant != nil {
+		opt.Tenant.Column = TenantPath[T](opt.Tenant.Column)
+	}
+	return nil
+}
+
+/*
+TenantPath 租户字段在文档中的bson路径
+
+	默认编码下未标记inline的嵌入结构体会编码为子文档，如嵌入po.BizSection得到bizsection.bizId，
+	按bson标签解析实际路径，未找到时返回column本身。
+*/
+func TenantPath[T any](column string) string {
+	rt := reflect.TypeOf((*T)(nil)).Elem()
+	if v, ok := tenantPaths.Load(rt); ok {
+		return v.(string)
+	}
+	path, ok := bsonPath(rt, column)
+	if !ok {
+		path = column
+	}
+	tenantPaths.Store(rt, path)
+	return path
+}
+
+func bsonPath(rt reflect.Type, column string) (string, bool) {
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct {
+		return "", false
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		tags, err := bsoncodec.DefaultStructTagParser.ParseStructTags(sf)
+		if err != nil || tags.Skip {
+			continue
+		}
+		if sf.Anonymous || tags.Inline {
+			if sub, ok := bsonPath(sf.Type, column); ok {
+				if tags.Inline {
+					return sub, true
+				}
+				return tags.Name + "." + sub, true
+			}
+			continue
+		}
+		if strings.EqualFold(tags.Name, column) {
+			return tags.Name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,105 @@
+package mongoex
+
+import (
+	"context"
+	"testing"
+
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+type testTenantPo struct {
+	dependency.EmptyPo `bson:"-"`
+	po.RawBizSection          // 未标记inline，编码为rawbizsection子文档
+	Id                 string `bson:"_id"`
+	Code               string `bson:"code"`
+}
+
+func (s testTenantPo) TableName() string {
+	return "test_tenant"
+}
+
+func (s testTenantPo) Database() string {
+	return ""
+}
+
+type testInlineTenantPo struct {
+	dependency.EmptyPo `bson:"-"`
+	po.BizSection      `bson:",inline"`
+	Id                 string `bson:"_id"`
+}
+
+func (s testInlineTenantPo) TableName() string {
+	return "test_tenant"
+}
+
+func TestTenantPath(t *testing.T) {
+	convey.Convey("TestTenantPath", t, func() {
+		convey.So(TenantPath[testTenantPo]("bizId"), convey.ShouldEqual, "rawbizsection.bizId")
+		convey.So(TenantPath[testInlineTenantPo]("bizId"), convey.ShouldEqual, "bizId")
+
+		// 写入的BizId与过滤条件路径一致
+		p := testTenantPo{Id: "a"}
+		p.BizId = 7
+		raw, err := bson.Marshal(p)
+		convey.So(err, convey.ShouldBeNil)
+		v, err := bson.Raw(raw).LookupErr("rawbizsection", "bizId")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v.AsInt64(), convey.ShouldEqual, 7)
+	})
+}
+
+func TestBaseRepositoryTenant(t *testing.T) {
+	dependency.EnableTenancy(true)
+	defer dependency.EnableTenancy(false)
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	mt.Run("TestBaseRepositoryTenant", func(mt *mtest.T) {
+		SetGetKeyFunc(func(ctx context.Context) string { return "tenant" })
+		defer SetGetKeyFunc(nil)
+		MongoComponent.NewWriter("tenant", mt.Client)
+		MongoNameMap["tenant"] = "test"
+		defer delete(MongoNameMap, "tenant")
+		repo := &BaseRepository[testTenantPo]{}
+		convey.Convey("TestBaseRepositoryTenant", t, func() {
+			convey.Convey("bizId required", func() {
+				_, err := repo.BaseQuery(context.Background())
+				convey.So(err, convey.ShouldEqual, dependency.ErrTenantRequired)
+			})
+			convey.Convey("query filter by bson path", func() {
+				ctx := contextex.WithBizId(context.Background(), 7)
+				mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.test_tenant", mtest.FirstBatch,
+					bson.D{{Key: "_id", Value: "a"}, {Key: "rawbizsection", Value: bson.D{{Key: "bizId", Value: int64(7)}}}}))
+				ts, err := repo.BaseQuery(ctx, dependency.WithConds("code", "x"))
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(ts, convey.ShouldHaveLength, 1)
+				convey.So(ts[0].BizId, convey.ShouldEqual, 7)
+				filter := mt.GetStartedEvent().Command.Lookup("filter").Document()
+				convey.So(filter.Lookup("code").StringValue(), convey.ShouldEqual, "x")
+				convey.So(filter.Lookup("rawbizsection.bizId").AsInt64(), convey.ShouldEqual, 7)
+			})
+			convey.Convey("delete filter by bson path", func() {
+				ctx := contextex.WithBizId(context.Background(), 7)
+				mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}))
+				affect, err := repo.BaseDelete(ctx, &testTenantPo{Id: "a"}, dependency.WithConds("_id", "a"))
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(affect, convey.ShouldEqual, 1)
+				deletes := mt.GetStartedEvent().Command.Lookup("deletes").Array()
+				q := deletes.Index(0).Value().Document().Lookup("q").Document()
+				convey.So(q.Lookup("rawbizsection.bizId").AsInt64(), convey.ShouldEqual, 7)
+			})
+			convey.Convey("create stamp bizId", func() {
+				ctx := contextex.WithBizId(context.Background(), 7)
+				mt.AddMockResponses(mtest.CreateSuccessResponse())
+				p := &testTenantPo{Id: "b"}
+				_, err := repo.BaseCreate(ctx, []*testTenantPo{p})
+				convey.So(err, convey.ShouldBeNil)
+				doc := mt.GetStartedEvent().Command.Lookup("documents").Array().Index(0).Value().Document()
+				convey.So(doc.Lookup("rawbizsection", "bizId").AsInt64(), convey.ShouldEqual, 7)
+			})
+		})
+	})
+}
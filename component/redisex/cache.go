@@ -0,0 +1,74 @@
+package redisex
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+Cache string cache based on redis, implements oauth2.ICache and session.ICache.
+
+	missing key returns "" and nil error, GetDelCtx uses GETDEL (redis >= 6.2) to be atomic.
+*/
+type Cache struct {
+	Client redis.UniversalClient // fixed client, otherwise get client from RedisComponent by Key
+	Key    string                // key of RedisComponent
+}
+
+// NewCache new a cache with fixed client
+func NewCache(client redis.UniversalClient) *Cache {
+	return &Cache{Client: client}
+}
+
+func (c *Cache) client() (redis.UniversalClient, error) {
+	if c.Client != nil {
+		return c.Client, nil
+	}
+	client := RedisComponent.GetWriter(c.Key)
+	if client == nil {
+		return nil, ErrClientNil
+	}
+	return client, nil
+}
+
+func (c *Cache) SetCtx(ctx context.Context, key, value string, duration time.Duration) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.Set(ctx, key, value, duration).Err()
+}
+
+func (c *Cache) GetCtx(ctx context.Context, key string) (string, error) {
+	client, err := c.client()
+	if err != nil {
+		return "", err
+	}
+	return nilAsEmpty(client.Get(ctx, key).Result())
+}
+
+func (c *Cache) DelCtx(ctx context.Context, key string) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+	return client.Del(ctx, key).Err()
+}
+
+func (c *Cache) GetDelCtx(ctx context.Context, key string) (string, error) {
+	client, err := c.client()
+	if err != nil {
+		return "", err
+	}
+	return nilAsEmpty(client.GetDel(ctx, key).Result())
+}
+
+func nilAsEmpty(v string, err error) (string, error) {
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	return v, err
+}
@@ -0,0 +1,67 @@
+package redisex
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/illidaris/aphrodite/biz/oauth2"
+	"github.com/illidaris/aphrodite/biz/session"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	_ oauth2.ICache  = &Cache{}
+	_ session.ICache = &Cache{}
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	s, client := newTestClient(t)
+	c := NewCache(client)
+	convey.Convey("TestCache", t, func() {
+		v, err := c.GetCtx(ctx, "k")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldBeEmpty)
+
+		convey.So(c.SetCtx(ctx, "k", "v", time.Minute), convey.ShouldBeNil)
+		v, err = c.GetCtx(ctx, "k")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "v")
+		convey.So(s.TTL("k"), convey.ShouldEqual, time.Minute)
+
+		v, err = c.GetDelCtx(ctx, "k")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "v")
+		v, err = c.GetDelCtx(ctx, "k")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldBeEmpty)
+
+		convey.So(c.SetCtx(ctx, "k", "v", 0), convey.ShouldBeNil)
+		convey.So(c.DelCtx(ctx, "k"), convey.ShouldBeNil)
+		convey.So(s.Exists("k"), convey.ShouldBeFalse)
+
+		// 并发GetDel仅一个请求能取到值
+		convey.So(c.SetCtx(ctx, "k", "v", 0), convey.ShouldBeNil)
+		var (
+			wg  sync.WaitGroup
+			hit atomic.Int32
+		)
+		for i := 0; i < 16; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if v, _ := c.GetDelCtx(ctx, "k"); v != "" {
+					hit.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		convey.So(hit.Load(), convey.ShouldEqual, 1)
+
+		_, err = (&Cache{Key: "cache_none"}).GetCtx(ctx, "k")
+		convey.So(err, convey.ShouldEqual, ErrClientNil)
+	})
+}
@@ -0,0 +1,87 @@
+package redisex
+
+import "github.com/redis/go-redis/v9"
+
+// LUA_TASK_CLAIM 锁定到期的任务，时间均采用redis时间，保障所有节点计算时间一致
+// 候选任务由调用方预先读取，脚本内重新校验是否仍到期，所有访问的key均通过KEYS传入以兼容redis cluster
+// KEYS[1] 待执行集合 KEYS[2] 锁定者集合 KEYS[3] 死信集合 KEYS[3+i] 第i个候选任务Key
+// ARGV[1] 默认超时（秒） ARGV[2] 锁定者 ARGV[3] 最大重试次数 ARGV[4] 锁定者集合有效期（秒） ARGV[4+i] 第i个候选任务ID
+const LUA_TASK_CLAIM = `
+local now = tonumber(redis.call('TIME')[1])
+local maxRetries = tonumber(ARGV[3])
+local locked = 0
+for i = 4, #KEYS do
+	local key = KEYS[i]
+	local id = ARGV[i + 1]
+	local score = redis.call('ZSCORE', KEYS[1], id)
+	if score and tonumber(score) < now then
+		if redis.call('EXISTS', key) == 0 then
+			redis.call('ZREM', KEYS[1], id)
+		else
+			local retries = tonumber(redis.call('HGET', key, 'retries') or '0')
+			if maxRetries > 0 and retries >= maxRetries then
+				redis.call('ZREM', KEYS[1], id)
+				redis.call('ZADD', KEYS[3], now, id)
+			else
+				local timeout = tonumber(redis.call('HGET', key, 'timeout') or '0')
+				if timeout <= 0 then
+					timeout = tonumber(ARGV[1])
+				end
+				local expire = now + timeout
+				redis.call('HSET', key, 'locker', ARGV[2], 'expire', expire, 'retries', retries + 1)
+				redis.call('ZADD', KEYS[1], expire, id)
+				redis.call('SADD', KEYS[2], id)
+				locked = locked + 1
+			end
+		end
+	end
+end
+if locked > 0 then
+	redis.call('EXPIRE', KEYS[2], tonumber(ARGV[4]))
+end
+return locked`
+
+// LUA_TASK_REPORT 汇报执行结果，仅锁定者可以汇报，成功则删除任务，失败则记录原因
+// 待执行集合由调用方预先读取，与任务中记录的不一致时返回-1，由调用方重试
+// KEYS[1] 任务Key KEYS[2] 全部任务集合 KEYS[3] 锁定者集合 KEYS[4] 待执行集合
+// ARGV[1] 任务ID ARGV[2] 锁定者 ARGV[3] 是否成功 ARGV[4] 最后失败原因 ARGV[5] 最后执行时间
+const LUA_TASK_REPORT = `
+local fields = redis.call('HMGET', KEYS[1], 'locker', 'wait')
+if fields[1] ~= ARGV[2] then
+	return 0
+end
+if fields[2] ~= KEYS[4] then
+	return -1
+end
+if ARGV[3] == '1' then
+	redis.call('ZREM', KEYS[4], ARGV[1])
+	redis.call('ZREM', KEYS[2], ARGV[1])
+	redis.call('SREM', KEYS[3], ARGV[1])
+	redis.call('DEL', KEYS[1])
+	return 1
+end
+redis.call('HSET', KEYS[1], 'lastError', ARGV[4], 'lastExecAt', ARGV[5])
+return 1`
+
+// LUA_TASK_RENEW 续租，仅锁定者可以续租，过期时间采用redis时间
+// 待执行集合由调用方预先读取，与任务中记录的不一致时返回-1，由调用方重试
+// KEYS[1] 任务Key KEYS[2] 待执行集合
+// ARGV[1] 任务ID ARGV[2] 锁定者 ARGV[3] 续租时长（秒）
+const LUA_TASK_RENEW = `
+local fields = redis.call('HMGET', KEYS[1], 'locker', 'wait')
+if fields[1] ~= ARGV[2] then
+	return 0
+end
+if fields[2] ~= KEYS[2] then
+	return -1
+end
+local expire = tonumber(redis.call('TIME')[1]) + tonumber(ARGV[3])
+redis.call('HSET', KEYS[1], 'expire', expire)
+redis.call('ZADD', KEYS[2], expire, ARGV[1])
+return 1`
+
+var (
+	taskClaimScript  = redis.NewScript(LUA_TASK_CLAIM)
+	taskReportScript = redis.NewScript(LUA_TASK_REPORT)
+	taskRenewScript  = redis.NewScript(LUA_TASK_RENEW)
+)
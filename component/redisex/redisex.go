@@ -0,0 +1,38 @@
+package redisex
+
+import (
+	"context"
+	"errors"
+
+	"github.com/illidaris/aphrodite/component/embedded"
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	ErrClientNil          = errors.New("redis client is nil")
+	ErrCondsNotSupported  = errors.New("redis repository not support conds")
+	ErrTaskDuplicate      = errors.New("task is exist")
+	ErrTaskIDNotSupported = errors.New("task id must be number when generate by redis")
+	ErrTaskWaitChanged    = errors.New("wait set of task changed during the operation")
+	RedisComponent        = embedded.NewComponent[redis.UniversalClient]()
+)
+
+// NewRedisClient new a redis client and ping it
+func NewRedisClient(ctx context.Context, opt *redis.UniversalOptions) (redis.UniversalClient, error) {
+	client := redis.NewUniversalClient(opt)
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewRedis register a redis client with the key to RedisComponent
+func NewRedis(ctx context.Context, key string, opt *redis.UniversalOptions) error {
+	client, err := NewRedisClient(ctx, opt)
+	if err != nil {
+		return err
+	}
+	RedisComponent.NewWriter(key, client)
+	RedisComponent.NewReader(key, client)
+	return nil
+}
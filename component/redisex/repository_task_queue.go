@@ -0,0 +1,660 @@
+package redisex
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/cast"
+)
+
+type writeMode int
+
+const (
+	writeCreate writeMode = iota // error if exist
+	writeIgnore                  // skip if exist
+	writeSave                    // overwrite if exist
+)
+
+const (
+	DEFAULT_TASK_PREFIX     = "aphrodite:tq"
+	DEFAULT_TASK_LOCKER_TTL = time.Hour
+	MAX_TASK_WAIT_RETRIES   = 3
+)
+
+// lockFields json name of po.LockSection => field of task hash
+var lockFields = map[string]string{
+	"locaker":    "locker",
+	"expire":     "expire",
+	"timeout":    "timeout",
+	"retries":    "retries",
+	"lastError":  "lastError",
+	"lastExecAt": "lastExecAt",
+}
+
+var _ = dependency.IMQProducerRepository[dependency.IEventMessage](&TaskQueueRepository[dependency.IEventMessage]{})
+
+/*
+TaskQueueRepository redis impl of dependency.IMQProducerRepository, all keys of a table share the same hash tag,
+every key accessed by the lua scripts is passed through KEYS, so it works with redis cluster.
+
+	{prefix}:{db:table}:task:{id}                          hash, data and lock state of task
+	{prefix}:{db:table}:wait:{bizId}:{category}:{name}     zset, score is expire of the task
+	{prefix}:{db:table}:locker:{locker}                    set, ids locked by the locker
+	{prefix}:{db:table}:ids                                zset, all ids order by create time
+	{prefix}:{db:table}:dead                               zset, ids reach MaxRetries
+	{prefix}:{db:table}:seq                                id generator
+
+Conds of BaseOption is not supported, query by page over all tasks instead.
+*/
+type TaskQueueRepository[T dependency.IEventMessage] struct {
+	Client     redis.UniversalClient // fixed client, otherwise get client from RedisComponent by database
+	Prefix     string                // key prefix, default is DEFAULT_TASK_PREFIX
+	MaxRetries int32                 // task will be moved to dead set when retries reach it, 0 means no limit
+	LockerTTL  time.Duration         // ttl of locker set, default is DEFAULT_TASK_LOCKER_TTL
+}
+
+type taskKeys struct {
+	base string
+}
+
+func (k taskKeys) Seq() string {
+	return k.base + ":seq"
+}
+
+func (k taskKeys) Ids() string {
+	return k.base + ":ids"
+}
+
+func (k taskKeys) Dead() string {
+	return k.base + ":dead"
+}
+
+func (k taskKeys) TaskPrefix() string {
+	return k.base + ":task:"
+}
+
+func (k taskKeys) Task(id any) string {
+	return k.TaskPrefix() + cast.ToString(id)
+}
+
+func (k taskKeys) Locker(locker string) string {
+	return k.base + ":locker:" + locker
+}
+
+func (k taskKeys) Wait(t dependency.IBaseTask) string {
+	return fmt.Sprintf("%s:wait:%d:%d:%s", k.base, t.GetBizId(), t.GetCategory(), t.GetName())
+}
+
+func (r *TaskQueueRepository[T]) keys(t *T, opt *dependency.BaseOption) taskKeys {
+	if t == nil {
+		t = new(T)
+	}
+	prefix := r.Prefix
+	if prefix == "" {
+		prefix = DEFAULT_TASK_PREFIX
+	}
+	return taskKeys{
+		base: fmt.Sprintf("%s:{%s:%s}", prefix, opt.GetDataBase(*t), opt.GetTableName(*t)),
+	}
+}
+
+func (r *TaskQueueRepository[T]) client(t *T, opt *dependency.BaseOption) (redis.UniversalClient, error) {
+	if r.Client != nil {
+		return r.Client, nil
+	}
+	if t == nil {
+		t = new(T)
+	}
+	var c redis.UniversalClient
+	if opt.ReadOnly {
+		c = RedisComponent.GetReader(opt.GetDataBase(*t))
+	} else {
+		c = RedisComponent.GetWriter(opt.GetDataBase(*t))
+	}
+	if c == nil {
+		return nil, ErrClientNil
+	}
+	return c, nil
+}
+
+// lockScope client and keys of the lock operations, the database is taken from T.Database(),
+// FindLockeds, ReportExecResult and RenewLease have no task, so it must not depend on the fields of the task
+func (r *TaskQueueRepository[T]) lockScope(t *T) (redis.UniversalClient, taskKeys, error) {
+	if t == nil {
+		t = new(T)
+	}
+	opt := dependency.NewBaseOption(dependency.WithDataBase((*t).Database()))
+	client, err := r.client(t, opt)
+	if err != nil {
+		return nil, taskKeys{}, err
+	}
+	return client, r.keys(t, opt), nil
+}
+
+func (r *TaskQueueRepository[T]) lockerTTL() time.Duration {
+	if r.LockerTTL > 0 {
+		return r.LockerTTL
+	}
+	return DEFAULT_TASK_LOCKER_TTL
+}
+
+// BaseCreate
+func (r *TaskQueueRepository[T]) BaseCreate(ctx context.Context, ps []*T, opts ...dependency.BaseOptionFunc) (int64, error) {
+	opt := dependency.NewBaseOption(opts...)
+	mode := writeCreate
+	if opt.Ignore {
+		mode = writeIgnore
+	}
+	return r.write(ctx, ps, opt, mode)
+}
+
+// BaseSave
+func (r *TaskQueueRepository[T]) BaseSave(ctx context.Context, ps []*T, opts ...dependency.BaseOptionFunc) (int64, error) {
+	return r.write(ctx, ps, dependency.NewBaseOption(opts...), writeSave)
+}
+
+func (r *TaskQueueRepository[T]) write(ctx context.Context, ps []*T, opt *dependency.BaseOption, mode writeMode) (int64, error) {
+	var affect int64
+	for _, p := range ps {
+		if p == nil {
+			continue
+		}
+		client, err := r.client(p, opt)
+		if err != nil {
+			return affect, err
+		}
+		ks := r.keys(p, opt)
+		if err := r.fillID(ctx, client, ks, p, opt); err != nil {
+			return affect, err
+		}
+		n, err := r.writeOne(ctx, client, ks, p, mode)
+		affect += n
+		if err != nil {
+			return affect, err
+		}
+	}
+	return affect, nil
+}
+
+func (r *TaskQueueRepository[T]) writeOne(ctx context.Context, client redis.UniversalClient, ks taskKeys, p *T, mode writeMode) (int64, error) {
+	var (
+		affect  int64
+		id      = cast.ToString((*p).ID())
+		taskKey = ks.Task(id)
+		waitKey = ks.Wait(*p)
+	)
+	data, err := json.Marshal(p)
+	if err != nil {
+		return 0, err
+	}
+	lock := po.LockSection{}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return 0, err
+	}
+	err = client.Watch(ctx, func(tx *redis.Tx) error {
+		oldWait, err := tx.HGet(ctx, taskKey, "wait").Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+		exist := err == nil
+		if exist && mode == writeCreate {
+			return ErrTaskDuplicate
+		}
+		if exist && mode == writeIgnore {
+			return nil
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			if exist && oldWait != waitKey {
+				pipe.ZRem(ctx, oldWait, id)
+			}
+			pipe.HSet(ctx, taskKey,
+				"data", data,
+				"wait", waitKey,
+				"locker", lock.Locker,
+				"expire", lock.Expire,
+				"timeout", lock.Timeout,
+				"retries", lock.Retries,
+				"lastError", lock.LastError,
+				"lastExecAt", lock.LastExecAt)
+			pipe.ZAdd(ctx, waitKey, redis.Z{Score: float64(lock.Expire), Member: id})
+			if !exist {
+				pipe.ZAdd(ctx, ks.Ids(), redis.Z{Score: float64(time.Now().UnixMicro()), Member: id})
+			}
+			return nil
+		})
+		if err == nil {
+			affect = 1
+		}
+		return err
+	}, taskKey)
+	return affect, err
+}
+
+func (r *TaskQueueRepository[T]) fillID(ctx context.Context, client redis.UniversalClient, ks taskKeys, p *T, opt *dependency.BaseOption) error {
+	if !isZero((*p).ID()) {
+		return nil
+	}
+	if idgen, ok := any(p).(dependency.IGenerateID); ok && opt.IDGenerate != nil {
+		idgen.SetID(opt.IDGenerate(ctx))
+		return nil
+	}
+	n, err := client.Incr(ctx, ks.Seq()).Result()
+	if err != nil {
+		return err
+	}
+	if err := overlay(p, po.IDAutoSection{Id: uint64(n)}); err != nil || isZero((*p).ID()) {
+		return ErrTaskIDNotSupported
+	}
+	return nil
+}
+
+// BaseUpdate update non-zero fields of p and UpdatedMap, the key of UpdatedMap is json name
+func (r *TaskQueueRepository[T]) BaseUpdate(ctx context.Context, p *T, opts ...dependency.BaseOptionFunc) (int64, error) {
+	opt := dependency.NewBaseOption(opts...)
+	if len(opt.Conds) > 0 {
+		return 0, ErrCondsNotSupported
+	}
+	if p == nil || isZero((*p).ID()) {
+		return 0, nil
+	}
+	client, err := r.client(p, opt)
+	if err != nil {
+		return 0, err
+	}
+	patch, err := nonZeroFields(p)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range opt.UpdatedMap {
+		patch[k] = v
+	}
+	var (
+		affect  int64
+		ks      = r.keys(p, opt)
+		id      = cast.ToString((*p).ID())
+		taskKey = ks.Task(id)
+	)
+	err = client.Watch(ctx, func(tx *redis.Tx) error {
+		fields, err := tx.HGetAll(ctx, taskKey).Result()
+		if err != nil || len(fields) == 0 {
+			return err
+		}
+		data := map[string]any{}
+		if err := unmarshalNumber([]byte(fields["data"]), &data); err != nil {
+			return err
+		}
+		values := []any{}
+		for k, v := range patch {
+			data[k] = v
+			if field, ok := lockFields[k]; ok {
+				values = append(values, field, fmt.Sprint(v))
+			}
+		}
+		bs, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		values = append(values, "data", bs)
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, taskKey, values...)
+			if expire, ok := patch["expire"]; ok {
+				pipe.ZAdd(ctx, fields["wait"], redis.Z{Score: cast.ToFloat64(fmt.Sprint(expire)), Member: id})
+			}
+			return nil
+		})
+		if err == nil {
+			affect = 1
+		}
+		return err
+	}, taskKey)
+	return affect, err
+}
+
+// BaseGet
+func (r *TaskQueueRepository[T]) BaseGet(ctx context.Context, opts ...dependency.BaseOptionFunc) (*T, error) {
+	opts = append(opts, dependency.WithPage(&dto.Page{PageIndex: 1, PageSize: 1}))
+	ts, err := r.BaseQuery(ctx, opts...)
+	if err != nil || len(ts) == 0 {
+		return nil, err
+	}
+	return &ts[0], nil
+}
+
+// BaseDelete delete task by id of p
+func (r *TaskQueueRepository[T]) BaseDelete(ctx context.Context, p *T, opts ...dependency.BaseOptionFunc) (int64, error) {
+	opt := dependency.NewBaseOption(opts...)
+	if len(opt.Conds) > 0 {
+		return 0, ErrCondsNotSupported
+	}
+	if p == nil || isZero((*p).ID()) {
+		return 0, nil
+	}
+	client, err := r.client(p, opt)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		affect  int64
+		ks      = r.keys(p, opt)
+		id      = cast.ToString((*p).ID())
+		taskKey = ks.Task(id)
+	)
+	err = client.Watch(ctx, func(tx *redis.Tx) error {
+		fields, err := tx.HMGet(ctx, taskKey, "wait", "locker").Result()
+		if err != nil || fields[0] == nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.ZRem(ctx, cast.ToString(fields[0]), id)
+			if locker := cast.ToString(fields[1]); locker != "" {
+				pipe.SRem(ctx, ks.Locker(locker), id)
+			}
+			pipe.ZRem(ctx, ks.Ids(), id)
+			pipe.ZRem(ctx, ks.Dead(), id)
+			pipe.Del(ctx, taskKey)
+			return nil
+		})
+		if err == nil {
+			affect = 1
+		}
+		return err
+	}, taskKey)
+	return affect, err
+}
+
+// BaseCount
+func (r *TaskQueueRepository[T]) BaseCount(ctx context.Context, opts ...dependency.BaseOptionFunc) (int64, error) {
+	opt := dependency.NewBaseOption(opts...)
+	if len(opt.Conds) > 0 {
+		return 0, ErrCondsNotSupported
+	}
+	client, err := r.client(nil, opt)
+	if err != nil {
+		return 0, err
+	}
+	return client.ZCard(ctx, r.keys(nil, opt).Ids()).Result()
+}
+
+// BaseQuery query tasks order by create time
+func (r *TaskQueueRepository[T]) BaseQuery(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]T, error) {
+	opt := dependency.NewBaseOption(opts...)
+	if len(opt.Conds) > 0 {
+		return nil, ErrCondsNotSupported
+	}
+	client, err := r.client(nil, opt)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		ks    = r.keys(nil, opt)
+		start = int64(0)
+		stop  = int64(-1)
+	)
+	if opt.Page != nil {
+		start = opt.Page.GetBegin()
+		stop = start + opt.Page.GetSize() - 1
+	} else if opt.ReadOnly && opt.BatchSize > 0 {
+		stop = opt.BatchSize - 1
+	}
+	ids, err := client.ZRange(ctx, ks.Ids(), start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	return r.findByIds(ctx, client, ks, "", ids...)
+}
+
+// BaseQueryWithCount
+func (r *TaskQueueRepository[T]) BaseQueryWithCount(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]T, int64, error) {
+	count, err := r.BaseCount(ctx, opts...)
+	if err != nil {
+		return nil, count, err
+	}
+	ts, err := r.BaseQuery(ctx, opts...)
+	return ts, count, err
+}
+
+// InsertAction the task is written to redis when the action is executed, it can not be rolled back with the db transaction
+func (r *TaskQueueRepository[T]) InsertAction(ctx context.Context, db string, t *T) func(context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := r.BaseCreate(ctx, []*T{t}, dependency.WithDataBase(db))
+		return err
+	}
+}
+
+// WaitExecWithLock 需要锁定的记录
+func (r *TaskQueueRepository[T]) WaitExecWithLock(ctx context.Context, t T, batch int) (string, int64, error) {
+	locker := uuid.NewString()
+	client, ks, err := r.lockScope(&t)
+	if err != nil {
+		return locker, 0, err
+	}
+	// 先读取候选任务，使脚本访问的key均通过KEYS传入，脚本内按redis时间重新校验
+	now, err := client.Time(ctx).Result()
+	if err != nil {
+		return locker, 0, err
+	}
+	ids, err := client.ZRangeByScore(ctx, ks.Wait(t), &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   fmt.Sprintf("(%d", now.Unix()),
+		Count: int64(batch),
+	}).Result()
+	if err != nil || len(ids) == 0 {
+		return locker, 0, err
+	}
+	keys := []string{ks.Wait(t), ks.Locker(locker), ks.Dead()}
+	args := []any{
+		int64(t.GetTimeout().Seconds()),
+		locker,
+		r.MaxRetries,
+		int64(r.lockerTTL().Seconds()),
+	}
+	for _, id := range ids {
+		keys = append(keys, ks.Task(id))
+		args = append(args, id)
+	}
+	affect, err := taskClaimScript.Run(ctx, client, keys, args...).Int64()
+	return locker, affect, err
+}
+
+// FindLockeds 找到被锁定的记录
+func (r *TaskQueueRepository[T]) FindLockeds(ctx context.Context, locker string) ([]T, error) {
+	client, ks, err := r.lockScope(nil)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := client.SMembers(ctx, ks.Locker(locker)).Result()
+	if err != nil {
+		return nil, err
+	}
+	return r.findByIds(ctx, client, ks, locker, ids...)
+}
+
+// ReportExecResult 汇报执行结果
+func (r *TaskQueueRepository[T]) ReportExecResult(ctx context.Context, id int64, locker string, execResult string, execErr error) (int64, error) {
+	if locker == "" {
+		return 0, nil
+	}
+	client, ks, err := r.lockScope(nil)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		success      = 1
+		lastErrorStr = ""
+	)
+	if execErr != nil {
+		success = 0
+		lastErrorStr = execErr.Error()
+		if len(lastErrorStr) > 255 {
+			lastErrorStr = lastErrorStr[:255]
+		}
+	}
+	return runWithWait(ctx, client, taskReportScript,
+		[]string{ks.Task(id), ks.Ids(), ks.Locker(locker)},
+		id,
+		locker,
+		success,
+		lastErrorStr,
+		time.Now().Unix(),
+	)
+}
+
+// RenewLease 续租，仅锁定者可以续租，影响行数为0表示锁已丢失
+func (r *TaskQueueRepository[T]) RenewLease(ctx context.Context, id int64, locker string, lease time.Duration) (int64, error) {
+	if locker == "" {
+		return 0, nil
+	}
+	client, ks, err := r.lockScope(nil)
+	if err != nil {
+		return 0, err
+	}
+	return runWithWait(ctx, client, taskRenewScript,
+		[]string{ks.Task(id)},
+		id,
+		locker,
+		int64(lease.Seconds()),
+	)
+}
+
+// runWithWait 读取任务所在的待执行集合并追加到keys末尾后执行脚本，keys[0]为任务Key，
+// 集合在此期间被BaseSave修改时脚本返回-1，重新读取后重试
+func runWithWait(ctx context.Context, client redis.UniversalClient, script *redis.Script, keys []string, args ...any) (int64, error) {
+	for i := 0; i < MAX_TASK_WAIT_RETRIES; i++ {
+		wait, err := client.HGet(ctx, keys[0], "wait").Result()
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		affect, err := script.Run(ctx, client, append(keys[:len(keys):len(keys)], wait), args...).Int64()
+		if err != nil || affect >= 0 {
+			return affect, err
+		}
+	}
+	return 0, ErrTaskWaitChanged
+}
+
+// CountDue 到期待执行的数量
+func (r *TaskQueueRepository[T]) CountDue(ctx context.Context, t T) (int64, error) {
+	client, ks, err := r.lockScope(&t)
+	if err != nil {
+		return 0, err
+	}
+	now, err := client.Time(ctx).Result()
+	if err != nil {
+		return 0, err
+	}
+	return client.ZCount(ctx, ks.Wait(t), "-inf", fmt.Sprintf("(%d", now.Unix())).Result()
+}
+
+func (r *TaskQueueRepository[T]) findByIds(ctx context.Context, client redis.UniversalClient, ks taskKeys, locker string, ids ...string) ([]T, error) {
+	res := []T{}
+	if len(ids) == 0 {
+		return res, nil
+	}
+	cmds := make([]*redis.MapStringStringCmd, 0, len(ids))
+	_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			cmds = append(cmds, pipe.HGetAll(ctx, ks.Task(id)))
+		}
+		return nil
+	})
+	if err != nil {
+		return res, err
+	}
+	for _, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			continue
+		}
+		if locker != "" && fields["locker"] != locker {
+			continue
+		}
+		t, err := decodeTask[T](fields)
+		if err != nil {
+			return res, err
+		}
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+func decodeTask[T any](fields map[string]string) (T, error) {
+	var t T
+	if err := json.Unmarshal([]byte(fields["data"]), &t); err != nil {
+		return t, err
+	}
+	err := overlay(&t, po.LockSection{
+		Locker:     fields["locker"],
+		Expire:     cast.ToInt64(fields["expire"]),
+		Timeout:    cast.ToInt64(fields["timeout"]),
+		LastError:  fields["lastError"],
+		LastExecAt: cast.ToInt64(fields["lastExecAt"]),
+		Retries:    cast.ToInt32(fields["retries"]),
+	})
+	return t, err
+}
+
+// overlay write json fields of src to dst
+func overlay(dst any, src any) error {
+	bs, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, dst)
+}
+
+func unmarshalNumber(bs []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// nonZeroFields json fields of v without zero value, same as gorm Updates with struct
+func nonZeroFields(v any) (map[string]any, error) {
+	bs, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	if err := unmarshalNumber(bs, &m); err != nil {
+		return nil, err
+	}
+	for k, v := range m {
+		switch val := v.(type) {
+		case nil:
+			delete(m, k)
+		case string:
+			if val == "" {
+				delete(m, k)
+			}
+		case bool:
+			if !val {
+				delete(m, k)
+			}
+		case json.Number:
+			if f, err := val.Float64(); err == nil && f == 0 {
+				delete(m, k)
+			}
+		}
+	}
+	return m, nil
+}
+
+func isZero(v any) bool {
+	if v == nil {
+		return true
+	}
+	return reflect.ValueOf(v).IsZero()
+}
@@ -0,0 +1,295 @@
+package redisex
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/pkg/dependency/dependencytest"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/redis/go-redis/v9"
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/cast"
+)
+
+func newTestClient(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	s := miniredis.RunT(t)
+	return s, redis.NewClient(&redis.Options{Addr: s.Addr()})
+}
+
+func TestTaskQueueRepositoryContract(t *testing.T) {
+	_, client := newTestClient(t)
+	dependencytest.MQProducerRepositorySuite(t, &TaskQueueRepository[po.MqMessage]{Client: client})
+}
+
+func TestTaskQueueRepositoryComponent(t *testing.T) {
+	s := miniredis.RunT(t)
+	repo := &TaskQueueRepository[po.MqMessage]{}
+	convey.Convey("TestTaskQueueRepositoryComponent", t, func() {
+		_, err := repo.BaseCount(context.Background())
+		convey.So(err, convey.ShouldEqual, ErrClientNil)
+	})
+	if err := NewRedis(context.Background(), "", &redis.UniversalOptions{Addrs: []string{s.Addr()}}); err != nil {
+		t.Fatal(err)
+	}
+	dependencytest.MQProducerRepositorySuite(t, repo)
+}
+
+func TestTaskQueueRepositoryBase(t *testing.T) {
+	_, client := newTestClient(t)
+	ctx := context.Background()
+	repo := &TaskQueueRepository[po.MqMessage]{Client: client}
+	convey.Convey("TestTaskQueueRepositoryBase", t, func() {
+		m1 := po.NewMqMessage(ctx, 1, "", 1, "topic", "k1", map[string]any{"a": 1}, time.Minute)
+		m2 := po.NewMqMessage(ctx, 1, "", 1, "topic", "k2", map[string]any{"a": 2}, time.Minute)
+		affect, err := repo.BaseCreate(ctx, []*po.MqMessage{m1, m2})
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 2)
+		convey.So(m2.Id, convey.ShouldEqual, m1.Id+1)
+
+		_, err = repo.BaseCreate(ctx, []*po.MqMessage{m1})
+		convey.So(err, convey.ShouldEqual, ErrTaskDuplicate)
+		affect, err = repo.BaseCreate(ctx, []*po.MqMessage{m1}, dependency.WithIgnore(true))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 0)
+
+		count, err := repo.BaseCount(ctx)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(count, convey.ShouldEqual, 2)
+
+		ts, total, err := repo.BaseQueryWithCount(ctx, dependency.WithPage(&dto.Page{PageIndex: 2, PageSize: 1}))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(total, convey.ShouldEqual, 2)
+		convey.So(len(ts), convey.ShouldEqual, 1)
+		convey.So(ts[0].Key, convey.ShouldEqual, "k2")
+		convey.So(ts[0].Locker, convey.ShouldEqual, m2.Locker)
+
+		first, err := repo.BaseGet(ctx)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(first.Key, convey.ShouldEqual, "k1")
+
+		m1.Name = "topic2"
+		affect, err = repo.BaseSave(ctx, []*po.MqMessage{m1})
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+		count, _ = repo.BaseCount(ctx)
+		convey.So(count, convey.ShouldEqual, 2)
+
+		_, err = repo.BaseQuery(ctx, dependency.WithConds("id = ?", 1))
+		convey.So(err, convey.ShouldEqual, ErrCondsNotSupported)
+
+		affect, err = repo.BaseUpdate(ctx, m2, dependency.WithUpdatedMap(map[string]any{"expire": 1}))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+		template := po.MqMessage{}
+		template.BizId, template.Category, template.Name = 1, 1, "topic"
+		_, affect, err = repo.WaitExecWithLock(ctx, template, 10)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+	})
+}
+
+func TestTaskQueueRepositoryReport(t *testing.T) {
+	s, client := newTestClient(t)
+	ctx := context.Background()
+	repo := &TaskQueueRepository[po.MqMessage]{Client: client, MaxRetries: 2}
+	convey.Convey("TestTaskQueueRepositoryReport", t, func() {
+		s.FlushAll()
+		m := po.NewMqMessage(ctx, 1, "", 1, "report", "k", nil, 0)
+		m.Expire = 1
+		_, err := repo.BaseCreate(ctx, []*po.MqMessage{m})
+		convey.So(err, convey.ShouldBeNil)
+		template := po.MqMessage{}
+		template.BizId, template.Category, template.Name = 1, 1, "report"
+
+		convey.Convey("failed and retry until dead", func() {
+			locker, affect, err := repo.WaitExecWithLock(ctx, template, 1)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+
+			affect, err = repo.ReportExecResult(ctx, int64(m.Id), "other", "", nil)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 0)
+
+			affect, err = repo.ReportExecResult(ctx, int64(m.Id), locker, "", errors.New("failed"))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+			lockeds, _ := repo.FindLockeds(ctx, locker)
+			convey.So(lockeds[0].LastError, convey.ShouldEqual, "failed")
+
+			s.SetTime(time.Now().Add(2 * time.Second))
+			_, affect, _ = repo.WaitExecWithLock(ctx, template, 1)
+			convey.So(affect, convey.ShouldEqual, 1)
+			s.SetTime(time.Now().Add(4 * time.Second))
+			_, affect, _ = repo.WaitExecWithLock(ctx, template, 1)
+			convey.So(affect, convey.ShouldEqual, 0)
+			convey.So(s.Exists(repo.keys(nil, dependency.NewBaseOption()).Dead()), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("success and delete", func() {
+			locker, _, _ := repo.WaitExecWithLock(ctx, template, 1)
+			affect, err := repo.ReportExecResult(ctx, int64(m.Id), locker, "ok", nil)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+			count, _ := repo.BaseCount(ctx)
+			convey.So(count, convey.ShouldEqual, 0)
+			lockeds, _ := repo.FindLockeds(ctx, locker)
+			convey.So(len(lockeds), convey.ShouldEqual, 0)
+		})
+	})
+}
+
+func TestTaskQueueRepositoryRenewLease(t *testing.T) {
+	s, client := newTestClient(t)
+	ctx := context.Background()
+	repo := &TaskQueueRepository[po.MqMessage]{Client: client}
+	convey.Convey("TestTaskQueueRepositoryRenewLease", t, func() {
+		s.SetTime(time.Now())
+		m := po.NewMqMessage(ctx, 1, "", 1, "renew", "k", nil, 0)
+		m.Expire = 1
+		m.Timeout = 10
+		_, err := repo.BaseCreate(ctx, []*po.MqMessage{m})
+		convey.So(err, convey.ShouldBeNil)
+		template := po.MqMessage{}
+		template.BizId, template.Category, template.Name = 1, 1, "renew"
+
+		due, err := repo.CountDue(ctx, template)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(due, convey.ShouldEqual, 1)
+
+		locker, affect, err := repo.WaitExecWithLock(ctx, template, 1)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+		due, _ = repo.CountDue(ctx, template)
+		convey.So(due, convey.ShouldEqual, 0)
+
+		affect, err = repo.RenewLease(ctx, int64(m.Id), "other", time.Minute)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 0)
+		affect, err = repo.RenewLease(ctx, int64(m.Id), locker, time.Minute)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+
+		s.SetTime(time.Now().Add(30 * time.Second))
+		due, _ = repo.CountDue(ctx, template)
+		convey.So(due, convey.ShouldEqual, 0)
+		_, affect, _ = repo.WaitExecWithLock(ctx, template, 1)
+		convey.So(affect, convey.ShouldEqual, 0)
+		s.SetTime(time.Now().Add(2 * time.Minute))
+		due, _ = repo.CountDue(ctx, template)
+		convey.So(due, convey.ShouldEqual, 1)
+	})
+}
+
+// shardedMessage DbSharding differs from Database
+type shardedMessage struct {
+	po.MqMessage
+}
+
+func (s shardedMessage) Database() string              { return "tq" }
+func (s shardedMessage) DbSharding(keys ...any) string { return "shard" }
+
+func TestTaskQueueRepositoryLockScope(t *testing.T) {
+	_, client := newTestClient(t)
+	ctx := context.Background()
+	repo := &TaskQueueRepository[shardedMessage]{Client: client}
+	convey.Convey("TestTaskQueueRepositoryLockScope", t, func() {
+		m := &shardedMessage{MqMessage: *po.NewMqMessage(ctx, 1, "", 1, "scope", "k", nil, 0)}
+		m.Expire = 1
+		_, err := repo.BaseCreate(ctx, []*shardedMessage{m}, dependency.WithDataBase("tq"))
+		convey.So(err, convey.ShouldBeNil)
+		template := shardedMessage{}
+		template.BizId, template.Category, template.Name = 1, 1, "scope"
+
+		locker, affect, err := repo.WaitExecWithLock(ctx, template, 1)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+		lockeds, err := repo.FindLockeds(ctx, locker)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(lockeds, convey.ShouldHaveLength, 1)
+		affect, err = repo.RenewLease(ctx, int64(m.Id), locker, time.Minute)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+		affect, err = repo.ReportExecResult(ctx, int64(m.Id), locker, "", nil)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+	})
+}
+
+// scriptKeysHook records KEYS of the scripts
+type scriptKeysHook struct {
+	keys [][]string
+}
+
+func (h *scriptKeysHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *scriptKeysHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if name := cmd.Name(); name == "evalsha" || name == "eval" {
+			args := cmd.Args()
+			keys := []string{}
+			for _, k := range args[3 : 3+cast.ToInt(args[2])] {
+				keys = append(keys, cast.ToString(k))
+			}
+			h.keys = append(h.keys, keys)
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *scriptKeysHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestTaskQueueRepositoryScriptKeys(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	hook := &scriptKeysHook{}
+	client.AddHook(hook)
+	ctx := context.Background()
+	repo := &TaskQueueRepository[po.MqMessage]{Client: client}
+	convey.Convey("TestTaskQueueRepositoryScriptKeys", t, func() {
+		m := po.NewMqMessage(ctx, 1, "", 1, "keys", "k", nil, 0)
+		m.Expire = 1
+		_, err := repo.BaseCreate(ctx, []*po.MqMessage{m})
+		convey.So(err, convey.ShouldBeNil)
+		template := po.MqMessage{}
+		template.BizId, template.Category, template.Name = 1, 1, "keys"
+		ks := repo.keys(nil, dependency.NewBaseOption())
+
+		locker, affect, err := repo.WaitExecWithLock(ctx, template, 1)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+		convey.So(hook.keys[len(hook.keys)-1], convey.ShouldContain, ks.Task(m.Id))
+
+		// the wait set is changed after claim
+		m.Name = "keys2"
+		m.Locker, m.Expire = locker, time.Now().Add(time.Minute).Unix()
+		_, err = repo.BaseSave(ctx, []*po.MqMessage{m})
+		convey.So(err, convey.ShouldBeNil)
+		affect, err = repo.RenewLease(ctx, int64(m.Id), locker, time.Minute)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+		convey.So(hook.keys[len(hook.keys)-1], convey.ShouldContain, ks.Wait(*m))
+		affect, err = repo.ReportExecResult(ctx, int64(m.Id), locker, "", nil)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+		convey.So(hook.keys[len(hook.keys)-1], convey.ShouldContain, ks.Wait(*m))
+		convey.So(s.Exists(ks.Wait(*m)), convey.ShouldBeFalse)
+
+		// all keys share the same hash tag
+		tag := ks.Ids()[strings.Index(ks.Ids(), "{"):strings.Index(ks.Ids(), "}")]
+		for _, keys := range hook.keys {
+			for _, k := range keys {
+				convey.So(k, convey.ShouldContainSubstring, tag)
+			}
+		}
+	})
+}
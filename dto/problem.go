@@ -0,0 +1,14 @@
+package dto
+
+// Problem RFC 7807 problem details，附带业务错误码与字段错误
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     int32        `json:"code"`
+	SubCode  int32        `json:"subCode,omitempty"`
+	Reason   string       `json:"reason"`
+	Errors   []FieldError `json:"errors,omitempty"`
+}
@@ -21,10 +21,19 @@ type IResponse interface {
 }
 
 type BaseResponse struct {
-	Code    int32  `json:"code"`
-	SubCode int32  `json:"subCode"`
-	Message string `json:"message"`
-	Msg     string `json:"msg,omitempty"`
+	Code    int32        `json:"code"`
+	SubCode int32        `json:"subCode"`
+	Message string       `json:"message"`
+	Msg     string       `json:"msg,omitempty"`
+	Errors  []FieldError `json:"errors,omitempty"` // 参数校验失败的字段
+}
+
+// FieldError 字段校验错误
+type FieldError struct {
+	Field   string `json:"field"`           // 字段路径，使用json名称，如items[0].title
+	Rule    string `json:"rule"`            // 校验规则，如required、mobile
+	Param   string `json:"param,omitempty"` // 规则参数
+	Message string `json:"message"`         // 本地化后的提示
 }
 
 func (r BaseResponse) ToException() exception.Exception {
@@ -58,6 +67,13 @@ type PtrResponse[T any] struct {
 	Data *T `json:"data"`
 }
 
+// NewFieldErrorResponse 参数校验失败的响应，携带字段错误列表
+func NewFieldErrorResponse(ex exception.Exception, errs []FieldError) *Response {
+	res := NewResponse(nil, ex)
+	res.Errors = errs
+	return res
+}
+
 // ErrorResponse 函数接收一个错误对象 err，返回一个指向 Response 结构体的指针 res。
 // 该函数用于生成一个错误响应对象，将错误信息赋值给 Response 结构体的 Message 字段，
 // 并将 Code 字段设为 -1。
@@ -0,0 +1,76 @@
+package essync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	"github.com/illidaris/aphrodite/po"
+)
+
+const (
+	CATEGORY_ES_SYNC   uint32 = 1024      // 发件箱消息类别
+	TOPIC_PREFIX              = "essync." // 发件箱消息主题前缀，后接表名
+	OP_UPSERT                 = "upsert"  // 新增或修改
+	OP_DELETE                 = "delete"  // 删除
+	PRIMARY_KEY               = "id"      // 回查主键列
+	DEFAULT_BATCH_SIZE        = 500       // 回查、重建与校验的批量
+	DEFAULT_TIMEOUT           = 30        // 消费锁定时长（秒）
+)
+
+var (
+	ErrNoID         = errors.New("essync: entity has no id, the change can not be captured")
+	ErrInvalidEvent = errors.New("essync: invalid change event")
+)
+
+// ChangeEvent 实体变更事件，消费时按Ids回查数据库的最新状态，不存在则删除
+type ChangeEvent struct {
+	Op            string   `json:"op"`
+	Db            string   `json:"db"`
+	Table         string   `json:"table"`
+	DbShardingKey []any    `json:"dbShardingKey,omitempty"`
+	TbShardingKey []any    `json:"tbShardingKey,omitempty"`
+	Ids           []string `json:"ids"`
+	Versions      []int64  `json:"versions,omitempty"` // 与Ids一一对应，用于删除时的外部版本
+}
+
+// Topic topic of the outbox message of table
+func Topic(table string) string {
+	return TOPIC_PREFIX + table
+}
+
+// NewMessage outbox message of the change event, it is due immediately
+func NewMessage(ctx context.Context, e *ChangeEvent, timeout time.Duration) *po.MqMessage {
+	key := e.Table
+	if len(e.Ids) > 0 {
+		key = e.Ids[0]
+	}
+	m := po.NewMqMessage(ctx, uint64(contextex.GetBizId(ctx)), e.Db, CATEGORY_ES_SYNC, Topic(e.Table), key, e, timeout)
+	m.Expire = time.Now().Unix() - 1
+	return m
+}
+
+// ParseMessage change event of the outbox message
+func ParseMessage(m po.MqMessage) (*ChangeEvent, error) {
+	e := &ChangeEvent{}
+	if err := json.Unmarshal([]byte(m.Args), e); err != nil {
+		return nil, errors.Join(ErrInvalidEvent, err)
+	}
+	if len(e.Versions) > 0 && len(e.Versions) != len(e.Ids) {
+		return nil, ErrInvalidEvent
+	}
+	return e, nil
+}
+
+// Template template of the outbox messages of table, register it to taskworker.Worker with Projector.Handle
+func Template(bizId uint64, db, table string) po.MqMessage {
+	m := po.MqMessage{}
+	m.BizId = bizId
+	m.Db = db
+	m.Category = CATEGORY_ES_SYNC
+	m.Name = Topic(table)
+	m.Timeout = DEFAULT_TIMEOUT
+	return m
+}
@@ -0,0 +1,313 @@
+package essync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/agiledragon/gomonkey/v2"
+	"github.com/illidaris/aphrodite/component/gormex"
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+	iLog "github.com/illidaris/logger"
+	"github.com/smartystreets/goconvey/convey"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type essyncArticle struct {
+	dependency.EmptyPo
+	Id      int64  `json:"id" gorm:"primaryKey"`
+	Title   string `json:"title"`
+	Version int64  `json:"version"`
+}
+
+func (a essyncArticle) ID() any           { return a.Id }
+func (a essyncArticle) TableName() string { return "essync_article" }
+func (a essyncArticle) GetVersion() int64 { return a.Version }
+
+// memSource in memory ISource, only the conds used by Projector are supported
+type memSource struct {
+	rows map[int64]essyncArticle
+}
+
+func (s *memSource) BaseQuery(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]essyncArticle, error) {
+	opt := dependency.NewBaseOption(opts...)
+	res := []essyncArticle{}
+	for _, row := range s.rows {
+		if len(opt.Conds) == 2 {
+			switch opt.Conds[0] {
+			case "id IN ?":
+				hit := false
+				for _, id := range opt.Conds[1].([]string) {
+					hit = hit || id == strconv.FormatInt(row.Id, 10)
+				}
+				if !hit {
+					continue
+				}
+			case "id > ?":
+				if row.Id <= opt.Conds[1].(int64) {
+					continue
+				}
+			}
+		}
+		res = append(res, row)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+	if opt.Page != nil && int64(len(res)) > opt.Page.GetPageSize() {
+		res = res[:opt.Page.GetPageSize()]
+	}
+	return res, nil
+}
+
+func (s *memSource) BaseCount(ctx context.Context, opts ...dependency.BaseOptionFunc) (int64, error) {
+	return int64(len(s.rows)), nil
+}
+
+// memSink in memory ISink with external versions
+type memSink struct {
+	docs     map[string]essyncArticle
+	versions map[string]int64
+	syncs    int
+}
+
+func newMemSink() *memSink {
+	return &memSink{docs: map[string]essyncArticle{}, versions: map[string]int64{}}
+}
+
+func (s *memSink) BaseSync(ctx context.Context, upserts []*essyncArticle, deletes map[string]int64, opts ...dependency.BaseOptionFunc) (int64, error) {
+	s.syncs++
+	var affect int64
+	for _, t := range upserts {
+		id := strconv.FormatInt(t.Id, 10)
+		if t.Version > 0 && t.Version <= s.versions[id] {
+			continue
+		}
+		s.docs[id] = *t
+		s.versions[id] = t.Version
+		affect++
+	}
+	for id, version := range deletes {
+		if _, ok := s.docs[id]; !ok || version > 0 && version <= s.versions[id] {
+			continue
+		}
+		delete(s.docs, id)
+		affect++
+	}
+	return affect, nil
+}
+
+func (s *memSink) BaseQueryByIDs(ctx context.Context, ids []string, opts ...dependency.BaseOptionFunc) ([]essyncArticle, error) {
+	res := []essyncArticle{}
+	for _, id := range ids {
+		if doc, ok := s.docs[id]; ok {
+			res = append(res, doc)
+		}
+	}
+	return res, nil
+}
+
+func (s *memSink) BaseCount(ctx context.Context, opts ...dependency.BaseOptionFunc) (int64, error) {
+	return int64(len(s.docs)), nil
+}
+
+func newMemSource(n int) *memSource {
+	s := &memSource{rows: map[int64]essyncArticle{}}
+	for i := 1; i <= n; i++ {
+		s.rows[int64(i)] = essyncArticle{Id: int64(i), Title: fmt.Sprintf("t%d", i), Version: 1}
+	}
+	return s
+}
+
+func TestProjector(t *testing.T) {
+	convey.Convey("TestProjector", t, func() {
+		ctx := context.Background()
+		source, sink := newMemSource(5), newMemSink()
+		p := NewProjector[essyncArticle](source, sink, WithBatchSize(2))
+
+		convey.Convey("project upsert and delete", func() {
+			affect, err := p.Project(ctx, &ChangeEvent{Op: OP_UPSERT, Ids: []string{"1", "2", "3"}})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 3)
+			convey.So(sink.syncs, convey.ShouldEqual, 2)
+
+			// 旧事件重复消费不会覆盖新版本
+			source.rows[1] = essyncArticle{Id: 1, Title: "new", Version: 2}
+			_, err = p.Sync(ctx, "1")
+			convey.So(err, convey.ShouldBeNil)
+			delete(source.rows, 2)
+			affect, err = p.Project(ctx, &ChangeEvent{Op: OP_DELETE, Ids: []string{"2"}, Versions: []int64{1}}, &ChangeEvent{Op: OP_UPSERT, Ids: []string{"1"}})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+			convey.So(sink.docs["1"].Title, convey.ShouldEqual, "new")
+			convey.So(sink.docs, convey.ShouldNotContainKey, "2")
+
+			_, err = p.Project(ctx, &ChangeEvent{Op: OP_UPSERT, Ids: []string{"1"}, Versions: []int64{1, 2}})
+			convey.So(err, convey.ShouldEqual, ErrInvalidEvent)
+		})
+
+		convey.Convey("handle outbox message", func() {
+			m := NewMessage(ctx, &ChangeEvent{Op: OP_UPSERT, Table: "essync_article", Ids: []string{"4"}}, 0)
+			convey.So(m.Name, convey.ShouldEqual, Template(0, "", "essync_article").Name)
+			convey.So(m.Category, convey.ShouldEqual, CATEGORY_ES_SYNC)
+			res, err := p.Handle(ctx, *m)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(res, convey.ShouldEqual, "1")
+			_, err = p.Handle(ctx, po.MqMessage{})
+			convey.So(err, convey.ShouldWrap, ErrInvalidEvent)
+		})
+
+		convey.Convey("rebuild and check", func() {
+			progress := []int64{}
+			p := NewProjector[essyncArticle](source, sink, WithBatchSize(2), WithProgress(func(done, total int64) {
+				progress = append(progress, done)
+			}))
+			res, err := p.Check(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(res.Consistent(), convey.ShouldBeFalse)
+			convey.So(res.Missing, convey.ShouldResemble, []string{"1", "2", "3", "4", "5"})
+
+			affect, err := p.Rebuild(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 5)
+			convey.So(progress[len(progress)-1], convey.ShouldEqual, 5)
+
+			res, err = p.Check(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(res.Consistent(), convey.ShouldBeTrue)
+
+			sink.docs["3"] = essyncArticle{Id: 3, Title: "dirty", Version: 1}
+			sink.docs["9"] = essyncArticle{Id: 9}
+			res, err = p.Check(ctx)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(res.Mismatched, convey.ShouldResemble, []string{"3"})
+			convey.So(res.SinkCount-res.SourceCount, convey.ShouldEqual, 1)
+		})
+	})
+}
+
+// tenantSource memSource scoped by the tenant of ctx like gormex.BaseRepository
+type tenantSource struct {
+	*memSource
+	bizIds []int64
+}
+
+func (s *tenantSource) BaseQuery(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]essyncArticle, error) {
+	opt := dependency.NewBaseOption(opts...)
+	if err := dependency.ApplyTenant[po.BizSection](ctx, nil, opt, dependency.TENANT_OP_QUERY); err != nil {
+		return nil, err
+	}
+	s.bizIds = append(s.bizIds, opt.Tenant.BizId)
+	return s.memSource.BaseQuery(ctx, opts...)
+}
+
+func TestProjectorTenant(t *testing.T) {
+	dependency.EnableTenancy(true)
+	defer dependency.EnableTenancy(false)
+	convey.Convey("TestProjectorTenant", t, func() {
+		source, sink := &tenantSource{memSource: newMemSource(2)}, newMemSink()
+		p := NewProjector[essyncArticle](source, sink)
+		m := NewMessage(contextex.WithBizId(context.Background(), 7), &ChangeEvent{Op: OP_UPSERT, Table: "essync_article", Ids: []string{"1"}}, 0)
+		convey.So(m.BizId, convey.ShouldEqual, 7)
+
+		// 消息的BizId写入上下文
+		res, err := p.Handle(context.Background(), *m)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(res, convey.ShouldEqual, "1")
+		convey.So(source.bizIds, convey.ShouldResemble, []int64{7})
+
+		_, err = p.Rebuild(context.Background())
+		convey.So(err, convey.ShouldEqual, dependency.ErrTenantRequired)
+	})
+}
+
+// recordOutbox record the messages inserted into outbox
+type recordOutbox struct {
+	gormex.EventRepository[po.MqMessage]
+	messages []*po.MqMessage
+}
+
+func (r *recordOutbox) InsertAction(ctx context.Context, db string, t *po.MqMessage) func(context.Context) error {
+	r.messages = append(r.messages, t)
+	return r.EventRepository.InsertAction(ctx, db, t)
+}
+
+func TestRepository(t *testing.T) {
+	mockDb(func(mock sqlmock.Sqlmock) {
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `essync_article`").WillReturnResult(sqlmock.NewResult(7, 1))
+		mock.ExpectExec("INSERT INTO `aphrodite_mq_compensate`").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("DELETE FROM `essync_article`").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO `essync_article`").WillReturnResult(sqlmock.NewResult(9, 1))
+		mock.ExpectExec("INSERT INTO `aphrodite_mq_compensate`").WillReturnResult(sqlmock.NewResult(2, 1))
+		mock.ExpectCommit()
+	}, func(mock sqlmock.Sqlmock, err error) {
+		convey.Convey("TestRepository", t, func() {
+			convey.So(err, convey.ShouldBeNil)
+			ctx := context.Background()
+			outbox := &recordOutbox{}
+			repo := NewRepository[essyncArticle](WithOutbox(outbox))
+
+			affect, err := repo.BaseCreate(ctx, []*essyncArticle{{Title: "a", Version: 3}})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+			convey.So(outbox.messages, convey.ShouldHaveLength, 1)
+			e, err := ParseMessage(*outbox.messages[0])
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(e, convey.ShouldResemble, &ChangeEvent{Op: OP_UPSERT, Table: "essync_article", Ids: []string{"7"}, Versions: []int64{3}})
+
+			// 未影响行不写发件箱
+			affect, err = repo.BaseDelete(ctx, &essyncArticle{Id: 8})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 0)
+			convey.So(outbox.messages, convey.ShouldHaveLength, 1)
+
+			_, err = repo.BaseUpdate(ctx, &essyncArticle{Title: "b"})
+			convey.So(err, convey.ShouldEqual, ErrNoID)
+
+			// 加入上下文中的事务，影响行数在写入后返回
+			tx := gormex.GetTransactionDb("").Begin()
+			affect, err = repo.BaseCreate(context.WithValue(ctx, gormex.GetDbTX(""), tx), []*essyncArticle{{Title: "c", Version: 1}})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(affect, convey.ShouldEqual, 1)
+			convey.So(tx.Commit().Error, convey.ShouldBeNil)
+			convey.So(outbox.messages, convey.ShouldHaveLength, 2)
+			convey.So(mock.ExpectationsWereMet(), convey.ShouldBeNil)
+		})
+	})
+}
+
+func mockDb(f func(sqlmock.Sqlmock), exec func(sqlmock.Sqlmock, error)) {
+	iLog.OnlyConsole()
+	gormex.SetDisableQueryFields()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		exec(nil, err)
+		return
+	}
+	f(mock)
+	defer db.Close()
+	gormDb, err := gorm.Open(mysql.New(mysql.Config{
+		Conn:                      db,
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{
+		Logger: gormex.NewLogger(),
+	})
+	if err != nil {
+		exec(nil, err)
+		return
+	}
+	f1 := gomonkey.ApplyFunc(gormex.GetTransactionDb, func(id string) *gorm.DB {
+		return gormDb
+	})
+	defer f1.Reset()
+	exec(mock, nil)
+}
@@ -0,0 +1,86 @@
+package essync
+
+import (
+	"time"
+
+	"github.com/illidaris/aphrodite/component/gormex"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+)
+
+// UnitOfWorkFunc 创建写实体与发件箱的本地事务
+type UnitOfWorkFunc func(db string) dependency.IUnitOfWork
+
+type Option func(*Options)
+
+type Options struct {
+	Timeout    time.Duration                                  // 发件箱消息的消费锁定时长
+	Outbox     dependency.IMQProducerRepository[po.MqMessage] // 发件箱仓储
+	UnitOfWork UnitOfWorkFunc                                 // ctx中无事务时创建事务
+	SourceOpts []dependency.BaseOptionFunc                    // 回查数据库的附加选项
+	SinkOpts   []dependency.BaseOptionFunc                    // 写入es的附加选项，例如索引名
+	BatchSize  int64                                          // 回查、重建与校验的批量
+	Progress   func(done, total int64)                        // 重建与校验的进度回调
+}
+
+func newOptions(opts ...Option) *Options {
+	o := &Options{
+		Timeout:    DEFAULT_TIMEOUT * time.Second,
+		Outbox:     &gormex.EventRepository[po.MqMessage]{},
+		UnitOfWork: defaultUnitOfWork,
+		BatchSize:  DEFAULT_BATCH_SIZE,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = DEFAULT_BATCH_SIZE
+	}
+	return o
+}
+
+func defaultUnitOfWork(db string) dependency.IUnitOfWork {
+	return gormex.NewUnitOfWork(db)
+}
+
+func WithTimeout(v time.Duration) Option {
+	return func(o *Options) {
+		o.Timeout = v
+	}
+}
+
+func WithOutbox(v dependency.IMQProducerRepository[po.MqMessage]) Option {
+	return func(o *Options) {
+		o.Outbox = v
+	}
+}
+
+func WithUnitOfWork(v UnitOfWorkFunc) Option {
+	return func(o *Options) {
+		o.UnitOfWork = v
+	}
+}
+
+func WithSourceOpts(vs ...dependency.BaseOptionFunc) Option {
+	return func(o *Options) {
+		o.SourceOpts = vs
+	}
+}
+
+func WithSinkOpts(vs ...dependency.BaseOptionFunc) Option {
+	return func(o *Options) {
+		o.SinkOpts = vs
+	}
+}
+
+func WithBatchSize(v int64) Option {
+	return func(o *Options) {
+		o.BatchSize = v
+	}
+}
+
+func WithProgress(v func(done, total int64)) Option {
+	return func(o *Options) {
+		o.Progress = v
+	}
+}
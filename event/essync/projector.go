@@ -0,0 +1,294 @@
+package essync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+	iLog "github.com/illidaris/logger"
+	"go.uber.org/zap"
+)
+
+// ISource 数据源，一般为gormex.BaseRepository
+type ISource[T dependency.IEntity] interface {
+	BaseQuery(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]T, error)
+	BaseCount(ctx context.Context, opts ...dependency.BaseOptionFunc) (int64, error)
+}
+
+// ISink 投影目标，一般为elasticex.BaseRepository
+type ISink[T dependency.IEntity] interface {
+	BaseSync(ctx context.Context, upserts []*T, deletes map[string]int64, opts ...dependency.BaseOptionFunc) (int64, error)
+	BaseQueryByIDs(ctx context.Context, ids []string, opts ...dependency.BaseOptionFunc) ([]T, error)
+	BaseCount(ctx context.Context, opts ...dependency.BaseOptionFunc) (int64, error)
+}
+
+// CheckResult 一致性校验结果
+type CheckResult struct {
+	SourceCount    int64    `json:"sourceCount"`
+	SinkCount      int64    `json:"sinkCount"`
+	SourceChecksum uint64   `json:"sourceChecksum"` // 文档摘要的异或，与顺序无关
+	SinkChecksum   uint64   `json:"sinkChecksum"`
+	Missing        []string `json:"missing"`    // 数据库存在，es不存在
+	Mismatched     []string `json:"mismatched"` // 两边内容不一致
+}
+
+// Consistent counts and checksums are equal
+func (r *CheckResult) Consistent() bool {
+	return r.SourceCount == r.SinkCount && r.SourceChecksum == r.SinkChecksum && len(r.Missing)+len(r.Mismatched) == 0
+}
+
+/*
+Projector project the changes of the database into elasticsearch.
+
+	p := essync.NewProjector[Article](&gormex.BaseRepository[Article]{}, &elasticex.BaseRepository[Article]{})
+	worker.Register(essync.Template(0, "db", "article"), p.Handle)
+
+the entities are reloaded by ids, the existed are upserted and the missing are deleted,
+so the events can be consumed repeatedly or out of order, versions of IVersion guard the stale writes.
+*/
+type Projector[T dependency.IEntity] struct {
+	source ISource[T]
+	sink   ISink[T]
+	opts   *Options
+}
+
+func NewProjector[T dependency.IEntity](source ISource[T], sink ISink[T], opts ...Option) *Projector[T] {
+	return &Projector[T]{
+		source: source,
+		sink:   sink,
+		opts:   newOptions(opts...),
+	}
+}
+
+// Handle taskworker.Handler of the outbox messages, the BizId of the message is the tenant of the projection
+func (p *Projector[T]) Handle(ctx context.Context, m po.MqMessage) (string, error) {
+	e, err := ParseMessage(m)
+	if err != nil {
+		return "", err
+	}
+	if m.BizId != 0 {
+		ctx = contextex.WithBizId(ctx, int64(m.BizId))
+	}
+	affect, err := p.Project(ctx, e)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d", affect), nil
+}
+
+// Project apply the change events
+func (p *Projector[T]) Project(ctx context.Context, events ...*ChangeEvent) (int64, error) {
+	var affect int64
+	for _, e := range events {
+		if e == nil || len(e.Ids) == 0 {
+			continue
+		}
+		if len(e.Versions) > 0 && len(e.Versions) != len(e.Ids) {
+			return affect, ErrInvalidEvent
+		}
+		n, err := p.project(ctx, e)
+		affect += n
+		if err != nil {
+			return affect, err
+		}
+	}
+	return affect, nil
+}
+
+// Sync reload and project the entities by ids
+func (p *Projector[T]) Sync(ctx context.Context, ids ...string) (int64, error) {
+	return p.Project(ctx, &ChangeEvent{Op: OP_UPSERT, Ids: ids})
+}
+
+func (p *Projector[T]) project(ctx context.Context, e *ChangeEvent) (int64, error) {
+	var affect int64
+	for begin := 0; begin < len(e.Ids); begin += int(p.opts.BatchSize) {
+		end := min(begin+int(p.opts.BatchSize), len(e.Ids))
+		ids := e.Ids[begin:end]
+		ts, err := p.source.BaseQuery(ctx, p.sourceOpts(e, dependency.WithConds(PRIMARY_KEY+" IN ?", ids))...)
+		if err != nil {
+			return affect, err
+		}
+		found := map[string]struct{}{}
+		upserts := make([]*T, 0, len(ts))
+		for i := range ts {
+			found[idString(ts[i].ID())] = struct{}{}
+			upserts = append(upserts, &ts[i])
+		}
+		deletes := map[string]int64{}
+		for i, id := range ids {
+			if _, ok := found[id]; ok {
+				continue
+			}
+			var version int64
+			if len(e.Versions) > 0 && e.Versions[begin+i] > 0 {
+				// 删除晚于该版本的写入
+				version = e.Versions[begin+i] + 1
+			}
+			deletes[id] = version
+		}
+		n, err := p.sink.BaseSync(ctx, upserts, deletes, p.opts.SinkOpts...)
+		affect += n
+		if err != nil {
+			return affect, err
+		}
+	}
+	return affect, nil
+}
+
+func (p *Projector[T]) sourceOpts(e *ChangeEvent, opts ...dependency.BaseOptionFunc) []dependency.BaseOptionFunc {
+	res := append([]dependency.BaseOptionFunc{}, p.opts.SourceOpts...)
+	if e != nil {
+		if e.Db != "" {
+			res = append(res, dependency.WithDataBase(e.Db))
+		}
+		if e.Table != "" {
+			res = append(res, dependency.WithTableName(e.Table))
+		}
+		if len(e.DbShardingKey) > 0 {
+			res = append(res, dependency.WithDbShardingKey(e.DbShardingKey...))
+		}
+		if len(e.TbShardingKey) > 0 {
+			res = append(res, dependency.WithTbShardingKey(e.TbShardingKey...))
+		}
+	}
+	return append(res, opts...)
+}
+
+// page keyset paging by primary key, the ids must be ordered
+func (p *Projector[T]) page(ctx context.Context, cursor any) ([]T, error) {
+	opts := []dependency.BaseOptionFunc{
+		dependency.WithPage(&dto.Page{PageIndex: 1, PageSize: p.opts.BatchSize, Sorts: []string{PRIMARY_KEY}}),
+	}
+	if cursor != nil {
+		opts = append(opts, dependency.WithConds(PRIMARY_KEY+" > ?", cursor))
+	}
+	return p.source.BaseQuery(ctx, p.sourceOpts(nil, opts...)...)
+}
+
+// Rebuild backfill all entities of the database into elasticsearch,
+// with tenancy enabled ctx carries the BizId of the tenant or dependency.WithCrossTenant for all tenants
+func (p *Projector[T]) Rebuild(ctx context.Context) (int64, error) {
+	total, err := p.source.BaseCount(ctx, p.sourceOpts(nil)...)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		affect int64
+		done   int64
+		cursor any
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return affect, err
+		}
+		ts, err := p.page(ctx, cursor)
+		if err != nil {
+			return affect, err
+		}
+		if len(ts) == 0 {
+			break
+		}
+		upserts := make([]*T, 0, len(ts))
+		for i := range ts {
+			upserts = append(upserts, &ts[i])
+		}
+		n, err := p.sink.BaseSync(ctx, upserts, nil, p.opts.SinkOpts...)
+		affect += n
+		if err != nil {
+			return affect, err
+		}
+		done += int64(len(ts))
+		if p.opts.Progress != nil {
+			p.opts.Progress(done, total)
+		}
+		if int64(len(ts)) < p.opts.BatchSize {
+			break
+		}
+		cursor = ts[len(ts)-1].ID()
+	}
+	iLog.InfoCtx(ctx, "essync rebuild done", zap.Int64("total", total), zap.Int64("affect", affect))
+	return affect, nil
+}
+
+// Check compare counts and checksums of the database and elasticsearch, the documents only in elasticsearch make the counts differ,
+// the tenant of ctx is the same as Rebuild
+func (p *Projector[T]) Check(ctx context.Context) (*CheckResult, error) {
+	res := &CheckResult{}
+	var err error
+	if res.SourceCount, err = p.source.BaseCount(ctx, p.sourceOpts(nil)...); err != nil {
+		return nil, err
+	}
+	if res.SinkCount, err = p.sink.BaseCount(ctx, p.opts.SinkOpts...); err != nil {
+		return nil, err
+	}
+	var (
+		done   int64
+		cursor any
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ts, err := p.page(ctx, cursor)
+		if err != nil {
+			return nil, err
+		}
+		if len(ts) == 0 {
+			break
+		}
+		ids := make([]string, 0, len(ts))
+		for _, t := range ts {
+			ids = append(ids, idString(t.ID()))
+		}
+		docs, err := p.sink.BaseQueryByIDs(ctx, ids, p.opts.SinkOpts...)
+		if err != nil {
+			return nil, err
+		}
+		sums := map[string]uint64{}
+		for _, doc := range docs {
+			sum := checksum(doc)
+			sums[idString(doc.ID())] = sum
+			res.SinkChecksum ^= sum
+		}
+		for i, t := range ts {
+			sum := checksum(t)
+			res.SourceChecksum ^= sum
+			cur, ok := sums[ids[i]]
+			if !ok {
+				res.Missing = append(res.Missing, ids[i])
+			} else if cur != sum {
+				res.Mismatched = append(res.Mismatched, ids[i])
+			}
+		}
+		done += int64(len(ts))
+		if p.opts.Progress != nil {
+			p.opts.Progress(done, res.SourceCount)
+		}
+		if int64(len(ts)) < p.opts.BatchSize {
+			break
+		}
+		cursor = ts[len(ts)-1].ID()
+	}
+	if !res.Consistent() {
+		iLog.WarnCtx(ctx, "essync check inconsistent",
+			zap.Int64("sourceCount", res.SourceCount),
+			zap.Int64("sinkCount", res.SinkCount),
+			zap.Int("missing", len(res.Missing)),
+			zap.Int("mismatched", len(res.Mismatched)))
+	}
+	return res, nil
+}
+
+// checksum fnv64a of the json document
+func checksum(v any) uint64 {
+	bs, _ := json.Marshal(v)
+	h := fnv.New64a()
+	_, _ = h.Write(bs)
+	return h.Sum64()
+}
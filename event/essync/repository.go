@@ -0,0 +1,167 @@
+package essync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/illidaris/aphrodite/component/gormex"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"gorm.io/gorm"
+)
+
+var _ = dependency.IRepository[dependency.IEntity](&Repository[dependency.IEntity]{})
+
+/*
+Repository gormex.BaseRepository which captures the changes into the outbox in the same transaction,
+the transaction in ctx is joined, otherwise a new one is created.
+
+	repo := essync.NewRepository[Article]()
+	_, err := repo.BaseCreate(ctx, []*Article{a})
+
+the entity of the outbox message is not the document, the consumer reload it by ids,
+so the projection is always the latest state of the database.
+*/
+type Repository[T dependency.IEntity] struct {
+	gormex.BaseRepository[T]
+	opts *Options
+}
+
+func NewRepository[T dependency.IEntity](opts ...Option) *Repository[T] {
+	return &Repository[T]{opts: newOptions(opts...)}
+}
+
+func (r *Repository[T]) options() *Options {
+	if r.opts == nil {
+		r.opts = newOptions()
+	}
+	return r.opts
+}
+
+// BaseCreate create and capture upsert
+func (r *Repository[T]) BaseCreate(ctx context.Context, ps []*T, opts ...dependency.BaseOptionFunc) (int64, error) {
+	return r.capture(ctx, OP_UPSERT, ps, func(ctx context.Context) (int64, error) {
+		return r.BaseRepository.BaseCreate(ctx, ps, opts...)
+	}, opts...)
+}
+
+// BaseSave save and capture upsert
+func (r *Repository[T]) BaseSave(ctx context.Context, ps []*T, opts ...dependency.BaseOptionFunc) (int64, error) {
+	return r.capture(ctx, OP_UPSERT, ps, func(ctx context.Context) (int64, error) {
+		return r.BaseRepository.BaseSave(ctx, ps, opts...)
+	}, opts...)
+}
+
+// BaseUpdate update and capture upsert, the id of p is required
+func (r *Repository[T]) BaseUpdate(ctx context.Context, p *T, opts ...dependency.BaseOptionFunc) (int64, error) {
+	// 按条件批量变更无法得知影响的id
+	if isCreate(p) {
+		return 0, ErrNoID
+	}
+	return r.capture(ctx, OP_UPSERT, []*T{p}, func(ctx context.Context) (int64, error) {
+		return r.BaseRepository.BaseUpdate(ctx, p, opts...)
+	}, opts...)
+}
+
+// BaseDelete delete and capture delete, the id of p is required
+func (r *Repository[T]) BaseDelete(ctx context.Context, p *T, opts ...dependency.BaseOptionFunc) (int64, error) {
+	// 按条件批量变更无法得知影响的id
+	if isCreate(p) {
+		return 0, ErrNoID
+	}
+	return r.capture(ctx, OP_DELETE, []*T{p}, func(ctx context.Context) (int64, error) {
+		return r.BaseRepository.BaseDelete(ctx, p, opts...)
+	}, opts...)
+}
+
+func (r *Repository[T]) capture(ctx context.Context, op string, ps []*T, write func(context.Context) (int64, error), opts ...dependency.BaseOptionFunc) (int64, error) {
+	if len(ps) == 0 {
+		return 0, nil
+	}
+	var (
+		o      = r.options()
+		opt    = dependency.NewBaseOption(opts...)
+		db     = opt.GetDataBase(*ps[0])
+		affect int64
+	)
+	action := func(ctx context.Context) error {
+		n, err := write(ctx)
+		if err != nil {
+			return err
+		}
+		affect = n
+		if n == 0 {
+			return nil
+		}
+		// 自增主键在写入后才能取得
+		e, err := NewChangeEvent(op, ps, opt)
+		if err != nil {
+			return err
+		}
+		e.Db = db
+		return o.Outbox.InsertAction(ctx, db, NewMessage(ctx, e, o.Timeout))(ctx)
+	}
+	if _, ok := ctx.Value(gormex.GetDbTX(db)).(*gorm.DB); ok {
+		// action赋值affect，需先执行再返回
+		err := action(ctx)
+		return affect, err
+	}
+	err := o.UnitOfWork(db).Execute(ctx, action)
+	return affect, err
+}
+
+// NewChangeEvent change event of the entities, the entities without id are rejected
+func NewChangeEvent[T dependency.IEntity](op string, ps []*T, opt *dependency.BaseOption) (*ChangeEvent, error) {
+	e := &ChangeEvent{
+		Op:            op,
+		Db:            opt.GetDataBase(*ps[0]),
+		Table:         opt.GetTableName(*ps[0]),
+		DbShardingKey: opt.DbShardingKey,
+		TbShardingKey: opt.TbShardingKey,
+	}
+	versioned := false
+	for _, p := range ps {
+		if p == nil {
+			continue
+		}
+		id := idString((*p).ID())
+		if id == "" {
+			return nil, ErrNoID
+		}
+		var version int64
+		if v, ok := any(*p).(dependency.IVersion); ok {
+			version = v.GetVersion()
+			versioned = versioned || version > 0
+		}
+		e.Ids = append(e.Ids, id)
+		e.Versions = append(e.Versions, version)
+	}
+	if !versioned {
+		e.Versions = nil
+	}
+	return e, nil
+}
+
+// isCreate the id of p is empty, it will be generated on create
+func isCreate[T dependency.IEntity](p *T) bool {
+	return p == nil || idString((*p).ID()) == ""
+}
+
+// idString zero value of the id is treated as empty
+func idString(id any) string {
+	switch v := id.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case *string:
+		if v == nil {
+			return ""
+		}
+		return *v
+	}
+	s := fmt.Sprint(id)
+	if s == "0" || s == "<nil>" {
+		return ""
+	}
+	return s
+}
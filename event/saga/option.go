@@ -0,0 +1,81 @@
+package saga
+
+import (
+	"time"
+
+	"github.com/illidaris/aphrodite/component/gormex"
+	"github.com/illidaris/aphrodite/event"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+)
+
+const (
+	DEFAULT_LEASE       = time.Minute
+	DEFAULT_MAX_RETRIES = 0
+)
+
+// UnitOfWorkFunc 创建步骤的本地事务，e不为空时需同时写入发件箱
+type UnitOfWorkFunc func(db string, e *po.MqMessage) dependency.IUnitOfWork
+
+type Option func(*Options)
+
+type Options struct {
+	DataBase   string        // 实例与步骤写操作所在的db
+	Lease      time.Duration // 推进实例时持有锁的时长，每次保存状态都会续租
+	MaxRetries int32         // 补偿失败次数达到该值后置为失败，0表示不限制
+	Repository ISagaRepository
+	UnitOfWork UnitOfWorkFunc
+}
+
+func newOptions(opts ...Option) *Options {
+	o := &Options{
+		Lease:      DEFAULT_LEASE,
+		MaxRetries: DEFAULT_MAX_RETRIES,
+		Repository: &GormRepository{},
+		UnitOfWork: defaultUnitOfWork,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Lease < time.Second {
+		o.Lease = time.Second
+	}
+	return o
+}
+
+func defaultUnitOfWork(db string, e *po.MqMessage) dependency.IUnitOfWork {
+	if e == nil {
+		return gormex.NewUnitOfWork(db)
+	}
+	return event.NewUnitOfWork(db, e)
+}
+
+func WithDataBase(db string) Option {
+	return func(o *Options) {
+		o.DataBase = db
+	}
+}
+
+func WithLease(lease time.Duration) Option {
+	return func(o *Options) {
+		o.Lease = lease
+	}
+}
+
+func WithMaxRetries(retries int32) Option {
+	return func(o *Options) {
+		o.MaxRetries = retries
+	}
+}
+
+func WithRepository(repo ISagaRepository) Option {
+	return func(o *Options) {
+		o.Repository = repo
+	}
+}
+
+func WithUnitOfWork(f UnitOfWorkFunc) Option {
+	return func(o *Options) {
+		o.UnitOfWork = f
+	}
+}
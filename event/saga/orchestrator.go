@@ -0,0 +1,307 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/illidaris/core"
+)
+
+/*
+Orchestrator 事务编排器
+
+	每个步骤的本地写操作、发件箱消息与实例状态在同一个本地事务内提交，
+	因此崩溃后实例状态与业务数据一致，Recover会从记录的步骤继续推进。
+	推进前需持有实例的锁，保存状态时以锁定者为条件，防止多个节点同时推进。
+	异步步骤提交后实例进入等待状态，由消费者收到结果后调用Notify继续推进。
+*/
+type Orchestrator struct {
+	opts *Options
+	mu   sync.RWMutex
+	defs map[string]Definition
+}
+
+func NewOrchestrator(opts ...Option) *Orchestrator {
+	return &Orchestrator{
+		opts: newOptions(opts...),
+		defs: map[string]Definition{},
+	}
+}
+
+// Register 注册事务定义
+func (o *Orchestrator) Register(defs ...Definition) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, d := range defs {
+		if err := d.validate(); err != nil {
+			return fmt.Errorf("%w: %s", err, d.Name)
+		}
+		o.defs[d.Name] = d
+	}
+	return nil
+}
+
+func (o *Orchestrator) definition(name string) (Definition, error) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	d, ok := o.defs[name]
+	if !ok {
+		return d, fmt.Errorf("%w: %s", ErrDefinitionMissing, name)
+	}
+	return d, nil
+}
+
+// Start 创建实例并同步推进，直至结束或进入等待状态
+func (o *Orchestrator) Start(ctx context.Context, name string, bizId uint64, key string, args any) (*po.SagaInstance, error) {
+	if _, err := o.definition(name); err != nil {
+		return nil, err
+	}
+	bs, err := json.Marshal(args)
+	if err != nil {
+		return nil, err
+	}
+	s := &po.SagaInstance{}
+	s.BizId = bizId
+	s.Db = o.opts.DataBase
+	s.Name = name
+	s.Key = key
+	s.Args = string(bs)
+	s.Status = po.SAGA_STATUS_RUNNING
+	s.TraceId = core.TraceID.GetString(ctx)
+	s.Locker = uuid.NewString()
+	s.Expire = time.Now().Add(o.opts.Lease).Unix()
+	s.Timeout = int64(o.opts.Lease.Seconds())
+	if err := o.opts.Repository.Create(ctx, s); err != nil {
+		return nil, err
+	}
+	return s, o.drive(ctx, s)
+}
+
+// Resume 抢占实例的锁并继续推进
+func (o *Orchestrator) Resume(ctx context.Context, id uint64) (*po.SagaInstance, error) {
+	s, err := o.lock(ctx, id)
+	if err != nil {
+		return s, err
+	}
+	return s, o.drive(ctx, s)
+}
+
+// Notify 异步步骤的执行结果，stepErr为空则继续执行下一步，否则从该步骤开始补偿
+func (o *Orchestrator) Notify(ctx context.Context, id uint64, step int32, stepErr error) (*po.SagaInstance, error) {
+	s, err := o.lock(ctx, id)
+	if err != nil {
+		return s, err
+	}
+	if s.Status != po.SAGA_STATUS_WAITING || s.Step != step {
+		_, _ = o.opts.Repository.Unlock(ctx, s.Db, s.Id, s.Locker)
+		return s, ErrNotWaiting
+	}
+	next := *s
+	next.LastExecAt = time.Now().Unix()
+	if stepErr == nil {
+		next.Status = po.SAGA_STATUS_RUNNING
+		next.Step++
+	} else {
+		next.Status = po.SAGA_STATUS_COMPENSATING
+		next.LastError = lastError(stepErr)
+	}
+	if err := o.commit(ctx, s, &next, nil); err != nil {
+		_, _ = o.opts.Repository.Unlock(ctx, s.Db, s.Id, s.Locker)
+		return s, err
+	}
+	return s, o.drive(ctx, s)
+}
+
+// Recover 恢复锁已过期的执行中与补偿中的实例，返回成功推进的数量
+func (o *Orchestrator) Recover(ctx context.Context, batch int) (int, error) {
+	ss, err := o.opts.Repository.FindRecoverable(ctx, o.opts.DataBase, batch)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		count int
+		errs  []error
+	)
+	for _, v := range ss {
+		_, err := o.Resume(ctx, v.Id)
+		if errors.Is(err, ErrLocked) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("saga %d: %w", v.Id, err))
+			continue
+		}
+		count++
+	}
+	return count, errors.Join(errs...)
+}
+
+// Run 定期执行Recover，阻塞直至ctx结束
+func (o *Orchestrator) Run(ctx context.Context, interval time.Duration, batch int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			_, _ = o.Recover(ctx, batch)
+		}
+	}
+}
+
+func (o *Orchestrator) lock(ctx context.Context, id uint64) (*po.SagaInstance, error) {
+	repo := o.opts.Repository
+	locker, affect, err := repo.Lock(ctx, o.opts.DataBase, id, o.opts.Lease)
+	if err != nil {
+		return nil, err
+	}
+	s, err := repo.Get(ctx, o.opts.DataBase, id)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, ErrNotFound
+	}
+	if affect == 0 || s.Locker != locker {
+		return s, ErrLocked
+	}
+	return s, nil
+}
+
+// drive 推进直至结束、进入等待状态或出错，结束后释放锁
+func (o *Orchestrator) drive(ctx context.Context, s *po.SagaInstance) error {
+	defer func() {
+		_, _ = o.opts.Repository.Unlock(context.WithoutCancel(ctx), s.Db, s.Id, s.Locker)
+	}()
+	def, err := o.definition(s.Name)
+	if err != nil {
+		return err
+	}
+	for !s.IsFinished() && s.Status != po.SAGA_STATUS_WAITING {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		switch s.Status {
+		case po.SAGA_STATUS_RUNNING:
+			err = o.forward(ctx, def, s)
+		case po.SAGA_STATUS_COMPENSATING:
+			err = o.backward(ctx, def, s)
+		default:
+			return fmt.Errorf("saga %d unknown status %d", s.Id, s.Status)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forward 执行当前步骤，失败时本地事务已回滚，从上一步开始补偿
+func (o *Orchestrator) forward(ctx context.Context, def Definition, s *po.SagaInstance) error {
+	next := *s
+	next.LastExecAt = time.Now().Unix()
+	if int(s.Step) >= len(def.Steps) {
+		next.Status = po.SAGA_STATUS_DONE
+		return o.commit(ctx, s, &next, nil)
+	}
+	res, err := call(ctx, def.Steps[s.Step].Action, s)
+	if err == nil {
+		if res != nil && res.Async {
+			next.Status = po.SAGA_STATUS_WAITING
+		} else {
+			next.Step++
+		}
+		err = o.commit(ctx, s, &next, res)
+		if err == nil || errors.Is(err, ErrLockLost) {
+			return err
+		}
+	}
+	next = *s
+	next.LastExecAt = time.Now().Unix()
+	next.Status = po.SAGA_STATUS_COMPENSATING
+	next.Step = s.Step - 1
+	next.LastError = lastError(err)
+	return o.commit(ctx, s, &next, nil)
+}
+
+// backward 补偿当前步骤，失败时记录重试次数，超过MaxRetries则置为失败
+func (o *Orchestrator) backward(ctx context.Context, def Definition, s *po.SagaInstance) error {
+	next := *s
+	next.LastExecAt = time.Now().Unix()
+	if s.Step < 0 {
+		next.Status = po.SAGA_STATUS_COMPENSATED
+		return o.commit(ctx, s, &next, nil)
+	}
+	var (
+		res *StepResult
+		err error
+	)
+	if f := def.Steps[s.Step].Compensate; f != nil {
+		res, err = call(ctx, f, s)
+	}
+	if err == nil {
+		next.Step--
+		err = o.commit(ctx, s, &next, res)
+		if err == nil || errors.Is(err, ErrLockLost) {
+			return err
+		}
+	}
+	next = *s
+	next.LastExecAt = time.Now().Unix()
+	next.Retries++
+	next.LastError = lastError(err)
+	if o.opts.MaxRetries > 0 && next.Retries >= o.opts.MaxRetries {
+		next.Status = po.SAGA_STATUS_FAILED
+	}
+	if cerr := o.commit(ctx, s, &next, nil); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// commit 步骤的写操作、发件箱消息与状态在同一个本地事务内提交，成功后更新s
+func (o *Orchestrator) commit(ctx context.Context, s, next *po.SagaInstance, res *StepResult) error {
+	var (
+		actions = []dependency.DbAction{}
+		e       *po.MqMessage
+	)
+	if res != nil {
+		actions = append(actions, res.Actions...)
+		e = res.Event
+	}
+	actions = append(actions, o.opts.Repository.SaveAction(next, o.opts.Lease))
+	if err := o.opts.UnitOfWork(next.Db, e).Execute(ctx, actions...); err != nil {
+		return err
+	}
+	*s = *next
+	return nil
+}
+
+func call(ctx context.Context, f StepFunc, s *po.SagaInstance) (res *StepResult, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrStepPanic, r)
+		}
+	}()
+	cp := *s
+	return f(ctx, &cp)
+}
+
+func lastError(err error) string {
+	if err == nil {
+		return ""
+	}
+	str := err.Error()
+	if len(str) > 255 {
+		str = str[:255]
+	}
+	return str
+}
@@ -0,0 +1,347 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// memRepository in memory ISagaRepository
+type memRepository struct {
+	mu  sync.Mutex
+	seq uint64
+	m   map[uint64]po.SagaInstance
+}
+
+func newMemRepository() *memRepository {
+	return &memRepository{m: map[uint64]po.SagaInstance{}}
+}
+
+func (r *memRepository) Create(ctx context.Context, s *po.SagaInstance) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seq++
+	s.Id = r.seq
+	r.m[s.Id] = *s
+	return nil
+}
+
+func (r *memRepository) Get(ctx context.Context, db string, id uint64) (*po.SagaInstance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.m[id]
+	if !ok {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+func (r *memRepository) Lock(ctx context.Context, db string, id uint64, lease time.Duration) (string, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	locker := uuid.NewString()
+	s, ok := r.m[id]
+	if !ok || s.Expire >= time.Now().Unix() {
+		return locker, 0, nil
+	}
+	s.Locker = locker
+	s.Expire = time.Now().Add(lease).Unix()
+	r.m[id] = s
+	return locker, 1, nil
+}
+
+func (r *memRepository) Unlock(ctx context.Context, db string, id uint64, locker string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, ok := r.m[id]
+	if !ok || s.Locker != locker {
+		return 0, nil
+	}
+	s.Expire = 0
+	r.m[id] = s
+	return 1, nil
+}
+
+func (r *memRepository) SaveAction(s *po.SagaInstance, lease time.Duration) dependency.DbAction {
+	return func(ctx context.Context) error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		old, ok := r.m[s.Id]
+		if !ok || old.Locker != s.Locker {
+			return ErrLockLost
+		}
+		v := *s
+		v.Expire = time.Now().Add(lease).Unix()
+		r.m[s.Id] = v
+		return nil
+	}
+}
+
+func (r *memRepository) FindRecoverable(ctx context.Context, db string, batch int) ([]po.SagaInstance, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := []po.SagaInstance{}
+	for _, s := range r.m {
+		if (s.Status == po.SAGA_STATUS_RUNNING || s.Status == po.SAGA_STATUS_COMPENSATING) &&
+			s.Expire < time.Now().Unix() && len(res) < batch {
+			res = append(res, s)
+		}
+	}
+	return res, nil
+}
+
+func (r *memRepository) set(s po.SagaInstance) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.m[s.Id] = s
+}
+
+// recorder records committed actions and outbox events
+type recorder struct {
+	mu     sync.Mutex
+	logs   []string
+	events []string
+}
+
+func (rec *recorder) unitOfWork(db string, e *po.MqMessage) dependency.IUnitOfWork {
+	return uow{rec: rec, e: e}
+}
+
+func (rec *recorder) log(v string) dependency.DbAction {
+	return func(ctx context.Context) error {
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.logs = append(rec.logs, v)
+		return nil
+	}
+}
+
+type uow struct {
+	rec *recorder
+	e   *po.MqMessage
+}
+
+func (u uow) Execute(ctx context.Context, fs ...dependency.DbAction) error {
+	for _, f := range fs {
+		if err := f(ctx); err != nil {
+			return err
+		}
+	}
+	if u.e != nil {
+		u.rec.mu.Lock()
+		u.rec.events = append(u.rec.events, u.e.Name)
+		u.rec.mu.Unlock()
+	}
+	return nil
+}
+
+func step(rec *recorder, name string, failAction, failCompensate error) Step {
+	return Step{
+		Name: name,
+		Action: func(ctx context.Context, s *po.SagaInstance) (*StepResult, error) {
+			if failAction != nil {
+				return nil, failAction
+			}
+			e := &po.MqMessage{}
+			e.Name = name
+			return &StepResult{Actions: []dependency.DbAction{rec.log("do:" + name)}, Event: e}, nil
+		},
+		Compensate: func(ctx context.Context, s *po.SagaInstance) (*StepResult, error) {
+			if failCompensate != nil {
+				return nil, failCompensate
+			}
+			return &StepResult{Actions: []dependency.DbAction{rec.log("undo:" + name)}}, nil
+		},
+	}
+}
+
+func newTestOrchestrator(repo *memRepository, rec *recorder, opts ...Option) *Orchestrator {
+	return NewOrchestrator(append([]Option{WithRepository(repo), WithUnitOfWork(rec.unitOfWork)}, opts...)...)
+}
+
+func TestOrchestratorRegister(t *testing.T) {
+	convey.Convey("TestOrchestratorRegister", t, func() {
+		o := NewOrchestrator()
+		convey.So(errors.Is(o.Register(Definition{Name: "empty"}), ErrDefinitionInvalid), convey.ShouldBeTrue)
+		convey.So(errors.Is(o.Register(Definition{Name: "nil", Steps: []Step{{Name: "a"}}}), ErrDefinitionInvalid), convey.ShouldBeTrue)
+		_, err := o.Start(context.Background(), "missing", 1, "k", nil)
+		convey.So(errors.Is(err, ErrDefinitionMissing), convey.ShouldBeTrue)
+	})
+}
+
+func TestOrchestratorStart(t *testing.T) {
+	convey.Convey("TestOrchestratorStart", t, func() {
+		ctx := context.Background()
+		repo, rec := newMemRepository(), &recorder{}
+		o := newTestOrchestrator(repo, rec)
+
+		convey.Convey("all steps done", func() {
+			convey.So(o.Register(Definition{Name: "order", Steps: []Step{
+				step(rec, "a", nil, nil),
+				step(rec, "b", nil, nil),
+				step(rec, "c", nil, nil),
+			}}), convey.ShouldBeNil)
+			s, err := o.Start(ctx, "order", 1, "k1", map[string]any{"amount": 1})
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(s.Status, convey.ShouldEqual, po.SAGA_STATUS_DONE)
+			convey.So(s.Step, convey.ShouldEqual, 3)
+			convey.So(s.Args, convey.ShouldEqual, `{"amount":1}`)
+			convey.So(rec.logs, convey.ShouldResemble, []string{"do:a", "do:b", "do:c"})
+			convey.So(rec.events, convey.ShouldResemble, []string{"a", "b", "c"})
+			stored, _ := repo.Get(ctx, "", s.Id)
+			convey.So(stored.Status, convey.ShouldEqual, po.SAGA_STATUS_DONE)
+			convey.So(stored.Expire, convey.ShouldEqual, 0)
+		})
+
+		convey.Convey("compensate in reverse", func() {
+			convey.So(o.Register(Definition{Name: "order", Steps: []Step{
+				step(rec, "a", nil, nil),
+				{Name: "b", Action: step(rec, "b", nil, nil).Action},
+				step(rec, "c", nil, nil),
+				step(rec, "d", errors.New("d failed"), nil),
+			}}), convey.ShouldBeNil)
+			s, err := o.Start(ctx, "order", 1, "k2", nil)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(s.Status, convey.ShouldEqual, po.SAGA_STATUS_COMPENSATED)
+			convey.So(s.Step, convey.ShouldEqual, -1)
+			convey.So(s.LastError, convey.ShouldEqual, "d failed")
+			convey.So(rec.logs, convey.ShouldResemble, []string{"do:a", "do:b", "do:c", "undo:c", "undo:a"})
+		})
+
+		convey.Convey("panic treated as failure", func() {
+			convey.So(o.Register(Definition{Name: "order", Steps: []Step{
+				step(rec, "a", nil, nil),
+				{Name: "b", Action: func(ctx context.Context, s *po.SagaInstance) (*StepResult, error) {
+					panic("boom")
+				}},
+			}}), convey.ShouldBeNil)
+			s, err := o.Start(ctx, "order", 1, "k3", nil)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(s.Status, convey.ShouldEqual, po.SAGA_STATUS_COMPENSATED)
+			convey.So(rec.logs, convey.ShouldResemble, []string{"do:a", "undo:a"})
+		})
+
+		convey.Convey("compensation failed until max retries", func() {
+			o = newTestOrchestrator(repo, rec, WithMaxRetries(2))
+			convey.So(o.Register(Definition{Name: "order", Steps: []Step{
+				step(rec, "a", nil, errors.New("undo failed")),
+				step(rec, "b", errors.New("b failed"), nil),
+			}}), convey.ShouldBeNil)
+			s, err := o.Start(ctx, "order", 1, "k4", nil)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(s.Status, convey.ShouldEqual, po.SAGA_STATUS_COMPENSATING)
+			convey.So(s.Retries, convey.ShouldEqual, 1)
+
+			count, err := o.Recover(ctx, 10)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(count, convey.ShouldEqual, 0)
+			stored, _ := repo.Get(ctx, "", s.Id)
+			convey.So(stored.Status, convey.ShouldEqual, po.SAGA_STATUS_FAILED)
+			convey.So(stored.LastError, convey.ShouldEqual, "undo failed")
+		})
+	})
+}
+
+func TestOrchestratorNotify(t *testing.T) {
+	convey.Convey("TestOrchestratorNotify", t, func() {
+		ctx := context.Background()
+		repo, rec := newMemRepository(), &recorder{}
+		o := newTestOrchestrator(repo, rec)
+		async := step(rec, "b", nil, nil)
+		action := async.Action
+		async.Action = func(ctx context.Context, s *po.SagaInstance) (*StepResult, error) {
+			res, err := action(ctx, s)
+			res.Async = true
+			return res, err
+		}
+		convey.So(o.Register(Definition{Name: "order", Steps: []Step{
+			step(rec, "a", nil, nil),
+			async,
+			step(rec, "c", nil, nil),
+		}}), convey.ShouldBeNil)
+		s, err := o.Start(ctx, "order", 1, "k", nil)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(s.Status, convey.ShouldEqual, po.SAGA_STATUS_WAITING)
+		convey.So(s.Step, convey.ShouldEqual, 1)
+		convey.So(rec.events, convey.ShouldResemble, []string{"a", "b"})
+
+		_, err = o.Notify(ctx, s.Id, 0, nil)
+		convey.So(err, convey.ShouldEqual, ErrNotWaiting)
+		_, err = o.Notify(ctx, 100, 1, nil)
+		convey.So(err, convey.ShouldEqual, ErrNotFound)
+
+		convey.Convey("step succeed", func() {
+			s, err := o.Notify(ctx, s.Id, 1, nil)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(s.Status, convey.ShouldEqual, po.SAGA_STATUS_DONE)
+			convey.So(rec.logs, convey.ShouldResemble, []string{"do:a", "do:b", "do:c"})
+		})
+
+		convey.Convey("step failed", func() {
+			s, err := o.Notify(ctx, s.Id, 1, errors.New("remote failed"))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(s.Status, convey.ShouldEqual, po.SAGA_STATUS_COMPENSATED)
+			convey.So(rec.logs, convey.ShouldResemble, []string{"do:a", "do:b", "undo:b", "undo:a"})
+		})
+	})
+}
+
+func TestOrchestratorRecover(t *testing.T) {
+	convey.Convey("TestOrchestratorRecover", t, func() {
+		ctx := context.Background()
+		repo, rec := newMemRepository(), &recorder{}
+		o := newTestOrchestrator(repo, rec)
+		convey.So(o.Register(Definition{Name: "order", Steps: []Step{
+			step(rec, "a", nil, nil),
+			step(rec, "b", nil, nil),
+		}}), convey.ShouldBeNil)
+
+		// crashed after step a committed
+		s := &po.SagaInstance{}
+		s.Name = "order"
+		s.Status = po.SAGA_STATUS_RUNNING
+		s.Step = 1
+		s.Locker = "crashed"
+		s.Expire = time.Now().Add(time.Hour).Unix()
+		convey.So(repo.Create(ctx, s), convey.ShouldBeNil)
+
+		_, err := o.Resume(ctx, s.Id)
+		convey.So(err, convey.ShouldEqual, ErrLocked)
+		count, err := o.Recover(ctx, 10)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(count, convey.ShouldEqual, 0)
+
+		s.Expire = time.Now().Add(-time.Second).Unix()
+		repo.set(*s)
+		count, err = o.Recover(ctx, 10)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(count, convey.ShouldEqual, 1)
+		stored, _ := repo.Get(ctx, "", s.Id)
+		convey.So(stored.Status, convey.ShouldEqual, po.SAGA_STATUS_DONE)
+		convey.So(rec.logs, convey.ShouldResemble, []string{"do:b"})
+
+		convey.Convey("lock lost during step", func() {
+			o2 := newTestOrchestrator(repo, rec)
+			convey.So(o2.Register(Definition{Name: "steal", Steps: []Step{{
+				Name: "a",
+				Action: func(ctx context.Context, s *po.SagaInstance) (*StepResult, error) {
+					v := *s
+					v.Locker = "other"
+					repo.set(v)
+					return nil, nil
+				},
+			}}}), convey.ShouldBeNil)
+			s, err := o2.Start(ctx, "steal", 1, fmt.Sprint(time.Now().UnixNano()), nil)
+			convey.So(err, convey.ShouldEqual, ErrLockLost)
+			convey.So(s.Step, convey.ShouldEqual, 0)
+		})
+	})
+}
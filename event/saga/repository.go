@@ -0,0 +1,97 @@
+package saga
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/illidaris/aphrodite/component/gormex"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+	"gorm.io/gorm"
+)
+
+var _ = ISagaRepository(&GormRepository{})
+
+// ISagaRepository 事务实例状态存储
+type ISagaRepository interface {
+	// Create 创建实例，实例的Locker与Expire即为创建者持有的锁
+	Create(ctx context.Context, s *po.SagaInstance) error
+	Get(ctx context.Context, db string, id uint64) (*po.SagaInstance, error)
+	// Lock 锁已过期时抢占，返回新的锁定者，影响行数为0表示被他人持有
+	Lock(ctx context.Context, db string, id uint64, lease time.Duration) (string, int64, error)
+	Unlock(ctx context.Context, db string, id uint64, locker string) (int64, error)
+	// SaveAction 以s.Locker为条件保存状态并续租，在步骤的本地事务内执行，锁丢失时返回ErrLockLost
+	SaveAction(s *po.SagaInstance, lease time.Duration) dependency.DbAction
+	// FindRecoverable 执行中或补偿中且锁已过期的实例
+	FindRecoverable(ctx context.Context, db string, batch int) ([]po.SagaInstance, error)
+}
+
+// GormRepository 当前时间均采用数据库时间，保障所有节点计算时间一致
+type GormRepository struct {
+	gormex.BaseRepository[po.SagaInstance]
+}
+
+func (r *GormRepository) Create(ctx context.Context, s *po.SagaInstance) error {
+	_, err := r.BaseCreate(ctx, []*po.SagaInstance{s}, dependency.WithDataBase(s.Db))
+	return err
+}
+
+func (r *GormRepository) Get(ctx context.Context, db string, id uint64) (*po.SagaInstance, error) {
+	return r.BaseGet(ctx, dependency.WithConds("id = ?", id), dependency.WithDataBase(db))
+}
+
+func (r *GormRepository) Lock(ctx context.Context, db string, id uint64, lease time.Duration) (string, int64, error) {
+	locker := uuid.NewString()
+	result := r.BuildFrmOptions(ctx, new(po.SagaInstance),
+		dependency.WithConds("id = ? AND expire < unix_timestamp()", id),
+		dependency.WithDataBase(db),
+	).Updates(map[string]interface{}{
+		"locker": locker,
+		"expire": gorm.Expr("unix_timestamp() + ?", int64(lease.Seconds())),
+	})
+	return locker, result.RowsAffected, result.Error
+}
+
+func (r *GormRepository) Unlock(ctx context.Context, db string, id uint64, locker string) (int64, error) {
+	result := r.BuildFrmOptions(ctx, new(po.SagaInstance),
+		dependency.WithConds("id = ? AND locker = ?", id, locker),
+		dependency.WithDataBase(db),
+	).Updates(map[string]interface{}{
+		"expire": 0,
+	})
+	return result.RowsAffected, result.Error
+}
+
+func (r *GormRepository) SaveAction(s *po.SagaInstance, lease time.Duration) dependency.DbAction {
+	return func(ctx context.Context) error {
+		result := r.BuildFrmOptions(ctx, new(po.SagaInstance),
+			dependency.WithConds("id = ? AND locker = ?", s.Id, s.Locker),
+			dependency.WithDataBase(s.Db),
+		).Updates(map[string]interface{}{
+			"status":     s.Status,
+			"step":       s.Step,
+			"retries":    s.Retries,
+			"lastError":  s.LastError,
+			"lastExecAt": s.LastExecAt,
+			"expire":     gorm.Expr("unix_timestamp() + ?", int64(lease.Seconds())),
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrLockLost
+		}
+		return nil
+	}
+}
+
+func (r *GormRepository) FindRecoverable(ctx context.Context, db string, batch int) ([]po.SagaInstance, error) {
+	return r.BaseQuery(ctx,
+		dependency.WithConds("status IN ? AND expire < unix_timestamp()",
+			[]int32{po.SAGA_STATUS_RUNNING, po.SAGA_STATUS_COMPENSATING}),
+		dependency.WithPage(&dto.Page{PageIndex: 1, PageSize: int64(batch), Sorts: []string{"updateAt|asc"}}),
+		dependency.WithDataBase(db),
+	)
+}
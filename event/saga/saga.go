@@ -0,0 +1,55 @@
+package saga
+
+import (
+	"context"
+	"errors"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+)
+
+var (
+	ErrLockLost          = errors.New("saga lock is lost")
+	ErrLocked            = errors.New("saga is locked by others")
+	ErrNotFound          = errors.New("saga not found")
+	ErrNotWaiting        = errors.New("saga is not waiting for the step")
+	ErrDefinitionInvalid = errors.New("saga definition is invalid")
+	ErrDefinitionMissing = errors.New("saga definition is not registered")
+	ErrStepPanic         = errors.New("saga step panic")
+)
+
+// StepFunc 步骤的执行或补偿，返回需要在同一个本地事务内完成的写操作与发件箱消息
+// 事务外的副作用（如调用远程服务）必须幂等，崩溃恢复后步骤可能被再次执行
+type StepFunc func(ctx context.Context, s *po.SagaInstance) (*StepResult, error)
+
+// StepResult 步骤结果，Actions、Event与状态保存共用同一个EventTransactionImpl
+type StepResult struct {
+	Actions []dependency.DbAction // 本地写操作
+	Event   *po.MqMessage         // 发件箱消息，为空则仅使用本地事务
+	Async   bool                  // 异步步骤，提交后等待Notify推进，仅对Action有效
+}
+
+// Step 步骤，Compensate为空表示无需补偿
+type Step struct {
+	Name       string
+	Action     StepFunc
+	Compensate StepFunc
+}
+
+// Definition 事务定义，步骤按顺序执行，失败时按逆序补偿已完成的步骤
+type Definition struct {
+	Name  string
+	Steps []Step
+}
+
+func (d Definition) validate() error {
+	if d.Name == "" || len(d.Steps) == 0 {
+		return ErrDefinitionInvalid
+	}
+	for _, s := range d.Steps {
+		if s.Action == nil {
+			return ErrDefinitionInvalid
+		}
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package ginhandle
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/ginhandle/validate"
+	"github.com/illidaris/aphrodite/pkg/exception"
+)
+
+// bindRequest 先映射路径参数再绑定请求并校验，使binding规则能同时覆盖路径参数；
+// 绑定后再次映射路径参数，请求体与query不能覆盖路径中的值，随后按最终值重新校验；
+// 请求实现validate.IValidator时继续执行自定义校验，失败返回异常与字段错误
+func bindRequest(c *gin.Context, request any) (exception.Exception, []dto.FieldError) {
+	validate.Engine()
+	params := make(map[string][]string, len(c.Params))
+	for _, p := range c.Params {
+		params[p.Key] = []string{p.Value}
+	}
+	if len(params) > 0 {
+		if err := binding.MapFormWithTag(request, params, "uri"); err != nil {
+			return exception.ERR_COMMON_BADPARAM.Wrap(err), nil
+		}
+	}
+	if err := c.ShouldBind(request); err != nil {
+		return bindError(c, err)
+	}
+	if len(params) > 0 {
+		if err := binding.MapFormWithTag(request, params, "uri"); err != nil {
+			return exception.ERR_COMMON_BADPARAM.Wrap(err), nil
+		}
+		if err := binding.Validator.ValidateStruct(request); err != nil {
+			return bindError(c, err)
+		}
+	}
+	if v, ok := request.(validate.IValidator); ok {
+		if errs := v.Validate(c.Request.Context()); len(errs) > 0 {
+			return fieldErrorException(errs), errs
+		}
+	}
+	return nil, nil
+}
+
+func bindError(c *gin.Context, err error) (exception.Exception, []dto.FieldError) {
+	errs, ok := validate.FieldErrors(err, validate.Lang(c.GetHeader("Accept-Language")))
+	if !ok || len(errs) == 0 {
+		return exception.ERR_COMMON_BADPARAM.Wrap(err), nil
+	}
+	return fieldErrorException(errs), errs
+}
+
+// fieldErrorException 首个字段错误作为异常信息，便于只展示message的客户端
+func fieldErrorException(errs []dto.FieldError) exception.Exception {
+	return exception.ERR_COMMON_BADPARAM.New(errs[0].Message)
+}
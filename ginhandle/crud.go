@@ -9,53 +9,192 @@ import (
 	"github.com/illidaris/aphrodite/dto"
 	"github.com/illidaris/aphrodite/pkg/dependency"
 	"github.com/illidaris/aphrodite/pkg/exception"
-	"github.com/jinzhu/copier"
 )
 
+// RepoFactory 按请求上下文构造仓储，gorm、mongo、es等实现均可
+type RepoFactory[T dependency.IEntity] func(ctx context.Context) dependency.IRepository[T]
+
+// GormRepo 默认gorm仓储
+func GormRepo[T dependency.IEntity]() RepoFactory[T] {
+	return func(ctx context.Context) dependency.IRepository[T] {
+		return &gormex.BaseRepository[T]{}
+	}
+}
+
 func ListHandler[Req dependency.ICondPage, T dependency.IEntity](opts ...crud.Option) func(c *gin.Context) {
+	return ListHandlerFrom(GormRepo[T](), WithCrudOptions[Req, T](opts...))
+}
+
+func CreateManyHandler[Req any, T dependency.IEntity](f func(Req) []*T, opts ...crud.Option) func(c *gin.Context) {
+	return CreateManyHandlerFrom(GormRepo[T](), f, WithCrudOptions[Req, T](opts...))
+}
+
+// CreateHandler 请求按同名字段复制为实体，见WithCopyMapping
+func CreateHandler[Req any, T dependency.IEntity](opts ...crud.Option) func(c *gin.Context) {
+	return CreateHandlerFrom(GormRepo[T](), WithCopyMapping[Req, T](), WithCrudOptions[Req, T](opts...))
+}
+
+// UpdateHandler 请求按同名字段复制为实体，见WithCopyMapping
+func UpdateHandler[Req dependency.ICond, T dependency.IEntity](opts ...crud.Option) func(c *gin.Context) {
+	return UpdateHandlerFrom(GormRepo[T](), WithCopyMapping[Req, T](), WithCrudOptions[Req, T](opts...))
+}
+
+func DeleteHandler[Req dependency.ICond, T dependency.IEntity](opts ...crud.Option) func(c *gin.Context) {
+	return DeleteHandlerFrom(GormRepo[T](), WithCrudOptions[Req, T](opts...))
+}
+
+func DetailHandler[Req dependency.ICond, T dependency.IEntity](opts ...crud.Option) func(c *gin.Context) {
+	return DetailHandlerFrom(GormRepo[T](), WithCrudOptions[Req, T](opts...))
+}
+
+// ListHandlerFrom 分页列表
+func ListHandlerFrom[Req dependency.ICondPage, T dependency.IEntity](factory RepoFactory[T], opts ...HandlerOption[Req, T]) func(c *gin.Context) {
+	o := newHandlerOptions(opts...)
 	return GinOneHandler(func(ctx context.Context, r *Req) (*dto.RecordPtrPager[T], exception.Exception) {
-		repo := &gormex.BaseRepository[T]{}
-		return crud.PageListFunc(repo, opts...)(ctx, *r)
+		d, ex := o.authorize(ctx, r)
+		if ex != nil {
+			return nil, ex
+		}
+		repo := factory(ctx)
+		copts, ex := o.crudOptions(d, repo)
+		if ex != nil {
+			return nil, ex
+		}
+		result, ex := crud.PageListFunc(repo, copts...)(ctx, *r)
+		if ex != nil {
+			return result, ex
+		}
+		for _, t := range result.Data {
+			o.mask(ctx, t)
+		}
+		return result, nil
 	})
 }
 
-func CreateManyHandler[Req any, T dependency.IEntity](f func(Req) []*T, opts ...crud.Option) func(c *gin.Context) {
-	return GinOneHandler(func(ctx context.Context, r *Req) (int64, exception.Exception) {
-		repo := &gormex.BaseRepository[T]{}
-		return crud.Create(repo, nil, opts...)(ctx, f(*r))
+// DetailHandlerFrom 详情，条件由请求的GetConds提供
+func DetailHandlerFrom[Req dependency.ICond, T dependency.IEntity](factory RepoFactory[T], opts ...HandlerOption[Req, T]) func(c *gin.Context) {
+	o := newHandlerOptions(opts...)
+	return GinOneHandler(func(ctx context.Context, r *Req) (*T, exception.Exception) {
+		d, ex := o.authorize(ctx, r)
+		if ex != nil {
+			return nil, ex
+		}
+		repo := factory(ctx)
+		copts, ex := o.crudOptions(d, repo)
+		if ex != nil {
+			return nil, ex
+		}
+		t, ex := crud.DetailFunc(repo, copts...)(ctx, *r)
+		if ex != nil {
+			return t, ex
+		}
+		o.mask(ctx, t)
+		return t, nil
 	})
 }
 
-func CreateHandler[Req any, T dependency.IEntity](opts ...crud.Option) func(c *gin.Context) {
+// CreateHandlerFrom 创建，请求通过Mapping转换为实体
+func CreateHandlerFrom[Req any, T dependency.IEntity](factory RepoFactory[T], opts ...HandlerOption[Req, T]) func(c *gin.Context) {
+	o := newHandlerOptions(opts...)
 	return GinOneHandler(func(ctx context.Context, r *Req) (int64, exception.Exception) {
-		repo := &gormex.BaseRepository[T]{}
-		t := new(T)
-		_ = copier.Copy(t, r)
-		return crud.Create(repo, nil, opts...)(ctx, []*T{t})
+		d, ex := o.authorize(ctx, r)
+		if ex != nil {
+			return 0, ex
+		}
+		t, ex := o.mapping(ctx, r)
+		if ex != nil {
+			return 0, ex
+		}
+		if ex := permit(d, t); ex != nil {
+			return 0, ex
+		}
+		return crud.Create(factory(ctx), nil, o.CrudOptions...)(ctx, []*T{t})
 	})
 }
 
-func UpdateHandler[Req dependency.ICond, T dependency.IEntity](opts ...crud.Option) func(c *gin.Context) {
+// CreateManyHandlerFrom 一个请求转换为多个实体创建，每个实体分别校验策略条件
+func CreateManyHandlerFrom[Req any, T dependency.IEntity](factory RepoFactory[T], f func(Req) []*T, opts ...HandlerOption[Req, T]) func(c *gin.Context) {
+	o := newHandlerOptions(opts...)
 	return GinOneHandler(func(ctx context.Context, r *Req) (int64, exception.Exception) {
-		repo := &gormex.BaseRepository[T]{}
-		t := new(T)
-		_ = copier.Copy(t, r)
-		return crud.Update(repo, nil, opts...)(ctx, t, (*r).GetConds()...)
+		d, ex := o.authorize(ctx, r)
+		if ex != nil {
+			return 0, ex
+		}
+		ts := f(*r)
+		for _, t := range ts {
+			if ex := permit(d, t); ex != nil {
+				return 0, ex
+			}
+		}
+		return crud.Create(factory(ctx), nil, o.CrudOptions...)(ctx, ts)
 	})
 }
 
-func DeleteHandler[Req dependency.ICond, T dependency.IEntity](opts ...crud.Option) func(c *gin.Context) {
+// BatchRequest 批量创建请求
+type BatchRequest[Req any] struct {
+	Items []*Req `json:"items" form:"items" binding:"required,min=1"`
+}
+
+// CreateBatchHandlerFrom 批量创建，每一项分别鉴权与转换
+func CreateBatchHandlerFrom[Req any, T dependency.IEntity](factory RepoFactory[T], opts ...HandlerOption[Req, T]) func(c *gin.Context) {
+	o := newHandlerOptions(opts...)
+	return GinOneHandler(func(ctx context.Context, r *BatchRequest[Req]) (int64, exception.Exception) {
+		ts := make([]*T, 0, len(r.Items))
+		for _, item := range r.Items {
+			d, ex := o.authorize(ctx, item)
+			if ex != nil {
+				return 0, ex
+			}
+			t, ex := o.mapping(ctx, item)
+			if ex != nil {
+				return 0, ex
+			}
+			if ex := permit(d, t); ex != nil {
+				return 0, ex
+			}
+			ts = append(ts, t)
+		}
+		return crud.Create(factory(ctx), nil, o.CrudOptions...)(ctx, ts)
+	})
+}
+
+// UpdateHandlerFrom 更新，条件由请求的GetConds提供
+func UpdateHandlerFrom[Req dependency.ICond, T dependency.IEntity](factory RepoFactory[T], opts ...HandlerOption[Req, T]) func(c *gin.Context) {
+	o := newHandlerOptions(opts...)
 	return GinOneHandler(func(ctx context.Context, r *Req) (int64, exception.Exception) {
-		repo := &gormex.BaseRepository[T]{}
-		t := new(T)
-		_ = copier.Copy(t, r)
-		return crud.Delete(repo, opts...)(ctx, r, (*r).GetConds()...)
+		d, ex := o.authorize(ctx, r)
+		if ex != nil {
+			return 0, ex
+		}
+		t, ex := o.mapping(ctx, r)
+		if ex != nil {
+			return 0, ex
+		}
+		if ex := permitChanges(d, t); ex != nil {
+			return 0, ex
+		}
+		repo := factory(ctx)
+		copts, ex := o.crudOptions(d, repo)
+		if ex != nil {
+			return 0, ex
+		}
+		return crud.Update(repo, nil, copts...)(ctx, t, (*r).GetConds()...)
 	})
 }
 
-func DetailHandler[Req dependency.ICond, T dependency.IEntity](opts ...crud.Option) func(c *gin.Context) {
-	return GinOneHandler(func(ctx context.Context, r *Req) (*T, exception.Exception) {
-		repo := &gormex.BaseRepository[T]{}
-		return crud.DetailFunc(repo, opts...)(ctx, *r)
+// DeleteHandlerFrom 删除，条件由请求的GetConds提供
+func DeleteHandlerFrom[Req dependency.ICond, T dependency.IEntity](factory RepoFactory[T], opts ...HandlerOption[Req, T]) func(c *gin.Context) {
+	o := newHandlerOptions(opts...)
+	return GinOneHandler(func(ctx context.Context, r *Req) (int64, exception.Exception) {
+		d, ex := o.authorize(ctx, r)
+		if ex != nil {
+			return 0, ex
+		}
+		repo := factory(ctx)
+		copts, ex := o.crudOptions(d, repo)
+		if ex != nil {
+			return 0, ex
+		}
+		return crud.Delete(repo, copts...)(ctx, r, (*r).GetConds()...)
 	})
 }
@@ -0,0 +1,144 @@
+package ginhandle
+
+import (
+	"context"
+
+	"github.com/illidaris/aphrodite/biz/authz"
+	"github.com/illidaris/aphrodite/biz/crud"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/pkg/exception"
+	"github.com/jinzhu/copier"
+)
+
+type HandlerOption[Req any, T dependency.IEntity] func(*HandlerOptions[Req, T])
+
+// HandlerOptions 单个路由的钩子
+type HandlerOptions[Req any, T dependency.IEntity] struct {
+	Authorize   func(ctx context.Context, req *Req) exception.Exception          // 鉴权，返回异常则中止
+	Mapping     func(ctx context.Context, req *Req) (*T, exception.Exception)    // 请求转换为实体，Req与T不同时必须设置
+	Mask        func(ctx context.Context, t *T)                                  // 输出前脱敏
+	Policy      func(ctx context.Context) (*authz.Decision, exception.Exception) // 策略判定，为空时取AuthzMiddleware的判定
+	CrudOptions []crud.Option
+}
+
+func newHandlerOptions[Req any, T dependency.IEntity](opts ...HandlerOption[Req, T]) *HandlerOptions[Req, T] {
+	o := &HandlerOptions[Req, T]{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// authorize 执行鉴权钩子与策略判定，返回的判定可能为空
+func (o *HandlerOptions[Req, T]) authorize(ctx context.Context, req *Req) (*authz.Decision, exception.Exception) {
+	if o.Authorize != nil {
+		if ex := o.Authorize(ctx, req); ex != nil {
+			return nil, ex
+		}
+	}
+	if o.Policy != nil {
+		return o.Policy(ctx)
+	}
+	d, _ := authz.DecisionFromContext(ctx)
+	return d, nil
+}
+
+// crudOptions 带条件的判定注入行级过滤，仓储不支持字符串条件时拒绝，避免条件被忽略后放开全部数据
+func (o *HandlerOptions[Req, T]) crudOptions(d *authz.Decision, repo any) ([]crud.Option, exception.Exception) {
+	if d == nil || d.Unconditional() {
+		return o.CrudOptions, nil
+	}
+	if s, ok := repo.(dependency.ISQLConds); !ok || !s.SQLConds() {
+		return nil, exception.ERR_COMMON_NOPERMISSION.New("仓储不支持行级过滤")
+	}
+	return append(append([]crud.Option{}, o.CrudOptions...), crud.WithRepoOptins(dependency.WithAndConds(d.Conds()...))), nil
+}
+
+// permit 判定实体是否满足策略条件
+func permit[T any](d *authz.Decision, t *T) exception.Exception {
+	if d == nil || d.Match(t) {
+		return nil
+	}
+	return exception.ERR_COMMON_NOPERMISSION.New("没有权限")
+}
+
+// permitChanges 判定更新的新值是否满足策略条件，避免将数据转移给其他所有者
+func permitChanges[T any](d *authz.Decision, t *T) exception.Exception {
+	if d == nil || d.MatchChanges(t) {
+		return nil
+	}
+	return exception.ERR_COMMON_NOPERMISSION.New("没有权限")
+}
+
+func (o *HandlerOptions[Req, T]) mapping(ctx context.Context, req *Req) (*T, exception.Exception) {
+	if o.Mapping != nil {
+		return o.Mapping(ctx, req)
+	}
+	if t, ok := any(req).(*T); ok {
+		return t, nil
+	}
+	// 不隐式复制，避免请求写入不允许修改的字段
+	return nil, exception.ERR_COMMON.New("未设置Mapping，见WithMapping与WithCopyMapping")
+}
+
+func (o *HandlerOptions[Req, T]) mask(ctx context.Context, t *T) {
+	if o.Mask == nil || t == nil {
+		return
+	}
+	o.Mask(ctx, t)
+}
+
+func WithAuthorize[Req any, T dependency.IEntity](f func(ctx context.Context, req *Req) exception.Exception) HandlerOption[Req, T] {
+	return func(o *HandlerOptions[Req, T]) {
+		o.Authorize = f
+	}
+}
+
+func WithMapping[Req any, T dependency.IEntity](f func(ctx context.Context, req *Req) (*T, exception.Exception)) HandlerOption[Req, T] {
+	return func(o *HandlerOptions[Req, T]) {
+		o.Mapping = f
+	}
+}
+
+/*
+WithCopyMapping 按同名字段将请求复制为实体，请求中的所有字段都会写入实体，
+Req只能包含调用方允许设置的字段，否则使用WithMapping逐个赋值。
+*/
+func WithCopyMapping[Req any, T dependency.IEntity]() HandlerOption[Req, T] {
+	return WithMapping(func(ctx context.Context, req *Req) (*T, exception.Exception) {
+		t := new(T)
+		if err := copier.Copy(t, req); err != nil {
+			return nil, exception.ERR_COMMON_BADPARAM.Wrap(err)
+		}
+		return t, nil
+	})
+}
+
+func WithMask[Req any, T dependency.IEntity](f func(ctx context.Context, t *T)) HandlerOption[Req, T] {
+	return func(o *HandlerOptions[Req, T]) {
+		o.Mask = f
+	}
+}
+
+// WithPolicy 按策略鉴权，带条件的策略在列表、详情、更新、删除时注入行级过滤，在创建时校验实体
+func WithPolicy[Req any, T dependency.IEntity](e *authz.Enforcer, resource, action string) HandlerOption[Req, T] {
+	return func(o *HandlerOptions[Req, T]) {
+		o.Policy = func(ctx context.Context) (*authz.Decision, exception.Exception) {
+			sub, ok := authz.FromContext(ctx)
+			if !ok {
+				return nil, exception.ERR_COMMON_UNAUTH.New("未登录")
+			}
+			d := e.Enforce(sub, resource, action)
+			if !d.Allowed {
+				return nil, exception.ERR_COMMON_NOPERMISSION.New("没有权限")
+			}
+			return d, nil
+		}
+	}
+}
+
+func WithCrudOptions[Req any, T dependency.IEntity](opts ...crud.Option) HandlerOption[Req, T] {
+	return func(o *HandlerOptions[Req, T]) {
+		o.CrudOptions = append(o.CrudOptions, opts...)
+	}
+}
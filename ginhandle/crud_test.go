@@ -0,0 +1,337 @@
+package ginhandle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/biz/authz"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/pkg/exception"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type book struct {
+	dependency.EmptyPo
+	Id     int64  `json:"id"`
+	Title  string `json:"title"`
+	Secret string `json:"secret"`
+}
+
+func (b book) ID() any { return b.Id }
+
+type bookCond struct{}
+
+func (bookCond) GetDbShardingKeys() []any { return nil }
+func (bookCond) GetTbShardingKeys() []any { return nil }
+
+type bookListReq struct {
+	dto.Page
+	bookCond
+}
+
+func (bookListReq) GetConds() []any { return nil }
+
+type bookKeyReq struct {
+	bookCond
+	Id int64 `uri:"id" json:"-" form:"-"`
+}
+
+func (r bookKeyReq) GetConds() []any { return []any{"id", r.Id} }
+
+type bookCreateReq struct {
+	Title string `json:"title" binding:"required"`
+}
+
+type bookUpdateReq struct {
+	bookKeyReq
+	Title string `json:"title"`
+}
+
+// memRepo 内存仓储，仅支持按id条件
+type memRepo struct {
+	mu    sync.Mutex
+	seq   int64
+	books map[int64]*book
+}
+
+var _ = dependency.IRepository[book](&memRepo{})
+
+func (r *memRepo) match(opts []dependency.BaseOptionFunc) []*book {
+	opt := dependency.NewBaseOption(opts...)
+	res := []*book{}
+	for id := int64(1); id <= r.seq; id++ {
+		b, ok := r.books[id]
+		if !ok {
+			continue
+		}
+		if len(opt.Conds) == 2 && opt.Conds[1] != b.Id {
+			continue
+		}
+		res = append(res, b)
+	}
+	return res
+}
+
+func (r *memRepo) BaseCreate(ctx context.Context, ps []*book, opts ...dependency.BaseOptionFunc) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, p := range ps {
+		r.seq++
+		p.Id = r.seq
+		r.books[p.Id] = p
+	}
+	return int64(len(ps)), nil
+}
+
+func (r *memRepo) BaseSave(ctx context.Context, ps []*book, opts ...dependency.BaseOptionFunc) (int64, error) {
+	return r.BaseCreate(ctx, ps, opts...)
+}
+
+func (r *memRepo) BaseUpdate(ctx context.Context, p *book, opts ...dependency.BaseOptionFunc) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bs := r.match(opts)
+	for _, b := range bs {
+		b.Title = p.Title
+	}
+	return int64(len(bs)), nil
+}
+
+func (r *memRepo) BaseGet(ctx context.Context, opts ...dependency.BaseOptionFunc) (*book, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if bs := r.match(opts); len(bs) > 0 {
+		b := *bs[0]
+		return &b, nil
+	}
+	return nil, nil
+}
+
+func (r *memRepo) BaseDelete(ctx context.Context, p *book, opts ...dependency.BaseOptionFunc) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bs := r.match(opts)
+	for _, b := range bs {
+		delete(r.books, b.Id)
+	}
+	return int64(len(bs)), nil
+}
+
+func (r *memRepo) BaseCount(ctx context.Context, opts ...dependency.BaseOptionFunc) (int64, error) {
+	_, total, err := r.BaseQueryWithCount(ctx, opts...)
+	return total, err
+}
+
+func (r *memRepo) BaseQuery(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]book, error) {
+	ps, _, err := r.BaseQueryWithCount(ctx, opts...)
+	return ps, err
+}
+
+func (r *memRepo) BaseQueryWithCount(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]book, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := []book{}
+	for _, b := range r.match(opts) {
+		res = append(res, *b)
+	}
+	return res, int64(len(res)), nil
+}
+
+func TestResource(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := &memRepo{books: map[int64]*book{}}
+	mask := WithMask[bookKeyReq](func(ctx context.Context, b *book) { b.Secret = "***" })
+	resource := &Resource[book, bookListReq, bookKeyReq, bookCreateReq, bookUpdateReq]{
+		Factory: func(ctx context.Context) dependency.IRepository[book] { return repo },
+		List: []HandlerOption[bookListReq, book]{
+			WithMask[bookListReq](func(ctx context.Context, b *book) { b.Secret = "***" }),
+		},
+		Detail: []HandlerOption[bookKeyReq, book]{mask},
+		Create: []HandlerOption[bookCreateReq, book]{
+			WithAuthorize[bookCreateReq, book](func(ctx context.Context, req *bookCreateReq) exception.Exception {
+				if req.Title == "forbidden" {
+					return exception.ERR_COMMON_NOPERMISSION.New("forbidden")
+				}
+				return nil
+			}),
+			WithMapping(func(ctx context.Context, req *bookCreateReq) (*book, exception.Exception) {
+				return &book{Title: req.Title, Secret: "s-" + req.Title}, nil
+			}),
+		},
+		Update:  []HandlerOption[bookUpdateReq, book]{WithCopyMapping[bookUpdateReq, book]()},
+		Exclude: []string{ROUTE_DELETE},
+	}
+	r := gin.New()
+	resource.Register(r, "/books")
+
+	do := func(method, path, body string) *dto.Response {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		resp := &dto.Response{}
+		_ = json.Unmarshal(w.Body.Bytes(), resp)
+		return resp
+	}
+	convey.Convey("TestResource", t, func() {
+		resp := do(http.MethodPost, "/books", `{"title":"a"}`)
+		convey.So(resp.Code, convey.ShouldEqual, 0)
+		resp = do(http.MethodPost, "/books/batch", `{"items":[{"title":"b"},{"title":"c"}]}`)
+		convey.So(resp.Code, convey.ShouldEqual, 0)
+		convey.So(resp.Data, convey.ShouldEqual, 2)
+		resp = do(http.MethodPost, "/books/batch", `{"items":[{"title":"d"},{"title":"forbidden"}]}`)
+		convey.So(resp.Code, convey.ShouldEqual, exception.ERR_COMMON_NOPERMISSION)
+		resp = do(http.MethodPost, "/books", `{}`)
+		convey.So(resp.Code, convey.ShouldEqual, exception.ERR_COMMON_BADPARAM)
+		convey.So(len(repo.books), convey.ShouldEqual, 3)
+		convey.So(repo.books[1].Secret, convey.ShouldEqual, "s-a")
+
+		resp = do(http.MethodPut, "/books/2", `{"title":"b2"}`)
+		convey.So(resp.Code, convey.ShouldEqual, 0)
+		convey.So(repo.books[2].Title, convey.ShouldEqual, "b2")
+
+		resp = do(http.MethodGet, "/books/2", "")
+		convey.So(resp.Code, convey.ShouldEqual, 0)
+		detail := resp.Data.(map[string]any)
+		convey.So(detail["title"], convey.ShouldEqual, "b2")
+		convey.So(detail["secret"], convey.ShouldEqual, "***")
+		convey.So(repo.books[2].Secret, convey.ShouldEqual, "s-b")
+
+		resp = do(http.MethodGet, "/books?page=1&pageSize=10", "")
+		convey.So(resp.Code, convey.ShouldEqual, 0)
+		list := resp.Data.(map[string]any)
+		convey.So(list["total"], convey.ShouldEqual, 3)
+		convey.So(list["data"].([]any)[0].(map[string]any)["secret"], convey.ShouldEqual, "***")
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/books/1", nil))
+		convey.So(w.Code, convey.ShouldEqual, http.StatusNotFound)
+	})
+}
+
+// condsRepo 记录查询条件
+type condsRepo struct {
+	*memRepo
+	conds []any
+}
+
+func (r *condsRepo) BaseQueryWithCount(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]book, int64, error) {
+	r.conds = dependency.NewBaseOption(opts...).Conds
+	return r.memRepo.BaseQueryWithCount(ctx, opts...)
+}
+
+func (r *condsRepo) SQLConds() bool { return true }
+
+func TestResourcePolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e, err := authz.NewEnforcer(context.Background(), authz.StaticLoader(authz.Rules{
+		Roles: []authz.RoleInherit{{Role: "writer", Parents: []string{"reader"}}},
+		Policies: []authz.Policy{
+			{Subject: "reader", Resource: "/books", Action: authz.ACTION_READ},
+			{Subject: "writer", Resource: "/books", Action: "*", Conditions: []string{"own_title"}},
+		},
+	}), authz.WithCondition("own_title", authz.Owner("title")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &condsRepo{memRepo: &memRepo{books: map[int64]*book{}}}
+	var current dependency.IRepository[book] = repo
+	router := func(e *authz.Enforcer) *gin.Engine {
+		resource := &Resource[book, bookListReq, bookKeyReq, bookCreateReq, bookUpdateReq]{
+			Factory:  func(ctx context.Context) dependency.IRepository[book] { return current },
+			Create:   []HandlerOption[bookCreateReq, book]{WithCopyMapping[bookCreateReq, book]()},
+			Update:   []HandlerOption[bookUpdateReq, book]{WithCopyMapping[bookUpdateReq, book]()},
+			Enforcer: e,
+		}
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			if user := c.GetHeader("X-User"); user != "" {
+				sub := &authz.Subject{ID: user, Roles: []string{c.GetHeader("X-Role")}}
+				c.Request = c.Request.WithContext(authz.NewContext(c.Request.Context(), sub))
+			}
+		})
+		resource.Register(r, "/books")
+		return r
+	}
+	r := router(e)
+	do := func(method, path, body, user, role string) *dto.Response {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("X-User", user)
+		req.Header.Set("X-Role", role)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		resp := &dto.Response{}
+		_ = json.Unmarshal(w.Body.Bytes(), resp)
+		return resp
+	}
+	convey.Convey("TestResourcePolicy", t, func() {
+		convey.So(do(http.MethodGet, "/books?page=1&pageSize=10", "", "", "").Code, convey.ShouldEqual, exception.ERR_COMMON_UNAUTH)
+		convey.So(do(http.MethodPost, "/books", `{"title":"alice"}`, "alice", "writer").Code, convey.ShouldEqual, 0)
+		convey.So(do(http.MethodPost, "/books", `{"title":"bob"}`, "alice", "writer").Code, convey.ShouldEqual, exception.ERR_COMMON_NOPERMISSION)
+		convey.So(do(http.MethodPost, "/books", `{"title":"carol"}`, "carol", "reader").Code, convey.ShouldEqual, exception.ERR_COMMON_NOPERMISSION)
+		convey.So(do(http.MethodDelete, "/books/1", "", "carol", "reader").Code, convey.ShouldEqual, exception.ERR_COMMON_NOPERMISSION)
+
+		// reader无条件读取，writer继承reader
+		convey.So(do(http.MethodGet, "/books?page=1&pageSize=10", "", "alice", "writer").Code, convey.ShouldEqual, 0)
+		convey.So(repo.conds, convey.ShouldBeNil)
+
+		// 仅有条件授权时注入行级过滤
+		e2, _ := authz.NewEnforcer(context.Background(), authz.StaticLoader(authz.Rules{Policies: []authz.Policy{
+			{Subject: "writer", Resource: "/books", Action: "*", Conditions: []string{"own_title"}},
+		}}), authz.WithCondition("own_title", authz.Owner("title")))
+		r = router(e2)
+		convey.So(do(http.MethodGet, "/books?page=1&pageSize=10", "", "alice", "writer").Code, convey.ShouldEqual, 0)
+		convey.So(repo.conds, convey.ShouldResemble, []any{"(`title` = ?)", "alice"})
+
+		// 更新的新值同样需满足条件
+		convey.So(do(http.MethodPut, "/books/1", `{"title":"bob"}`, "alice", "writer").Code, convey.ShouldEqual, exception.ERR_COMMON_NOPERMISSION)
+		convey.So(do(http.MethodPut, "/books/1", `{"title":"alice"}`, "alice", "writer").Code, convey.ShouldEqual, 0)
+
+		// 仓储不支持字符串条件时拒绝，避免过滤被忽略
+		current = repo.memRepo
+		convey.So(do(http.MethodGet, "/books?page=1&pageSize=10", "", "alice", "writer").Code, convey.ShouldEqual, exception.ERR_COMMON_NOPERMISSION)
+		convey.So(do(http.MethodGet, "/books/1", "", "alice", "writer").Code, convey.ShouldEqual, exception.ERR_COMMON_NOPERMISSION)
+	})
+}
+
+func TestCreateHandlerFrom(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	repo := &memRepo{books: map[int64]*book{}}
+	factory := func(ctx context.Context) dependency.IRepository[book] { return repo }
+	r := gin.New()
+	r.POST("/implicit", CreateHandlerFrom[bookCreateReq](factory))
+	r.POST("/many", CreateManyHandlerFrom(factory, func(req bookCreateReq) []*book {
+		return []*book{{Title: req.Title}, {Title: req.Title + "2"}}
+	}))
+	do := func(path, body string) *dto.Response {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		resp := &dto.Response{}
+		_ = json.Unmarshal(w.Body.Bytes(), resp)
+		return resp
+	}
+	convey.Convey("TestCreateHandlerFrom", t, func() {
+		// 请求与实体不同且未设置Mapping时不隐式复制
+		convey.So(do("/implicit", `{"title":"a"}`).Code, convey.ShouldEqual, exception.ERR_COMMON)
+		convey.So(repo.books, convey.ShouldBeEmpty)
+
+		resp := do("/many", `{"title":"a"}`)
+		convey.So(resp.Code, convey.ShouldEqual, 0)
+		convey.So(resp.Data, convey.ShouldEqual, 2)
+		convey.So(repo.books[2].Title, convey.ShouldEqual, "a2")
+	})
+}
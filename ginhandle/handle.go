@@ -2,10 +2,8 @@ package ginhandle
 
 import (
 	"context"
-	"net/http"
 
 	"github.com/gin-gonic/gin"
-	"github.com/illidaris/aphrodite/dto"
 	"github.com/illidaris/aphrodite/pkg/dependency"
 	"github.com/illidaris/aphrodite/pkg/exception"
 )
@@ -15,23 +13,19 @@ func BizGinExHandler[Req dependency.IBindRequest, Resp any](request Req, exec fu
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		if exec == nil {
-			c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_BUSI.New("当前业务尚未启用")))
+			RenderAbort(c, exception.ERR_BUSI.New("当前业务尚未启用"), nil)
 			return
 		}
 		if any(request) != nil {
-			if err := c.ShouldBind(request); err != nil {
-				c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(err)))
-				return
-			}
-			if err := c.ShouldBindUri(request); err != nil {
-				c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(err)))
+			if ex, errs := bindRequest(c, request); ex != nil {
+				RenderAbort(c, ex, errs)
 				return
 			}
 		}
 		dependency.BizFrmCtx(ctx, request)
 		dependency.IPFrmCtx(ctx, request)
 		res, ex := exec(ctx, request)
-		c.JSON(http.StatusOK, dto.NewResponse(res, ex))
+		Render(c, res, ex)
 	}
 }
 
@@ -41,19 +35,15 @@ func GinOneHandler[Req, Resp any](exec func(context.Context, *Req) (Resp, except
 		request := new(Req)
 		ctx := c.Request.Context()
 		if exec == nil {
-			c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_BUSI.New("当前业务尚未启用")))
-			return
-		}
-		if err := c.ShouldBind(request); err != nil {
-			c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(err)))
+			RenderAbort(c, exception.ERR_BUSI.New("当前业务尚未启用"), nil)
 			return
 		}
-		if err := c.ShouldBindUri(request); err != nil {
-			c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(err)))
+		if ex, errs := bindRequest(c, request); ex != nil {
+			RenderAbort(c, ex, errs)
 			return
 		}
 		res, ex := exec(ctx, request)
-		c.JSON(http.StatusOK, dto.NewResponse(res, ex))
+		Render(c, res, ex)
 	}
 }
 
@@ -62,28 +52,24 @@ func GinExHandler[Req, Resp any](request *Req, exec func(context.Context, *Req)
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		if exec == nil {
-			c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_BUSI.New("当前业务尚未启用")))
+			RenderAbort(c, exception.ERR_BUSI.New("当前业务尚未启用"), nil)
 			return
 		}
 		if request != nil {
-			if err := c.ShouldBind(request); err != nil {
-				c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(err)))
-				return
-			}
-			if err := c.ShouldBindUri(request); err != nil {
-				c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(err)))
+			if ex, errs := bindRequest(c, request); ex != nil {
+				RenderAbort(c, ex, errs)
 				return
 			}
 		}
 		for _, f := range reqFuncs {
 			ex := f(ctx, request)
 			if ex != nil {
-				c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, ex))
+				RenderAbort(c, ex, nil)
 				return
 			}
 		}
 		res, ex := exec(ctx, request)
-		c.JSON(http.StatusOK, dto.NewResponse(res, ex))
+		Render(c, res, ex)
 	}
 }
 
@@ -92,15 +78,11 @@ func GinHandler[Req, Resp any](request Req, f func(context.Context, Req) (Resp,
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 		execFunc := f
-		if err := c.ShouldBind(request); err != nil {
-			c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(err)))
-			return
-		}
-		if err := c.ShouldBindUri(request); err != nil {
-			c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(err)))
+		if ex, errs := bindRequest(c, request); ex != nil {
+			RenderAbort(c, ex, errs)
 			return
 		}
 		res, ex := execFunc(ctx, request)
-		c.JSON(http.StatusOK, dto.NewResponse(res, ex))
+		Render(c, res, ex)
 	}
 }
@@ -0,0 +1,103 @@
+package ginhandle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/exception"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type orderReq struct {
+	ShopId int64  `uri:"shop" json:"-" binding:"required,gte=1"`
+	Mobile string `json:"mobile" binding:"required,mobile"`
+	Begin  int64  `json:"begin"`
+	End    int64  `json:"end" binding:"omitempty,gtfield=Begin"`
+}
+
+func (r *orderReq) Validate(ctx context.Context) []dto.FieldError {
+	if r.ShopId == 404 {
+		return []dto.FieldError{{Field: "shop", Rule: "exists", Message: "店铺不存在"}}
+	}
+	return nil
+}
+
+func TestGinOneHandlerValidate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/shops/:shop/orders", GinOneHandler(func(ctx context.Context, req *orderReq) (int64, exception.Exception) {
+		return req.ShopId, nil
+	}))
+	do := func(shop, body, lang string) *dto.Response {
+		req := httptest.NewRequest(http.MethodPost, "/shops/"+shop+"/orders", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Language", lang)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		resp := &dto.Response{}
+		_ = json.Unmarshal(w.Body.Bytes(), resp)
+		return resp
+	}
+	convey.Convey("TestGinOneHandlerValidate", t, func() {
+		resp := do("7", `{"mobile":"13800000000","begin":1,"end":2}`, "")
+		convey.So(resp.Code, convey.ShouldEqual, 0)
+		convey.So(resp.Data, convey.ShouldEqual, 7)
+
+		resp = do("0", `{"mobile":"123","begin":2,"end":1}`, "zh-CN")
+		convey.So(resp.Code, convey.ShouldEqual, exception.ERR_COMMON_BADPARAM)
+		convey.So(resp.Errors, convey.ShouldHaveLength, 3)
+		convey.So(resp.Errors[0].Field, convey.ShouldEqual, "shop")
+		convey.So(resp.Errors[1].Rule, convey.ShouldEqual, "mobile")
+		convey.So(resp.Errors[2].Rule, convey.ShouldEqual, "gtfield")
+		convey.So(resp.Message, convey.ShouldEqual, resp.Errors[0].Message)
+
+		resp = do("1", `{}`, "en")
+		convey.So(resp.Errors[0].Message, convey.ShouldEqual, "mobile is a required field")
+
+		resp = do("404", `{"mobile":"13800000000"}`, "")
+		convey.So(resp.Errors, convey.ShouldResemble, []dto.FieldError{{Field: "shop", Rule: "exists", Message: "店铺不存在"}})
+
+		resp = do("1", `{"mobile":`, "")
+		convey.So(resp.Code, convey.ShouldEqual, exception.ERR_COMMON_BADPARAM)
+		convey.So(resp.Errors, convey.ShouldBeEmpty)
+	})
+}
+
+type pathWinsReq struct {
+	Id   int64  `uri:"id" json:"id" form:"id" binding:"required,gte=1"`
+	Name string `json:"name"`
+}
+
+func TestBindPathWins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.PUT("/x/:id", GinOneHandler(func(ctx context.Context, req *pathWinsReq) (int64, exception.Exception) {
+		return req.Id, nil
+	}))
+	do := func(path, body string) *dto.Response {
+		req := httptest.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		resp := &dto.Response{}
+		_ = json.Unmarshal(w.Body.Bytes(), resp)
+		return resp
+	}
+	convey.Convey("TestBindPathWins", t, func() {
+		resp := do("/x/5", `{"id":9,"name":"a"}`)
+		convey.So(resp.Code, convey.ShouldEqual, 0)
+		convey.So(resp.Data, convey.ShouldEqual, 5)
+
+		resp = do("/x/5?id=9", `{"name":"a"}`)
+		convey.So(resp.Data, convey.ShouldEqual, 5)
+
+		resp = do("/x/0", `{"id":9}`)
+		convey.So(resp.Code, convey.ShouldEqual, exception.ERR_COMMON_BADPARAM)
+	})
+}
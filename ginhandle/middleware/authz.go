@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/biz/authz"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/exception"
+)
+
+/*
+AuthzMiddleware 访问控制中间件
+
+	资源默认为路由FullPath，操作按请求方法映射为read、create、update、delete，
+	主体默认取authz.FromContext，需位于会话中间件之后。
+	判定结果写入请求上下文，ginhandle的CRUD处理据此注入行级过滤条件。
+*/
+func AuthzMiddleware(e *authz.Enforcer, opts ...AuthzOption) gin.HandlerFunc {
+	o := NewAuthzOptions(opts...)
+	return func(c *gin.Context) {
+		sub, ok := o.SubjectFunc(c)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, dto.NewResponse(nil, exception.ERR_COMMON_UNAUTH.New("未登录")))
+			return
+		}
+		d := e.Enforce(sub, o.ResourceFunc(c), o.ActionFunc(c))
+		if !d.Allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, dto.NewResponse(nil, exception.ERR_COMMON_NOPERMISSION.New("没有权限")))
+			return
+		}
+		ctx := authz.NewContext(c.Request.Context(), sub)
+		c.Request = c.Request.WithContext(authz.WithDecision(ctx, d))
+		c.Next()
+	}
+}
+
+// MethodAction 请求方法对应的操作
+func MethodAction(method string) string {
+	switch method {
+	case http.MethodPost:
+		return authz.ACTION_CREATE
+	case http.MethodPut, http.MethodPatch:
+		return authz.ACTION_UPDATE
+	case http.MethodDelete:
+		return authz.ACTION_DELETE
+	}
+	return authz.ACTION_READ
+}
+
+type AuthzOption func(*AuthzOptions)
+
+type AuthzOptions struct {
+	ResourceFunc func(*gin.Context) string
+	ActionFunc   func(*gin.Context) string
+	SubjectFunc  func(*gin.Context) (*authz.Subject, bool)
+}
+
+func NewAuthzOptions(opts ...AuthzOption) *AuthzOptions {
+	o := &AuthzOptions{
+		ResourceFunc: func(c *gin.Context) string { return c.FullPath() },
+		ActionFunc:   func(c *gin.Context) string { return MethodAction(c.Request.Method) },
+		SubjectFunc: func(c *gin.Context) (*authz.Subject, bool) {
+			return authz.FromContext(c.Request.Context())
+		},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAuthzResource 固定资源名
+func WithAuthzResource(v string) AuthzOption {
+	return func(o *AuthzOptions) {
+		o.ResourceFunc = func(*gin.Context) string { return v }
+	}
+}
+
+// WithAuthzAction 固定操作
+func WithAuthzAction(v string) AuthzOption {
+	return func(o *AuthzOptions) {
+		o.ActionFunc = func(*gin.Context) string { return v }
+	}
+}
+
+func WithAuthzSubjectFunc(f func(*gin.Context) (*authz.Subject, bool)) AuthzOption {
+	return func(o *AuthzOptions) {
+		o.SubjectFunc = f
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/biz/authz"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuthzMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	e, err := authz.NewEnforcer(context.Background(), authz.StaticLoader(authz.Rules{Policies: []authz.Policy{
+		{Subject: "viewer", Resource: "/orders", Action: authz.ACTION_READ, Conditions: []string{authz.COND_SAME_BIZ}},
+		{Subject: "admin", Resource: "*", Action: "*"},
+	}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if role := c.GetHeader("X-Role"); role != "" {
+			sub := &authz.Subject{ID: "u1", Roles: []string{role}, BizId: 7}
+			c.Request = c.Request.WithContext(authz.NewContext(c.Request.Context(), sub))
+		}
+	}, AuthzMiddleware(e))
+	var conds []any
+	handle := func(c *gin.Context) {
+		conds = nil
+		if d, ok := authz.DecisionFromContext(c.Request.Context()); ok {
+			conds = d.Conds()
+		}
+		c.Status(http.StatusOK)
+	}
+	r.GET("/orders", handle)
+	r.POST("/orders", handle)
+	do := func(method, role string) int {
+		req := httptest.NewRequest(method, "/orders", nil)
+		req.Header.Set("X-Role", role)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	convey.Convey("TestAuthzMiddleware", t, func() {
+		convey.So(do(http.MethodGet, ""), convey.ShouldEqual, http.StatusUnauthorized)
+		convey.So(do(http.MethodGet, "viewer"), convey.ShouldEqual, http.StatusOK)
+		convey.So(conds, convey.ShouldResemble, []any{"(`bizId` = ?)", int64(7)})
+		convey.So(do(http.MethodPost, "viewer"), convey.ShouldEqual, http.StatusForbidden)
+		convey.So(do(http.MethodPost, "admin"), convey.ShouldEqual, http.StatusOK)
+		convey.So(conds, convey.ShouldBeNil)
+	})
+}
@@ -0,0 +1,220 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/cache"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/pkg/exception"
+	"github.com/spf13/cast"
+)
+
+const (
+	HEADER_IDEMPOTENCY_KEY      = "Idempotency-Key"
+	HEADER_IDEMPOTENCY_REPLAYED = "Idempotency-Replayed"
+	IDEMPOTENCY_KEY_PREFIX      = "_aph_idempotency:%d:%s:%s:%s" // bizId:method:route:key
+	DEFAULT_IDEMPOTENCY_TTL     = 24 * time.Hour
+	DEFAULT_IDEMPOTENCY_LOCK    = time.Minute
+	MAX_IDEMPOTENCY_KEY_LEN     = 128
+)
+
+// idempotencyRecord 缓存的响应
+type idempotencyRecord struct {
+	Fingerprint string `json:"fingerprint"`
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
+
+type bodyWriter struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w *bodyWriter) Write(bs []byte) (int, error) {
+	w.body.Write(bs)
+	return w.ResponseWriter.Write(bs)
+}
+
+func (w *bodyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+/*
+IdempotencyMiddleware 幂等中间件，仅作用于POST、PUT、PATCH、DELETE
+
+	键按BizId、方法、路由与Idempotency-Key隔离，沿用cache.Shell的约定：
+	key保存响应，key+KEY_LOCK_SUFFIX为处理中的锁，锁的值为请求体指纹。
+	相同key与指纹的重复请求返回首次的响应，处理中返回409，指纹不同返回422，
+	响应状态码>=500或429时不保存，允许客户端重试；RENDER_ENVELOPE下http状态恒为200，
+	按响应体中错误码注册的状态判断，见exception.Register。
+*/
+func IdempotencyMiddleware(c dependency.ICache, opts ...IdempotencyOption) gin.HandlerFunc {
+	o := NewIdempotencyOptions(opts...)
+	return func(ctx *gin.Context) {
+		if !idempotentMethod(ctx.Request.Method) {
+			ctx.Next()
+			return
+		}
+		idemKey := ctx.GetHeader(HEADER_IDEMPOTENCY_KEY)
+		if idemKey == "" {
+			if o.Required {
+				ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.New("缺少Idempotency-Key")))
+				return
+			}
+			ctx.Next()
+			return
+		}
+		if len(idemKey) > MAX_IDEMPOTENCY_KEY_LEN {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.New("Idempotency-Key过长")))
+			return
+		}
+		fingerprint, err := requestFingerprint(ctx)
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusBadRequest, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(err)))
+			return
+		}
+		key := fmt.Sprintf(IDEMPOTENCY_KEY_PREFIX, contextex.GetBizId(ctx.Request.Context()), ctx.Request.Method, ctx.FullPath(), idemKey)
+		keyLocked := key + cache.KEY_LOCK_SUFFIX
+		if replayIdempotency(ctx, c, key, fingerprint) {
+			return
+		}
+		if ok, err := c.SetNX(keyLocked, fingerprint, o.LockTTL); err != nil || !ok {
+			// 加锁期间首个请求可能已完成
+			if replayIdempotency(ctx, c, key, fingerprint) {
+				return
+			}
+			if err == nil && cast.ToString(c.Get(keyLocked)) != fingerprint {
+				ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.New("Idempotency-Key已用于其他请求")))
+				return
+			}
+			ctx.AbortWithStatusJSON(http.StatusConflict, dto.NewResponse(nil, exception.ERR_COMMON_REQ_TOOMANEY.New("请求正在处理中")))
+			return
+		}
+		defer func() {
+			_ = c.Delete(keyLocked)
+		}()
+		writer := &bodyWriter{ResponseWriter: ctx.Writer, body: &bytes.Buffer{}}
+		ctx.Writer = writer
+		ctx.Next()
+		status := writer.Status()
+		if retryableStatus(responseStatus(status, writer.body.Bytes())) {
+			return
+		}
+		bs, _ := json.Marshal(idempotencyRecord{
+			Fingerprint: fingerprint,
+			Status:      status,
+			ContentType: writer.Header().Get("Content-Type"),
+			Body:        writer.body.Bytes(),
+		})
+		_ = c.Set(key, string(bs), o.TTL)
+	}
+}
+
+// replayIdempotency 已有响应时回放，返回是否已处理
+func replayIdempotency(ctx *gin.Context, c dependency.ICache, key, fingerprint string) bool {
+	raw := cast.ToString(c.Get(key))
+	if raw == "" {
+		return false
+	}
+	record := idempotencyRecord{}
+	if err := json.Unmarshal([]byte(raw), &record); err != nil {
+		return false
+	}
+	if record.Fingerprint != fingerprint {
+		ctx.AbortWithStatusJSON(http.StatusUnprocessableEntity, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.New("Idempotency-Key已用于其他请求")))
+		return true
+	}
+	ctx.Header(HEADER_IDEMPOTENCY_REPLAYED, "true")
+	ctx.Data(record.Status, record.ContentType, record.Body)
+	ctx.Abort()
+	return true
+}
+
+// responseStatus 响应的实际状态，http状态非错误时按响应体dto.Response中的错误码取注册的状态
+func responseStatus(status int, body []byte) int {
+	if status >= http.StatusBadRequest {
+		return status
+	}
+	resp := dto.BaseResponse{}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Code == 0 {
+		return status
+	}
+	return exception.ExceptionType(resp.Code).Status()
+}
+
+// retryableStatus 可重试的状态，其响应不保存
+func retryableStatus(status int) bool {
+	return status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// requestFingerprint 方法、路径、查询参数与请求体的摘要，读取后恢复请求体
+func requestFingerprint(ctx *gin.Context) (string, error) {
+	h := sha256.New()
+	_, _ = io.WriteString(h, ctx.Request.Method+" "+ctx.Request.URL.Path+"?"+ctx.Request.URL.RawQuery+"\n")
+	if ctx.Request.Body != nil {
+		bs, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			return "", err
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(bs))
+		_, _ = h.Write(bs)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func idempotentMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+type IdempotencyOption func(*IdempotencyOptions)
+
+type IdempotencyOptions struct {
+	TTL      time.Duration // 响应保存时间
+	LockTTL  time.Duration // 处理中锁的时间，应大于接口最长耗时
+	Required bool          // 缺少Idempotency-Key时返回400
+}
+
+func NewIdempotencyOptions(opts ...IdempotencyOption) *IdempotencyOptions {
+	o := &IdempotencyOptions{
+		TTL:     DEFAULT_IDEMPOTENCY_TTL,
+		LockTTL: DEFAULT_IDEMPOTENCY_LOCK,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func WithIdempotencyTTL(v time.Duration) IdempotencyOption {
+	return func(o *IdempotencyOptions) {
+		o.TTL = v
+	}
+}
+
+func WithIdempotencyLockTTL(v time.Duration) IdempotencyOption {
+	return func(o *IdempotencyOptions) {
+		o.LockTTL = v
+	}
+}
+
+func WithIdempotencyRequired(v bool) IdempotencyOption {
+	return func(o *IdempotencyOptions) {
+		o.Required = v
+	}
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	"github.com/illidaris/aphrodite/pkg/exception"
+	"github.com/illidaris/aphrodite/pkg/testkit"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var (
+		calls   int64
+		started = make(chan struct{})
+		release = make(chan struct{})
+		c       = testkit.NewCache(nil)
+		r       = gin.New()
+	)
+	r.Use(func(ctx *gin.Context) {
+		bizId := int64(1)
+		if ctx.GetHeader("X-Biz") == "2" {
+			bizId = 2
+		}
+		ctx.Request = ctx.Request.WithContext(contextex.WithBizId(ctx.Request.Context(), bizId))
+	}, IdempotencyMiddleware(c))
+	r.POST("/orders", func(ctx *gin.Context) {
+		n := atomic.AddInt64(&calls, 1)
+		if ctx.GetHeader("X-Block") != "" {
+			close(started)
+			<-release
+		}
+		ctx.JSON(http.StatusCreated, gin.H{"order": n})
+	})
+	r.POST("/fail", func(ctx *gin.Context) {
+		atomic.AddInt64(&calls, 1)
+		ctx.Status(http.StatusInternalServerError)
+	})
+	r.POST("/busy", func(ctx *gin.Context) {
+		n := atomic.AddInt64(&calls, 1)
+		ex := exception.ERR_COMMON_BUSY.New("服务器繁忙")
+		if n > 7 {
+			ex = exception.ERR_BUSI_HASEXIST.New("已经存在")
+		}
+		ctx.JSON(http.StatusOK, dto.NewResponse(nil, ex))
+	})
+	do := func(path, key, body string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(HEADER_IDEMPOTENCY_KEY, key)
+		}
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	convey.Convey("TestIdempotencyMiddleware", t, func() {
+		w := do("/orders", "k1", `{"sku":1}`)
+		convey.So(w.Code, convey.ShouldEqual, http.StatusCreated)
+		convey.So(w.Body.String(), convey.ShouldEqual, `{"order":1}`)
+
+		// 重复请求回放首次响应
+		w = do("/orders", "k1", `{"sku":1}`)
+		convey.So(w.Code, convey.ShouldEqual, http.StatusCreated)
+		convey.So(w.Body.String(), convey.ShouldEqual, `{"order":1}`)
+		convey.So(w.Header().Get(HEADER_IDEMPOTENCY_REPLAYED), convey.ShouldEqual, "true")
+		convey.So(w.Header().Get("Content-Type"), convey.ShouldContainSubstring, "application/json")
+
+		// 相同key不同请求体
+		w = do("/orders", "k1", `{"sku":2}`)
+		convey.So(w.Code, convey.ShouldEqual, http.StatusUnprocessableEntity)
+
+		// 不同BizId、无key互不影响
+		convey.So(do("/orders", "k1", `{"sku":1}`, "X-Biz", "2").Body.String(), convey.ShouldEqual, `{"order":2}`)
+		convey.So(do("/orders", "", `{"sku":1}`).Body.String(), convey.ShouldEqual, `{"order":3}`)
+
+		// 5xx不保存
+		convey.So(do("/fail", "k2", "").Code, convey.ShouldEqual, http.StatusInternalServerError)
+		convey.So(do("/fail", "k2", "").Code, convey.ShouldEqual, http.StatusInternalServerError)
+		convey.So(atomic.LoadInt64(&calls), convey.ShouldEqual, 5)
+
+		// 处理中的重复请求
+		done := make(chan *httptest.ResponseRecorder)
+		go func() { done <- do("/orders", "k3", `{"sku":3}`, "X-Block", "1") }()
+		<-started
+		convey.So(do("/orders", "k3", `{"sku":3}`).Code, convey.ShouldEqual, http.StatusConflict)
+		convey.So(do("/orders", "k3", `{"sku":4}`).Code, convey.ShouldEqual, http.StatusUnprocessableEntity)
+		close(release)
+		convey.So((<-done).Code, convey.ShouldEqual, http.StatusCreated)
+		w = do("/orders", "k3", `{"sku":3}`)
+		convey.So(w.Body.String(), convey.ShouldEqual, `{"order":6}`)
+
+		// http 200的可重试业务错误不保存，不可重试的保存
+		convey.So(do("/busy", "k4", "").Body.String(), convey.ShouldContainSubstring, fmt.Sprintf(`"code":%d`, exception.ERR_COMMON_BUSY))
+		w = do("/busy", "k4", "")
+		convey.So(w.Header().Get(HEADER_IDEMPOTENCY_REPLAYED), convey.ShouldBeEmpty)
+		convey.So(w.Body.String(), convey.ShouldContainSubstring, fmt.Sprintf(`"code":%d`, exception.ERR_BUSI_HASEXIST))
+		w = do("/busy", "k4", "")
+		convey.So(w.Header().Get(HEADER_IDEMPOTENCY_REPLAYED), convey.ShouldEqual, "true")
+		convey.So(atomic.LoadInt64(&calls), convey.ShouldEqual, 8)
+	})
+}
@@ -3,57 +3,102 @@ package middleware
 import (
 	"context"
 	"crypto/sha256"
+	"fmt"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/dependency"
 	"github.com/illidaris/aphrodite/pkg/exception"
 	"github.com/illidaris/rest/signature"
 
 	"github.com/spf13/cast"
 )
 
-// 用于前端签名使用，最好配合mojito_bg.wasm
+const (
+	SIGN_NONCE_KEY_PREFIX = "_aph_sign_nonce:%s:%s" // app:noise
+)
+
+/*
+WebSignMiddleware 用于前端签名使用，最好配合mojito_bg.wasm
+
+	依次校验应用、版本、来源IP、时间戳与签名值，配置NonceCache时校验随机串防重放，
+	随机串在签名有效期内只能使用一次；密钥轮换期间新旧密钥均可验签。
+*/
 func WebSignMiddleware(sopts ...WebsignOption) gin.HandlerFunc {
+	opts := NewWebsignOptions(sopts...)
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
-		opts := NewWebsignOptions(sopts...)
-		app := c.Query(signature.SignAppID)
+		app := signParam(c, signature.SignAppID)
 		ver := c.Query("ver")
-		tsStr := c.Query(signature.SignKeyTimestamp)
+		tsStr := signParam(c, signature.SignKeyTimestamp)
 		// 校验签名
 		if !opts.Skip(ctx) {
-			secret := opts.SecretFunc(ctx, app)
-			if secret == "" {
-				c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_COMMON_SIGN_APP.New("应用访问被拒绝")))
+			secrets := opts.Secrets(ctx, app)
+			if len(secrets) == 0 {
+				abortSign(c, exception.ERR_COMMON_SIGN_APP.New("应用访问被拒绝"))
 				return
 			}
 			if !opts.AllowVerFunc(ctx, ver) {
-				c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_COMMON_SIGN_VER.New("签名版本失效")))
+				abortSign(c, exception.ERR_COMMON_SIGN_VER.New("签名版本失效"))
+				return
+			}
+			if opts.AllowIPFunc != nil && !opts.AllowIPFunc(ctx, app, c.ClientIP()) {
+				abortSign(c, exception.ERR_COMMON_SIGN_IP.New("来源IP不允许"))
 				return
 			}
 			timeout := opts.TimeoutFunc(ctx)
 			now := time.Now()
 			beg := now.Add(-1 * timeout)
 			end := now.Add(timeout)
-			if ts := cast.ToInt64(tsStr); beg.Unix() > ts || end.Unix() < ts {
-				c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_COMMON_SIGN_EXPIRED.New("签名已过期")))
+			ts := cast.ToInt64(tsStr)
+			if beg.Unix() > ts || end.Unix() < ts {
+				abortSign(c, exception.ERR_COMMON_SIGN_EXPIRED.New("签名已过期"))
+				return
+			}
+			noise := signParam(c, signature.SignKeyNoise)
+			if opts.NonceCache != nil && noise == "" {
+				abortSign(c, exception.ERR_COMMON_SIGN_NONCE.New("签名缺少随机串"))
 				return
 			}
-			realOpts := []signature.OptionFunc{
-				signature.WithHmacFunc(func(s string, as ...string) string {
-					return signature.HashMac(sha256.New, s, as...)
-				}),
-				signature.WithExpire(timeout),
-				signature.WithSecret(secret),
+			var err error
+			for _, secret := range secrets {
+				realOpts := []signature.OptionFunc{
+					signature.WithHmacFunc(func(s string, as ...string) string {
+						return signature.HashMac(sha256.New, s, as...)
+					}),
+					signature.WithExpire(timeout),
+					signature.WithSecret(secret),
+				}
+				realOpts = append(realOpts, opts.RestOptions...)
+				if err = signature.VerifySign(c.Request, realOpts...); err == nil {
+					break
+				}
 			}
-			realOpts = append(realOpts, opts.RestOptions...)
-			err := signature.VerifySign(c.Request, realOpts...)
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, exception.ERR_COMMON_BADPARAM.Wrap(err)))
+				abortSign(c, exception.ERR_COMMON_SIGN.Wrap(err, "签名值错误"))
 				return
 			}
+			// 验签通过后再占用随机串，避免伪造请求消耗随机串
+			if opts.NonceCache != nil {
+				// 随机串保留至签名失效
+				ttl := time.Unix(ts, 0).Add(timeout).Sub(now)
+				if ttl < time.Second {
+					ttl = time.Second
+				}
+				ok, err := opts.NonceCache.SetNX(fmt.Sprintf(SIGN_NONCE_KEY_PREFIX, app, noise), ts, ttl)
+				if err != nil {
+					abortSign(c, exception.ERR_COMMON_BUSY.Wrap(err))
+					return
+				}
+				if !ok {
+					abortSign(c, exception.ERR_COMMON_SIGN_REPLAY.New("请求已被处理，请勿重放"))
+					return
+				}
+			}
 		}
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(200)
@@ -63,6 +108,61 @@ func WebSignMiddleware(sopts ...WebsignOption) gin.HandlerFunc {
 	}
 }
 
+func abortSign(c *gin.Context, ex exception.Exception) {
+	c.AbortWithStatusJSON(http.StatusOK, dto.NewResponse(nil, ex))
+}
+
+// signParam 签名参数优先取query，其次取header
+func signParam(c *gin.Context, key string) string {
+	if v := c.Query(key); v != "" {
+		return v
+	}
+	return c.GetHeader(key)
+}
+
+// AppSecret 应用密钥，ExpireAt为零值时不过期，轮换时旧密钥设置ExpireAt作为重叠期
+type AppSecret struct {
+	Secret   string
+	ExpireAt time.Time
+}
+
+// NewIPAllowList 按应用配置来源IP白名单，支持IP与CIDR，未配置的应用不限制
+func NewIPAllowList(apps map[string][]string) (func(ctx context.Context, app, ip string) bool, error) {
+	nets := map[string][]*net.IPNet{}
+	for app, items := range apps {
+		for _, item := range items {
+			if !strings.Contains(item, "/") {
+				if strings.Contains(item, ":") {
+					item += "/128"
+				} else {
+					item += "/32"
+				}
+			}
+			_, n, err := net.ParseCIDR(item)
+			if err != nil {
+				return nil, err
+			}
+			nets[app] = append(nets[app], n)
+		}
+	}
+	return func(ctx context.Context, app, ip string) bool {
+		allows, ok := nets[app]
+		if !ok {
+			return true
+		}
+		addr := net.ParseIP(ip)
+		if addr == nil {
+			return false
+		}
+		for _, n := range allows {
+			if n.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
 type WebsignOption func(*WebsignOptions)
 
 // NewWebsignOptions 创建并返回一个新的WebsignOptions实例，初始化允许的主机和版本为空，超时时间为2分钟，签名不可用。
@@ -98,6 +198,27 @@ func WithExpireFunc(v func(ctx context.Context) time.Duration) WebsignOption {
 	}
 }
 
+// WithSecretsFunc 按应用返回多个密钥，用于密钥轮换，优先于WithSecretFunc
+func WithSecretsFunc(v func(ctx context.Context, app string) []AppSecret) WebsignOption {
+	return func(opts *WebsignOptions) {
+		opts.SecretsFunc = v
+	}
+}
+
+// WithIPFunc 按应用校验来源IP，可配合NewIPAllowList
+func WithIPFunc(v func(ctx context.Context, app, ip string) bool) WebsignOption {
+	return func(opts *WebsignOptions) {
+		opts.AllowIPFunc = v
+	}
+}
+
+// WithNonceCache 随机串缓存，设置后开启防重放
+func WithNonceCache(v dependency.ICache) WebsignOption {
+	return func(opts *WebsignOptions) {
+		opts.NonceCache = v
+	}
+}
+
 func WithHostFunc(v func(ctx context.Context, s string) bool) WebsignOption {
 	return func(opts *WebsignOptions) {
 		opts.AllowHostFunc = v
@@ -125,6 +246,9 @@ type WebsignOptions struct {
 	AllowVerFunc  func(context.Context, string) bool   // 允许签名的版本集合
 	RestOptions   []signature.OptionFunc               // 框架参数
 	SkipFunc      func(context.Context) bool
+	SecretsFunc   func(context.Context, string) []AppSecret  // 轮换中的多个密钥
+	AllowIPFunc   func(context.Context, string, string) bool // 按应用允许的来源IP
+	NonceCache    dependency.ICache                          // 随机串缓存，为空时不防重放
 }
 
 func (opts *WebsignOptions) Skip(ctx context.Context) bool {
@@ -133,3 +257,22 @@ func (opts *WebsignOptions) Skip(ctx context.Context) bool {
 	}
 	return opts.SkipFunc(ctx)
 }
+
+// Secrets 应用当前有效的密钥
+func (opts *WebsignOptions) Secrets(ctx context.Context, app string) []string {
+	if opts.SecretsFunc == nil {
+		if secret := opts.SecretFunc(ctx, app); secret != "" {
+			return []string{secret}
+		}
+		return nil
+	}
+	now := time.Now()
+	res := []string{}
+	for _, s := range opts.SecretsFunc(ctx, app) {
+		if s.Secret == "" || (!s.ExpireAt.IsZero() && now.After(s.ExpireAt)) {
+			continue
+		}
+		res = append(res, s.Secret)
+	}
+	return res
+}
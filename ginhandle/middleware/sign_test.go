@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/exception"
+	"github.com/illidaris/aphrodite/pkg/testkit"
+	"github.com/illidaris/rest/core"
+	"github.com/illidaris/rest/signature"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestWebSignMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	allowIP, err := NewIPAllowList(map[string][]string{"partner": {"192.168.0.0/16", "10.0.0.8"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := gin.New()
+	r.Use(WebSignMiddleware(
+		WithSecretsFunc(func(ctx context.Context, app string) []AppSecret {
+			switch app {
+			case "web":
+				return []AppSecret{{Secret: "new-secret"}, {Secret: "old-secret", ExpireAt: time.Now().Add(time.Hour)}}
+			case "partner":
+				return []AppSecret{{Secret: "partner-secret"}, {Secret: "expired-secret", ExpireAt: time.Now().Add(-time.Hour)}}
+			}
+			return nil
+		}),
+		WithIPFunc(allowIP),
+		WithNonceCache(testkit.NewCache(nil)),
+	))
+	r.GET("/orders", func(c *gin.Context) {
+		c.JSON(http.StatusOK, dto.NewResponse("ok", nil))
+	})
+	signed := func(app, secret string) url.Values {
+		sign, err := signature.Generate(signature.GenerateParam{
+			Method:      http.MethodGet,
+			ContentType: core.NilContent,
+			Action:      "orders",
+			UrlQuery:    url.Values{"id": {"1"}},
+		}, signature.WithAppID(app), signature.WithSecret(secret), signature.WithHmacFunc(func(s string, as ...string) string {
+			return signature.HashMac(sha256.New, s, as...)
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		vs := sign.ToMap()
+		vs.Set("id", "1")
+		return vs
+	}
+	do := func(vs url.Values, ip string) int32 {
+		req := httptest.NewRequest(http.MethodGet, "/orders?"+vs.Encode(), nil)
+		req.RemoteAddr = ip + ":5555"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		resp := &dto.Response{}
+		_ = json.Unmarshal(w.Body.Bytes(), resp)
+		return resp.Code
+	}
+	convey.Convey("TestWebSignMiddleware", t, func() {
+		convey.Convey("replay", func() {
+			vs := signed("web", "new-secret")
+			convey.So(do(vs, "1.1.1.1"), convey.ShouldEqual, 0)
+			convey.So(do(vs, "1.1.1.1"), convey.ShouldEqual, exception.ERR_COMMON_SIGN_REPLAY)
+			vs.Del(signature.SignKeyNoise)
+			convey.So(do(vs, "1.1.1.1"), convey.ShouldEqual, exception.ERR_COMMON_SIGN_NONCE)
+		})
+		convey.Convey("rotation", func() {
+			convey.So(do(signed("web", "old-secret"), "1.1.1.1"), convey.ShouldEqual, 0)
+			convey.So(do(signed("partner", "expired-secret"), "10.0.0.8"), convey.ShouldEqual, exception.ERR_COMMON_SIGN)
+			convey.So(do(signed("unknown", "new-secret"), "1.1.1.1"), convey.ShouldEqual, exception.ERR_COMMON_SIGN_APP)
+		})
+		convey.Convey("ip", func() {
+			convey.So(do(signed("partner", "partner-secret"), "192.168.3.4"), convey.ShouldEqual, 0)
+			convey.So(do(signed("partner", "partner-secret"), "10.0.0.8"), convey.ShouldEqual, 0)
+			convey.So(do(signed("partner", "partner-secret"), "10.0.0.9"), convey.ShouldEqual, exception.ERR_COMMON_SIGN_IP)
+		})
+		convey.Convey("expired", func() {
+			vs := signed("web", "new-secret")
+			vs.Set(signature.SignKeyTimestamp, "1000")
+			convey.So(do(vs, "1.1.1.1"), convey.ShouldEqual, exception.ERR_COMMON_SIGN_EXPIRED)
+		})
+	})
+}
@@ -0,0 +1,80 @@
+package ginhandle
+
+import (
+	"context"
+	"path"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/ginhandle/openapi"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/pkg/exception"
+)
+
+// DocRouter 注册路由的同时记录接口文档，通过Handle、Document或Resource注册的路由会写入Registry
+type DocRouter struct {
+	gin.IRouter
+	Registry *openapi.Registry
+}
+
+func NewDocRouter(g gin.IRouter, registry *openapi.Registry) *DocRouter {
+	return &DocRouter{IRouter: g, Registry: registry}
+}
+
+// DocGroup 子路由组，保留文档记录
+func (r *DocRouter) DocGroup(relativePath string, handlers ...gin.HandlerFunc) *DocRouter {
+	return &DocRouter{IRouter: r.IRouter.Group(relativePath, handlers...), Registry: r.Registry}
+}
+
+// ServeSpec 注册文档路由，默认/openapi.json
+func (r *DocRouter) ServeSpec(relativePath string) gin.IRoutes {
+	if relativePath == "" {
+		relativePath = openapi.PATH
+	}
+	return r.IRouter.GET(relativePath, r.Registry.Handler())
+}
+
+// Document 记录路由的请求与响应类型，响应外层为dto.Response信封，g不是DocRouter时忽略
+func Document[Req, Resp any](g gin.IRouter, method, relativePath string, opts ...openapi.RouteOption) {
+	r, ok := g.(*DocRouter)
+	if !ok || r.Registry == nil {
+		return
+	}
+	r.Registry.Add(openapi.Route{
+		Method: method,
+		Path:   joinPath(g, relativePath),
+		Req:    reflect.TypeOf((*Req)(nil)).Elem(),
+		Resp:   reflect.TypeOf(dto.TResponse[Resp]{}),
+	}, opts...)
+}
+
+// Handle 使用GinOneHandler注册路由并记录文档
+func Handle[Req, Resp any](g gin.IRouter, method, relativePath string, exec func(context.Context, *Req) (Resp, exception.Exception), opts ...openapi.RouteOption) gin.IRoutes {
+	Document[Req, Resp](g, method, relativePath, opts...)
+	return g.Handle(method, relativePath, GinOneHandler(exec))
+}
+
+// HandleBiz 使用BizGinExHandler注册路由并记录文档
+func HandleBiz[Req dependency.IBindRequest, Resp any](g gin.IRouter, method, relativePath string, request Req, exec func(context.Context, Req) (Resp, exception.Exception), opts ...openapi.RouteOption) gin.IRoutes {
+	Document[Req, Resp](g, method, relativePath, opts...)
+	return g.Handle(method, relativePath, BizGinExHandler(request, exec))
+}
+
+func joinPath(g gin.IRouter, relativePath string) string {
+	base := "/"
+	if r, ok := g.(*DocRouter); ok {
+		g = r.IRouter
+	}
+	if v, ok := g.(interface{ BasePath() string }); ok {
+		base = v.BasePath()
+	}
+	if relativePath == "" {
+		return base
+	}
+	p := path.Join(base, relativePath)
+	if relativePath[len(relativePath)-1] == '/' && p[len(p)-1] != '/' {
+		p += "/"
+	}
+	return p
+}
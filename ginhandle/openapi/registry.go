@@ -0,0 +1,161 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	PATH          = "/openapi.json"
+	CONTENT_JSON  = "application/json"
+	PARAM_IN_PATH = "path"
+	PARAM_QUERY   = "query"
+)
+
+// Route 路由文档，Req与Resp为空表示没有请求参数或响应体
+type Route struct {
+	Method  string
+	Path    string // gin格式路径，如/books/:id
+	Req     reflect.Type
+	Resp    reflect.Type // 包含dto.Response信封的完整响应类型
+	Summary string
+	Tags    []string
+}
+
+type RouteOption func(*Route)
+
+func WithSummary(summary string) RouteOption {
+	return func(r *Route) {
+		r.Summary = summary
+	}
+}
+
+func WithTags(tags ...string) RouteOption {
+	return func(r *Route) {
+		r.Tags = append(r.Tags, tags...)
+	}
+}
+
+// Registry 记录注册的路由并生成文档
+type Registry struct {
+	mu     sync.RWMutex
+	info   Info
+	routes []Route
+}
+
+func NewRegistry(title, version string) *Registry {
+	return &Registry{info: Info{Title: title, Version: version}}
+}
+
+func (r *Registry) Add(route Route, opts ...RouteOption) {
+	for _, opt := range opts {
+		opt(&route)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = append(r.routes, route)
+}
+
+func (r *Registry) Routes() []Route {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Route{}, r.routes...)
+}
+
+// Document 生成文档，路由按路径与方法排序，输出稳定
+func (r *Registry) Document() *Document {
+	routes := r.Routes()
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	g := newGenerator()
+	doc := &Document{
+		OpenAPI: VERSION,
+		Info:    r.info,
+		Paths:   map[string]PathItem{},
+	}
+	for _, route := range routes {
+		path := ConvertPath(route.Path)
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = PathItem{}
+			doc.Paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = g.operation(route)
+	}
+	doc.Components.Schemas = g.schemas
+	return doc
+}
+
+// Handler 输出json文档
+func (r *Registry) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, r.Document())
+	}
+}
+
+// ConvertPath gin路径参数转换为OpenAPI格式，:id与*path均转换为{id}、{path}
+func ConvertPath(path string) string {
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			segs[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+func (g *generator) operation(route Route) *Operation {
+	op := &Operation{
+		Tags:      route.Tags,
+		Summary:   route.Summary,
+		Responses: map[string]*Response{},
+	}
+	if route.Req != nil {
+		g.request(op, route)
+	}
+	resp := &Response{Description: http.StatusText(http.StatusOK)}
+	if route.Resp != nil {
+		resp.Content = map[string]*MediaType{CONTENT_JSON: {Schema: g.schema(route.Resp)}}
+	}
+	op.Responses["200"] = resp
+	return op
+}
+
+// pathParams 路径中的参数名
+func pathParams(path string) map[string]bool {
+	params := map[string]bool{}
+	for _, seg := range strings.Split(path, "/") {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			params[seg[1:]] = true
+		}
+	}
+	return params
+}
+
+// request uri标签且出现在路径中的字段作为路径参数，GET、DELETE的其余字段作为查询参数，其他方法使用json请求体
+func (g *generator) request(op *Operation, route Route) {
+	query := route.Method == http.MethodGet || route.Method == http.MethodDelete || route.Method == http.MethodHead
+	params := pathParams(route.Path)
+	for _, f := range fields(route.Req) {
+		switch {
+		case params[f.uri]:
+			op.Parameters = append(op.Parameters, &Parameter{Name: f.uri, In: PARAM_IN_PATH, Required: true, Schema: g.field(f)})
+		case query && f.form != "-":
+			op.Parameters = append(op.Parameters, &Parameter{Name: f.form, In: PARAM_QUERY, Required: f.required(), Schema: g.field(f)})
+		}
+	}
+	if query {
+		return
+	}
+	body := g.schema(route.Req)
+	op.RequestBody = &RequestBody{Required: true, Content: map[string]*MediaType{CONTENT_JSON: {Schema: body}}}
+}
@@ -0,0 +1,215 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const REF_PREFIX = "#/components/schemas/"
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawType       = reflect.TypeOf(json.RawMessage{})
+	pkgPathRegexp = regexp.MustCompile(`[\w.\-]*/`)
+	nameReplacer  = strings.NewReplacer("[", "_", "]", "", ",", "_", "*", "", " ", "")
+)
+
+// field 结构体展开后的字段，匿名嵌入字段按encoding/json规则展开
+type field struct {
+	reflect.StructField
+	json    string
+	form    string
+	uri     string
+	binding []string
+}
+
+func (f field) required() bool {
+	for _, v := range f.binding {
+		if v == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+func tagName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	return name
+}
+
+func fields(t reflect.Type) []field {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	res := []field{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		jsonTag := tagName(sf.Tag.Get("json"))
+		if sf.Anonymous && jsonTag == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				res = append(res, fields(ft)...)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		f := field{StructField: sf, json: jsonTag, form: tagName(sf.Tag.Get("form")), uri: tagName(sf.Tag.Get("uri"))}
+		if f.json == "" {
+			f.json = sf.Name
+		}
+		if f.form == "" {
+			f.form = sf.Name
+		}
+		if v := sf.Tag.Get("binding"); v != "" {
+			f.binding = strings.Split(v, ",")
+		}
+		res = append(res, f)
+	}
+	return res
+}
+
+// SchemaName 组件名，去掉包路径仅保留包名，泛型参数以_连接
+func SchemaName(t reflect.Type) string {
+	name := t.Name()
+	if t.PkgPath() != "" {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+	return nameReplacer.Replace(pkgPathRegexp.ReplaceAllString(name, ""))
+}
+
+type generator struct {
+	schemas map[string]*Schema
+}
+
+func newGenerator() *generator {
+	return &generator{schemas: map[string]*Schema{}}
+}
+
+// schema 命名结构体注册为组件并返回引用
+func (g *generator) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawType:
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name := SchemaName(t)
+		if _, ok := g.schemas[name]; !ok {
+			// 先占位，避免递归类型死循环
+			g.schemas[name] = &Schema{}
+			*g.schemas[name] = *g.object(t)
+		}
+		return &Schema{Ref: REF_PREFIX + name}
+	}
+	return &Schema{}
+}
+
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, f := range fields(t) {
+		if f.json == "-" {
+			continue
+		}
+		s.Properties[f.json] = g.field(f)
+		if f.required() {
+			s.Required = append(s.Required, f.json)
+		}
+	}
+	return s
+}
+
+// field 字段schema，附加binding约束
+func (g *generator) field(f field) *Schema {
+	s := g.schema(f.Type)
+	if s.Ref != "" {
+		return s
+	}
+	for _, rule := range f.binding {
+		k, v, _ := strings.Cut(rule, "=")
+		switch k {
+		case "oneof":
+			for _, item := range strings.Fields(v) {
+				if s.Type == "integer" || s.Type == "number" {
+					if n, err := strconv.ParseFloat(item, 64); err == nil {
+						s.Enum = append(s.Enum, n)
+						continue
+					}
+				}
+				s.Enum = append(s.Enum, item)
+			}
+		case "min", "gte", "max", "lte", "len":
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			lower := k == "min" || k == "gte" || k == "len"
+			upper := k == "max" || k == "lte" || k == "len"
+			switch s.Type {
+			case "integer", "number":
+				if lower {
+					s.Minimum = &n
+				}
+				if upper {
+					s.Maximum = &n
+				}
+			case "string":
+				u := uint64(n)
+				if lower {
+					s.MinLength = &u
+				}
+				if upper {
+					s.MaxLength = &u
+				}
+			case "array":
+				u := uint64(n)
+				if lower {
+					s.MinItems = &u
+				}
+				if upper {
+					s.MaxItems = &u
+				}
+			}
+		}
+	}
+	return s
+}
@@ -0,0 +1,42 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type node struct {
+	Name     string    `json:"name" binding:"required,min=1,max=8"`
+	Children []*node   `json:"children"`
+	At       time.Time `json:"at"`
+	Raw      []byte    `json:"raw"`
+	skip     string
+	Ignore   string `json:"-"`
+}
+
+type pair[K, V any] struct {
+	Key   K `json:"key"`
+	Value V `json:"value"`
+}
+
+func TestSchema(t *testing.T) {
+	convey.Convey("TestSchema", t, func() {
+		convey.So(ConvertPath("/a/:id/*path"), convey.ShouldEqual, "/a/{id}/{path}")
+		convey.So(SchemaName(reflect.TypeOf(pair[string, *node]{})), convey.ShouldEqual, "openapi.pair_string_openapi.node")
+
+		g := newGenerator()
+		ref := g.schema(reflect.TypeOf(&node{}))
+		convey.So(ref.Ref, convey.ShouldEqual, REF_PREFIX+"openapi.node")
+		s := g.schemas["openapi.node"]
+		convey.So(len(s.Properties), convey.ShouldEqual, 4)
+		convey.So(s.Required, convey.ShouldResemble, []string{"name"})
+		convey.So(*s.Properties["name"].MinLength, convey.ShouldEqual, 1)
+		convey.So(*s.Properties["name"].MaxLength, convey.ShouldEqual, 8)
+		convey.So(s.Properties["children"].Items.Ref, convey.ShouldEqual, REF_PREFIX+"openapi.node")
+		convey.So(s.Properties["at"].Format, convey.ShouldEqual, "date-time")
+		convey.So(s.Properties["raw"].Format, convey.ShouldEqual, "byte")
+	})
+}
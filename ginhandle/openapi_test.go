@@ -0,0 +1,71 @@
+package ginhandle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/ginhandle/openapi"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/pkg/exception"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+type searchReq struct {
+	Keyword string   `form:"keyword" binding:"required,max=32"`
+	Status  int32    `form:"status" binding:"oneof=1 2"`
+	Tags    []string `form:"tags"`
+	Shelf   string   `uri:"shelf"`
+}
+
+type searchResp struct {
+	Hits  []*book        `json:"hits"`
+	Facet map[string]int `json:"facet,omitempty"`
+}
+
+func TestOpenAPI(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := openapi.NewRegistry("aphrodite", "1.0.0")
+	r := gin.New()
+	doc := NewDocRouter(r, registry)
+	doc.ServeSpec("")
+	api := doc.DocGroup("/api/v1")
+	(&Resource[book, bookListReq, bookKeyReq, bookCreateReq, bookUpdateReq]{
+		Factory: func(ctx context.Context) dependency.IRepository[book] { return &memRepo{books: map[int64]*book{}} },
+		Tags:    []string{"book"},
+	}).Register(api, "/books")
+	Handle(api, http.MethodGet, "/shelves/:shelf/search", func(ctx context.Context, req *searchReq) (*searchResp, exception.Exception) {
+		return &searchResp{}, nil
+	}, openapi.WithSummary("search books"), openapi.WithTags("search"))
+	// 非DocRouter注册的路由不记录
+	Handle(r, http.MethodGet, "/internal", func(ctx context.Context, req *searchReq) (int, exception.Exception) {
+		return 0, nil
+	})
+
+	convey.Convey("TestOpenAPI", t, func() {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, openapi.PATH, nil))
+		convey.So(w.Code, convey.ShouldEqual, http.StatusOK)
+		out := &bytes.Buffer{}
+		convey.So(json.Indent(out, w.Body.Bytes(), "", "  "), convey.ShouldBeNil)
+		out.WriteByte('\n')
+
+		golden := filepath.Join("testdata", "openapi.golden.json")
+		if *update {
+			_ = os.MkdirAll("testdata", 0o755)
+			convey.So(os.WriteFile(golden, out.Bytes(), 0o644), convey.ShouldBeNil)
+		}
+		expect, err := os.ReadFile(golden)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(out.String(), convey.ShouldEqual, string(expect))
+	})
+}
@@ -0,0 +1,107 @@
+package ginhandle
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/ginhandle/validate"
+	"github.com/illidaris/aphrodite/pkg/exception"
+)
+
+type RenderMode int32
+
+const (
+	RENDER_ENVELOPE RenderMode = iota // http 200，错误信息在dto.Response中
+	RENDER_STATUS                     // dto.Response，http状态码按错误码映射
+	RENDER_PROBLEM                    // 错误时输出RFC 7807 application/problem+json
+)
+
+const (
+	CONTENT_TYPE_PROBLEM = "application/problem+json"
+	PROBLEM_TYPE_BLANK   = "about:blank"
+)
+
+var (
+	renderMode      atomic.Int32
+	problemTypeBase atomic.Value // string
+)
+
+// SetRenderMode 设置GinOneHandler等通用处理的响应方式，默认RENDER_ENVELOPE
+func SetRenderMode(mode RenderMode) {
+	renderMode.Store(int32(mode))
+}
+
+// SetProblemTypeBase problem的type为base+小写reason，为空时使用about:blank
+func SetProblemTypeBase(base string) {
+	problemTypeBase.Store(base)
+}
+
+// Render 输出结果，ex不为空时按语言本地化消息并按模式选择状态码与格式
+func Render(c *gin.Context, data any, ex exception.Exception) {
+	if ex == nil {
+		c.JSON(http.StatusOK, dto.NewResponse(data, nil))
+		return
+	}
+	render(c, data, ex, nil)
+}
+
+// RenderAbort 中止请求并输出异常，errs为字段校验错误
+func RenderAbort(c *gin.Context, ex exception.Exception, errs []dto.FieldError) {
+	render(c, nil, ex, errs)
+	c.Abort()
+}
+
+func render(c *gin.Context, data any, ex exception.Exception, errs []dto.FieldError) {
+	l := exception.Localize(ex, validate.Lang(c.GetHeader("Accept-Language")))
+	if len(errs) > 0 {
+		l.Message = errs[0].Message
+	}
+	mode := RenderMode(renderMode.Load())
+	if mode == RENDER_PROBLEM {
+		typ := PROBLEM_TYPE_BLANK
+		if base, _ := problemTypeBase.Load().(string); base != "" {
+			typ = base + strings.ToLower(l.Reason)
+		}
+		c.Render(l.Status, problemRender{&dto.Problem{
+			Type:     typ,
+			Title:    l.Message,
+			Status:   l.Status,
+			Detail:   l.Detail,
+			Instance: c.Request.URL.Path,
+			Code:     l.Code,
+			SubCode:  l.SubCode,
+			Reason:   l.Reason,
+			Errors:   errs,
+		}})
+		return
+	}
+	status := http.StatusOK
+	if mode == RENDER_STATUS {
+		status = l.Status
+	}
+	resp := dto.NewResponse(data, ex)
+	resp.Message = l.Message
+	resp.Errors = errs
+	c.JSON(status, resp)
+}
+
+type problemRender struct {
+	problem *dto.Problem
+}
+
+func (r problemRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	return renderJSON(w, r.problem)
+}
+
+func (r problemRender) WriteContentType(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", CONTENT_TYPE_PROBLEM)
+}
+
+func renderJSON(w http.ResponseWriter, v any) error {
+	return json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,78 @@
+package ginhandle
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/exception"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestRenderMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/shops/:shop/orders", GinOneHandler(func(ctx context.Context, req *orderReq) (int64, exception.Exception) {
+		if req.ShopId == 2 {
+			return 0, exception.ERR_BUSI_NOFOUND.New("订单不存在")
+		}
+		return req.ShopId, nil
+	}))
+	do := func(shop, body, lang string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/shops/"+shop+"/orders", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept-Language", lang)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	defer SetRenderMode(RENDER_ENVELOPE)
+	defer SetProblemTypeBase("")
+	convey.Convey("TestRenderMode", t, func() {
+		convey.Convey("envelope", func() {
+			SetRenderMode(RENDER_ENVELOPE)
+			w := do("2", `{"mobile":"13800000000"}`, "")
+			convey.So(w.Code, convey.ShouldEqual, http.StatusOK)
+			resp := &dto.Response{}
+			_ = json.Unmarshal(w.Body.Bytes(), resp)
+			convey.So(resp.Code, convey.ShouldEqual, exception.ERR_BUSI_NOFOUND)
+			convey.So(resp.Message, convey.ShouldEqual, "订单不存在")
+		})
+		convey.Convey("status", func() {
+			SetRenderMode(RENDER_STATUS)
+			w := do("2", `{"mobile":"13800000000"}`, "en-US,en;q=0.9")
+			convey.So(w.Code, convey.ShouldEqual, http.StatusNotFound)
+			resp := &dto.Response{}
+			_ = json.Unmarshal(w.Body.Bytes(), resp)
+			convey.So(resp.Message, convey.ShouldEqual, "Not found")
+
+			w = do("7", `{"mobile":"13800000000"}`, "")
+			convey.So(w.Code, convey.ShouldEqual, http.StatusOK)
+		})
+		convey.Convey("problem", func() {
+			SetRenderMode(RENDER_PROBLEM)
+			SetProblemTypeBase("https://errors.example.com/")
+			w := do("0", `{"mobile":"123"}`, "en")
+			convey.So(w.Code, convey.ShouldEqual, http.StatusBadRequest)
+			convey.So(w.Header().Get("Content-Type"), convey.ShouldEqual, CONTENT_TYPE_PROBLEM)
+			p := &dto.Problem{}
+			_ = json.Unmarshal(w.Body.Bytes(), p)
+			convey.So(p.Status, convey.ShouldEqual, http.StatusBadRequest)
+			convey.So(p.Reason, convey.ShouldEqual, "BAD_PARAM")
+			convey.So(p.Type, convey.ShouldEqual, "https://errors.example.com/bad_param")
+			convey.So(p.Instance, convey.ShouldEqual, "/shops/0/orders")
+			convey.So(p.Errors, convey.ShouldHaveLength, 2)
+
+			w = do("2", `{"mobile":"13800000000"}`, "")
+			convey.So(w.Code, convey.ShouldEqual, http.StatusNotFound)
+			_ = json.Unmarshal(w.Body.Bytes(), p)
+			convey.So(p.Code, convey.ShouldEqual, exception.ERR_BUSI_NOFOUND)
+			convey.So(p.Title, convey.ShouldEqual, "订单不存在")
+		})
+	})
+}
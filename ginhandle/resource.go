@@ -0,0 +1,107 @@
+package ginhandle
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/illidaris/aphrodite/biz/authz"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/ginhandle/openapi"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+)
+
+/*
+Resource 资源路由，一次注册标准的增删改查路由
+
+	GET    path        列表，请求类型List
+	GET    path/:id    详情，请求类型Key
+	POST   path        创建，请求类型Create
+	POST   path/batch  批量创建，请求体为{"items":[Create...]}
+	PUT    path/:id    更新，请求类型Update
+	DELETE path/:id    删除，请求类型Key
+	Key与Update需绑定uri中的id并在GetConds中返回对应条件，
+	Create与Update的类型不是T时需设置WithMapping或WithCopyMapping。
+*/
+type Resource[T dependency.IEntity, List dependency.ICondPage, Key dependency.ICond, Create any, Update dependency.ICond] struct {
+	Factory RepoFactory[T]
+	List    []HandlerOption[List, T]
+	Detail  []HandlerOption[Key, T]
+	Create  []HandlerOption[Create, T] // 创建与批量创建共用
+	Update  []HandlerOption[Update, T]
+	Delete  []HandlerOption[Key, T]
+	Exclude []string // 不注册的路由，值为ROUTE_*
+	Tags    []string // 文档标签，g为DocRouter时记录文档
+	// Enforcer 不为空时按策略鉴权，资源为Name，为空时使用path
+	Enforcer *authz.Enforcer
+	Name     string
+}
+
+const (
+	ROUTE_LIST   = "list"
+	ROUTE_DETAIL = "detail"
+	ROUTE_CREATE = "create"
+	ROUTE_BATCH  = "batch"
+	ROUTE_UPDATE = "update"
+	ROUTE_DELETE = "delete"
+)
+
+// Register 在g下注册资源路由，Factory为空则使用gorm仓储
+func (r *Resource[T, List, Key, Create, Update]) Register(g gin.IRouter, path string) gin.IRouter {
+	factory := r.Factory
+	if factory == nil {
+		factory = GormRepo[T]()
+	}
+	var group gin.IRouter = g.Group(path)
+	if dr, ok := g.(*DocRouter); ok {
+		group = &DocRouter{IRouter: group, Registry: dr.Registry}
+	}
+	tags := openapi.WithTags(r.Tags...)
+	name := r.Name
+	if name == "" {
+		name = path
+	}
+	list := withPolicy(r.Enforcer, name, authz.ACTION_READ, r.List)
+	detail := withPolicy(r.Enforcer, name, authz.ACTION_READ, r.Detail)
+	create := withPolicy(r.Enforcer, name, authz.ACTION_CREATE, r.Create)
+	update := withPolicy(r.Enforcer, name, authz.ACTION_UPDATE, r.Update)
+	del := withPolicy(r.Enforcer, name, authz.ACTION_DELETE, r.Delete)
+	routes := []struct {
+		name   string
+		method string
+		path   string
+		handle func(*gin.Context)
+		doc    func(g gin.IRouter, method, path string, opts ...openapi.RouteOption)
+	}{
+		{ROUTE_LIST, http.MethodGet, "", ListHandlerFrom(factory, list...), Document[List, *dto.RecordPtrPager[T]]},
+		{ROUTE_DETAIL, http.MethodGet, "/:id", DetailHandlerFrom(factory, detail...), Document[Key, *T]},
+		{ROUTE_CREATE, http.MethodPost, "", CreateHandlerFrom(factory, create...), Document[Create, int64]},
+		{ROUTE_BATCH, http.MethodPost, "/batch", CreateBatchHandlerFrom(factory, create...), Document[BatchRequest[Create], int64]},
+		{ROUTE_UPDATE, http.MethodPut, "/:id", UpdateHandlerFrom(factory, update...), Document[Update, int64]},
+		{ROUTE_DELETE, http.MethodDelete, "/:id", DeleteHandlerFrom(factory, del...), Document[Key, int64]},
+	}
+	for _, route := range routes {
+		if r.excluded(route.name) {
+			continue
+		}
+		route.doc(group, route.method, route.path, tags)
+		group.Handle(route.method, route.path, route.handle)
+	}
+	return group
+}
+
+func (r *Resource[T, List, Key, Create, Update]) excluded(name string) bool {
+	for _, v := range r.Exclude {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// withPolicy 在路由钩子前加入策略判定，路由自带的WithPolicy可覆盖
+func withPolicy[Req any, T dependency.IEntity](e *authz.Enforcer, resource, action string, opts []HandlerOption[Req, T]) []HandlerOption[Req, T] {
+	if e == nil {
+		return opts
+	}
+	return append([]HandlerOption[Req, T]{WithPolicy[Req, T](e, resource, action)}, opts...)
+}
@@ -0,0 +1,228 @@
+package validate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/zh"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	enTrans "github.com/go-playground/validator/v10/translations/en"
+	zhTrans "github.com/go-playground/validator/v10/translations/zh"
+	"github.com/illidaris/aphrodite/dto"
+	"github.com/illidaris/aphrodite/pkg/check"
+)
+
+const (
+	LANG_ZH      = "zh"
+	LANG_EN      = "en"
+	DEFAULT_LANG = LANG_ZH
+)
+
+// IValidator 请求自定义校验，在binding标签校验通过后执行，可实现跨字段与条件规则
+type IValidator interface {
+	Validate(ctx context.Context) []dto.FieldError
+}
+
+var (
+	once     sync.Once
+	engine   *validator.Validate
+	uni      *ut.UniversalTranslator
+	setupErr error
+)
+
+// Engine gin使用的校验器，首次调用时注册字段名、翻译与内置规则
+func Engine() *validator.Validate {
+	once.Do(setup)
+	return engine
+}
+
+func setup() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		setupErr = errors.New("[validate]binding validator is not go-playground/validator")
+		engine = validator.New()
+		return
+	}
+	engine = v
+	engine.RegisterTagNameFunc(fieldName)
+	zhLocale, enLocale := zh.New(), en.New()
+	uni = ut.New(zhLocale, zhLocale, enLocale)
+	zhT, _ := uni.GetTranslator(LANG_ZH)
+	enT, _ := uni.GetTranslator(LANG_EN)
+	setupErr = errors.Join(
+		zhTrans.RegisterDefaultTranslations(engine, zhT),
+		enTrans.RegisterDefaultTranslations(engine, enT),
+	)
+	for _, rule := range builtinRules {
+		setupErr = errors.Join(setupErr, register(rule.tag, rule.fn, rule.messages))
+	}
+}
+
+// SetupError 初始化错误
+func SetupError() error {
+	once.Do(setup)
+	return setupErr
+}
+
+// fieldName 字段名依次取json、form、uri标签
+func fieldName(f reflect.StructField) string {
+	for _, key := range []string{"json", "form", "uri"} {
+		name, _, _ := strings.Cut(f.Tag.Get(key), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return f.Name
+}
+
+type rule struct {
+	tag      string
+	fn       validator.Func
+	messages map[string]string
+}
+
+func stringRule(f func(string) bool) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		return f(fl.Field().String())
+	}
+}
+
+var builtinRules = []rule{
+	{"mobile", stringRule(check.IsValidChineseMobile), map[string]string{LANG_ZH: "{0}必须是有效的手机号", LANG_EN: "{0} must be a valid mobile number"}},
+	{"idcard", stringRule(check.IsValidIDCard18), map[string]string{LANG_ZH: "{0}必须是有效的身份证号", LANG_EN: "{0} must be a valid ID card number"}},
+	{"mail", stringRule(check.IsValidEmail), map[string]string{LANG_ZH: "{0}必须是有效的邮箱", LANG_EN: "{0} must be a valid email address"}},
+}
+
+// RegisterValidation 注册自定义规则，messages按语言提供提示，{0}为字段名，{1}为规则参数
+func RegisterValidation(tag string, fn validator.Func, messages map[string]string) error {
+	Engine()
+	return register(tag, fn, messages)
+}
+
+func register(tag string, fn validator.Func, messages map[string]string) error {
+	if err := engine.RegisterValidation(tag, fn); err != nil {
+		return err
+	}
+	return registerMessage(tag, messages)
+}
+
+// RegisterMessage 注册规则的提示，也可用于结构体规则上报的tag
+func RegisterMessage(tag string, messages map[string]string) error {
+	Engine()
+	return registerMessage(tag, messages)
+}
+
+func registerMessage(tag string, messages map[string]string) error {
+	if uni == nil {
+		return setupErr
+	}
+	for lang, msg := range messages {
+		trans, found := uni.GetTranslator(lang)
+		if !found {
+			continue
+		}
+		err := engine.RegisterTranslation(tag, trans, func(t ut.Translator) error {
+			return t.Add(tag, msg, true)
+		}, func(t ut.Translator, fe validator.FieldError) string {
+			s, _ := t.T(tag, fe.Field(), fe.Param())
+			return s
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterStructRule 注册结构体规则，用于跨字段与条件校验，report的field为json字段名
+func RegisterStructRule[T any](fn func(t *T, report func(field, tag, param string))) {
+	Engine().RegisterStructValidation(func(sl validator.StructLevel) {
+		t, ok := sl.Current().Interface().(T)
+		if !ok {
+			return
+		}
+		fn(&t, func(field, tag, param string) {
+			sl.ReportError(nil, field, field, tag, param)
+		})
+	}, *new(T))
+}
+
+// Lang 由Accept-Language选择语言，默认中文
+func Lang(acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+		switch {
+		case strings.HasPrefix(tag, LANG_ZH):
+			return LANG_ZH
+		case strings.HasPrefix(tag, LANG_EN):
+			return LANG_EN
+		}
+	}
+	return DEFAULT_LANG
+}
+
+// FieldErrors 将校验错误转换为字段错误列表，err不是校验错误时返回false
+func FieldErrors(err error, lang string) ([]dto.FieldError, bool) {
+	Engine()
+	var (
+		verrs  validator.ValidationErrors
+		serrs  binding.SliceValidationError
+		result []dto.FieldError
+	)
+	switch {
+	case errors.As(err, &verrs):
+		trans := translator(lang)
+		for _, fe := range verrs {
+			result = append(result, fieldError(fe, trans, lang))
+		}
+		return result, true
+	case errors.As(err, &serrs):
+		for i, e := range serrs {
+			items, ok := FieldErrors(e, lang)
+			if !ok {
+				return nil, false
+			}
+			for _, item := range items {
+				item.Field = fmt.Sprintf("[%d].%s", i, item.Field)
+				result = append(result, item)
+			}
+		}
+		return result, true
+	}
+	return nil, false
+}
+
+func translator(lang string) ut.Translator {
+	if uni == nil {
+		return nil
+	}
+	trans, _ := uni.GetTranslator(lang)
+	return trans
+}
+
+func fieldError(fe validator.FieldError, trans ut.Translator, lang string) dto.FieldError {
+	field := fe.Namespace()
+	// 去掉根结构体名称
+	if i := strings.Index(field, "."); i >= 0 {
+		field = field[i+1:]
+	}
+	msg := ""
+	if trans != nil {
+		msg = fe.Translate(trans)
+	}
+	if msg == "" || msg == fe.Error() {
+		if lang == LANG_EN {
+			msg = fmt.Sprintf("%s failed on the '%s' rule", fe.Field(), fe.Tag())
+		} else {
+			msg = fmt.Sprintf("%s未通过%s校验", fe.Field(), fe.Tag())
+		}
+	}
+	return dto.FieldError{Field: field, Rule: fe.Tag(), Param: fe.Param(), Message: msg}
+}
@@ -0,0 +1,78 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type contact struct {
+	Kind  string `json:"kind" binding:"required,oneof=mobile mail"`
+	Value string `json:"value" binding:"required"`
+}
+
+type signup struct {
+	Name     string     `json:"name" binding:"required,max=8"`
+	Mobile   string     `json:"mobile" binding:"omitempty,mobile"`
+	IDCard   string     `json:"idCard" binding:"omitempty,idcard"`
+	Password string     `json:"password" binding:"required"`
+	Confirm  string     `json:"confirm" binding:"eqfield=Password"`
+	Company  bool       `json:"company"`
+	TaxNo    string     `json:"taxNo" binding:"required_if=Company true"`
+	Contacts []*contact `json:"contacts" binding:"dive"`
+}
+
+func TestValidate(t *testing.T) {
+	if err := SetupError(); err != nil {
+		t.Fatal(err)
+	}
+	RegisterStructRule(func(c *contact, report func(field, tag, param string)) {
+		if c.Kind == "mobile" && len(c.Value) != 11 {
+			report("value", "mobile", "")
+		}
+	})
+	convey.Convey("TestValidate", t, func() {
+		convey.So(Lang("en-US,en;q=0.9"), convey.ShouldEqual, LANG_EN)
+		convey.So(Lang("zh-CN"), convey.ShouldEqual, LANG_ZH)
+		convey.So(Lang(""), convey.ShouldEqual, LANG_ZH)
+
+		ok := &signup{Name: "a", Mobile: "13800000000", IDCard: "11010519491231002X", Password: "p", Confirm: "p"}
+		convey.So(binding.Validator.ValidateStruct(ok), convey.ShouldBeNil)
+
+		bad := &signup{
+			Name:     "too long name",
+			Mobile:   "12345",
+			IDCard:   "110101199003074478",
+			Password: "p",
+			Confirm:  "q",
+			Company:  true,
+			Contacts: []*contact{{Kind: "fax", Value: "1"}, {Kind: "mobile", Value: "1"}},
+		}
+		errs, matched := FieldErrors(binding.Validator.ValidateStruct(bad), LANG_ZH)
+		convey.So(matched, convey.ShouldBeTrue)
+		fields := map[string]string{}
+		for _, e := range errs {
+			fields[e.Field] = e.Rule
+		}
+		convey.So(fields, convey.ShouldResemble, map[string]string{
+			"name":              "max",
+			"mobile":            "mobile",
+			"idCard":            "idcard",
+			"confirm":           "eqfield",
+			"taxNo":             "required_if",
+			"contacts[0].kind":  "oneof",
+			"contacts[1].value": "mobile",
+		})
+		for _, e := range errs {
+			if e.Field == "mobile" {
+				convey.So(e.Message, convey.ShouldEqual, "mobile必须是有效的手机号")
+			}
+		}
+		errs, _ = FieldErrors(binding.Validator.ValidateStruct(&signup{Password: "p", Confirm: "p"}), LANG_EN)
+		convey.So(errs[0].Message, convey.ShouldEqual, "name is a required field")
+
+		_, matched = FieldErrors(binding.SliceValidationError{binding.Validator.ValidateStruct(bad)}, LANG_ZH)
+		convey.So(matched, convey.ShouldBeTrue)
+	})
+}
@@ -0,0 +1,32 @@
+package check
+
+import (
+	"regexp"
+	"time"
+)
+
+var (
+	idCard18Regexp  = regexp.MustCompile(`^\d{17}[\dXx]$`)
+	idCard18Weights = []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	idCard18Codes   = "10X98765432"
+)
+
+// IsValidIDCard18 验证18位居民身份证号，校验出生日期与末位校验码
+func IsValidIDCard18(idCard string) bool {
+	if !idCard18Regexp.MatchString(idCard) {
+		return false
+	}
+	birth, err := time.Parse("20060102", idCard[6:14])
+	if err != nil || birth.Year() < 1900 || birth.After(time.Now()) {
+		return false
+	}
+	sum := 0
+	for i, w := range idCard18Weights {
+		sum += int(idCard[i]-'0') * w
+	}
+	last := idCard[17]
+	if last == 'x' {
+		last = 'X'
+	}
+	return idCard18Codes[sum%11] == last
+}
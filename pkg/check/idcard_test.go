@@ -0,0 +1,30 @@
+package check
+
+import "testing"
+
+// TestIsValidIDCard18 测试18位身份证号验证函数
+func TestIsValidIDCard18(t *testing.T) {
+	tests := []struct {
+		name   string // 测试用例名称
+		idCard string // 输入身份证号
+		want   bool   // 期望结果
+	}{
+		{"valid", "11010519491231002X", true},
+		{"valid_lower_x", "11010519491231002x", true},
+		{"too_old", "440524188001010014", false}, // 出生年份早于1900
+		{"valid_digit", "110101199003074477", true},
+		{"bad_checksum", "110101199003074478", false},
+		{"bad_date", "110101199002304471", false},
+		{"future_date", "110101299003074477", false},
+		{"too_short", "11010119900307447", false},
+		{"letters", "11010119900307447A", false},
+		{"empty_string", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsValidIDCard18(tt.idCard); got != tt.want {
+				t.Errorf("IsValidIDCard18(%q) = %v, want %v", tt.idCard, got, tt.want)
+			}
+		})
+	}
+}
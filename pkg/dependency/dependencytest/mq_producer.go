@@ -0,0 +1,169 @@
+// Package dependencytest provides contract suites shared by the implementations of dependency interfaces.
+package dependencytest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func newContractMessage(name string, expire int64) *po.MqMessage {
+	m := &po.MqMessage{}
+	m.BizId = 1
+	m.Category = 7
+	m.Name = name
+	m.Key = "k"
+	m.Args = `{"name":"` + name + `"}`
+	m.Expire = expire
+	return m
+}
+
+// execResultReporter ReportExecResult of the task queues, e.g. taskworker.ITaskQueue
+type execResultReporter interface {
+	ReportExecResult(ctx context.Context, id int64, locker string, execResult string, execErr error) (int64, error)
+}
+
+// MQProducerRepositorySuite contract of dependency.IMQProducerRepository, every impl should pass it.
+// The repo must use the default database, tasks are isolated by a random name.
+// ReportExecResult is verified when the repo implements it.
+func MQProducerRepositorySuite(t *testing.T, repo dependency.IMQProducerRepository[po.MqMessage]) {
+	var (
+		ctx      = context.Background()
+		name     = "contract-" + uuid.NewString()[:8]
+		now      = time.Now().Unix()
+		template = po.MqMessage{}
+	)
+	template.BizId = 1
+	template.Category = 7
+	template.Name = name
+	template.Timeout = 60
+
+	convey.Convey("MQProducerRepositorySuite", t, func() {
+		dues := []*po.MqMessage{
+			newContractMessage(name, now-30),
+			newContractMessage(name, now-20),
+			newContractMessage(name, now-10),
+		}
+		future := newContractMessage(name, now+3600)
+		other := newContractMessage(name+"-o", now-30)
+		all := append([]*po.MqMessage{future, other}, dues...)
+		defer func() {
+			for _, m := range all {
+				_, _ = repo.BaseDelete(ctx, m)
+			}
+		}()
+
+		convey.Convey("InsertAction", func() {
+			for _, m := range all {
+				convey.So(repo.InsertAction(ctx, "", m)(ctx), convey.ShouldBeNil)
+				convey.So(m.Id, convey.ShouldNotEqual, 0)
+			}
+
+			locker, affect, err := repo.WaitExecWithLock(ctx, template, 2)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(locker, convey.ShouldNotBeEmpty)
+			convey.So(affect, convey.ShouldEqual, 2)
+
+			lockeds, err := repo.FindLockeds(ctx, locker)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(len(lockeds), convey.ShouldEqual, 2)
+			for _, v := range lockeds {
+				convey.So(v.Locker, convey.ShouldEqual, locker)
+				convey.So(v.Retries, convey.ShouldEqual, 1)
+				convey.So(v.Expire, convey.ShouldBeGreaterThan, now)
+				convey.So(v.GetTopic(), convey.ShouldEqual, name)
+				convey.So(string(v.GetValue()), convey.ShouldEqual, `{"name":"`+name+`"}`)
+			}
+
+			convey.Convey("WaitExecWithLock skip locked and future tasks", func() {
+				locker2, affect, err := repo.WaitExecWithLock(ctx, template, 10)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(affect, convey.ShouldEqual, 1)
+				lockeds2, err := repo.FindLockeds(ctx, locker2)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(len(lockeds2), convey.ShouldEqual, 1)
+				convey.So(lockeds2[0].Locker, convey.ShouldEqual, locker2)
+
+				_, affect, err = repo.WaitExecWithLock(ctx, template, 10)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(affect, convey.ShouldEqual, 0)
+			})
+
+			convey.Convey("BaseUpdate keep lock", func() {
+				update := &po.MqMessage{}
+				update.Id = lockeds[0].Id
+				update.BizId = lockeds[0].BizId
+				update.LastError = "contract error"
+				update.LastExecAt = now
+				affect, err := repo.BaseUpdate(ctx, update)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(affect, convey.ShouldEqual, 1)
+
+				lockeds2, err := repo.FindLockeds(ctx, locker)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(len(lockeds2), convey.ShouldEqual, 2)
+				for _, v := range lockeds2 {
+					if v.Id == update.Id {
+						convey.So(v.LastError, convey.ShouldEqual, "contract error")
+						convey.So(v.LastExecAt, convey.ShouldEqual, now)
+						convey.So(v.Retries, convey.ShouldEqual, 1)
+					}
+				}
+			})
+
+			reporter, ok := repo.(execResultReporter)
+			convey.Convey("ReportExecResult", func() {
+				if !ok {
+					convey.SkipSo("repo does not implement ReportExecResult")
+					return
+				}
+				failed, succeeded := int64(lockeds[0].Id), int64(lockeds[1].Id)
+				affect, err := reporter.ReportExecResult(ctx, failed, "", "", nil)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(affect, convey.ShouldEqual, 0)
+				affect, err = reporter.ReportExecResult(ctx, failed, uuid.NewString(), "", errors.New("other locker"))
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(affect, convey.ShouldEqual, 0)
+
+				affect, err = reporter.ReportExecResult(ctx, failed, locker, "", errors.New("contract failed"))
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(affect, convey.ShouldEqual, 1)
+				affect, err = reporter.ReportExecResult(ctx, succeeded, locker, "ok", nil)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(affect, convey.ShouldEqual, 1)
+				affect, err = reporter.ReportExecResult(ctx, succeeded, locker, "ok", nil)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(affect, convey.ShouldEqual, 0)
+
+				// the failed task keeps the lock until expire, the succeeded task is removed
+				lockeds2, err := repo.FindLockeds(ctx, locker)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(len(lockeds2), convey.ShouldEqual, 1)
+				convey.So(int64(lockeds2[0].Id), convey.ShouldEqual, failed)
+				convey.So(lockeds2[0].LastError, convey.ShouldEqual, "contract failed")
+				convey.So(lockeds2[0].LastExecAt, convey.ShouldBeGreaterThanOrEqualTo, now)
+
+				_, affect, err = repo.WaitExecWithLock(ctx, template, 10)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(affect, convey.ShouldEqual, 1)
+			})
+
+			convey.Convey("BaseDelete", func() {
+				for _, v := range lockeds {
+					affect, err := repo.BaseDelete(ctx, &v)
+					convey.So(err, convey.ShouldBeNil)
+					convey.So(affect, convey.ShouldEqual, 1)
+				}
+				lockeds2, err := repo.FindLockeds(ctx, locker)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(len(lockeds2), convey.ShouldEqual, 0)
+			})
+		})
+	})
+}
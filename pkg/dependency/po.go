@@ -72,3 +72,8 @@ Create a new index.
 type IMapping interface {
 	GetMapping() string
 }
+
+// IVersion version of the entity, the larger is the newer, such as the update time in milliseconds
+type IVersion interface {
+	GetVersion() int64
+}
@@ -2,7 +2,10 @@ package dependency
 
 import (
 	"context"
+	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 )
 
 const (
@@ -42,6 +45,7 @@ type BaseOption struct {
 	UpdatedMap     map[string]any                `json:"-"`             // updated map
 	IDGenerate     func(ctx context.Context) any `json:"-"`             // id generate func
 	IterativeFuncs []func(any)                   `json:"-"`             // iterative func
+	Tenant         *TenantScope                  `json:"-"`             // tenant scope, set by ApplyTenant
 }
 
 // GetDataBase
@@ -117,6 +121,60 @@ func WithConds(vs ...any) BaseOptionFunc {
 	}
 }
 
+// WithAndConds and with exist conds, for row level filters
+func WithAndConds(vs ...any) BaseOptionFunc {
+	return func(o *BaseOption) {
+		o.Conds = AndConds(o.Conds, vs)
+	}
+}
+
+// ISQLConds repositories accept gorm style string conds, the row filters of AndConds can only be
+// injected into them, other repositories (mongo, es) would ignore the string conds and match all rows
+type ISQLConds interface {
+	SQLConds() bool
+}
+
+// AndConds combine two gorm style conds (query string or map[string]any with args) by AND,
+// fail closed with "1 = 0" when the conds can not be combined
+func AndConds(a, b []any) []any {
+	if len(a) == 0 {
+		return b
+	}
+	if len(b) == 0 {
+		return a
+	}
+	qa, argsA, okA := condString(a)
+	qb, argsB, okB := condString(b)
+	if !okA || !okB {
+		return []any{"1 = 0"}
+	}
+	return append([]any{fmt.Sprintf("(%s) AND (%s)", qa, qb)}, append(argsA, argsB...)...)
+}
+
+func condString(conds []any) (string, []any, bool) {
+	switch q := conds[0].(type) {
+	case string:
+		return q, append([]any{}, conds[1:]...), true
+	case map[string]any:
+		keys := make([]string, 0, len(q))
+		for k := range q {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		items := make([]string, 0, len(keys))
+		args := make([]any, 0, len(keys))
+		for _, k := range keys {
+			items = append(items, fmt.Sprintf("`%s` = ?", k))
+			args = append(args, q[k])
+		}
+		if len(items) == 0 {
+			return "1 = 1", nil, true
+		}
+		return strings.Join(items, " AND "), args, true
+	}
+	return "", nil, false
+}
+
 // WithPage
 func WithPage(v IPage) BaseOptionFunc {
 	return func(o *BaseOption) {
@@ -0,0 +1,190 @@
+package dependency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	iLog "github.com/illidaris/logger"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+)
+
+// 租户操作
+const (
+	TENANT_OP_CREATE = "create"
+	TENANT_OP_QUERY  = "query"
+	TENANT_OP_UPDATE = "update"
+	TENANT_OP_DELETE = "delete"
+	TENANT_OP_RAW    = "raw" // 仓储BuildFrmOptions等自定义操作
+)
+
+var (
+	ErrTenantRequired = errors.New("[tenant]bizId is required in context")
+	ErrTenantMismatch = errors.New("[tenant]entity bizId mismatch context")
+)
+
+// ITenant 多租户实体，嵌入BizSection即实现，TenantColumn返回空时不隔离
+type ITenant interface {
+	TenantColumn() string
+	GetTenant() int64
+	SetTenant(bizId int64)
+}
+
+// TenantScope 本次操作的租户范围，由各仓储转换为对应的查询条件
+type TenantScope struct {
+	Column string
+	BizId  int64
+}
+
+// TenantAudit 跨租户访问审计
+type TenantAudit struct {
+	Table  string
+	Op     string
+	BizId  int64 // 上下文中的BizId，可能为0
+	Reason string
+}
+
+var (
+	tenancy        atomic.Bool
+	tenantSharding atomic.Bool
+	tenantAuditor  atomic.Value // func(context.Context, TenantAudit)
+	tenantDbFunc   atomic.Value // func(any) string
+	tenantTbFunc   atomic.Value // func(string, any) string
+	defaultAuditor = func(ctx context.Context, a TenantAudit) {
+		iLog.WarnCtx(ctx, "[tenant]cross tenant access", zap.String("op", a.Op), zap.String("table", a.Table), zap.Int64("bizId", a.BizId), zap.String("reason", a.Reason))
+	}
+)
+
+// EnableTenancy 开启多租户隔离，ITenant实体的增删改查按上下文BizId限定
+func EnableTenancy(v bool) {
+	tenancy.Store(v)
+}
+
+func TenancyEnabled() bool {
+	return tenancy.Load()
+}
+
+// EnableTenantSharding 按租户分库分表，未指定分库分表键时以BizId作为键，配合SetTenantDatabase与TenantTable使用
+func EnableTenantSharding(v bool) {
+	tenantSharding.Store(v)
+}
+
+func TenantShardingEnabled() bool {
+	return tenantSharding.Load()
+}
+
+// SetTenantAuditor 设置跨租户访问的审计，默认输出告警日志
+func SetTenantAuditor(f func(ctx context.Context, a TenantAudit)) {
+	tenantAuditor.Store(f)
+}
+
+type crossTenantKey struct{}
+
+// WithCrossTenant 显式跨租户访问，reason必填，每次访问都会审计
+func WithCrossTenant(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, crossTenantKey{}, reason)
+}
+
+func crossTenant(ctx context.Context) (string, bool) {
+	reason, ok := ctx.Value(crossTenantKey{}).(string)
+	return reason, ok && reason != ""
+}
+
+/*
+ApplyTenant 解析租户范围并写入opt.Tenant，t为实体或nil
+
+	未开启或非ITenant实体时不处理；跨租户上下文审计后放行；
+	开启EnableTenantSharding且未指定分库分表键时以BizId作为键。
+*/
+func ApplyTenant[T any](ctx context.Context, t *T, opt *BaseOption, op string) error {
+	if !TenancyEnabled() {
+		return nil
+	}
+	if t == nil {
+		t = new(T)
+	}
+	tenant, ok := any(t).(ITenant)
+	if !ok || tenant.TenantColumn() == "" {
+		return nil
+	}
+	bizId := contextex.GetBizId(ctx)
+	if reason, ok := crossTenant(ctx); ok {
+		auditor, _ := tenantAuditor.Load().(func(context.Context, TenantAudit))
+		if auditor == nil {
+			auditor = defaultAuditor
+		}
+		table := ""
+		if po, ok := any(t).(IPo); ok {
+			table = po.TableName()
+		}
+		auditor(ctx, TenantAudit{Table: table, Op: op, BizId: bizId, Reason: reason})
+		return nil
+	}
+	if bizId == 0 {
+		return ErrTenantRequired
+	}
+	if v, ok := opt.UpdatedMap[tenant.TenantColumn()]; ok && cast.ToInt64(v) != bizId {
+		return ErrTenantMismatch
+	}
+	opt.Tenant = &TenantScope{Column: tenant.TenantColumn(), BizId: bizId}
+	if !TenantShardingEnabled() {
+		return nil
+	}
+	if len(opt.DbShardingKey) == 0 {
+		opt.DbShardingKey = []any{bizId}
+	}
+	if _, ok := any(t).(ITableSharding); ok && len(opt.TbShardingKey) == 0 {
+		opt.TbShardingKey = []any{bizId}
+	}
+	return nil
+}
+
+// StampTenant 写入前校验并填充实体的BizId，scope为空时不处理
+func StampTenant[T any](scope *TenantScope, ps ...*T) error {
+	if scope == nil {
+		return nil
+	}
+	for _, p := range ps {
+		tenant, ok := any(p).(ITenant)
+		if !ok {
+			continue
+		}
+		switch tenant.GetTenant() {
+		case 0:
+			tenant.SetTenant(scope.BizId)
+		case scope.BizId:
+		default:
+			return ErrTenantMismatch
+		}
+	}
+	return nil
+}
+
+// SetTenantDatabase 设置租户到数据库的映射，默认为BizId本身
+func SetTenantDatabase(f func(bizId any) string) {
+	tenantDbFunc.Store(f)
+}
+
+// TenantDatabase 租户对应的数据库，供IDbSharding实现使用
+func TenantDatabase(bizId any) string {
+	if f, ok := tenantDbFunc.Load().(func(any) string); ok && f != nil {
+		return f(bizId)
+	}
+	return cast.ToString(bizId)
+}
+
+// SetTenantTable 设置租户到表的映射，默认为table_BizId
+func SetTenantTable(f func(table string, bizId any) string) {
+	tenantTbFunc.Store(f)
+}
+
+// TenantTable 租户对应的表，供ITableSharding实现使用
+func TenantTable(table string, bizId any) string {
+	if f, ok := tenantTbFunc.Load().(func(string, any) string); ok && f != nil {
+		return f(table, bizId)
+	}
+	return fmt.Sprintf("%s_%v", table, bizId)
+}
@@ -0,0 +1,203 @@
+package encrypter
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"github.com/tjfoc/gmsm/sm4"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+/*
+密文格式
+	单块: magic(3) | version(1) | algorithm(1) | nonce | ciphertext+tag
+	分块: magic(3) | version(1) | algorithm(1) | chunkSize(4) | noncePrefix | chunk...
+无magic的数据视为旧版CFB/CTR密文，需WithLegacy显式开启，仅用于解密与迁移。
+*/
+
+// Algorithm AEAD算法
+type Algorithm byte
+
+const (
+	ALG_AES_GCM           Algorithm = 1 // 密钥16/24/32字节
+	ALG_CHACHA20_POLY1305 Algorithm = 2 // 密钥32字节
+	ALG_SM4_GCM           Algorithm = 3 // 密钥16字节
+
+	VERSION_SEAL   byte = 1 // 单块
+	VERSION_STREAM byte = 2 // 分块流
+
+	HEADER_SIZE        = 5
+	DEFAULT_CHUNK_SIZE = 64 * 1024
+	MAX_CHUNK_SIZE     = 16 * 1024 * 1024
+)
+
+var (
+	headerMagic = []byte{0xA7, 'a', 'e'}
+
+	ErrUnknownAlgorithm = errors.New("unknown aead algorithm")
+	ErrInvalidHeader    = errors.New("invalid aead header")
+	ErrAuthFailed       = errors.New("message authentication failed")
+	ErrLegacyDisabled   = errors.New("legacy ciphertext is disabled")
+	ErrTruncated        = errors.New("aead stream is truncated")
+)
+
+type aeadOptions struct {
+	Algorithm Algorithm
+	ChunkSize int
+	Legacy    []Option // 旧版密文的解密选项，为空时拒绝旧版密文
+}
+
+type AEADOption func(*aeadOptions)
+
+func newAEADOptions(opts ...AEADOption) *aeadOptions {
+	o := &aeadOptions{
+		Algorithm: ALG_AES_GCM,
+		ChunkSize: DEFAULT_CHUNK_SIZE,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithAlgorithm 加密算法，解密时以密文头为准
+func WithAlgorithm(v Algorithm) AEADOption {
+	return func(o *aeadOptions) {
+		o.Algorithm = v
+	}
+}
+
+// WithChunkSize 分块流每块明文的尺寸
+func WithChunkSize(v int) AEADOption {
+	return func(o *aeadOptions) {
+		o.ChunkSize = v
+	}
+}
+
+// WithLegacy 旧版密文的解密选项，默认禁用旧版密文，仅在迁移时显式开启，
+// 例如DataEncrypt旧版的CTR需传入WithLegacy(WithEncrypter(cipher.NewCTR), WithDecrypter(cipher.NewCTR))
+func WithLegacy(opts ...Option) AEADOption {
+	return func(o *aeadOptions) {
+		o.Legacy = opts
+	}
+}
+
+// NewAEAD 创建算法对应的AEAD
+func NewAEAD(alg Algorithm, key []byte) (cipher.AEAD, error) {
+	switch alg {
+	case ALG_AES_GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case ALG_CHACHA20_POLY1305:
+		return chacha20poly1305.New(key)
+	case ALG_SM4_GCM:
+		block, err := sm4.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	}
+	return nil, ErrUnknownAlgorithm
+}
+
+func header(version byte, alg Algorithm) []byte {
+	return append(append([]byte{}, headerMagic...), version, byte(alg))
+}
+
+// parseHeader 解析密文头，ok为false表示旧版密文
+func parseHeader(data []byte) (version byte, alg Algorithm, ok bool) {
+	if len(data) < HEADER_SIZE || !bytes.Equal(data[:len(headerMagic)], headerMagic) {
+		return 0, 0, false
+	}
+	version, alg = data[3], Algorithm(data[4])
+	if version != VERSION_SEAL && version != VERSION_STREAM || alg < ALG_AES_GCM || alg > ALG_SM4_GCM {
+		return 0, 0, false
+	}
+	return version, alg, true
+}
+
+// IsLegacy 无版本头的旧版CFB/CTR密文，需要迁移
+func IsLegacy(data []byte) bool {
+	_, _, ok := parseHeader(data)
+	return !ok
+}
+
+// additional 密文头与关联数据均被认证
+func additional(h, aad []byte) []byte {
+	return append(append(make([]byte, 0, len(h)+len(aad)), h...), aad...)
+}
+
+// Seal 认证加密，aad为关联数据，例如租户或记录id，解密时必须一致
+func Seal(plain, key, aad []byte, opts ...AEADOption) ([]byte, error) {
+	o := newAEADOptions(opts...)
+	aead, err := NewAEAD(o.Algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+	h := header(VERSION_SEAL, o.Algorithm)
+	out := make([]byte, HEADER_SIZE+aead.NonceSize(), HEADER_SIZE+aead.NonceSize()+len(plain)+aead.Overhead())
+	copy(out, h)
+	nonce := out[HEADER_SIZE:]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, plain, additional(h, aad)), nil
+}
+
+// Open 认证解密，旧版密文按WithLegacy解密且不校验完整性
+func Open(data, key, aad []byte, opts ...AEADOption) ([]byte, error) {
+	o := newAEADOptions(opts...)
+	version, alg, ok := parseHeader(data)
+	if !ok {
+		return openLegacy(data, key, o)
+	}
+	if version == VERSION_STREAM {
+		out := &bytes.Buffer{}
+		err := OpenStream(bytes.NewReader(data), out, key, aad, opts...)
+		return out.Bytes(), err
+	}
+	aead, err := NewAEAD(alg, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < HEADER_SIZE+aead.NonceSize()+aead.Overhead() {
+		return nil, ErrInvalidHeader
+	}
+	nonce := data[HEADER_SIZE : HEADER_SIZE+aead.NonceSize()]
+	plain, err := aead.Open(nil, nonce, data[HEADER_SIZE+aead.NonceSize():], additional(data[:HEADER_SIZE], aad))
+	if err != nil {
+		return nil, ErrAuthFailed
+	}
+	return plain, nil
+}
+
+func openLegacy(data, key []byte, o *aeadOptions) ([]byte, error) {
+	if len(o.Legacy) == 0 {
+		return nil, ErrLegacyDisabled
+	}
+	out := &bytes.Buffer{}
+	if err := DecryptStream(bytes.NewReader(data), out, key, o.Legacy...); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// Migrate 旧版密文重新认证加密，已是新版的密文原样返回
+func Migrate(data, key, aad []byte, opts ...AEADOption) ([]byte, bool, error) {
+	if !IsLegacy(data) {
+		return data, false, nil
+	}
+	plain, err := Open(data, key, aad, opts...)
+	if err != nil {
+		return nil, false, err
+	}
+	res, err := Seal(plain, key, aad, opts...)
+	return res, err == nil, err
+}
@@ -0,0 +1,154 @@
+package encrypter
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// streamNonce nonce of the chunk, noncePrefix | counter(4) | last(1)
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, len(prefix)+5)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[len(prefix):], counter)
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// SealStream 分块认证加密，块序号与末块标记参与nonce，可检测块的重排与截断
+func SealStream(in io.Reader, out io.Writer, key, aad []byte, opts ...AEADOption) error {
+	o := newAEADOptions(opts...)
+	if o.ChunkSize <= 0 || o.ChunkSize > MAX_CHUNK_SIZE {
+		return errors.New("invalid chunk size")
+	}
+	aead, err := NewAEAD(o.Algorithm, key)
+	if err != nil {
+		return err
+	}
+	h := header(VERSION_STREAM, o.Algorithm)
+	h = binary.BigEndian.AppendUint32(h, uint32(o.ChunkSize))
+	prefix := make([]byte, aead.NonceSize()-5)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return err
+	}
+	h = append(h, prefix...)
+	if _, err := out.Write(h); err != nil {
+		return err
+	}
+	var (
+		ad      = additional(h, aad)
+		reader  = bufio.NewReader(in)
+		buf     = make([]byte, o.ChunkSize)
+		sealed  = make([]byte, 0, o.ChunkSize+aead.Overhead())
+		counter uint32
+	)
+	for {
+		n, err := io.ReadFull(reader, buf)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		if !last {
+			if _, err := reader.Peek(1); err == io.EOF {
+				last = true
+			}
+		}
+		sealed = aead.Seal(sealed[:0], streamNonce(prefix, counter, last), buf[:n], ad)
+		if _, err := out.Write(sealed); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		if counter == math.MaxUint32 {
+			return errors.New("aead stream is too large")
+		}
+		counter++
+	}
+}
+
+// OpenStream 分块认证解密，无版本头的旧版密文按WithLegacy解密
+func OpenStream(in io.Reader, out io.Writer, key, aad []byte, opts ...AEADOption) error {
+	o := newAEADOptions(opts...)
+	h := make([]byte, HEADER_SIZE)
+	n, err := io.ReadFull(in, h)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	version, alg, ok := parseHeader(h[:n])
+	if !ok {
+		if len(o.Legacy) == 0 {
+			return ErrLegacyDisabled
+		}
+		return DecryptStream(io.MultiReader(bytes.NewReader(h[:n]), in), out, key, o.Legacy...)
+	}
+	if version == VERSION_SEAL {
+		data, err := io.ReadAll(in)
+		if err != nil {
+			return err
+		}
+		plain, err := Open(append(h, data...), key, aad, opts...)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(plain)
+		return err
+	}
+	aead, err := NewAEAD(alg, key)
+	if err != nil {
+		return err
+	}
+	rest := make([]byte, 4+aead.NonceSize()-5)
+	if _, err := io.ReadFull(in, rest); err != nil {
+		return ErrInvalidHeader
+	}
+	chunkSize := int(binary.BigEndian.Uint32(rest))
+	if chunkSize <= 0 || chunkSize > MAX_CHUNK_SIZE {
+		return ErrInvalidHeader
+	}
+	h = append(h, rest...)
+	var (
+		prefix  = rest[4:]
+		ad      = additional(h, aad)
+		reader  = bufio.NewReader(in)
+		buf     = make([]byte, chunkSize+aead.Overhead())
+		plain   = make([]byte, 0, chunkSize)
+		counter uint32
+	)
+	for {
+		n, err := io.ReadFull(reader, buf)
+		if err == io.EOF {
+			// 末块至少包含tag
+			return ErrTruncated
+		}
+		last := err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		if !last {
+			if _, err := reader.Peek(1); err == io.EOF {
+				last = true
+			}
+		}
+		plain, err = aead.Open(plain[:0], streamNonce(prefix, counter, last), buf[:n], ad)
+		if err != nil {
+			return ErrAuthFailed
+		}
+		if _, err := out.Write(plain); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		if counter == math.MaxUint32 {
+			return ErrTruncated
+		}
+		counter++
+	}
+}
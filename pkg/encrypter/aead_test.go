@@ -0,0 +1,135 @@
+package encrypter
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"testing"
+
+	"github.com/tjfoc/gmsm/sm3"
+)
+
+func aeadKey(alg Algorithm) []byte {
+	if alg == ALG_CHACHA20_POLY1305 {
+		return []byte("0123456789abcdef0123456789abcdef")
+	}
+	return []byte("0123456789abcdef")
+}
+
+// TestSeal 测试 Seal/Open 函数
+func TestSeal(t *testing.T) {
+	raw := []byte("test aead data 测试")
+	for _, alg := range []Algorithm{ALG_AES_GCM, ALG_CHACHA20_POLY1305, ALG_SM4_GCM} {
+		key := aeadKey(alg)
+		enBs, err := Seal(raw, key, []byte("tenant:1"), WithAlgorithm(alg))
+		if err != nil {
+			t.Fatalf("Seal %d failed: %v", alg, err)
+		}
+		if IsLegacy(enBs) {
+			t.Errorf("Seal %d without header", alg)
+		}
+		// 解密以密文头的算法为准
+		deBs, err := Open(enBs, key, []byte("tenant:1"))
+		if err != nil || !bytes.Equal(deBs, raw) {
+			t.Errorf("Open %d failed: %v", alg, err)
+		}
+		if _, err := Open(enBs, key, []byte("tenant:2")); err != ErrAuthFailed {
+			t.Errorf("Open %d with other aad: %v", alg, err)
+		}
+		enBs[len(enBs)-1] ^= 1
+		if _, err := Open(enBs, key, []byte("tenant:1")); err != ErrAuthFailed {
+			t.Errorf("Open %d tampered: %v", alg, err)
+		}
+	}
+	if _, err := Seal(raw, aeadKey(ALG_AES_GCM), nil, WithAlgorithm(9)); err != ErrUnknownAlgorithm {
+		t.Errorf("Seal unknown algorithm: %v", err)
+	}
+}
+
+// TestLegacy 测试旧版CTR密文的解密与迁移
+func TestLegacy(t *testing.T) {
+	secret := []byte("0123456789abcdef")
+	raw := []byte("legacy ctr data")
+	legacy := &bytes.Buffer{}
+	if err := EncryptStream(bytes.NewReader(raw), legacy, secret, WithEncrypter(cipher.NewCTR), WithDecrypter(cipher.NewCTR)); err != nil {
+		t.Fatalf("EncryptStream failed: %v", err)
+	}
+	ctr := WithLegacy(WithEncrypter(cipher.NewCTR), WithDecrypter(cipher.NewCTR))
+	if _, err := DataDecrypt(legacy.Bytes(), WithSecret(secret)); err != ErrLegacyDisabled {
+		t.Errorf("DataDecrypt legacy disabled by default: %v", err)
+	}
+	deBs, err := DataDecrypt(legacy.Bytes(), WithSecret(secret), WithAEADOptions(ctr))
+	if err != nil || !bytes.Equal(deBs, raw) {
+		t.Errorf("DataDecrypt legacy failed: %v", err)
+	}
+	if _, err := Open(legacy.Bytes(), secret, nil, WithLegacy()); err != ErrLegacyDisabled {
+		t.Errorf("Open legacy disabled: %v", err)
+	}
+	if _, _, err := Migrate(legacy.Bytes(), secret, []byte("id:1")); err != ErrLegacyDisabled {
+		t.Errorf("Migrate without WithLegacy: %v", err)
+	}
+	migrated, ok, err := Migrate(legacy.Bytes(), secret, []byte("id:1"), ctr)
+	if err != nil || !ok || IsLegacy(migrated) {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	deBs, err = DataDecrypt(migrated, WithSecret(secret), WithAAD([]byte("id:1")))
+	if err != nil || !bytes.Equal(deBs, raw) {
+		t.Errorf("DataDecrypt migrated failed: %v", err)
+	}
+	if again, ok, _ := Migrate(migrated, secret, []byte("id:1")); ok || !bytes.Equal(again, migrated) {
+		t.Error("Migrate twice")
+	}
+}
+
+// TestSealStream 测试 SealStream/OpenStream 函数
+func TestSealStream(t *testing.T) {
+	key := aeadKey(ALG_SM4_GCM)
+	for _, size := range []int{0, 1, 16, 32, 33, 100} {
+		raw := make([]byte, size)
+		_, _ = rand.Read(raw)
+		enout := &bytes.Buffer{}
+		if err := SealStream(bytes.NewReader(raw), enout, key, []byte("file:1"), WithAlgorithm(ALG_SM4_GCM), WithChunkSize(16)); err != nil {
+			t.Fatalf("SealStream %d failed: %v", size, err)
+		}
+		enBs := enout.Bytes()
+		deout := &bytes.Buffer{}
+		if err := OpenStream(bytes.NewReader(enBs), deout, key, []byte("file:1")); err != nil || !bytes.Equal(deout.Bytes(), raw) {
+			t.Errorf("OpenStream %d failed: %v", size, err)
+		}
+		if deBs, err := Open(enBs, key, []byte("file:1")); err != nil || !bytes.Equal(deBs, raw) {
+			t.Errorf("Open stream %d failed: %v", size, err)
+		}
+		if size <= 16 {
+			continue
+		}
+		// 截掉末块
+		headerSize := HEADER_SIZE + 4 + 7
+		chunk := 16 + 16
+		if err := OpenStream(bytes.NewReader(enBs[:headerSize+chunk]), &bytes.Buffer{}, key, []byte("file:1")); err == nil {
+			t.Errorf("OpenStream %d truncated", size)
+		}
+		// 交换前两块
+		swapped := append([]byte{}, enBs...)
+		if len(swapped) >= headerSize+2*chunk {
+			copy(swapped[headerSize:], enBs[headerSize+chunk:headerSize+2*chunk])
+			copy(swapped[headerSize+chunk:], enBs[headerSize:headerSize+chunk])
+			if err := OpenStream(bytes.NewReader(swapped), &bytes.Buffer{}, key, []byte("file:1")); err != ErrAuthFailed {
+				t.Errorf("OpenStream %d reordered: %v", size, err)
+			}
+		}
+	}
+}
+
+// TestMac 测试 Mac 函数
+func TestMac(t *testing.T) {
+	key, data := []byte("key"), []byte("data")
+	if !VerifyMac(key, data, Mac(key, data)) {
+		t.Error("VerifyMac sha256 failed")
+	}
+	if !VerifyMac(key, data, Mac(key, data, WithMacHash(sm3.New)), WithMacHash(sm3.New)) {
+		t.Error("VerifyMac sm3 failed")
+	}
+	if VerifyMac(key, []byte("other"), Mac(key, data)) {
+		t.Error("VerifyMac other data")
+	}
+}
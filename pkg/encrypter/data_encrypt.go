@@ -1,8 +1,6 @@
 package encrypter
 
 import (
-	"bytes"
-	"crypto/cipher"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -10,6 +8,8 @@ import (
 
 type dataEncryptOption struct {
 	Secret []byte
+	AAD    []byte       // 关联数据，绑定租户或记录id
+	AEAD   []AEADOption // 算法等选项
 }
 
 type DataEncryptOptionFunc func(*dataEncryptOption)
@@ -25,6 +25,20 @@ func WithSecretString(secret string) DataEncryptOptionFunc {
 		o.Secret = []byte(secret)
 	}
 }
+
+// WithAAD 关联数据，例如租户或记录id，密文只能在相同的关联数据下解密
+func WithAAD(aad []byte) DataEncryptOptionFunc {
+	return func(o *dataEncryptOption) {
+		o.AAD = aad
+	}
+}
+
+func WithAEADOptions(opts ...AEADOption) DataEncryptOptionFunc {
+	return func(o *dataEncryptOption) {
+		o.AEAD = opts
+	}
+}
+
 func newDataEncryptOption(opts ...DataEncryptOptionFunc) *dataEncryptOption {
 	opt := &dataEncryptOption{}
 	for _, f := range opts {
@@ -32,36 +46,23 @@ func newDataEncryptOption(opts ...DataEncryptOptionFunc) *dataEncryptOption {
 	}
 	return opt
 }
+
+// DataEncrypt 认证加密，默认AES-GCM
 func DataEncrypt(value []byte, opts ...DataEncryptOptionFunc) ([]byte, error) {
 	opt := newDataEncryptOption(opts...)
 	if len(opt.Secret) == 0 {
 		return value, errors.New("secret is nil")
 	}
-	outBs := &bytes.Buffer{}
-	err := EncryptStream(bytes.NewReader(value), outBs, opt.Secret,
-		WithDecrypter(cipher.NewCTR),
-		WithEncrypter(cipher.NewCTR),
-	)
-	if err != nil {
-		return outBs.Bytes(), err
-	}
-	return outBs.Bytes(), nil
+	return Seal(value, opt.Secret, opt.AAD, opt.AEAD...)
 }
 
+// DataDecrypt 认证解密，无版本头的旧版CTR密文需WithAEADOptions(WithLegacy(...))开启
 func DataDecrypt(value []byte, opts ...DataEncryptOptionFunc) ([]byte, error) {
 	opt := newDataEncryptOption(opts...)
 	if len(opt.Secret) == 0 {
 		return value, errors.New("secret is nil")
 	}
-	outBs := &bytes.Buffer{}
-	err := DecryptStream(bytes.NewReader(value), outBs, opt.Secret,
-		WithDecrypter(cipher.NewCTR),
-		WithEncrypter(cipher.NewCTR),
-	)
-	if err != nil {
-		return outBs.Bytes(), err
-	}
-	return outBs.Bytes(), nil
+	return Open(value, opt.Secret, opt.AAD, opt.AEAD...)
 }
 
 func StringEncrypt(value string, opts ...DataEncryptOptionFunc) (string, error) {
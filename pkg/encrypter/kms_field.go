@@ -0,0 +1,92 @@
+package encrypter
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+var blindIndexInfo = []byte("aphrodite/blind-index")
+
+type FieldCipherOption func(*FieldCipher)
+
+// WithFieldAEAD 字段加密的算法等选项
+func WithFieldAEAD(opts ...AEADOption) FieldCipherOption {
+	return func(c *FieldCipher) {
+		c.aead = opts
+	}
+}
+
+// WithBlindIndexKey 盲索引的独立密钥，默认由DEK派生，轮换DEK后需重建盲索引
+func WithBlindIndexKey(key []byte) FieldCipherOption {
+	return func(c *FieldCipher) {
+		c.indexKey = key
+	}
+}
+
+// WithBlindIndexMac 盲索引的摘要选项，例如国密sm3
+func WithBlindIndexMac(opts ...MacOption) FieldCipherOption {
+	return func(c *FieldCipher) {
+		c.mac = opts
+	}
+}
+
+// FieldCipher 字段级加解密，DEK由KmsManage按id加载
+type FieldCipher struct {
+	kms      *KmsManage
+	id       string
+	aead     []AEADOption
+	mac      []MacOption
+	indexKey []byte
+}
+
+func NewFieldCipher(kms *KmsManage, id string, opts ...FieldCipherOption) *FieldCipher {
+	c := &FieldCipher{kms: kms, id: id}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// dek 明文DEK，缓存未命中时从存储加载
+func (c *FieldCipher) dek(ctx context.Context) ([]byte, error) {
+	dek, err := c.kms.cache.DekPlainGet(ctx, c.id)
+	if err != nil {
+		if _, loadErr := c.kms.LoadByIds(ctx, c.id); loadErr != nil {
+			return nil, loadErr
+		}
+		if dek, err = c.kms.cache.DekPlainGet(ctx, c.id); err != nil {
+			return nil, err
+		}
+	}
+	return base64.StdEncoding.DecodeString(dek.Plain)
+}
+
+func (c *FieldCipher) Encrypt(ctx context.Context, plain, aad []byte) ([]byte, error) {
+	key, err := c.dek(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Seal(plain, key, aad, c.aead...)
+}
+
+func (c *FieldCipher) Decrypt(ctx context.Context, data, aad []byte) ([]byte, error) {
+	key, err := c.dek(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Open(data, key, aad, c.aead...)
+}
+
+// BlindIndex hmac of the plain, equal plains have equal indexes, so the encrypted field can be searched by equality
+func (c *FieldCipher) BlindIndex(ctx context.Context, plain []byte) (string, error) {
+	key := c.indexKey
+	if len(key) == 0 {
+		dek, err := c.dek(ctx)
+		if err != nil {
+			return "", err
+		}
+		key = Mac(dek, blindIndexInfo, c.mac...)
+	}
+	return hex.EncodeToString(Mac(key, plain, c.mac...)), nil
+}
@@ -0,0 +1,41 @@
+package encrypter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+)
+
+type macOptions struct {
+	Hash func() hash.Hash
+}
+
+type MacOption func(*macOptions)
+
+// WithMacHash 摘要算法，默认sha256，国密可用sm3.New
+func WithMacHash(v func() hash.Hash) MacOption {
+	return func(o *macOptions) {
+		o.Hash = v
+	}
+}
+
+func newMacOptions(opts ...MacOption) *macOptions {
+	o := &macOptions{Hash: sha256.New}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Mac hmac of the data
+func Mac(key, data []byte, opts ...MacOption) []byte {
+	o := newMacOptions(opts...)
+	h := hmac.New(o.Hash, key)
+	_, _ = h.Write(data)
+	return h.Sum(nil)
+}
+
+// VerifyMac 常量时间比较，避免时序攻击
+func VerifyMac(key, data, mac []byte, opts ...MacOption) bool {
+	return hmac.Equal(Mac(key, data, opts...), mac)
+}
@@ -70,7 +70,7 @@ func WithDecrypter(decrypter func(cipher.Block, []byte) cipher.Stream) Option {
 	}
 }
 
-// EncryptStream 对输入流进行加密，并将结果写入输出流。
+// EncryptStream 对输入流进行加密，并将结果写入输出流，密文无完整性保护，新数据应使用 SealStream。
 // in: 输入流，包含待加密的数据。
 // out: 输出流，用于写入加密后的数据。
 // secret: 加密密钥。
@@ -1,6 +1,7 @@
 package exception
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -50,10 +51,11 @@ var _ = error(&errorString{})
 var _ = Exception(&errorString{})
 
 type errorString struct {
-	ex    ExceptionType
-	subEx int32
-	err   error
-	s     string
+	ex     ExceptionType
+	subEx  int32
+	err    error
+	s      string
+	params map[string]any
 }
 
 func (e *errorString) Code() int32 {
@@ -78,3 +80,45 @@ func (e *errorString) Error() string {
 	}
 	return e.s
 }
+
+// Unwrap 返回被包装的错误，使errors.Is与errors.As可以沿原因链查找
+func (e *errorString) Unwrap() error {
+	return e.err
+}
+
+// Is 错误码相同即视为同一异常
+func (e *errorString) Is(target error) bool {
+	t, ok := target.(Exception)
+	return ok && t.Code() == e.Code()
+}
+
+// Params 消息模板参数
+func (e *errorString) Params() map[string]any {
+	return e.params
+}
+
+// WithParams 返回携带消息模板参数的副本，不修改ex本身（ex可能是包级共享的异常），ex不是本包创建的异常时原样返回
+func WithParams(ex Exception, params map[string]any) Exception {
+	e, ok := ex.(*errorString)
+	if !ok {
+		return ex
+	}
+	cp := *e
+	cp.params = make(map[string]any, len(e.params)+len(params))
+	for k, v := range e.params {
+		cp.params[k] = v
+	}
+	for k, v := range params {
+		cp.params[k] = v
+	}
+	return &cp
+}
+
+// As 取原因链上的第一个异常
+func As(err error) (Exception, bool) {
+	var ex Exception
+	if errors.As(err, &ex) {
+		return ex, true
+	}
+	return nil, false
+}
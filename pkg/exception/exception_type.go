@@ -1,7 +1,11 @@
 package exception
 
+import "errors"
+
 type ExceptionType int32
 
+const CATEGORY_SIZE = 10000 // 每个大类的错误码区间
+
 // 通用错误大类
 const (
 	ERR_COMMON     ExceptionType = (iota + 1) * 10000 // 通用错误码
@@ -24,6 +28,9 @@ const (
 	ERR_COMMON_SIGN_VER                               // 签名版本错误
 	ERR_COMMON_SIGN_EXPIRED                           // 签名已过期
 	ERR_COMMON_SIGN                                   // 签名值错误
+	ERR_COMMON_SIGN_REPLAY                            // 签名重放
+	ERR_COMMON_SIGN_NONCE                             // 签名缺少随机串
+	ERR_COMMON_SIGN_IP                                // 签名来源IP不允许
 )
 
 // 验证码错误
@@ -56,3 +63,19 @@ func (ex ExceptionType) New(s string) Exception {
 func (ex ExceptionType) Wrap(err error, msgs ...string) Exception {
 	return Wrap(ex, err, msgs...)
 }
+
+// Match err的原因链上是否存在该错误码的异常
+func (ex ExceptionType) Match(err error) bool {
+	for err != nil {
+		if e, ok := err.(Exception); ok && e.Code() == int32(ex) {
+			return true
+		}
+		err = errors.Unwrap(err)
+	}
+	return false
+}
+
+// Category 错误大类，如ERR_COMMON_BADPARAM的大类为ERR_COMMON
+func (ex ExceptionType) Category() ExceptionType {
+	return ex - ex%CATEGORY_SIZE
+}
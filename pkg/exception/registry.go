@@ -0,0 +1,155 @@
+package exception
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	LANG_ZH      = "zh"
+	LANG_EN      = "en"
+	DEFAULT_LANG = LANG_ZH // 异常自带的消息为中文
+)
+
+// Meta 错误码的http状态、机器可读原因与各语言的消息模板，模板中{name}由异常参数替换
+type Meta struct {
+	Status   int
+	Reason   string
+	Messages map[string]string
+}
+
+var (
+	metas   sync.Map // ExceptionType:Meta
+	unknown = Meta{Status: http.StatusInternalServerError, Reason: "UNKNOWN", Messages: map[string]string{LANG_ZH: "未知错误", LANG_EN: "Unknown error"}}
+)
+
+// Register 注册或覆盖错误码的元数据
+func Register(ex ExceptionType, meta Meta) {
+	metas.Store(ex, meta)
+}
+
+// Lookup 查找元数据，未注册时依次回退到大类与UNKNOWN
+func Lookup(ex ExceptionType) Meta {
+	if v, ok := metas.Load(ex); ok {
+		return v.(Meta)
+	}
+	if v, ok := metas.Load(ex.Category()); ok {
+		return v.(Meta)
+	}
+	return unknown
+}
+
+func (ex ExceptionType) Status() int {
+	return Lookup(ex).Status
+}
+
+func (ex ExceptionType) Reason() string {
+	return Lookup(ex).Reason
+}
+
+// Message 指定语言的消息，语言不存在时使用英文
+func (ex ExceptionType) Message(lang string, params map[string]any) string {
+	msgs := Lookup(ex).Messages
+	tpl, ok := msgs[lang]
+	if !ok {
+		tpl = msgs[LANG_EN]
+	}
+	return Interpolate(tpl, params)
+}
+
+// Interpolate 使用params替换模板中的{name}
+func Interpolate(tpl string, params map[string]any) string {
+	if len(params) == 0 || !strings.Contains(tpl, "{") {
+		return tpl
+	}
+	pairs := make([]string, 0, len(params)*2)
+	for k, v := range params {
+		pairs = append(pairs, "{"+k+"}", fmt.Sprint(v))
+	}
+	return strings.NewReplacer(pairs...).Replace(tpl)
+}
+
+// Localized 异常在指定语言下的呈现
+type Localized struct {
+	Status  int
+	Reason  string
+	Code    int32
+	SubCode int32
+	Message string // 本地化消息
+	Detail  string // 异常原始信息
+}
+
+/*
+Localize 解析err原因链上的第一个异常
+
+	默认语言下保留异常自带的消息，其他语言使用注册的模板；
+	err不包含异常时按ERR_COMMON处理。
+*/
+func Localize(err error, lang string) Localized {
+	ex, ok := As(err)
+	if !ok {
+		ex = Wrap(ERR_COMMON, err)
+	}
+	tp := ExceptionType(ex.Code())
+	meta := Lookup(tp)
+	res := Localized{
+		Status:  meta.Status,
+		Reason:  meta.Reason,
+		Code:    ex.Code(),
+		SubCode: ex.SubCode(),
+		Detail:  err.Error(),
+	}
+	var params map[string]any
+	if p, ok := ex.(interface{ Params() map[string]any }); ok {
+		params = p.Params()
+	}
+	if lang == DEFAULT_LANG && ex.Error() != "" {
+		res.Message = ex.Error()
+	} else {
+		res.Message = tp.Message(lang, params)
+	}
+	return res
+}
+
+func init() {
+	for ex, meta := range map[ExceptionType]Meta{
+		ERR_COMMON:                {http.StatusInternalServerError, "INTERNAL", msgs("服务器内部错误", "Internal server error")},
+		ERR_COMMON_BUSY:           {http.StatusServiceUnavailable, "BUSY", msgs("服务器繁忙", "Server is busy")},
+		ERR_COMMON_REQ_TOOMANEY:   {http.StatusTooManyRequests, "TOO_MANY_REQUESTS", msgs("请求过多", "Too many requests")},
+		ERR_COMMON_BADPARAM:       {http.StatusBadRequest, "BAD_PARAM", msgs("参数错误", "Invalid parameter")},
+		ERR_COMMON_UNAUTH:         {http.StatusUnauthorized, "UNAUTHENTICATED", msgs("登录失效", "Authentication required")},
+		ERR_COMMON_NOPERMISSION:   {http.StatusForbidden, "PERMISSION_DENIED", msgs("没有权限", "Permission denied")},
+		ERR_COMMON_USER:           {http.StatusForbidden, "INVALID_OPERATOR", msgs("操作人错误", "Invalid operator")},
+		ERR_COMMON_TIMEOUT:        {http.StatusGatewayTimeout, "TIMEOUT", msgs("请求超时", "Request timeout")},
+		ERR_COMMON_SIGN_APP:       {http.StatusUnauthorized, "SIGN_APP_DENIED", msgs("签名应用不合法", "Signing app denied")},
+		ERR_COMMON_SIGN_VER:       {http.StatusBadRequest, "SIGN_VERSION_INVALID", msgs("签名版本错误", "Invalid signature version")},
+		ERR_COMMON_SIGN_EXPIRED:   {http.StatusUnauthorized, "SIGN_EXPIRED", msgs("签名已过期", "Signature expired")},
+		ERR_COMMON_SIGN:           {http.StatusUnauthorized, "SIGN_INVALID", msgs("签名值错误", "Invalid signature")},
+		ERR_COMMON_SIGN_REPLAY:    {http.StatusConflict, "SIGN_REPLAYED", msgs("请求已被处理，请勿重放", "Signed request replayed")},
+		ERR_COMMON_SIGN_NONCE:     {http.StatusBadRequest, "SIGN_NONCE_MISSING", msgs("签名缺少随机串", "Signature nonce missing")},
+		ERR_COMMON_SIGN_IP:        {http.StatusForbidden, "SIGN_IP_DENIED", msgs("来源IP不允许", "Source IP not allowed")},
+		ERR_VERIFYCODE:            {http.StatusBadRequest, "VERIFYCODE_INVALID", msgs("验证码错误", "Invalid verification code")},
+		ERR_VERIFYCODE_SENDFAIL:   {http.StatusBadGateway, "VERIFYCODE_SEND_FAILED", msgs("发送验证码失败", "Failed to send verification code")},
+		ERR_VERIFYCODE_HASSEND:    {http.StatusTooManyRequests, "VERIFYCODE_ALREADY_SENT", msgs("验证码已经发送过", "Verification code already sent")},
+		ERR_VERIFYCODE_HASEXPIRED: {http.StatusBadRequest, "VERIFYCODE_EXPIRED", msgs("验证码已经过期", "Verification code expired")},
+		ERR_BUSI:                  {http.StatusUnprocessableEntity, "BUSINESS_ERROR", msgs("业务操作失败", "Business operation failed")},
+		ERR_BUSI_NOFOUND:          {http.StatusNotFound, "NOT_FOUND", msgs("没有找到", "Not found")},
+		ERR_BUSI_HASEXIST:         {http.StatusConflict, "ALREADY_EXISTS", msgs("已经存在", "Already exists")},
+		ERR_BUSI_CREATE:           {http.StatusInternalServerError, "CREATE_FAILED", msgs("创建失败", "Create failed")},
+		ERR_BUSI_UPDATE:           {http.StatusInternalServerError, "UPDATE_FAILED", msgs("更新失败", "Update failed")},
+		ERR_BUSI_DELETE:           {http.StatusInternalServerError, "DELETE_FAILED", msgs("删除失败", "Delete failed")},
+		ERR_BUSI_STATUS:           {http.StatusConflict, "INVALID_STATUS", msgs("状态错误", "Invalid status")},
+		ERR_UNRESPONSE:            {http.StatusBadGateway, "NO_RESPONSE", msgs("没有响应", "No response")},
+		ERR_CAPTCHA:               {http.StatusBadRequest, "CAPTCHA_INVALID", msgs("人机码错误", "Invalid captcha")},
+		ERR_CAPTCHA_FAIL:          {http.StatusBadRequest, "CAPTCHA_FAILED", msgs("人机码错误", "Captcha verification failed")},
+		ERR_CAPTCHA_HASEXPIRED:    {http.StatusBadRequest, "CAPTCHA_EXPIRED", msgs("人机码已经过期", "Captcha expired")},
+	} {
+		Register(ex, meta)
+	}
+}
+
+func msgs(zh, en string) map[string]string {
+	return map[string]string{LANG_ZH: zh, LANG_EN: en}
+}
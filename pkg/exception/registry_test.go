@@ -0,0 +1,64 @@
+package exception
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegistry(t *testing.T) {
+	convey.Convey("TestRegistry", t, func() {
+		convey.Convey("lookup", func() {
+			convey.So(ERR_BUSI_NOFOUND.Status(), convey.ShouldEqual, http.StatusNotFound)
+			convey.So(ERR_BUSI_NOFOUND.Reason(), convey.ShouldEqual, "NOT_FOUND")
+			// 未注册的错误码回退到大类
+			convey.So(ExceptionType(30099).Category(), convey.ShouldEqual, ERR_BUSI)
+			convey.So(ExceptionType(30099).Reason(), convey.ShouldEqual, "BUSINESS_ERROR")
+			convey.So(ExceptionType(990001).Reason(), convey.ShouldEqual, "UNKNOWN")
+
+			Register(ExceptionType(30099), Meta{Status: http.StatusPaymentRequired, Reason: "QUOTA", Messages: map[string]string{LANG_EN: "Quota of {name} exceeded: {used}/{max}"}})
+			convey.So(ExceptionType(30099).Message(LANG_EN, map[string]any{"name": "api", "used": 10, "max": 10}), convey.ShouldEqual, "Quota of api exceeded: 10/10")
+			convey.So(ExceptionType(30099).Message("fr", nil), convey.ShouldEqual, "Quota of {name} exceeded: {used}/{max}")
+		})
+
+		convey.Convey("chain", func() {
+			cause := errors.New("record not found")
+			inner := ERR_BUSI_NOFOUND.Wrap(cause, "用户不存在")
+			outer := fmt.Errorf("query user: %w", inner)
+			convey.So(errors.Is(outer, cause), convey.ShouldBeTrue)
+			convey.So(errors.Is(outer, ERR_BUSI_NOFOUND.New("")), convey.ShouldBeTrue)
+			convey.So(errors.Is(outer, ERR_BUSI_HASEXIST.New("")), convey.ShouldBeFalse)
+			convey.So(ERR_BUSI_NOFOUND.Match(outer), convey.ShouldBeTrue)
+			convey.So(ERR_BUSI.Match(outer), convey.ShouldBeFalse)
+			ex, ok := As(outer)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(ex.Code(), convey.ShouldEqual, ERR_BUSI_NOFOUND)
+		})
+
+		convey.Convey("localize", func() {
+			ex := WithParams(ERR_VERIFYCODE_HASSEND.New("验证码已发送，请60秒后重试"), map[string]any{"seconds": 60})
+			l := Localize(ex, LANG_ZH)
+			convey.So(l.Status, convey.ShouldEqual, http.StatusTooManyRequests)
+			convey.So(l.Message, convey.ShouldEqual, "验证码已发送，请60秒后重试")
+			l = Localize(fmt.Errorf("send: %w", ex), LANG_EN)
+			convey.So(l.Message, convey.ShouldEqual, "Verification code already sent")
+			convey.So(l.Detail, convey.ShouldEqual, "send: 验证码已发送，请60秒后重试")
+			convey.So(l.Code, convey.ShouldEqual, ERR_VERIFYCODE_HASSEND)
+
+			// 返回副本，不修改共享的异常
+			shared := ERR_VERIFYCODE_HASSEND.New("shared")
+			withParams := WithParams(shared, map[string]any{"seconds": 30})
+			convey.So(shared.(*errorString).params, convey.ShouldBeNil)
+			convey.So(withParams.(*errorString).params["seconds"], convey.ShouldEqual, 30)
+			convey.So(errors.Is(withParams, shared), convey.ShouldBeTrue)
+
+			l = Localize(errors.New("boom"), LANG_EN)
+			convey.So(l.Status, convey.ShouldEqual, http.StatusInternalServerError)
+			convey.So(l.Reason, convey.ShouldEqual, "INTERNAL")
+			convey.So(l.Message, convey.ShouldEqual, "Internal server error")
+		})
+	})
+}
@@ -2,6 +2,7 @@ package redq
 
 import (
 	"context"
+	"time"
 
 	"github.com/hibiken/asynq"
 )
@@ -10,9 +11,13 @@ type SubscribeHandler func(context.Context, []byte) error
 type RedqOption func(*RedqOptions)
 
 type RedqOptions struct {
-	RedisConfig asynq.RedisClientOpt
-	QueueConfig asynq.Config
-	HandleMap   map[string]SubscribeHandler
+	RedisConfig     asynq.RedisClientOpt
+	QueueConfig     asynq.Config
+	HandleMap       map[string]SubscribeHandler
+	SchedulerConfig asynq.SchedulerOpts
+	Specs           []CronSpec
+	SpecProvider    SpecProvider
+	SyncInterval    time.Duration
 }
 
 func WithRedisConfig(cfg asynq.RedisClientOpt) RedqOption {
@@ -36,6 +41,31 @@ func WithHandle(topic string, handler SubscribeHandler) RedqOption {
 	}
 }
 
+func WithSchedulerConfig(cfg asynq.SchedulerOpts) RedqOption {
+	return func(o *RedqOptions) {
+		o.SchedulerConfig = cfg
+	}
+}
+
+func WithCronSpec(specs ...CronSpec) RedqOption {
+	return func(o *RedqOptions) {
+		o.Specs = append(o.Specs, specs...)
+	}
+}
+
+func WithSpecProvider(p SpecProvider) RedqOption {
+	return func(o *RedqOptions) {
+		o.SpecProvider = p
+	}
+}
+
+// WithSyncInterval interval of reload specs from SpecProvider, default is 3m
+func WithSyncInterval(v time.Duration) RedqOption {
+	return func(o *RedqOptions) {
+		o.SyncInterval = v
+	}
+}
+
 func NewRedqOptions(opts ...RedqOption) *RedqOptions {
 	opt := &RedqOptions{}
 	for _, f := range opts {
@@ -0,0 +1,159 @@
+package redq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/hibiken/asynq"
+	"github.com/smartystreets/goconvey/convey"
+	"github.com/spf13/viper"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, RedqOption) {
+	s := miniredis.RunT(t)
+	return s, WithRedisConfig(asynq.RedisClientOpt{Addr: s.Addr()})
+}
+
+func TestSendTaskFuncProcessIn(t *testing.T) {
+	_, redisOpt := newTestRedis(t)
+	send := SendTaskFunc(redisOpt)
+	convey.Convey("TestSendTaskFuncProcessIn", t, func() {
+		convey.Convey("process in", func() {
+			info, err := send(context.Background(), "test:delay", []byte("1"), WithProcessIn(time.Hour))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(info.State, convey.ShouldEqual, asynq.TaskStateScheduled)
+			convey.So(info.NextProcessAt.After(time.Now().Add(59*time.Minute)), convey.ShouldBeTrue)
+		})
+		convey.Convey("process at", func() {
+			at := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+			info, err := send(context.Background(), "test:delay", []byte("2"), WithProcessAt(at), WithRetention(time.Hour))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(info.State, convey.ShouldEqual, asynq.TaskStateScheduled)
+			convey.So(info.NextProcessAt.Unix(), convey.ShouldEqual, at.Unix())
+			convey.So(info.Retention, convey.ShouldEqual, time.Hour)
+		})
+		convey.Convey("immediately", func() {
+			info, err := send(context.Background(), "test:delay", []byte("3"), WithQueue("low"))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(info.State, convey.ShouldEqual, asynq.TaskStatePending)
+			convey.So(info.Queue, convey.ShouldEqual, "low")
+		})
+	})
+}
+
+func TestSendTaskFuncUniqueKey(t *testing.T) {
+	s, redisOpt := newTestRedis(t)
+	send := SendTaskFunc(redisOpt)
+	convey.Convey("TestSendTaskFuncUniqueKey", t, func() {
+		ctx := context.Background()
+		_, err := send(ctx, "test:unique", []byte("a"), WithUniqueKey("order-1", time.Minute))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(s.Exists(UniqueLockKey("test:unique", "order-1")), convey.ShouldBeTrue)
+
+		_, err = send(ctx, "test:unique", []byte("b"), WithUniqueKey("order-1", time.Minute))
+		convey.So(errors.Is(err, asynq.ErrDuplicateTask), convey.ShouldBeTrue)
+
+		_, err = send(ctx, "test:unique_other", []byte("b"), WithUniqueKey("order-1", time.Minute))
+		convey.So(err, convey.ShouldBeNil)
+
+		s.FastForward(time.Minute + time.Second)
+		_, err = send(ctx, "test:unique", []byte("c"), WithUniqueKey("order-1", time.Minute))
+		convey.So(err, convey.ShouldBeNil)
+
+		_, err = send(ctx, "test:unique", []byte("d"), WithUniqueKey("order-2", 0))
+		convey.So(err, convey.ShouldEqual, ErrUniqueKeyNoTTL)
+	})
+}
+
+func TestNewTaskOptions(t *testing.T) {
+	convey.Convey("TestNewTaskOptions", t, func() {
+		convey.So(len(NewTaskOptions().AsynqOptions()), convey.ShouldEqual, 0)
+		opts := NewTaskOptions(
+			WithQueue("q"),
+			WithMaxRetry(0),
+			WithTimeout(time.Second),
+			WithUnique(time.Minute),
+			WithTaskID("id"),
+		).AsynqOptions()
+		convey.So(len(opts), convey.ShouldEqual, 5)
+	})
+}
+
+func TestSpecConfigProvider(t *testing.T) {
+	convey.Convey("TestSpecConfigProvider", t, func() {
+		static := NewStaticSpecProvider(CronSpec{Cronspec: "@every 1m", Topic: "static"})
+		p := specConfigProvider{
+			specs: []CronSpec{
+				{Cronspec: "@every 10s", Topic: "fixed", Options: CronSpecOption{Queue: "low", Unique: 10}},
+				{Cronspec: "@every 10s", Topic: "disabled", Disable: true},
+				{Topic: "no_spec"},
+			},
+			provider: static,
+		}
+		cfgs, err := p.GetConfigs()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(len(cfgs), convey.ShouldEqual, 2)
+		convey.So(cfgs[0].Task.Type(), convey.ShouldEqual, "fixed")
+		convey.So(len(cfgs[0].Opts), convey.ShouldEqual, 2)
+		convey.So(cfgs[1].Task.Type(), convey.ShouldEqual, "static")
+
+		static.Set(CronSpec{Cronspec: "@every 1m", Topic: "reload_a"}, CronSpec{Cronspec: "@every 1m", Topic: "reload_b"})
+		cfgs, err = p.GetConfigs()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(len(cfgs), convey.ShouldEqual, 3)
+		convey.So(cfgs[2].Task.Type(), convey.ShouldEqual, "reload_b")
+
+		p.provider = SpecProviderFunc(func() ([]CronSpec, error) {
+			return nil, errors.New("err")
+		})
+		_, err = p.GetConfigs()
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+}
+
+func TestViperSpecProvider(t *testing.T) {
+	convey.Convey("TestViperSpecProvider", t, func() {
+		v := viper.New()
+		p := ViperSpecProvider(v, "redq.crons")
+		specs, err := p.GetSpecs()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(len(specs), convey.ShouldEqual, 0)
+
+		v.Set("redq.crons", []map[string]any{
+			{"cronspec": "@every 1m", "topic": "report", "payload": "{}", "options": map[string]any{"queue": "low", "retention": 60}},
+		})
+		specs, err = p.GetSpecs()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(len(specs), convey.ShouldEqual, 1)
+		convey.So(specs[0].Topic, convey.ShouldEqual, "report")
+		convey.So(specs[0].Options.Queue, convey.ShouldEqual, "low")
+		convey.So(specs[0].Options.Retention, convey.ShouldEqual, 60)
+	})
+}
+
+func TestNewRedqScheduler(t *testing.T) {
+	s, redisOpt := newTestRedis(t)
+	convey.Convey("TestNewRedqScheduler", t, func() {
+		_, err := NewRedqScheduler(redisOpt)
+		convey.So(err, convey.ShouldEqual, ErrNoSpecProvider)
+
+		mgr, err := NewRedqScheduler(redisOpt,
+			WithCronSpec(CronSpec{Cronspec: "@every 1s", Topic: "test:cron"}),
+			WithSyncInterval(time.Second))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(mgr.Start(), convey.ShouldBeNil)
+		defer mgr.Shutdown()
+
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if s.Exists("asynq:{default}:pending") {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		convey.So(s.Exists("asynq:{default}:pending"), convey.ShouldBeTrue)
+	})
+}
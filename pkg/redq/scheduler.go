@@ -0,0 +1,182 @@
+package redq
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/spf13/viper"
+)
+
+var (
+	ErrNoSpecProvider = errors.New("no cron spec or spec provider")
+)
+
+// CronSpec declarative periodic task
+type CronSpec struct {
+	Cronspec string         `json:"cronspec" mapstructure:"cronspec"` // cron expression, e.g. "@every 30s" or "0 */5 * * *"
+	Topic    string         `json:"topic" mapstructure:"topic"`       // task type, same as the key of HandleMap
+	Payload  string         `json:"payload" mapstructure:"payload"`   // task payload
+	Disable  bool           `json:"disable" mapstructure:"disable"`   // skip this spec
+	Options  CronSpecOption `json:"options" mapstructure:"options"`   // enqueue options
+}
+
+// CronSpecOption enqueue options of cron spec, which can be declared in config file
+type CronSpecOption struct {
+	Queue     string `json:"queue" mapstructure:"queue"`
+	MaxRetry  int    `json:"maxRetry" mapstructure:"maxRetry"`
+	Timeout   int64  `json:"timeout" mapstructure:"timeout"`     // seconds
+	Unique    int64  `json:"unique" mapstructure:"unique"`       // seconds
+	Retention int64  `json:"retention" mapstructure:"retention"` // seconds
+}
+
+// TaskOptions convert to task options
+func (o CronSpecOption) TaskOptions() []TaskOption {
+	opts := []TaskOption{}
+	if o.Queue != "" {
+		opts = append(opts, WithQueue(o.Queue))
+	}
+	if o.MaxRetry > 0 {
+		opts = append(opts, WithMaxRetry(o.MaxRetry))
+	}
+	if o.Timeout > 0 {
+		opts = append(opts, WithTimeout(seconds(o.Timeout)))
+	}
+	if o.Unique > 0 {
+		opts = append(opts, WithUnique(seconds(o.Unique)))
+	}
+	if o.Retention > 0 {
+		opts = append(opts, WithRetention(seconds(o.Retention)))
+	}
+	return opts
+}
+
+func seconds(v int64) time.Duration {
+	return time.Duration(v) * time.Second
+}
+
+// ToConfig convert to asynq periodic task config
+func (s CronSpec) ToConfig(opts ...TaskOption) *asynq.PeriodicTaskConfig {
+	opts = append(s.Options.TaskOptions(), opts...)
+	return &asynq.PeriodicTaskConfig{
+		Cronspec: s.Cronspec,
+		Task:     asynq.NewTask(s.Topic, []byte(s.Payload)),
+		Opts:     NewTaskOptions(opts...).AsynqOptions(),
+	}
+}
+
+// SpecProvider provide cron specs, it is called periodically to reload schedules at runtime
+type SpecProvider interface {
+	GetSpecs() ([]CronSpec, error)
+}
+
+var _ = SpecProvider(SpecProviderFunc(nil))
+
+// SpecProviderFunc func impl of SpecProvider
+type SpecProviderFunc func() ([]CronSpec, error)
+
+func (f SpecProviderFunc) GetSpecs() ([]CronSpec, error) {
+	return f()
+}
+
+var _ = SpecProvider(&StaticSpecProvider{})
+
+// StaticSpecProvider keep specs in memory, Set can replace them at runtime
+type StaticSpecProvider struct {
+	mu    sync.RWMutex
+	specs []CronSpec
+}
+
+func NewStaticSpecProvider(specs ...CronSpec) *StaticSpecProvider {
+	return &StaticSpecProvider{specs: specs}
+}
+
+func (p *StaticSpecProvider) Set(specs ...CronSpec) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.specs = specs
+}
+
+func (p *StaticSpecProvider) GetSpecs() ([]CronSpec, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]CronSpec{}, p.specs...), nil
+}
+
+// ViperSpecProvider read specs from viper key, work with viper.WatchConfig to reload at runtime
+//
+//	redq:
+//	  crons:
+//	    - cronspec: "@every 1m"
+//	      topic: "report:daily"
+//	      options:
+//	        queue: "low"
+//	        unique: 60
+func ViperSpecProvider(v *viper.Viper, key string) SpecProvider {
+	return SpecProviderFunc(func() ([]CronSpec, error) {
+		specs := []CronSpec{}
+		if v == nil || !v.IsSet(key) {
+			return specs, nil
+		}
+		err := v.UnmarshalKey(key, &specs)
+		return specs, err
+	})
+}
+
+var _ = asynq.PeriodicTaskConfigProvider(&specConfigProvider{})
+
+// specConfigProvider adapt SpecProvider to asynq.PeriodicTaskConfigProvider
+type specConfigProvider struct {
+	specs    []CronSpec
+	provider SpecProvider
+}
+
+func (p specConfigProvider) GetConfigs() ([]*asynq.PeriodicTaskConfig, error) {
+	specs := append([]CronSpec{}, p.specs...)
+	if p.provider != nil {
+		vs, err := p.provider.GetSpecs()
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, vs...)
+	}
+	cfgs := []*asynq.PeriodicTaskConfig{}
+	for _, s := range specs {
+		if s.Disable || s.Cronspec == "" || s.Topic == "" {
+			continue
+		}
+		cfgs = append(cfgs, s.ToConfig())
+	}
+	return cfgs, nil
+}
+
+// NewRedqScheduler new a periodic task manager, which sync specs from Specs and SpecProvider every SyncInterval
+func NewRedqScheduler(opts ...RedqOption) (*asynq.PeriodicTaskManager, error) {
+	o := NewRedqOptions(opts...)
+	if len(o.Specs) == 0 && o.SpecProvider == nil {
+		return nil, ErrNoSpecProvider
+	}
+	schedulerOpts := o.SchedulerConfig
+	if schedulerOpts.Logger == nil {
+		schedulerOpts.Logger = NewZapLog()
+	}
+	return asynq.NewPeriodicTaskManager(asynq.PeriodicTaskManagerOpts{
+		PeriodicTaskConfigProvider: specConfigProvider{
+			specs:    o.Specs,
+			provider: o.SpecProvider,
+		},
+		RedisConnOpt:  o.RedisConfig,
+		SchedulerOpts: &schedulerOpts,
+		SyncInterval:  o.SyncInterval,
+	})
+}
+
+// InitRedqScheduler run the periodic task manager until receive the stop signal
+func InitRedqScheduler(opts ...RedqOption) error {
+	mgr, err := NewRedqScheduler(opts...)
+	if err != nil {
+		return err
+	}
+	return mgr.Run()
+}
@@ -0,0 +1,195 @@
+package redq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	UNIQUE_KEY_PREFIX = "redq:unique"
+)
+
+var (
+	ErrUniqueKeyNoTTL = errors.New("unique key ttl must be greater than zero")
+	ErrRedisClient    = errors.New("redis client is not redis.UniversalClient")
+)
+
+type TaskOption func(*TaskOptions)
+
+// TaskOptions enqueue option of task
+type TaskOptions struct {
+	Queue     string        // queue name, default is asynq default queue
+	MaxRetry  int           // max retry, negative value means use asynq default
+	Timeout   time.Duration // process timeout
+	Deadline  time.Time     // process deadline
+	ProcessAt time.Time     // run at the time
+	ProcessIn time.Duration // run after the duration
+	Unique    time.Duration // dedup by topic+payload+queue in the duration
+	UniqueKey string        // dedup by custom key
+	UniqueTTL time.Duration // dedup by custom key in the duration
+	Retention time.Duration // keep the task after completed
+	TaskID    string        // custom task id
+	Group     string        // aggregation group
+}
+
+func WithQueue(v string) TaskOption {
+	return func(o *TaskOptions) {
+		o.Queue = v
+	}
+}
+
+func WithMaxRetry(v int) TaskOption {
+	return func(o *TaskOptions) {
+		o.MaxRetry = v
+	}
+}
+
+func WithTimeout(v time.Duration) TaskOption {
+	return func(o *TaskOptions) {
+		o.Timeout = v
+	}
+}
+
+func WithDeadline(v time.Time) TaskOption {
+	return func(o *TaskOptions) {
+		o.Deadline = v
+	}
+}
+
+// WithProcessAt run task at the time
+func WithProcessAt(v time.Time) TaskOption {
+	return func(o *TaskOptions) {
+		o.ProcessAt = v
+	}
+}
+
+// WithProcessIn run task after the duration
+func WithProcessIn(v time.Duration) TaskOption {
+	return func(o *TaskOptions) {
+		o.ProcessIn = v
+	}
+}
+
+// WithUnique dedup task by topic+payload+queue in the ttl
+func WithUnique(ttl time.Duration) TaskOption {
+	return func(o *TaskOptions) {
+		o.Unique = ttl
+	}
+}
+
+// WithUniqueKey dedup task by the custom key in the ttl, the key is scoped by topic
+func WithUniqueKey(key string, ttl time.Duration) TaskOption {
+	return func(o *TaskOptions) {
+		o.UniqueKey = key
+		o.UniqueTTL = ttl
+	}
+}
+
+// WithRetention keep the task in redis after completed
+func WithRetention(v time.Duration) TaskOption {
+	return func(o *TaskOptions) {
+		o.Retention = v
+	}
+}
+
+func WithTaskID(v string) TaskOption {
+	return func(o *TaskOptions) {
+		o.TaskID = v
+	}
+}
+
+func WithGroup(v string) TaskOption {
+	return func(o *TaskOptions) {
+		o.Group = v
+	}
+}
+
+func NewTaskOptions(opts ...TaskOption) *TaskOptions {
+	opt := &TaskOptions{
+		MaxRetry: -1,
+	}
+	for _, f := range opts {
+		f(opt)
+	}
+	return opt
+}
+
+// AsynqOptions convert to asynq options
+func (o TaskOptions) AsynqOptions() []asynq.Option {
+	res := []asynq.Option{}
+	if o.Queue != "" {
+		res = append(res, asynq.Queue(o.Queue))
+	}
+	if o.MaxRetry >= 0 {
+		res = append(res, asynq.MaxRetry(o.MaxRetry))
+	}
+	if o.Timeout > 0 {
+		res = append(res, asynq.Timeout(o.Timeout))
+	}
+	if !o.Deadline.IsZero() {
+		res = append(res, asynq.Deadline(o.Deadline))
+	}
+	if !o.ProcessAt.IsZero() {
+		res = append(res, asynq.ProcessAt(o.ProcessAt))
+	}
+	if o.ProcessIn > 0 {
+		res = append(res, asynq.ProcessIn(o.ProcessIn))
+	}
+	if o.Unique > 0 {
+		res = append(res, asynq.Unique(o.Unique))
+	}
+	if o.Retention > 0 {
+		res = append(res, asynq.Retention(o.Retention))
+	}
+	if o.TaskID != "" {
+		res = append(res, asynq.TaskID(o.TaskID))
+	}
+	if o.Group != "" {
+		res = append(res, asynq.Group(o.Group))
+	}
+	return res
+}
+
+// UniqueLockKey redis key of the unique key lock
+func UniqueLockKey(topic, key string) string {
+	return fmt.Sprintf("%s:%s:%s", UNIQUE_KEY_PREFIX, topic, key)
+}
+
+// SendTaskFunc enqueue task with TaskOption, the task will be rejected with asynq.ErrDuplicateTask
+// if the unique key has been used in the ttl.
+func SendTaskFunc(opts ...RedqOption) func(ctx context.Context, topic string, val []byte, taskopts ...TaskOption) (*asynq.TaskInfo, error) {
+	o := NewRedqOptions(opts...)
+	client := asynq.NewClient(o.RedisConfig)
+	rdb, _ := o.RedisConfig.MakeRedisClient().(redis.UniversalClient)
+	return func(ctx context.Context, topic string, val []byte, taskopts ...TaskOption) (*asynq.TaskInfo, error) {
+		to := NewTaskOptions(taskopts...)
+		if to.UniqueKey == "" {
+			return client.EnqueueContext(ctx, asynq.NewTask(topic, val), to.AsynqOptions()...)
+		}
+		if to.UniqueTTL <= 0 {
+			return nil, ErrUniqueKeyNoTTL
+		}
+		if rdb == nil {
+			return nil, ErrRedisClient
+		}
+		lockKey := UniqueLockKey(topic, to.UniqueKey)
+		locked, err := rdb.SetNX(ctx, lockKey, topic, to.UniqueTTL).Result()
+		if err != nil {
+			return nil, err
+		}
+		if !locked {
+			return nil, asynq.ErrDuplicateTask
+		}
+		info, err := client.EnqueueContext(ctx, asynq.NewTask(topic, val), to.AsynqOptions()...)
+		if err != nil {
+			// 入队失败释放唯一键，允许重新投递
+			_ = rdb.Del(ctx, lockKey).Err()
+		}
+		return info, err
+	}
+}
@@ -0,0 +1,112 @@
+package taskworker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	STATUS_SUCCESS = "success"
+	STATUS_FAILED  = "failed"
+	STATUS_LOST    = "lost" // 租约丢失，结果不汇报
+)
+
+// Metrics 任务执行监控指标
+//
+//	queue_depth              gauge_vec      到期待执行的任务数量
+//	task_duration_seconds    histogram_vec  任务执行耗时
+//	tasks_total              counter_vec    执行任务数量
+//	tasks_inflight           gauge_vec      执行中的任务数量
+type Metrics struct {
+	QueueDepth *prometheus.GaugeVec
+	Duration   *prometheus.HistogramVec
+	Total      *prometheus.CounterVec
+	Inflight   *prometheus.GaugeVec
+}
+
+// NewMetrics 创建监控指标，需调用Register注册
+func NewMetrics(subsystem string) *Metrics {
+	return &Metrics{
+		QueueDepth: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "queue_depth",
+			Help:      "How many tasks are due and waiting to be locked, partitioned by task name.",
+		}, []string{"name"}),
+		Duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Subsystem: subsystem,
+			Name:      "task_duration_seconds",
+			Help:      "The task handle latencies in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"name", "status"}),
+		Total: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Subsystem: subsystem,
+			Name:      "tasks_total",
+			Help:      "How many tasks handled, partitioned by task name and status.",
+		}, []string{"name", "status"}),
+		Inflight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Subsystem: subsystem,
+			Name:      "tasks_inflight",
+			Help:      "How many tasks are being handled, partitioned by task name.",
+		}, []string{"name"}),
+	}
+}
+
+// Register 注册到registerer，已注册时复用已有的指标
+func (m *Metrics) Register(reg prometheus.Registerer) error {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	var err error
+	if m.QueueDepth, err = register(reg, m.QueueDepth); err != nil {
+		return err
+	}
+	if m.Duration, err = register(reg, m.Duration); err != nil {
+		return err
+	}
+	if m.Total, err = register(reg, m.Total); err != nil {
+		return err
+	}
+	if m.Inflight, err = register(reg, m.Inflight); err != nil {
+		return err
+	}
+	return nil
+}
+
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	err := reg.Register(c)
+	if err == nil {
+		return c, nil
+	}
+	are := prometheus.AlreadyRegisteredError{}
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(C); ok {
+			return existing, nil
+		}
+	}
+	return c, err
+}
+
+func (m *Metrics) setDepth(name string, depth int64) {
+	if m == nil {
+		return
+	}
+	m.QueueDepth.WithLabelValues(name).Set(float64(depth))
+}
+
+func (m *Metrics) begin(name string) {
+	if m == nil {
+		return
+	}
+	m.Inflight.WithLabelValues(name).Inc()
+}
+
+func (m *Metrics) end(name, status string, cost time.Duration) {
+	if m == nil {
+		return
+	}
+	m.Inflight.WithLabelValues(name).Dec()
+	m.Duration.WithLabelValues(name, status).Observe(cost.Seconds())
+	m.Total.WithLabelValues(name, status).Inc()
+}
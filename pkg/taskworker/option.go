@@ -0,0 +1,93 @@
+package taskworker
+
+import "time"
+
+const (
+	DEFAULT_CONCURRENCY   = 10
+	DEFAULT_BATCH         = 10
+	DEFAULT_POLL_INTERVAL = time.Second
+	DEFAULT_DRAIN_TIMEOUT = 30 * time.Second
+	DEFAULT_LEASE         = time.Minute
+	MIN_RENEW_INTERVAL    = time.Second
+)
+
+type Option func(*Options)
+
+type Options struct {
+	Concurrency   int           // 同时执行的任务数量
+	Batch         int           // 每次锁定的任务数量
+	PollInterval  time.Duration // 无任务时轮询间隔
+	RenewInterval time.Duration // 续租间隔，默认为租期的1/3
+	DrainTimeout  time.Duration // 停止后等待执行中任务的时间，超时后取消任务上下文
+	Metrics       *Metrics      // 监控指标，为空则不采集
+}
+
+func newOptions(opts ...Option) *Options {
+	o := &Options{
+		Concurrency:  DEFAULT_CONCURRENCY,
+		Batch:        DEFAULT_BATCH,
+		PollInterval: DEFAULT_POLL_INTERVAL,
+		DrainTimeout: DEFAULT_DRAIN_TIMEOUT,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.Concurrency < 1 {
+		o.Concurrency = 1
+	}
+	if o.Batch < 1 {
+		o.Batch = 1
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = DEFAULT_POLL_INTERVAL
+	}
+	return o
+}
+
+// renewInterval 续租间隔，不小于MIN_RENEW_INTERVAL
+func (o *Options) renewInterval(lease time.Duration) time.Duration {
+	interval := o.RenewInterval
+	if interval <= 0 {
+		interval = lease / 3
+	}
+	if interval < MIN_RENEW_INTERVAL {
+		interval = MIN_RENEW_INTERVAL
+	}
+	return interval
+}
+
+func WithConcurrency(concurrency int) Option {
+	return func(o *Options) {
+		o.Concurrency = concurrency
+	}
+}
+
+func WithBatch(batch int) Option {
+	return func(o *Options) {
+		o.Batch = batch
+	}
+}
+
+func WithPollInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.PollInterval = interval
+	}
+}
+
+func WithRenewInterval(interval time.Duration) Option {
+	return func(o *Options) {
+		o.RenewInterval = interval
+	}
+}
+
+func WithDrainTimeout(timeout time.Duration) Option {
+	return func(o *Options) {
+		o.DrainTimeout = timeout
+	}
+}
+
+func WithMetrics(m *Metrics) Option {
+	return func(o *Options) {
+		o.Metrics = m
+	}
+}
@@ -0,0 +1,279 @@
+package taskworker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	groupv2 "github.com/illidaris/aphrodite/pkg/group/v2"
+	iLog "github.com/illidaris/logger"
+	"github.com/spf13/cast"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNoHandler       = errors.New("no handler registered")
+	ErrHandlerNotFound = errors.New("handler not found")
+	ErrHandlerPanic    = errors.New("handler panic")
+)
+
+// ITaskQueue 任务队列，gormex.TaskQueueRepository与redisex.TaskQueueRepository均已实现
+type ITaskQueue[T dependency.ITask] interface {
+	WaitExecWithLock(ctx context.Context, t T, batch int) (string, int64, error)
+	FindLockeds(ctx context.Context, locker string) ([]T, error)
+	ReportExecResult(ctx context.Context, id int64, locker string, execResult string, execErr error) (int64, error)
+	RenewLease(ctx context.Context, id int64, locker string, lease time.Duration) (int64, error)
+}
+
+// IDueCounter 统计到期待执行的数量，队列实现该接口时采集queue_depth
+type IDueCounter[T dependency.ITask] interface {
+	CountDue(ctx context.Context, t T) (int64, error)
+}
+
+// Handler 任务处理函数，返回值将通过ReportExecResult汇报
+type Handler[T dependency.ITask] func(ctx context.Context, t T) (string, error)
+
+type route[T dependency.ITask] struct {
+	template T
+	handler  Handler[T]
+}
+
+/*
+Worker 任务执行器
+
+	每个注册的任务名称独立轮询：锁定一批到期任务，通过group/v2并发执行，
+	执行期间定期续租，续租失败说明锁已被他人获取，取消任务上下文且不汇报结果。
+	Run的上下文结束后停止轮询，执行中的任务继续执行直至完成或超过DrainTimeout，
+	已锁定但未开始的任务不再执行，待租约到期后由其他节点重新锁定。
+*/
+type Worker[T dependency.ITask] struct {
+	queue  ITaskQueue[T]
+	opts   *Options
+	routes map[string]route[T]
+}
+
+func NewWorker[T dependency.ITask](queue ITaskQueue[T], opts ...Option) *Worker[T] {
+	return &Worker[T]{
+		queue:  queue,
+		opts:   newOptions(opts...),
+		routes: map[string]route[T]{},
+	}
+}
+
+// Register 注册任务处理函数，template提供bizId、category、name与默认超时，需在Run之前调用
+func (w *Worker[T]) Register(template T, handler Handler[T]) *Worker[T] {
+	w.routes[template.GetName()] = route[T]{template: template, handler: handler}
+	return w
+}
+
+// Run 阻塞执行直至ctx结束且执行中的任务排空
+func (w *Worker[T]) Run(ctx context.Context) error {
+	if len(w.routes) == 0 {
+		return ErrNoHandler
+	}
+	var (
+		wg           sync.WaitGroup
+		drained      = make(chan struct{})
+		hctx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	)
+	defer cancel()
+	go func() {
+		select {
+		case <-drained:
+			return
+		case <-ctx.Done():
+		}
+		if w.opts.DrainTimeout <= 0 {
+			<-drained
+			return
+		}
+		select {
+		case <-drained:
+		case <-time.After(w.opts.DrainTimeout):
+			cancel()
+		}
+	}()
+	for _, r := range w.routes {
+		wg.Add(1)
+		go func(r route[T]) {
+			defer wg.Done()
+			w.loop(ctx, hctx, r)
+		}(r)
+	}
+	wg.Wait()
+	close(drained)
+	return nil
+}
+
+// Poll 每个注册的任务执行一轮，阻塞直至本轮任务完成
+func (w *Worker[T]) Poll(ctx context.Context) (int64, error) {
+	var (
+		total int64
+		errs  []error
+	)
+	for _, r := range w.routes {
+		affect, err := w.poll(ctx, ctx, r)
+		total += affect
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return total, errors.Join(errs...)
+}
+
+func (w *Worker[T]) loop(ctx, hctx context.Context, r route[T]) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		affect, err := w.poll(ctx, hctx, r)
+		if err != nil {
+			iLog.ErrorCtx(ctx, "taskworker poll failed", zap.String("name", r.template.GetName()), zap.Error(err))
+		}
+		// 满批次说明可能还有积压，立即进行下一轮
+		if err == nil && affect >= int64(w.opts.Batch) {
+			timer.Reset(0)
+		} else {
+			timer.Reset(w.opts.PollInterval)
+		}
+	}
+}
+
+// poll 锁定一批任务并执行，ctx控制是否继续执行，hctx为任务上下文
+func (w *Worker[T]) poll(ctx, hctx context.Context, r route[T]) (int64, error) {
+	ctx, hctx = tenantCtx(ctx, r.template), tenantCtx(hctx, r.template)
+	w.depth(ctx, r.template)
+	locker, affect, err := w.queue.WaitExecWithLock(ctx, r.template, w.opts.Batch)
+	if err != nil || affect == 0 {
+		return 0, err
+	}
+	tasks, err := w.queue.FindLockeds(ctx, locker)
+	if err != nil {
+		return 0, err
+	}
+	lease := r.template.GetTimeout()
+	if lease <= 0 {
+		lease = DEFAULT_LEASE
+	}
+	var execed int64
+	_, _ = groupv2.GroupFunc(func(ts ...T) (int64, error) {
+		for _, t := range ts {
+			if ctx.Err() != nil {
+				break
+			}
+			w.exec(hctx, locker, lease, t)
+			atomic.AddInt64(&execed, 1)
+		}
+		return int64(len(ts)), nil
+	}, tasks, groupv2.WithBatch(1), groupv2.WithParallelismMax(w.opts.Concurrency))
+	return execed, nil
+}
+
+func (w *Worker[T]) depth(ctx context.Context, t T) {
+	counter, ok := w.queue.(IDueCounter[T])
+	if !ok || w.opts.Metrics == nil {
+		return
+	}
+	depth, err := counter.CountDue(ctx, t)
+	if err != nil {
+		return
+	}
+	w.opts.Metrics.setDepth(t.GetName(), depth)
+}
+
+func (w *Worker[T]) exec(ctx context.Context, locker string, lease time.Duration, t T) {
+	var (
+		id     = cast.ToInt64(t.ID())
+		name   = t.GetName()
+		begin  = time.Now()
+		status = STATUS_SUCCESS
+		lost   atomic.Bool
+	)
+	ctx = tenantCtx(ctx, t)
+	// 记录里设定了超时时间则以该时间为租期，与WaitExecWithLock一致
+	if timeout := t.GetTimeout(); timeout > 0 {
+		lease = timeout
+	}
+	w.opts.Metrics.begin(name)
+	hctx, cancel := context.WithCancel(ctx)
+	stop := w.renew(hctx, cancel, id, locker, lease, &lost)
+	result, err := w.handle(hctx, t)
+	stop()
+	cancel()
+	if err != nil {
+		status = STATUS_FAILED
+	}
+	if lost.Load() {
+		status = STATUS_LOST
+		iLog.WarnCtx(ctx, "taskworker lease lost", zap.String("name", name), zap.Int64("id", id), zap.String("locker", locker))
+	} else if _, rerr := w.queue.ReportExecResult(context.WithoutCancel(ctx), id, locker, result, err); rerr != nil {
+		iLog.ErrorCtx(ctx, "taskworker report failed", zap.String("name", name), zap.Int64("id", id), zap.Error(rerr))
+	}
+	w.opts.Metrics.end(name, status, time.Since(begin))
+}
+
+// renew 定期续租，续租影响行数为0时标记租约丢失并取消任务上下文，返回停止函数
+func (w *Worker[T]) renew(ctx context.Context, cancel context.CancelFunc, id int64, locker string, lease time.Duration, lost *atomic.Bool) func() {
+	var (
+		done   = make(chan struct{})
+		exited = make(chan struct{})
+	)
+	go func() {
+		defer close(exited)
+		ticker := time.NewTicker(w.opts.renewInterval(lease))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			affect, err := w.queue.RenewLease(ctx, id, locker, lease)
+			if err != nil {
+				iLog.WarnCtx(ctx, "taskworker renew failed", zap.Int64("id", id), zap.Error(err))
+				continue
+			}
+			if affect == 0 {
+				lost.Store(true)
+				cancel()
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-exited
+	}
+}
+
+func (w *Worker[T]) handle(ctx context.Context, t T) (result string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+		}
+	}()
+	r, ok := w.routes[t.GetName()]
+	if !ok {
+		return "", ErrHandlerNotFound
+	}
+	return r.handler(ctx, t)
+}
+
+// tenantCtx 任务的BizId写入上下文，开启多租户时仓储按该BizId限定，见dependency.EnableTenancy
+func tenantCtx(ctx context.Context, t dependency.IBaseTask) context.Context {
+	if bizId := t.GetBizId(); bizId != 0 {
+		return contextex.WithBizId(ctx, int64(bizId))
+	}
+	return ctx
+}
@@ -0,0 +1,270 @@
+package taskworker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/illidaris/aphrodite/component/gormex"
+	"github.com/illidaris/aphrodite/component/redisex"
+	"github.com/illidaris/aphrodite/pkg/contextex"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+var (
+	_ = ITaskQueue[po.MqMessage](gormex.TaskQueueRepository[po.MqMessage]{})
+	_ = ITaskQueue[po.MqMessage](&redisex.TaskQueueRepository[po.MqMessage]{})
+	_ = IDueCounter[po.MqMessage](gormex.TaskQueueRepository[po.MqMessage]{})
+	_ = IDueCounter[po.MqMessage](&redisex.TaskQueueRepository[po.MqMessage]{})
+)
+
+type report struct {
+	result string
+	err    error
+}
+
+// fakeQueue in memory queue, lease is ignored
+type fakeQueue struct {
+	mu        sync.Mutex
+	tasks     []*po.MqMessage
+	reports   map[int64]report
+	renews    int64
+	loseLease bool
+}
+
+func newFakeQueue(names ...string) *fakeQueue {
+	q := &fakeQueue{reports: map[int64]report{}}
+	for i, name := range names {
+		m := &po.MqMessage{}
+		m.Id = uint64(i + 1)
+		m.Name = name
+		q.tasks = append(q.tasks, m)
+	}
+	return q
+}
+
+func (q *fakeQueue) WaitExecWithLock(ctx context.Context, t po.MqMessage, batch int) (string, int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	locker := uuid.NewString()
+	var affect int64
+	for _, m := range q.tasks {
+		if int(affect) >= batch {
+			break
+		}
+		if m.Name == t.Name && m.Locker == "" {
+			m.Locker = locker
+			affect++
+		}
+	}
+	return locker, affect, nil
+}
+
+func (q *fakeQueue) FindLockeds(ctx context.Context, locker string) ([]po.MqMessage, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	res := []po.MqMessage{}
+	for _, m := range q.tasks {
+		if m.Locker == locker {
+			res = append(res, *m)
+		}
+	}
+	return res, nil
+}
+
+func (q *fakeQueue) ReportExecResult(ctx context.Context, id int64, locker string, execResult string, execErr error) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.reports[id] = report{result: execResult, err: execErr}
+	return 1, nil
+}
+
+func (q *fakeQueue) RenewLease(ctx context.Context, id int64, locker string, lease time.Duration) (int64, error) {
+	atomic.AddInt64(&q.renews, 1)
+	if q.loseLease {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+func (q *fakeQueue) CountDue(ctx context.Context, t po.MqMessage) (int64, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var count int64
+	for _, m := range q.tasks {
+		if m.Name == t.Name && m.Locker == "" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (q *fakeQueue) report(id int64) (report, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	r, ok := q.reports[id]
+	return r, ok
+}
+
+func template(name string) po.MqMessage {
+	m := po.MqMessage{}
+	m.Name = name
+	m.Timeout = 3
+	return m
+}
+
+func TestWorkerPoll(t *testing.T) {
+	convey.Convey("TestWorkerPoll", t, func() {
+		q := newFakeQueue("ok", "ok", "fail", "panic")
+		metrics := NewMetrics("test_poll")
+		convey.So(metrics.Register(prometheus.NewRegistry()), convey.ShouldBeNil)
+		w := NewWorker[po.MqMessage](q, WithConcurrency(2), WithMetrics(metrics)).
+			Register(template("ok"), func(ctx context.Context, m po.MqMessage) (string, error) {
+				return "done", nil
+			}).
+			Register(template("fail"), func(ctx context.Context, m po.MqMessage) (string, error) {
+				return "", errors.New("failed")
+			}).
+			Register(template("panic"), func(ctx context.Context, m po.MqMessage) (string, error) {
+				panic("boom")
+			})
+		affect, err := w.Poll(context.Background())
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 4)
+
+		r, _ := q.report(1)
+		convey.So(r.result, convey.ShouldEqual, "done")
+		convey.So(r.err, convey.ShouldBeNil)
+		r, _ = q.report(3)
+		convey.So(r.err.Error(), convey.ShouldEqual, "failed")
+		r, _ = q.report(4)
+		convey.So(errors.Is(r.err, ErrHandlerPanic), convey.ShouldBeTrue)
+
+		convey.So(testutil.ToFloat64(metrics.Total.WithLabelValues("ok", STATUS_SUCCESS)), convey.ShouldEqual, 2)
+		convey.So(testutil.ToFloat64(metrics.Total.WithLabelValues("panic", STATUS_FAILED)), convey.ShouldEqual, 1)
+		convey.So(testutil.ToFloat64(metrics.Inflight.WithLabelValues("ok")), convey.ShouldEqual, 0)
+		convey.So(testutil.ToFloat64(metrics.QueueDepth.WithLabelValues("ok")), convey.ShouldEqual, 2)
+
+		affect, err = w.Poll(context.Background())
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 0)
+	})
+}
+
+func TestWorkerTenant(t *testing.T) {
+	convey.Convey("TestWorkerTenant", t, func() {
+		q := newFakeQueue("tenant")
+		q.tasks[0].BizId = 7
+		var bizId int64
+		w := NewWorker[po.MqMessage](q).
+			Register(template("tenant"), func(ctx context.Context, m po.MqMessage) (string, error) {
+				bizId = contextex.GetBizId(ctx)
+				return "done", nil
+			})
+		affect, err := w.Poll(context.Background())
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+		convey.So(bizId, convey.ShouldEqual, 7)
+	})
+}
+
+func TestWorkerRenewLease(t *testing.T) {
+	convey.Convey("TestWorkerRenewLease", t, func() {
+		convey.Convey("renew while running", func() {
+			q := newFakeQueue("slow")
+			w := NewWorker[po.MqMessage](q, WithRenewInterval(time.Second)).
+				Register(template("slow"), func(ctx context.Context, m po.MqMessage) (string, error) {
+					time.Sleep(1500 * time.Millisecond)
+					return "done", ctx.Err()
+				})
+			_, err := w.Poll(context.Background())
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(atomic.LoadInt64(&q.renews), convey.ShouldEqual, 1)
+			r, ok := q.report(1)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(r.err, convey.ShouldBeNil)
+		})
+
+		convey.Convey("lease lost", func() {
+			q := newFakeQueue("slow")
+			q.loseLease = true
+			w := NewWorker[po.MqMessage](q, WithRenewInterval(time.Second)).
+				Register(template("slow"), func(ctx context.Context, m po.MqMessage) (string, error) {
+					<-ctx.Done()
+					return "", ctx.Err()
+				})
+			_, err := w.Poll(context.Background())
+			convey.So(err, convey.ShouldBeNil)
+			_, ok := q.report(1)
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+	})
+}
+
+func TestWorkerRun(t *testing.T) {
+	convey.Convey("TestWorkerRun", t, func() {
+		convey.Convey("no handler", func() {
+			err := NewWorker[po.MqMessage](newFakeQueue()).Run(context.Background())
+			convey.So(err, convey.ShouldEqual, ErrNoHandler)
+		})
+
+		convey.Convey("drain in-flight", func() {
+			q := newFakeQueue("a")
+			started := make(chan struct{})
+			w := NewWorker[po.MqMessage](q, WithPollInterval(10*time.Millisecond)).
+				Register(template("a"), func(ctx context.Context, m po.MqMessage) (string, error) {
+					close(started)
+					time.Sleep(100 * time.Millisecond)
+					return "done", ctx.Err()
+				})
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-started
+				cancel()
+			}()
+			convey.So(w.Run(ctx), convey.ShouldBeNil)
+			r, ok := q.report(1)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(r.result, convey.ShouldEqual, "done")
+			convey.So(r.err, convey.ShouldBeNil)
+		})
+
+		convey.Convey("drain timeout", func() {
+			q := newFakeQueue("a")
+			started := make(chan struct{})
+			w := NewWorker[po.MqMessage](q, WithPollInterval(10*time.Millisecond), WithDrainTimeout(50*time.Millisecond)).
+				Register(template("a"), func(ctx context.Context, m po.MqMessage) (string, error) {
+					close(started)
+					<-ctx.Done()
+					return "", ctx.Err()
+				})
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				<-started
+				cancel()
+			}()
+			convey.So(w.Run(ctx), convey.ShouldBeNil)
+			r, ok := q.report(1)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(errors.Is(r.err, context.Canceled), convey.ShouldBeTrue)
+		})
+	})
+}
+
+func TestMetricsRegister(t *testing.T) {
+	convey.Convey("TestMetricsRegister", t, func() {
+		reg := prometheus.NewRegistry()
+		m1 := NewMetrics("test_register")
+		convey.So(m1.Register(reg), convey.ShouldBeNil)
+		m2 := NewMetrics("test_register")
+		convey.So(m2.Register(reg), convey.ShouldBeNil)
+		convey.So(m2.Total, convey.ShouldEqual, m1.Total)
+	})
+}
@@ -0,0 +1,109 @@
+package testkit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+)
+
+var _ = dependency.ICache(&Cache{})
+
+type cacheItem struct {
+	val      any
+	expireAt time.Time // zero means never expire
+}
+
+func (i cacheItem) expired(now time.Time) bool {
+	return !i.expireAt.IsZero() && !now.Before(i.expireAt)
+}
+
+// Cache in memory dependency.ICache, timeout <= 0 means never expire
+type Cache struct {
+	mu    sync.Mutex
+	clock *FakeClock
+	items map[string]cacheItem
+}
+
+func NewCache(clock *FakeClock) *Cache {
+	return &Cache{
+		clock: orNewClock(clock),
+		items: map[string]cacheItem{},
+	}
+}
+
+// Clock clock of the cache
+func (c *Cache) Clock() *FakeClock {
+	return c.clock
+}
+
+func (c *Cache) load(key string) (cacheItem, bool) {
+	item, ok := c.items[key]
+	if !ok {
+		return item, false
+	}
+	if item.expired(c.clock.Now()) {
+		delete(c.items, key)
+		return item, false
+	}
+	return item, true
+}
+
+func (c *Cache) store(key string, val any, timeout time.Duration) {
+	item := cacheItem{val: val}
+	if timeout > 0 {
+		item.expireAt = c.clock.Now().Add(timeout)
+	}
+	c.items[key] = item
+}
+
+func (c *Cache) Get(key string) any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.load(key)
+	if !ok {
+		return nil
+	}
+	return item.val
+}
+
+func (c *Cache) TTL(key string) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.load(key)
+	if !ok || item.expireAt.IsZero() {
+		return 0
+	}
+	return item.expireAt.Sub(c.clock.Now())
+}
+
+func (c *Cache) Set(key string, val any, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.store(key, val, timeout)
+	return nil
+}
+
+func (c *Cache) SetNX(key string, val any, timeout time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.load(key); ok {
+		return false, nil
+	}
+	c.store(key, val, timeout)
+	return true, nil
+}
+
+func (c *Cache) IsExist(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.load(key)
+	return ok
+}
+
+func (c *Cache) Delete(key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.items, key)
+	return nil
+}
@@ -0,0 +1,49 @@
+// Package testkit provides thread-safe in-memory fakes of dependency interfaces for hermetic tests.
+package testkit
+
+import (
+	"sync"
+	"time"
+)
+
+// FakeClock controllable clock, expiry of all fakes is based on it
+type FakeClock struct {
+	mu  sync.RWMutex
+	now time.Time
+}
+
+// NewFakeClock new a clock starts at now, zero means time.Now()
+func NewFakeClock(now time.Time) *FakeClock {
+	if now.IsZero() {
+		now = time.Now()
+	}
+	return &FakeClock{now: now}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.now
+}
+
+// Advance move the clock forward
+func (c *FakeClock) Advance(d time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	return c.now
+}
+
+// Set set the clock to t
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+func orNewClock(c *FakeClock) *FakeClock {
+	if c == nil {
+		return NewFakeClock(time.Time{})
+	}
+	return c
+}
@@ -0,0 +1,662 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/redis/go-redis/v9"
+	lua "github.com/yuin/gopher-lua"
+)
+
+var _ = dependency.ILuaCache(&LuaCache{})
+
+var (
+	ErrWrongType  = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	ErrNotInteger = errors.New("ERR value is not an integer or out of range")
+	ErrSyntax     = errors.New("ERR syntax error")
+)
+
+type luaEntry struct {
+	str      *string
+	hash     map[string]string
+	expireAt time.Time // zero means never expire
+}
+
+/*
+LuaCache in memory dependency.ILuaCache, scripts run by an embedded lua interpreter atomically.
+
+	Supported commands of redis.call: GET SET SETNX INCR INCRBY DECR DECRBY DEL EXISTS
+	EXPIRE PEXPIRE TTL PTTL HGET HSET HMSET HSETNX HGETALL HINCRBY HDEL HEXISTS HLEN TIME
+
+Values are converted between redis and lua in the same way as redis, nil reply is returned as redis.Nil.
+*/
+type LuaCache struct {
+	mu    sync.Mutex
+	clock *FakeClock
+	data  map[string]*luaEntry
+}
+
+func NewLuaCache(clock *FakeClock) *LuaCache {
+	return &LuaCache{
+		clock: orNewClock(clock),
+		data:  map[string]*luaEntry{},
+	}
+}
+
+// Clock clock of the cache
+func (c *LuaCache) Clock() *FakeClock {
+	return c.clock
+}
+
+// Do run a redis command, such as c.Do(ctx, "HSET", "key", "f", 1)
+func (c *LuaCache) Do(ctx context.Context, args ...any) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	strs := make([]string, 0, len(args))
+	for _, a := range args {
+		strs = append(strs, argString(a))
+	}
+	res, err := c.exec(strs)
+	if s, ok := res.(status); ok {
+		return string(s), err
+	}
+	return res, err
+}
+
+func (c *LuaCache) Eval(script string, keys []string, args ...any) (any, error) {
+	return c.EvalContext(context.Background(), script, keys, args...)
+}
+
+func (c *LuaCache) EvalContext(ctx context.Context, script string, keys []string, args ...any) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	L := newLuaState(ctx)
+	defer L.Close()
+	L.SetGlobal("KEYS", stringsTable(L, keys))
+	argv := make([]string, 0, len(args))
+	for _, a := range args {
+		argv = append(argv, argString(a))
+	}
+	L.SetGlobal("ARGV", stringsTable(L, argv))
+	redisTable := L.NewTable()
+	L.SetField(redisTable, "call", L.NewFunction(c.luaCall(false)))
+	L.SetField(redisTable, "pcall", L.NewFunction(c.luaCall(true)))
+	L.SetField(redisTable, "status_reply", L.NewFunction(func(L *lua.LState) int {
+		t := L.NewTable()
+		L.SetField(t, "ok", lua.LString(L.CheckString(1)))
+		L.Push(t)
+		return 1
+	}))
+	L.SetField(redisTable, "error_reply", L.NewFunction(func(L *lua.LState) int {
+		t := L.NewTable()
+		L.SetField(t, "err", lua.LString(L.CheckString(1)))
+		L.Push(t)
+		return 1
+	}))
+	L.SetGlobal("redis", redisTable)
+
+	fn, err := L.LoadString(script)
+	if err != nil {
+		return nil, err
+	}
+	L.Push(fn)
+	if err := L.PCall(0, 1, nil); err != nil {
+		return nil, err
+	}
+	res, err := fromLua(L.Get(-1))
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, redis.Nil
+	}
+	return res, nil
+}
+
+// EvalSha scripts are not cached, the sha is treated as the script itself
+func (c *LuaCache) EvalSha(ctx context.Context, sha string, keys []string, args ...any) (any, error) {
+	return c.EvalContext(ctx, sha, keys, args...)
+}
+
+func (c *LuaCache) Delete(key string) (int64, error) {
+	return c.DeleteContext(context.Background(), key)
+}
+
+func (c *LuaCache) DeleteContext(ctx context.Context, key string) (int64, error) {
+	res, err := c.Do(ctx, "DEL", key)
+	if err != nil {
+		return 0, err
+	}
+	return res.(int64), nil
+}
+
+func (c *LuaCache) Get(key string) (string, error) {
+	return c.GetContext(context.Background(), key)
+}
+
+func (c *LuaCache) GetContext(ctx context.Context, key string) (string, error) {
+	res, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return "", err
+	}
+	if res == nil {
+		return "", redis.Nil
+	}
+	return res.(string), nil
+}
+
+// Context adapter whose Eval accepts a context, such as idsegment.ICache
+func (c *LuaCache) Context() ContextLuaCache {
+	return ContextLuaCache{c}
+}
+
+// ContextLuaCache LuaCache with context-first Eval
+type ContextLuaCache struct {
+	c *LuaCache
+}
+
+func (c ContextLuaCache) Eval(ctx context.Context, script string, keys []string, args ...any) (any, error) {
+	return c.c.EvalContext(ctx, script, keys, args...)
+}
+
+func (c ContextLuaCache) EvalSha(ctx context.Context, sha string, keys []string, args ...any) (any, error) {
+	return c.c.EvalSha(ctx, sha, keys, args...)
+}
+
+func newLuaState(ctx context.Context) *lua.LState {
+	L := lua.NewState(lua.Options{SkipOpenLibs: true})
+	for _, lib := range []struct {
+		name string
+		f    lua.LGFunction
+	}{
+		{lua.LoadLibName, lua.OpenPackage},
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.f))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+	L.SetContext(ctx)
+	return L
+}
+
+func stringsTable(L *lua.LState, vs []string) *lua.LTable {
+	t := L.CreateTable(len(vs), 0)
+	for _, v := range vs {
+		t.Append(lua.LString(v))
+	}
+	return t
+}
+
+func (c *LuaCache) luaCall(protected bool) lua.LGFunction {
+	return func(L *lua.LState) int {
+		args := make([]string, 0, L.GetTop())
+		for i := 1; i <= L.GetTop(); i++ {
+			v := L.Get(i)
+			switch v.Type() {
+			case lua.LTString, lua.LTNumber:
+				args = append(args, lua.LVAsString(v))
+			default:
+				L.RaiseError("Lua redis lib command arguments must be strings or integers")
+				return 0
+			}
+		}
+		res, err := c.exec(args)
+		if err != nil {
+			if protected {
+				t := L.NewTable()
+				L.SetField(t, "err", lua.LString(err.Error()))
+				L.Push(t)
+				return 1
+			}
+			L.RaiseError("%s", err.Error())
+			return 0
+		}
+		L.Push(toLua(L, res))
+		return 1
+	}
+}
+
+// status status reply of redis
+type status string
+
+// toLua redis reply => lua value
+func toLua(L *lua.LState, v any) lua.LValue {
+	switch val := v.(type) {
+	case nil:
+		return lua.LFalse
+	case int64:
+		return lua.LNumber(val)
+	case string:
+		return lua.LString(val)
+	case status:
+		t := L.NewTable()
+		L.SetField(t, "ok", lua.LString(val))
+		return t
+	case []any:
+		t := L.CreateTable(len(val), 0)
+		for _, item := range val {
+			t.Append(toLua(L, item))
+		}
+		return t
+	}
+	return lua.LFalse
+}
+
+// fromLua lua value => redis reply
+func fromLua(v lua.LValue) (any, error) {
+	switch val := v.(type) {
+	case lua.LNumber:
+		return int64(val), nil
+	case lua.LString:
+		return string(val), nil
+	case lua.LBool:
+		if val {
+			return int64(1), nil
+		}
+		return nil, nil
+	case *lua.LTable:
+		if e := val.RawGetString("err"); e != lua.LNil {
+			return nil, errors.New(lua.LVAsString(e))
+		}
+		if ok := val.RawGetString("ok"); ok != lua.LNil {
+			return lua.LVAsString(ok), nil
+		}
+		res := []any{}
+		for i := 1; i <= val.Len(); i++ {
+			item := val.RawGetInt(i)
+			if item == lua.LNil {
+				break
+			}
+			r, err := fromLua(item)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, r)
+		}
+		return res, nil
+	}
+	return nil, nil
+}
+
+// argString format arg like go-redis
+func argString(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case []byte:
+		return string(val)
+	case int:
+		return strconv.FormatInt(int64(val), 10)
+	case int8:
+		return strconv.FormatInt(int64(val), 10)
+	case int16:
+		return strconv.FormatInt(int64(val), 10)
+	case int32:
+		return strconv.FormatInt(int64(val), 10)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case uint:
+		return strconv.FormatUint(uint64(val), 10)
+	case uint8:
+		return strconv.FormatUint(uint64(val), 10)
+	case uint16:
+		return strconv.FormatUint(uint64(val), 10)
+	case uint32:
+		return strconv.FormatUint(uint64(val), 10)
+	case uint64:
+		return strconv.FormatUint(val, 10)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 64)
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		if val {
+			return "1"
+		}
+		return "0"
+	case time.Duration:
+		return strconv.FormatInt(int64(val), 10)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(v)
+}
+
+func (c *LuaCache) entry(key string) *luaEntry {
+	e, ok := c.data[key]
+	if !ok {
+		return nil
+	}
+	if !e.expireAt.IsZero() && !c.clock.Now().Before(e.expireAt) {
+		delete(c.data, key)
+		return nil
+	}
+	return e
+}
+
+func (c *LuaCache) stringEntry(key string) (*luaEntry, error) {
+	e := c.entry(key)
+	if e != nil && e.str == nil {
+		return nil, ErrWrongType
+	}
+	return e, nil
+}
+
+func (c *LuaCache) hashEntry(key string, create bool) (*luaEntry, error) {
+	e := c.entry(key)
+	if e != nil && e.hash == nil {
+		return nil, ErrWrongType
+	}
+	if e == nil && create {
+		e = &luaEntry{hash: map[string]string{}}
+		c.data[key] = e
+	}
+	return e, nil
+}
+
+func (c *LuaCache) setString(key, val string) {
+	c.data[key] = &luaEntry{str: &val}
+}
+
+func wrongArgs(cmd string) error {
+	return fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(cmd))
+}
+
+func parseInt(s string) (int64, error) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, ErrNotInteger
+	}
+	return v, nil
+}
+
+// exec run a command, caller must hold the lock
+func (c *LuaCache) exec(args []string) (any, error) {
+	if len(args) == 0 {
+		return nil, errors.New("ERR Please specify at least one argument for this redis lib call")
+	}
+	cmd := strings.ToUpper(args[0])
+	args = args[1:]
+	switch cmd {
+	case "GET":
+		if len(args) != 1 {
+			return nil, wrongArgs(cmd)
+		}
+		e, err := c.stringEntry(args[0])
+		if err != nil || e == nil {
+			return nil, err
+		}
+		return *e.str, nil
+	case "SET":
+		return c.set(cmd, args)
+	case "SETNX":
+		if len(args) != 2 {
+			return nil, wrongArgs(cmd)
+		}
+		if c.entry(args[0]) != nil {
+			return int64(0), nil
+		}
+		c.setString(args[0], args[1])
+		return int64(1), nil
+	case "INCR", "DECR", "INCRBY", "DECRBY":
+		var by int64 = 1
+		if cmd == "INCRBY" || cmd == "DECRBY" {
+			if len(args) != 2 {
+				return nil, wrongArgs(cmd)
+			}
+			v, err := parseInt(args[1])
+			if err != nil {
+				return nil, err
+			}
+			by = v
+		} else if len(args) != 1 {
+			return nil, wrongArgs(cmd)
+		}
+		if strings.HasPrefix(cmd, "DECR") {
+			by = -by
+		}
+		return c.incr(args[0], by)
+	case "DEL", "EXISTS":
+		if len(args) == 0 {
+			return nil, wrongArgs(cmd)
+		}
+		var count int64
+		for _, key := range args {
+			if c.entry(key) != nil {
+				count++
+				if cmd == "DEL" {
+					delete(c.data, key)
+				}
+			}
+		}
+		return count, nil
+	case "EXPIRE", "PEXPIRE":
+		if len(args) != 2 {
+			return nil, wrongArgs(cmd)
+		}
+		v, err := parseInt(args[1])
+		if err != nil {
+			return nil, err
+		}
+		e := c.entry(args[0])
+		if e == nil {
+			return int64(0), nil
+		}
+		unit := time.Second
+		if cmd == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		if v <= 0 {
+			delete(c.data, args[0])
+			return int64(1), nil
+		}
+		e.expireAt = c.clock.Now().Add(time.Duration(v) * unit)
+		return int64(1), nil
+	case "TTL", "PTTL":
+		if len(args) != 1 {
+			return nil, wrongArgs(cmd)
+		}
+		e := c.entry(args[0])
+		if e == nil {
+			return int64(-2), nil
+		}
+		if e.expireAt.IsZero() {
+			return int64(-1), nil
+		}
+		left := e.expireAt.Sub(c.clock.Now())
+		if cmd == "PTTL" {
+			return left.Milliseconds(), nil
+		}
+		return int64(math.Round(left.Seconds())), nil
+	case "HGET":
+		if len(args) != 2 {
+			return nil, wrongArgs(cmd)
+		}
+		e, err := c.hashEntry(args[0], false)
+		if err != nil || e == nil {
+			return nil, err
+		}
+		if v, ok := e.hash[args[1]]; ok {
+			return v, nil
+		}
+		return nil, nil
+	case "HSET", "HMSET", "HSETNX":
+		if len(args) < 3 || len(args)%2 == 0 || (cmd == "HSETNX" && len(args) != 3) {
+			return nil, wrongArgs(cmd)
+		}
+		e, err := c.hashEntry(args[0], true)
+		if err != nil {
+			return nil, err
+		}
+		var added int64
+		for i := 1; i < len(args); i += 2 {
+			if _, ok := e.hash[args[i]]; ok {
+				if cmd == "HSETNX" {
+					continue
+				}
+			} else {
+				added++
+			}
+			e.hash[args[i]] = args[i+1]
+		}
+		if cmd == "HMSET" {
+			return status("OK"), nil
+		}
+		return added, nil
+	case "HGETALL":
+		if len(args) != 1 {
+			return nil, wrongArgs(cmd)
+		}
+		e, err := c.hashEntry(args[0], false)
+		if err != nil {
+			return nil, err
+		}
+		res := []any{}
+		if e == nil {
+			return res, nil
+		}
+		fields := make([]string, 0, len(e.hash))
+		for f := range e.hash {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		for _, f := range fields {
+			res = append(res, f, e.hash[f])
+		}
+		return res, nil
+	case "HINCRBY":
+		if len(args) != 3 {
+			return nil, wrongArgs(cmd)
+		}
+		by, err := parseInt(args[2])
+		if err != nil {
+			return nil, err
+		}
+		e, err := c.hashEntry(args[0], true)
+		if err != nil {
+			return nil, err
+		}
+		var cur int64
+		if v, ok := e.hash[args[1]]; ok {
+			if cur, err = parseInt(v); err != nil {
+				return nil, errors.New("ERR hash value is not an integer")
+			}
+		}
+		cur += by
+		e.hash[args[1]] = strconv.FormatInt(cur, 10)
+		return cur, nil
+	case "HDEL", "HEXISTS":
+		if len(args) < 2 || (cmd == "HEXISTS" && len(args) != 2) {
+			return nil, wrongArgs(cmd)
+		}
+		e, err := c.hashEntry(args[0], false)
+		if err != nil || e == nil {
+			return int64(0), err
+		}
+		var count int64
+		for _, f := range args[1:] {
+			if _, ok := e.hash[f]; ok {
+				count++
+				if cmd == "HDEL" {
+					delete(e.hash, f)
+				}
+			}
+		}
+		if len(e.hash) == 0 {
+			delete(c.data, args[0])
+		}
+		return count, nil
+	case "HLEN":
+		if len(args) != 1 {
+			return nil, wrongArgs(cmd)
+		}
+		e, err := c.hashEntry(args[0], false)
+		if err != nil || e == nil {
+			return int64(0), err
+		}
+		return int64(len(e.hash)), nil
+	case "TIME":
+		now := c.clock.Now()
+		return []any{strconv.FormatInt(now.Unix(), 10), strconv.FormatInt(int64(now.Nanosecond()/1000), 10)}, nil
+	}
+	return nil, fmt.Errorf("ERR unknown command '%s'", strings.ToLower(cmd))
+}
+
+func (c *LuaCache) set(cmd string, args []string) (any, error) {
+	if len(args) < 2 {
+		return nil, wrongArgs(cmd)
+	}
+	var (
+		key, val = args[0], args[1]
+		expire   time.Duration
+		nx, xx   bool
+	)
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				return nil, ErrSyntax
+			}
+			v, err := parseInt(args[i+1])
+			if err != nil || v <= 0 {
+				return nil, ErrSyntax
+			}
+			unit := time.Second
+			if strings.ToUpper(args[i]) == "PX" {
+				unit = time.Millisecond
+			}
+			expire = time.Duration(v) * unit
+			i++
+		default:
+			return nil, ErrSyntax
+		}
+	}
+	exist := c.entry(key) != nil
+	if (nx && exist) || (xx && !exist) {
+		return nil, nil
+	}
+	c.setString(key, val)
+	if expire > 0 {
+		c.data[key].expireAt = c.clock.Now().Add(expire)
+	}
+	return status("OK"), nil
+}
+
+func (c *LuaCache) incr(key string, by int64) (any, error) {
+	e, err := c.stringEntry(key)
+	if err != nil {
+		return nil, err
+	}
+	var cur int64
+	if e != nil {
+		if cur, err = parseInt(*e.str); err != nil {
+			return nil, err
+		}
+	}
+	cur += by
+	v := strconv.FormatInt(cur, 10)
+	if e != nil {
+		e.str = &v
+		return cur, nil
+	}
+	c.setString(key, v)
+	return cur, nil
+}
@@ -0,0 +1,328 @@
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/illidaris/aphrodite/pkg/dependency"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/spf13/cast"
+)
+
+var _ = dependency.IMQProducerRepository[po.MqMessage](&MQProducerRepository{})
+
+var (
+	ErrDuplicate         = errors.New("testkit: record is exist")
+	ErrCondsNotSupported = errors.New("testkit: conds is not supported")
+)
+
+/*
+MQProducerRepository in memory dependency.IMQProducerRepository of po.MqMessage,
+behaves like gormex.TaskQueueRepository with the time of the fake clock.
+
+Conds of BaseOption is not supported, query by page over all messages order by id instead.
+*/
+type MQProducerRepository struct {
+	mu    sync.Mutex
+	clock *FakeClock
+	seq   uint64
+	rows  map[uint64]po.MqMessage
+}
+
+func NewMQProducerRepository(clock *FakeClock) *MQProducerRepository {
+	return &MQProducerRepository{
+		clock: orNewClock(clock),
+		rows:  map[uint64]po.MqMessage{},
+	}
+}
+
+// Clock clock of the repository
+func (r *MQProducerRepository) Clock() *FakeClock {
+	return r.clock
+}
+
+// All snapshot of all messages order by id
+func (r *MQProducerRepository) All() []po.MqMessage {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sorted()
+}
+
+func (r *MQProducerRepository) sorted() []po.MqMessage {
+	res := make([]po.MqMessage, 0, len(r.rows))
+	for _, v := range r.rows {
+		res = append(res, v)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].CreateAt != res[j].CreateAt {
+			return res[i].CreateAt < res[j].CreateAt
+		}
+		return res[i].Id < res[j].Id
+	})
+	return res
+}
+
+func (r *MQProducerRepository) write(ctx context.Context, ps []*po.MqMessage, opt *dependency.BaseOption, save bool) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var affect int64
+	for _, p := range ps {
+		if p == nil {
+			continue
+		}
+		if p.Id == 0 && opt.IDGenerate != nil {
+			p.Id = cast.ToUint64(opt.IDGenerate(ctx))
+		}
+		if p.Id == 0 {
+			r.seq++
+			p.Id = r.seq
+		}
+		if p.Id > r.seq {
+			r.seq = p.Id
+		}
+		if _, ok := r.rows[p.Id]; ok && !save {
+			if opt.Ignore {
+				continue
+			}
+			return affect, ErrDuplicate
+		}
+		now := r.clock.Now().Unix()
+		if p.CreateAt == 0 {
+			p.CreateAt = now
+		}
+		p.UpdateAt = now
+		r.rows[p.Id] = *p
+		affect++
+	}
+	return affect, nil
+}
+
+func (r *MQProducerRepository) BaseCreate(ctx context.Context, ps []*po.MqMessage, opts ...dependency.BaseOptionFunc) (int64, error) {
+	return r.write(ctx, ps, dependency.NewBaseOption(opts...), false)
+}
+
+func (r *MQProducerRepository) BaseSave(ctx context.Context, ps []*po.MqMessage, opts ...dependency.BaseOptionFunc) (int64, error) {
+	return r.write(ctx, ps, dependency.NewBaseOption(opts...), true)
+}
+
+// BaseUpdate 与gorm的Updates一致，仅更新非零值字段
+func (r *MQProducerRepository) BaseUpdate(ctx context.Context, p *po.MqMessage, opts ...dependency.BaseOptionFunc) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	old, ok := r.rows[p.Id]
+	if !ok {
+		return 0, nil
+	}
+	if err := overlayNonZero(&old, p); err != nil {
+		return 0, err
+	}
+	old.UpdateAt = r.clock.Now().Unix()
+	r.rows[p.Id] = old
+	return 1, nil
+}
+
+func (r *MQProducerRepository) BaseGet(ctx context.Context, opts ...dependency.BaseOptionFunc) (*po.MqMessage, error) {
+	ts, err := r.BaseQuery(ctx, opts...)
+	if err != nil || len(ts) == 0 {
+		return nil, err
+	}
+	return &ts[0], nil
+}
+
+func (r *MQProducerRepository) BaseDelete(ctx context.Context, p *po.MqMessage, opts ...dependency.BaseOptionFunc) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.rows[p.Id]; !ok {
+		return 0, nil
+	}
+	delete(r.rows, p.Id)
+	return 1, nil
+}
+
+func (r *MQProducerRepository) BaseCount(ctx context.Context, opts ...dependency.BaseOptionFunc) (int64, error) {
+	if len(dependency.NewBaseOption(opts...).Conds) > 0 {
+		return 0, ErrCondsNotSupported
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return int64(len(r.rows)), nil
+}
+
+func (r *MQProducerRepository) BaseQuery(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]po.MqMessage, error) {
+	opt := dependency.NewBaseOption(opts...)
+	if len(opt.Conds) > 0 {
+		return nil, ErrCondsNotSupported
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all := r.sorted()
+	if opt.Page == nil {
+		return all, nil
+	}
+	var (
+		size  = opt.Page.GetPageSize()
+		begin = (opt.Page.GetPageIndex() - 1) * size
+	)
+	if begin < 0 || begin >= int64(len(all)) {
+		return []po.MqMessage{}, nil
+	}
+	end := begin + size
+	if size <= 0 || end > int64(len(all)) {
+		end = int64(len(all))
+	}
+	return all[begin:end], nil
+}
+
+func (r *MQProducerRepository) BaseQueryWithCount(ctx context.Context, opts ...dependency.BaseOptionFunc) ([]po.MqMessage, int64, error) {
+	count, err := r.BaseCount(ctx, opts...)
+	if err != nil {
+		return nil, count, err
+	}
+	ts, err := r.BaseQuery(ctx, opts...)
+	return ts, count, err
+}
+
+func (r *MQProducerRepository) InsertAction(ctx context.Context, db string, t *po.MqMessage) func(context.Context) error {
+	return func(subCtx context.Context) error {
+		_, err := r.BaseCreate(subCtx, []*po.MqMessage{t}, dependency.WithDataBase(db))
+		return err
+	}
+}
+
+// WaitExecWithLock 锁定到期的记录，记录里设定了超时时间则采用该超时时间
+func (r *MQProducerRepository) WaitExecWithLock(ctx context.Context, t po.MqMessage, batch int) (string, int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		locker = uuid.NewString()
+		now    = r.clock.Now().Unix()
+		affect int64
+	)
+	for _, v := range r.sorted() {
+		if int(affect) >= batch {
+			break
+		}
+		if !r.due(v, t, now) {
+			continue
+		}
+		timeout := v.Timeout
+		if timeout <= 0 {
+			timeout = int64(t.GetTimeout().Seconds())
+		}
+		v.Expire = now + timeout
+		v.Retries++
+		v.Locker = locker
+		v.UpdateAt = now
+		r.rows[v.Id] = v
+		affect++
+	}
+	return locker, affect, nil
+}
+
+func (r *MQProducerRepository) due(v, t po.MqMessage, now int64) bool {
+	return v.Expire < now && v.BizId == t.BizId && v.Category == t.Category && v.Name == t.Name
+}
+
+func (r *MQProducerRepository) FindLockeds(ctx context.Context, locker string) ([]po.MqMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := []po.MqMessage{}
+	for _, v := range r.sorted() {
+		if v.Locker == locker {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// ReportExecResult 汇报执行结果，成功则删除，失败则记录原因
+func (r *MQProducerRepository) ReportExecResult(ctx context.Context, id int64, locker string, execResult string, execErr error) (int64, error) {
+	if locker == "" {
+		return 0, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.rows[uint64(id)]
+	if !ok || v.Locker != locker {
+		return 0, nil
+	}
+	if execErr == nil {
+		delete(r.rows, v.Id)
+		return 1, nil
+	}
+	v.LastError = execErr.Error()
+	if len(v.LastError) > 255 {
+		v.LastError = v.LastError[:255]
+	}
+	v.LastExecAt = r.clock.Now().Unix()
+	r.rows[v.Id] = v
+	return 1, nil
+}
+
+// RenewLease 续租，仅锁定者可以续租
+func (r *MQProducerRepository) RenewLease(ctx context.Context, id int64, locker string, lease time.Duration) (int64, error) {
+	if locker == "" {
+		return 0, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.rows[uint64(id)]
+	if !ok || v.Locker != locker {
+		return 0, nil
+	}
+	v.Expire = r.clock.Now().Unix() + int64(lease.Seconds())
+	r.rows[v.Id] = v
+	return 1, nil
+}
+
+// CountDue 到期待执行的数量
+func (r *MQProducerRepository) CountDue(ctx context.Context, t po.MqMessage) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		now   = r.clock.Now().Unix()
+		count int64
+	)
+	for _, v := range r.rows {
+		if r.due(v, t, now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// overlayNonZero 将src的非零值字段覆盖到dst
+func overlayNonZero(dst, src any) error {
+	bs, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	fields := map[string]any{}
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.UseNumber()
+	if err := decoder.Decode(&fields); err != nil {
+		return err
+	}
+	for k, v := range fields {
+		if n, ok := v.(json.Number); ok {
+			if f, _ := n.Float64(); f == 0 {
+				delete(fields, k)
+			}
+			continue
+		}
+		if v == nil || reflect.ValueOf(v).IsZero() {
+			delete(fields, k)
+		}
+	}
+	if bs, err = json.Marshal(fields); err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, dst)
+}
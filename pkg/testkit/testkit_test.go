@@ -0,0 +1,196 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/illidaris/aphrodite/cache"
+	"github.com/illidaris/aphrodite/idgenerate/idsegment"
+	"github.com/illidaris/aphrodite/pkg/dependency/dependencytest"
+	"github.com/illidaris/aphrodite/po"
+	"github.com/redis/go-redis/v9"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+var _ = idsegment.ICache(ContextLuaCache{})
+
+func TestCache(t *testing.T) {
+	convey.Convey("TestCache", t, func() {
+		c := NewCache(nil)
+		convey.So(c.Set("k", "v", time.Minute), convey.ShouldBeNil)
+		convey.So(c.Get("k"), convey.ShouldEqual, "v")
+		convey.So(c.TTL("k"), convey.ShouldEqual, time.Minute)
+		ok, err := c.SetNX("k", "v2", time.Minute)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(ok, convey.ShouldBeFalse)
+
+		c.Clock().Advance(30 * time.Second)
+		convey.So(c.TTL("k"), convey.ShouldEqual, 30*time.Second)
+		c.Clock().Advance(30 * time.Second)
+		convey.So(c.IsExist("k"), convey.ShouldBeFalse)
+		convey.So(c.Get("k"), convey.ShouldBeNil)
+		ok, _ = c.SetNX("k", "v2", 0)
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(c.TTL("k"), convey.ShouldEqual, 0)
+		convey.So(c.Delete("k"), convey.ShouldBeNil)
+		convey.So(c.IsExist("k"), convey.ShouldBeFalse)
+	})
+}
+
+func TestLuaCacheCommands(t *testing.T) {
+	convey.Convey("TestLuaCacheCommands", t, func() {
+		ctx := context.Background()
+		c := NewLuaCache(NewFakeClock(time.Unix(1700000000, 0)))
+
+		res, err := c.Do(ctx, "SET", "k", 1, "EX", 10)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(res, convey.ShouldEqual, "OK")
+		res, _ = c.Do(ctx, "TTL", "k")
+		convey.So(res, convey.ShouldEqual, 10)
+		_, err = c.Do(ctx, "HGET", "k", "f")
+		convey.So(err, convey.ShouldEqual, ErrWrongType)
+
+		res, err = c.Eval(`return redis.call('INCRBY', KEYS[1], ARGV[1])`, []string{"k"}, 2)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(res, convey.ShouldEqual, 3)
+		res, _ = c.Eval(`return redis.call('TIME')`, nil)
+		convey.So(res, convey.ShouldResemble, []any{"1700000000", "0"})
+		res, _ = c.Eval(`return redis.call('SET', KEYS[1], 'v')`, []string{"s"})
+		convey.So(res, convey.ShouldEqual, "OK")
+		res, _ = c.Eval(`local r = redis.pcall('INCR', KEYS[1]) return r['err']`, []string{"s"})
+		convey.So(res, convey.ShouldEqual, ErrNotInteger.Error())
+		_, err = c.Eval(`return redis.call('INCR', KEYS[1])`, []string{"s"})
+		convey.So(err, convey.ShouldNotBeNil)
+		_, err = c.Eval(`return redis.error_reply('boom')`, nil)
+		convey.So(err.Error(), convey.ShouldEqual, "boom")
+		_, err = c.Eval(`return redis.call('GET', 'missing')`, nil)
+		convey.So(err, convey.ShouldEqual, redis.Nil)
+
+		res, _ = c.Eval(`redis.call('HSET', KEYS[1], 'a', 1, 'b', 2) return redis.call('HGETALL', KEYS[1])`, []string{"h"})
+		convey.So(res, convey.ShouldResemble, []any{"a", "1", "b", "2"})
+
+		c.Clock().Advance(10 * time.Second)
+		_, err = c.Get("k")
+		convey.So(err, convey.ShouldEqual, redis.Nil)
+		affect, _ := c.Delete("s")
+		convey.So(affect, convey.ShouldEqual, 1)
+	})
+}
+
+func TestLuaCacheLimitIncr(t *testing.T) {
+	convey.Convey("TestLuaCacheLimitIncr", t, func() {
+		ctx := context.Background()
+		c := NewLuaCache(nil)
+		opts := []cache.LimitOption{
+			cache.WithLimitCache(c),
+			cache.WithLimitMax(2),
+			cache.WithLimitDur(10 * time.Second),
+		}
+		v, err := cache.LimitIncr(ctx, 1, "user", opts...)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, 1)
+		v, _ = cache.LimitIncr(ctx, 1, "user", opts...)
+		convey.So(v, convey.ShouldEqual, 2)
+		v, err = cache.LimitIncr(ctx, 1, "user", opts...)
+		convey.So(err, convey.ShouldEqual, cache.ErrLimit)
+		convey.So(v, convey.ShouldEqual, -1)
+		cursor, _ := cache.LimitGetCursor(ctx, 1, "user", opts...)
+		convey.So(cursor, convey.ShouldEqual, 2)
+
+		c.Clock().Advance(10 * time.Second)
+		v, err = cache.LimitIncr(ctx, 1, "user", opts...)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, 1)
+		affect, _ := cache.LimitClearIncr(ctx, 1, "user", opts...)
+		convey.So(affect, convey.ShouldEqual, 1)
+	})
+}
+
+// segmentRepo in memory idsegment.IRepository
+type segmentRepo struct {
+	mu  sync.Mutex
+	max map[string]int64
+}
+
+func (r *segmentRepo) BlockNextSegment(ctx context.Context, key string, step int64, tryGenerate func() (*idsegment.Segment, error)) (int64, int64, *idsegment.Segment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if tryGenerate != nil {
+		if seg, err := tryGenerate(); err == nil && seg.Code == idsegment.StatusCodeNil {
+			return 0, 0, seg, nil
+		}
+	}
+	b := r.max[key]
+	r.max[key] = b + step
+	return b, b + step, nil, nil
+}
+
+func TestLuaCacheIdSegment(t *testing.T) {
+	convey.Convey("TestLuaCacheIdSegment", t, func() {
+		ctx := context.Background()
+		c := NewLuaCache(nil)
+		gen := idsegment.IdSegment{
+			Batch: 3,
+			Cache: c.Context(),
+			Repo:  &segmentRepo{max: map[string]int64{}},
+		}
+		ids := []int64{}
+		for i := 0; i < 7; i++ {
+			id, err := gen.NewID(ctx, "order")
+			convey.So(err, convey.ShouldBeNil)
+			ids = append(ids, id)
+		}
+		convey.So(ids, convey.ShouldResemble, []int64{1, 2, 3, 4, 5, 6, 7})
+		res, _ := c.Do(ctx, "HGET", "order", "max")
+		convey.So(res, convey.ShouldEqual, "9")
+	})
+}
+
+func TestMQProducerRepositoryContract(t *testing.T) {
+	dependencytest.MQProducerRepositorySuite(t, NewMQProducerRepository(nil))
+}
+
+func TestMQProducerRepository(t *testing.T) {
+	convey.Convey("TestMQProducerRepository", t, func() {
+		ctx := context.Background()
+		repo := NewMQProducerRepository(nil)
+		clock := repo.Clock()
+		m := po.NewMqMessage(ctx, 1, "", 1, "topic", "k", nil, 0)
+		m.Expire = clock.Now().Unix() - 1
+		m.Timeout = 10
+		convey.So(repo.InsertAction(ctx, "", m)(ctx), convey.ShouldBeNil)
+		_, err := repo.BaseCreate(ctx, []*po.MqMessage{m})
+		convey.So(err, convey.ShouldEqual, ErrDuplicate)
+		template := po.MqMessage{}
+		template.BizId, template.Category, template.Name = 1, 1, "topic"
+
+		due, _ := repo.CountDue(ctx, template)
+		convey.So(due, convey.ShouldEqual, 1)
+		locker, affect, err := repo.WaitExecWithLock(ctx, template, 10)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(affect, convey.ShouldEqual, 1)
+
+		affect, _ = repo.RenewLease(ctx, int64(m.Id), locker, time.Minute)
+		convey.So(affect, convey.ShouldEqual, 1)
+		clock.Advance(30 * time.Second)
+		_, affect, _ = repo.WaitExecWithLock(ctx, template, 10)
+		convey.So(affect, convey.ShouldEqual, 0)
+
+		affect, _ = repo.ReportExecResult(ctx, int64(m.Id), locker, "", errors.New("failed"))
+		convey.So(affect, convey.ShouldEqual, 1)
+		convey.So(repo.All()[0].LastError, convey.ShouldEqual, "failed")
+
+		clock.Advance(31 * time.Second)
+		locker2, affect, _ := repo.WaitExecWithLock(ctx, template, 10)
+		convey.So(affect, convey.ShouldEqual, 1)
+		affect, _ = repo.ReportExecResult(ctx, int64(m.Id), locker, "", nil)
+		convey.So(affect, convey.ShouldEqual, 0)
+		affect, _ = repo.ReportExecResult(ctx, int64(m.Id), locker2, "ok", nil)
+		convey.So(affect, convey.ShouldEqual, 1)
+		count, _ := repo.BaseCount(ctx)
+		convey.So(count, convey.ShouldEqual, 0)
+	})
+}
@@ -0,0 +1,66 @@
+package po
+
+import (
+	"encoding/json"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+)
+
+var _ = dependency.IPo(&AuthzPolicy{})
+
+// AuthzPolicy 访问控制策略
+type AuthzPolicy struct {
+	dependency.EmptyPo
+	IDAutoSection `gorm:"embedded"`
+	Subject       string `json:"subject" gorm:"column:subject;type:varchar(128);index;comment:主体，用户ID、角色或*"`    // 主体
+	Resource      string `json:"resource" gorm:"column:resource;type:varchar(255);comment:资源，支持通配"`             // 资源
+	Action        string `json:"action" gorm:"column:action;type:varchar(64);comment:操作，支持通配"`                  // 操作
+	Effect        string `json:"effect" gorm:"column:effect;type:varchar(16);default:allow;comment:allow或deny"` // 效果
+	Conditions    string `json:"conditions" gorm:"column:conditions;type:varchar(255);comment:属性条件，逗号分隔"`       // 条件
+	Disable       bool   `json:"disable" gorm:"column:disable;default:false;comment:禁用"`                        // 禁用
+	CreateAt      int64  `json:"createAt" gorm:"column:createAt;<-:create;autoCreateTime;comment:创建时间"`         // 创建时间
+	UpdateAt      int64  `json:"updateAt" gorm:"column:updateAt;autoUpdateTime;comment:修改时间"`                   // 修改时间
+}
+
+func (s AuthzPolicy) TableName() string {
+	return "aphrodite_authz_policy"
+}
+
+func (s AuthzPolicy) ID() any {
+	return s.Id
+}
+
+func (p AuthzPolicy) ToJson() string {
+	bs, err := json.Marshal(&p)
+	if err != nil {
+		return ""
+	}
+	return string(bs)
+}
+
+var _ = dependency.IPo(&AuthzRole{})
+
+// AuthzRole 角色继承，Role继承Parent的全部权限
+type AuthzRole struct {
+	dependency.EmptyPo
+	IDAutoSection `gorm:"embedded"`
+	Role          string `json:"role" gorm:"column:role;type:varchar(128);uniqueIndex:role_parent;comment:角色"`      // 角色
+	Parent        string `json:"parent" gorm:"column:parent;type:varchar(128);uniqueIndex:role_parent;comment:父角色"` // 父角色
+	CreateAt      int64  `json:"createAt" gorm:"column:createAt;<-:create;autoCreateTime;comment:创建时间"`             // 创建时间
+}
+
+func (s AuthzRole) TableName() string {
+	return "aphrodite_authz_role"
+}
+
+func (s AuthzRole) ID() any {
+	return s.Id
+}
+
+func (p AuthzRole) ToJson() string {
+	bs, err := json.Marshal(&p)
+	if err != nil {
+		return ""
+	}
+	return string(bs)
+}
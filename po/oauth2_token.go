@@ -0,0 +1,36 @@
+package po
+
+import (
+	"encoding/json"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+)
+
+var _ = dependency.IPo(&OAuth2Token{})
+
+// OAuth2Token 第三方授权令牌，Token为加密后的密文
+type OAuth2Token struct {
+	dependency.EmptyPo
+	IDAutoSection `gorm:"embedded"`
+	Key           string `json:"key" gorm:"column:key;type:varchar(255);uniqueIndex;comment:令牌Key"`     // 令牌Key，包含提供方、业务与用户
+	Token         string `json:"-" gorm:"column:token;type:text;comment:令牌密文"`                          // 令牌密文
+	Expire        int64  `json:"expire" gorm:"column:expire;type:bigint;default:0;index;comment:过期时间"`  // 过期时间，0表示不过期
+	CreateAt      int64  `json:"createAt" gorm:"column:createAt;<-:create;autoCreateTime;comment:创建时间"` // 创建时间
+	UpdateAt      int64  `json:"updateAt" gorm:"column:updateAt;autoUpdateTime;comment:修改时间"`           // 修改时间
+}
+
+func (s OAuth2Token) TableName() string {
+	return "aphrodite_oauth2_token"
+}
+
+func (s OAuth2Token) ID() any {
+	return s.Id
+}
+
+func (p OAuth2Token) ToJson() string {
+	bs, err := json.Marshal(&p)
+	if err != nil {
+		return ""
+	}
+	return string(bs)
+}
@@ -0,0 +1,65 @@
+package po
+
+import (
+	"encoding/json"
+
+	"github.com/illidaris/aphrodite/pkg/dependency"
+)
+
+var _ = dependency.IPo(&SagaInstance{})
+
+const (
+	SAGA_STATUS_RUNNING      int32 = iota + 1 // 正向执行中
+	SAGA_STATUS_WAITING                       // 等待异步步骤结果
+	SAGA_STATUS_COMPENSATING                  // 补偿中
+	SAGA_STATUS_DONE                          // 全部步骤完成
+	SAGA_STATUS_COMPENSATED                   // 补偿完成
+	SAGA_STATUS_FAILED                        // 补偿失败次数超限，需人工介入
+)
+
+// SagaInstance 分布式事务实例，Step为正向时下一个待执行的步骤，补偿时为下一个待补偿的步骤
+type SagaInstance struct {
+	dependency.EmptyPo
+	IDAutoSection `gorm:"embedded"`
+	RawBizSection `gorm:"embedded"`
+	Db            string `json:"db" gorm:"column:db;type:varchar(36);comment:db"`                          // db
+	Name          string `json:"name" gorm:"column:name;type:varchar(64);uniqueIndex:saga;comment:事务名称"`   // 事务名称
+	Key           string `json:"key" gorm:"column:key;type:varchar(64);uniqueIndex:saga;comment:业务Key"`    // 业务Key
+	Args          string `json:"args" gorm:"column:args;type:text;comment:参数"`                             // 参数
+	Status        int32  `json:"status" gorm:"column:status;type:int;default:0;index;comment:状态"`          // 状态
+	Step          int32  `json:"step" gorm:"column:step;type:int;default:0;comment:当前步骤"`                  // 当前步骤
+	TraceId       string `json:"traceId"  gorm:"column:traceId;type:varchar(36);default:0;comment:追踪链路ID"` // 关联traceId
+	LockSection   `gorm:"embedded"`
+	CreateAt      int64 `json:"createAt" gorm:"column:createAt;<-:create;index;autoCreateTime;comment:创建时间"` // 创建时间
+	UpdateAt      int64 `json:"updateAt" gorm:"column:updateAt;index;autoUpdateTime;comment:修改时间"`           // 修改时间
+}
+
+// TenantColumn 框架内部表按BizId跨租户调度，不做隔离
+func (s SagaInstance) TenantColumn() string {
+	return ""
+}
+
+func (s SagaInstance) TableName() string {
+	return "aphrodite_saga"
+}
+
+func (p SagaInstance) Database() string {
+	return p.Db
+}
+
+func (s SagaInstance) ID() any {
+	return s.Id
+}
+
+// IsFinished 是否已结束
+func (s SagaInstance) IsFinished() bool {
+	return s.Status == SAGA_STATUS_DONE || s.Status == SAGA_STATUS_COMPENSATED || s.Status == SAGA_STATUS_FAILED
+}
+
+func (p SagaInstance) ToJson() string {
+	bs, err := json.Marshal(&p)
+	if err != nil {
+		return ""
+	}
+	return string(bs)
+}
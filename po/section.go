@@ -1,6 +1,6 @@
 package po
 
-import "github.com/spf13/cast"
+import "github.com/illidaris/aphrodite/pkg/dependency"
 
 // IDAutoSection
 type IDAutoSection struct {
@@ -13,23 +13,37 @@ func (p IDAutoSection) ID() any {
 
 // RawBizSection
 type RawBizSection struct {
-	BizId uint64 `json:"bizId" gorm:"column:bizId;type:bigint;index:biz;comment:业务ID"` // biz id
+	BizId uint64 `json:"bizId" bson:"bizId" gorm:"column:bizId;type:bigint;index:biz;comment:业务ID"` // biz id
 }
 
 func (s RawBizSection) Database() string {
 	return ""
 }
 
+// TenantColumn 多租户隔离字段
+func (s RawBizSection) TenantColumn() string {
+	return "bizId"
+}
+
+func (s RawBizSection) GetTenant() int64 {
+	return int64(s.BizId)
+}
+
+func (s *RawBizSection) SetTenant(bizId int64) {
+	s.BizId = uint64(bizId)
+}
+
 // BizSection
 type BizSection struct {
-	RawBizSection
+	RawBizSection `bson:",inline"`
 }
 
+// DbSharding 按租户分库，映射见dependency.SetTenantDatabase
 func (s BizSection) DbSharding(keys ...any) string {
 	if len(keys) == 0 {
-		return cast.ToString(s.BizId)
+		return dependency.TenantDatabase(s.BizId)
 	}
-	return cast.ToString(keys[0])
+	return dependency.TenantDatabase(keys[0])
 }
 
 // OperationSection
@@ -26,6 +26,11 @@ type TaskQueueMessage struct {
 	UpdateAt      int64 `json:"updateAt" gorm:"column:updateAt;index;autoUpdateTime;comment:修改时间"`           // 修改时间
 }
 
+// TenantColumn 框架内部表按BizId跨租户调度，不做隔离
+func (s TaskQueueMessage) TenantColumn() string {
+	return ""
+}
+
 func (s TaskQueueMessage) TableName() string {
 	return "task_queue_message"
 }